@@ -0,0 +1,94 @@
+package releasefmt
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DaysUntil counts calendar days from now, in the release country's time
+// zone, to the release day. It is negative once the release has passed.
+func DaysUntil(r Release, now time.Time) int {
+	loc := CountryLocation(r.Country)
+	y, m, d := now.In(loc).Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	// Both days are UTC midnights, so the difference is whole days even
+	// across daylight saving changes.
+	return int(r.Day(time.UTC).Sub(today).Hours() / 24)
+}
+
+// relativeLocale words countdowns in one language.
+type relativeLocale struct {
+	today, tomorrow, yesterday string
+	// future and past get the number of days and its plural form.
+	future, past func(n int, days string) string
+	days         func(n int) string
+}
+
+func plural(one, other string) func(int) string {
+	return func(n int) string {
+		if n == 1 {
+			return one
+		}
+		return other
+	}
+}
+
+func around(prefix, suffix string) func(int, string) string {
+	return func(n int, days string) string {
+		return strings.TrimSpace(fmt.Sprintf("%s %d %s %s", prefix, n, days, suffix))
+	}
+}
+
+var relativeLocales = map[string]relativeLocale{
+	"en": {"today", "tomorrow", "yesterday", around("in", ""), around("", "ago"), plural("day", "days")},
+	"de": {"heute", "morgen", "gestern", around("in", ""), around("vor", ""), func(n int) string {
+		// "in 3 Tagen", "vor 3 Tagen": both take the dative plural.
+		if n == 1 {
+			return "Tag"
+		}
+		return "Tagen"
+	}},
+	"fr": {"aujourd’hui", "demain", "hier", around("dans", ""), around("il y a", ""), plural("jour", "jours")},
+	"es": {"hoy", "mañana", "ayer", around("dentro de", ""), around("hace", ""), plural("día", "días")},
+	"pt": {"hoje", "amanhã", "ontem", around("em", ""), around("há", ""), plural("dia", "dias")},
+	"it": {"oggi", "domani", "ieri", around("tra", ""), around("", "fa"), plural("giorno", "giorni")},
+	"nl": {"vandaag", "morgen", "gisteren", around("over", ""), around("", "geleden"), plural("dag", "dagen")},
+	"ru": {"сегодня", "завтра", "вчера", around("через", ""), around("", "назад"), russianDays},
+	"ja": {"今日", "明日", "昨日", func(n int, _ string) string { return fmt.Sprintf("%d日後", n) }, func(n int, _ string) string { return fmt.Sprintf("%d日前", n) }, plural("", "")},
+	"zh": {"今天", "明天", "昨天", func(n int, _ string) string { return fmt.Sprintf("%d天后", n) }, func(n int, _ string) string { return fmt.Sprintf("%d天前", n) }, plural("", "")},
+	"ko": {"오늘", "내일", "어제", func(n int, _ string) string { return fmt.Sprintf("%d일 후", n) }, func(n int, _ string) string { return fmt.Sprintf("%d일 전", n) }, plural("", "")},
+}
+
+func russianDays(n int) string {
+	switch {
+	case n%10 == 1 && n%100 != 11:
+		return "день"
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return "дня"
+	default:
+		return "дней"
+	}
+}
+
+// Countdown words the distance to the release in locale, e.g. "in 3 days",
+// "tomorrow" or "2 days ago".
+func Countdown(r Release, now time.Time, locale string) string {
+	lang, _, _ := strings.Cut(strings.ReplaceAll(locale, "_", "-"), "-")
+	l, ok := relativeLocales[strings.ToLower(lang)]
+	if !ok {
+		l = relativeLocales["en"]
+	}
+	switch n := DaysUntil(r, now); {
+	case n == 0:
+		return l.today
+	case n == 1:
+		return l.tomorrow
+	case n == -1:
+		return l.yesterday
+	case n > 0:
+		return l.future(n, l.days(n))
+	default:
+		return l.past(-n, l.days(-n))
+	}
+}
@@ -0,0 +1,59 @@
+package releasefmt
+
+import (
+	"strings"
+	"time"
+	_ "time/tzdata"
+)
+
+// countryZones names the time zone most of a country's cinemas are in.
+// Countries spanning several zones use the most populous one.
+var countryZones = map[string]string{
+	"US": "America/New_York", "CA": "America/Toronto", "MX": "America/Mexico_City",
+	"BR": "America/Sao_Paulo", "AR": "America/Argentina/Buenos_Aires", "CL": "America/Santiago",
+	"CO": "America/Bogota", "PE": "America/Lima",
+	"GB": "Europe/London", "IE": "Europe/Dublin", "FR": "Europe/Paris", "DE": "Europe/Berlin",
+	"AT": "Europe/Vienna", "CH": "Europe/Zurich", "NL": "Europe/Amsterdam", "BE": "Europe/Brussels",
+	"ES": "Europe/Madrid", "PT": "Europe/Lisbon", "IT": "Europe/Rome", "DK": "Europe/Copenhagen",
+	"SE": "Europe/Stockholm", "NO": "Europe/Oslo", "FI": "Europe/Helsinki", "PL": "Europe/Warsaw",
+	"CZ": "Europe/Prague", "HU": "Europe/Budapest", "GR": "Europe/Athens", "TR": "Europe/Istanbul",
+	"RU": "Europe/Moscow", "UA": "Europe/Kyiv",
+	"IN": "Asia/Kolkata", "CN": "Asia/Shanghai", "HK": "Asia/Hong_Kong", "TW": "Asia/Taipei",
+	"JP": "Asia/Tokyo", "KR": "Asia/Seoul", "SG": "Asia/Singapore", "TH": "Asia/Bangkok",
+	"ID": "Asia/Jakarta", "PH": "Asia/Manila", "AE": "Asia/Dubai", "IL": "Asia/Jerusalem",
+	"AU": "Australia/Sydney", "NZ": "Pacific/Auckland", "ZA": "Africa/Johannesburg", "EG": "Africa/Cairo",
+	"NG": "Africa/Lagos",
+}
+
+// countryLocales names the locale releases in a country are usually read
+// in. Unlisted countries read English.
+var countryLocales = map[string]string{
+	"US": "en-US", "CA": "en-CA", "GB": "en-GB", "IE": "en-IE", "AU": "en-AU", "NZ": "en-NZ",
+	"PH": "en-PH", "IN": "en-IN", "SG": "en-SG", "ZA": "en-ZA",
+	"DE": "de", "AT": "de-AT", "CH": "de-CH", "FR": "fr", "BE": "fr-BE", "ES": "es", "MX": "es-MX",
+	"AR": "es-AR", "CL": "es-CL", "CO": "es-CO", "PE": "es-PE", "PT": "pt-PT", "BR": "pt-BR",
+	"IT": "it", "NL": "nl", "RU": "ru", "JP": "ja", "KR": "ko", "CN": "zh-CN", "TW": "zh-TW", "HK": "zh-HK",
+}
+
+// CountryLocation returns the time zone of an ISO 3166-1 country, or UTC
+// if it is unknown or the zone database lacks it.
+func CountryLocation(country string) *time.Location {
+	name, ok := countryZones[strings.ToUpper(country)]
+	if !ok {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// CountryLocale returns the BCP 47 locale releases in country are usually
+// read in.
+func CountryLocale(country string) string {
+	if l, ok := countryLocales[strings.ToUpper(country)]; ok {
+		return l
+	}
+	return "en"
+}
@@ -0,0 +1,122 @@
+// Package releasefmt renders stored release rows for people: as a date in
+// the reader's locale and as a countdown relative to now in the release
+// country's time zone. The cron, the website and notification senders use
+// it so a release never shows up a day early or late in one of them.
+//
+// TMDB stores a release as midnight UTC of the local release day, so the
+// day is read in UTC and never converted between time zones.
+package releasefmt
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Release is a row of MLocalRelease joined with its country.
+type Release struct {
+	Country string
+	Date    time.Time
+	Type    uint8
+	Note    string
+}
+
+// Day returns the calendar day of the release as midnight in loc.
+func (r Release) Day(loc *time.Location) time.Time {
+	y, m, d := r.Date.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, loc)
+}
+
+// dateLocale spells out dates of one language.
+type dateLocale struct {
+	months [12]string
+	// format builds the date from day, month name and year.
+	format func(day int, month string, year int) string
+}
+
+func dmy(sep string) func(int, string, int) string {
+	return func(day int, month string, year int) string {
+		return fmt.Sprintf("%d%s %s %d", day, sep, month, year)
+	}
+}
+
+func cjk(yearMark, monthMark, dayMark string) func(int, string, int) string {
+	return func(day int, month string, year int) string {
+		return fmt.Sprintf("%d%s%s%s%d%s", year, yearMark, month, monthMark, day, dayMark)
+	}
+}
+
+var numericMonths = [12]string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12"}
+
+var dateLocales = map[string]dateLocale{
+	"en": {
+		months: [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+		format: dmy(""),
+	},
+	"en-US": {
+		months: [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+		format: func(day int, month string, year int) string { return fmt.Sprintf("%s %d, %d", month, day, year) },
+	},
+	"de": {
+		months: [12]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"},
+		format: dmy("."),
+	},
+	"fr": {
+		months: [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		format: dmy(""),
+	},
+	"es": {
+		months: [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		format: func(day int, month string, year int) string { return fmt.Sprintf("%d de %s de %d", day, month, year) },
+	},
+	"pt": {
+		months: [12]string{"janeiro", "fevereiro", "março", "abril", "maio", "junho", "julho", "agosto", "setembro", "outubro", "novembro", "dezembro"},
+		format: func(day int, month string, year int) string { return fmt.Sprintf("%d de %s de %d", day, month, year) },
+	},
+	"it": {
+		months: [12]string{"gennaio", "febbraio", "marzo", "aprile", "maggio", "giugno", "luglio", "agosto", "settembre", "ottobre", "novembre", "dicembre"},
+		format: dmy(""),
+	},
+	"nl": {
+		months: [12]string{"januari", "februari", "maart", "april", "mei", "juni", "juli", "augustus", "september", "oktober", "november", "december"},
+		format: dmy(""),
+	},
+	"ru": {
+		months: [12]string{"января", "февраля", "марта", "апреля", "мая", "июня", "июля", "августа", "сентября", "октября", "ноября", "декабря"},
+		format: func(day int, month string, year int) string { return fmt.Sprintf("%d %s %d г.", day, month, year) },
+	},
+	"ja": {months: numericMonths, format: cjk("年", "月", "日")},
+	"zh": {months: numericMonths, format: cjk("年", "月", "日")},
+	"ko": {months: numericMonths, format: func(day int, month string, year int) string {
+		return fmt.Sprintf("%d년 %s월 %d일", year, month, day)
+	}},
+}
+
+// The English of these regions puts the month first.
+var monthFirstRegions = map[string]bool{"US": true, "PH": true}
+
+// Format spells out day in locale, a BCP 47 tag such as "de" or "en-GB".
+// Unknown languages fall back to English.
+func Format(day time.Time, locale string) string {
+	l := lookupDateLocale(locale)
+	y, m, d := day.Date()
+	return l.format(d, l.months[m-1], y)
+}
+
+func lookupDateLocale(locale string) dateLocale {
+	lang, region, _ := strings.Cut(strings.ReplaceAll(locale, "_", "-"), "-")
+	lang = strings.ToLower(lang)
+	if lang == "en" && (region == "" || monthFirstRegions[strings.ToUpper(region)]) {
+		return dateLocales["en-US"]
+	}
+	if l, ok := dateLocales[lang]; ok {
+		return l
+	}
+	return dateLocales["en-US"]
+}
+
+// FormatRelease formats the release day in the locale usually read in its
+// country.
+func FormatRelease(r Release) string {
+	return Format(r.Day(time.UTC), CountryLocale(r.Country))
+}
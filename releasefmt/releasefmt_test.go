@@ -0,0 +1,138 @@
+package releasefmt
+
+import (
+	"testing"
+	"time"
+)
+
+func utc(year int, month time.Month, day, hour, min int) time.Time {
+	return time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+}
+
+func release(country string, year int, month time.Month, day int) Release {
+	return Release{Country: country, Date: utc(year, month, day, 0, 0)}
+}
+
+func TestCountryLocation(t *testing.T) {
+	tests := []struct {
+		country string
+		want    string
+	}{
+		{"US", "America/New_York"},
+		{"us", "America/New_York"},
+		{"JP", "Asia/Tokyo"},
+		{"NZ", "Pacific/Auckland"},
+		{"XX", "UTC"},
+		{"", "UTC"},
+	}
+	for _, tt := range tests {
+		if got := CountryLocation(tt.country).String(); got != tt.want {
+			t.Errorf("CountryLocation(%q) = %s, want %s", tt.country, got, tt.want)
+		}
+	}
+}
+
+func TestDaysUntil(t *testing.T) {
+	tests := []struct {
+		name string
+		r    Release
+		now  time.Time
+		want int
+	}{
+		{"same day in UTC", release("GB", 2024, time.January, 10), utc(2024, time.January, 10, 12, 0), 0},
+		{"US evening is still the day before", release("US", 2024, time.March, 10), utc(2024, time.March, 10, 3, 0), 1},
+		{"Tokyo is already on the day", release("JP", 2024, time.March, 10), utc(2024, time.March, 10, 3, 0), 0},
+		{"Auckland is a day ahead of UTC", release("NZ", 2024, time.March, 11), utc(2024, time.March, 10, 12, 0), 0},
+		{"across the US DST change", release("US", 2024, time.March, 11), utc(2024, time.March, 9, 17, 0), 2},
+		{"future", release("FR", 2024, time.December, 25), utc(2024, time.December, 1, 9, 0), 24},
+		{"past", release("FR", 2024, time.January, 1), utc(2024, time.January, 5, 12, 0), -4},
+		{"unknown country counts in UTC", release("XX", 2024, time.March, 10), utc(2024, time.March, 9, 23, 59), 1},
+		{"unknown country past midnight", release("XX", 2024, time.March, 10), utc(2024, time.March, 10, 0, 0), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DaysUntil(tt.r, tt.now); got != tt.want {
+				t.Errorf("DaysUntil = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountdown(t *testing.T) {
+	now := utc(2024, time.June, 15, 12, 0)
+	day := func(offset int) Release {
+		return release("GB", 2024, time.June, 15+offset)
+	}
+	tests := []struct {
+		r      Release
+		locale string
+		want   string
+	}{
+		{day(0), "en", "today"},
+		{day(1), "en", "tomorrow"},
+		{day(-1), "en", "yesterday"},
+		{day(3), "en-GB", "in 3 days"},
+		{day(-2), "en", "2 days ago"},
+		{day(3), "de", "in 3 Tagen"},
+		{day(-5), "de-AT", "vor 5 Tagen"},
+		{day(1), "fr", "demain"},
+		{day(4), "pt_BR", "em 4 dias"},
+		{day(3), "ru", "через 3 дня"},
+		{day(12), "ru", "через 12 дней"},
+		{release("GB", 2024, time.July, 6), "ru", "через 21 день"},
+		{day(3), "ja", "3日後"},
+		{day(-2), "ko", "2일 전"},
+		{day(2), "xx", "in 2 days"},
+		{day(2), "", "in 2 days"},
+	}
+	for _, tt := range tests {
+		if got := Countdown(tt.r, now, tt.locale); got != tt.want {
+			t.Errorf("Countdown(%s %s, %q) = %q, want %q", tt.r.Country, tt.r.Date.Format(time.DateOnly), tt.locale, got, tt.want)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	day := time.Date(2024, time.March, 9, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		locale string
+		want   string
+	}{
+		{"en", "March 9, 2024"},
+		{"en-US", "March 9, 2024"},
+		{"en-GB", "9 March 2024"},
+		{"en_AU", "9 March 2024"},
+		{"de", "9. März 2024"},
+		{"fr-FR", "9 mars 2024"},
+		{"es", "9 de marzo de 2024"},
+		{"ru", "9 марта 2024 г."},
+		{"ja", "2024年3月9日"},
+		{"ko", "2024년 3월 9일"},
+		{"xx", "March 9, 2024"},
+		{"", "March 9, 2024"},
+	}
+	for _, tt := range tests {
+		if got := Format(day, tt.locale); got != tt.want {
+			t.Errorf("Format(%q) = %q, want %q", tt.locale, got, tt.want)
+		}
+	}
+}
+
+func TestFormatRelease(t *testing.T) {
+	tests := []struct {
+		r    Release
+		want string
+	}{
+		{release("US", 2024, time.March, 9), "March 9, 2024"},
+		{release("DE", 2024, time.March, 9), "9. März 2024"},
+		{release("JP", 2024, time.March, 9), "2024年3月9日"},
+		{release("XX", 2024, time.March, 9), "March 9, 2024"},
+		// The day is read in UTC, whatever zone the timestamp came in.
+		{Release{Country: "DE", Date: time.Date(2024, time.March, 8, 19, 0, 0, 0, time.FixedZone("EST", -5*3600))}, "9. März 2024"},
+	}
+	for _, tt := range tests {
+		if got := FormatRelease(tt.r); got != tt.want {
+			t.Errorf("FormatRelease(%s %s) = %q, want %q", tt.r.Country, tt.r.Date, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !unix
+
+package main
+
+// notifyDebugSignals does nothing where SIGUSR1 and SIGUSR2 don't exist.
+func notifyDebugSignals() {}
@@ -0,0 +1,27 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"wiitco-db-movies-cron/sync"
+)
+
+// notifyDebugSignals dumps the pipeline status on SIGUSR1 and flushes the
+// pending batches on SIGUSR2.
+func notifyDebugSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range signals {
+			if sig == syscall.SIGUSR1 {
+				sync.DumpStatus()
+			} else {
+				sync.FlushBatches()
+			}
+		}
+	}()
+}
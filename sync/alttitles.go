@@ -0,0 +1,69 @@
+package sync
+
+import (
+	"context"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// A movie's alternative titles, regional ones included, are kept in
+// MovieAlternativeTitle so the site's search finds movies by any of them.
+// As with keywords, they are replaced whenever the details came with the
+// alternative_titles sub-resource.
+
+type MovieAlternativeTitle struct {
+	MovieId  uint32 `gorm:"column:movieId"`
+	ISO31661 string `gorm:"column:iso31661"`
+	Title    string
+	Type     *string
+}
+
+// MovieAlternativeTitles are the alternative titles of one movie.
+type MovieAlternativeTitles struct {
+	MovieId uint32
+	Titles  []AlternativeTitle
+}
+
+func writeAlternativeTitleRows(db *gorm.DB, dataChannel chan MovieAlternativeTitles, batchSize int) {
+	writeBatches(dataChannel, batchSize, func(batch []MovieAlternativeTitles) error {
+		return writeAlternativeTitlesBatch(db, batch)
+	})
+}
+
+func writeAlternativeTitlesBatch(db *gorm.DB, objects []MovieAlternativeTitles) error {
+	ids := make([]uint32, 0, len(objects))
+	var rows []MovieAlternativeTitle
+	seen := map[string]bool{}
+	for _, o := range objects {
+		ids = append(ids, o.MovieId)
+		for _, t := range o.Titles {
+			if t.Title == "" {
+				continue
+			}
+			// TMDB lists a title once per type; the first type is kept.
+			if key := pairKey(o.MovieId, t.ISO31661+":"+t.Title); !seen[key] {
+				seen[key] = true
+				rows = append(rows, MovieAlternativeTitle{MovieId: o.MovieId, ISO31661: t.ISO31661, Title: t.Title, Type: filterEmptyDates(t.Type)})
+			}
+		}
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.WithContext(context.Background()).Table("MovieAlternativeTitle").Where(`"movieId" IN ?`, ids).Delete(&MovieAlternativeTitle{}).Error; err != nil {
+			return err
+		}
+		if len(rows) > 0 {
+			if err := tx.WithContext(context.Background()).Table("MovieAlternativeTitle").Create(&rows).Error; err != nil {
+				return err
+			}
+		}
+		changes := newChangeSet("movieAlternativeTitles")
+		for _, id := range ids {
+			changes.touch(strconv.Itoa(int(id)))
+		}
+		for _, r := range rows {
+			changes.add(strconv.Itoa(int(r.MovieId)), r)
+		}
+		return changes.record(tx)
+	})
+}
@@ -0,0 +1,164 @@
+// Package sync keeps the movie catalog in step with TMDB. The cron binary is
+// a thin wrapper around Command; other services can trigger the regular
+// changes sync in-process with Run.
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Report summarizes a finished run.
+type Report struct {
+	RunID      uint64
+	Status     string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	// WindowStart and WindowEnd bound the changes feed the run covered.
+	WindowStart   time.Time
+	WindowEnd     time.Time
+	Fetches       int
+	FetchFailures int
+	Batches       int
+	BatchFailures int
+	// TV is the report of the TV pass when a run syncs both media; the
+	// fields above then cover the movie pass.
+	TV *Report
+}
+
+// ErrUnknownCommand is returned by Command for names it doesn't know.
+var ErrUnknownCommand = errors.New("unknown command")
+
+// running serializes runs, which share the rate limiter, the write
+// statistics and the current SyncRun.
+var running sync.Mutex
+
+// Run performs the regular changes sync with c, as the binary does when
+// called without a command. Cancelling ctx stops scheduling fetches and
+// aborts outstanding TMDB requests; what was fetched by then is still
+// written and Run returns an error wrapping ErrInterrupted. Otherwise the
+// returned error is non-nil if the run failed. Config.Logger and
+// Config.OnProgress let the caller follow the run.
+func Run(ctx context.Context, c Config) (Report, error) {
+	running.Lock()
+	defer running.Unlock()
+	db, err := prepare(ctx, c)
+	if err != nil {
+		return Report{}, err
+	}
+	defer closeDB(db)
+	defer closeFetchCache()
+
+	finishedRuns = nil
+	err = runSync(db, nil)
+	var report Report
+	for _, run := range finishedRuns {
+		r := reportOf(run)
+		if run.Mode == "sync-tv" && len(finishedRuns) > 1 {
+			report.TV = &r
+		} else {
+			report = r
+		}
+	}
+	return report, err
+}
+
+// Command runs the binary's command called name with its arguments. Bad
+// arguments are returned as errors, flag.ErrHelp for -h.
+func Command(ctx context.Context, c Config, name string, args []string) error {
+	running.Lock()
+	defer running.Unlock()
+	if standalone, ok := standaloneCommands[name]; ok {
+		cfg, runCtx = c, ctx
+		return standalone(args)
+	}
+	run, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownCommand, name)
+	}
+	db, err := prepare(ctx, c)
+	if err != nil {
+		return err
+	}
+	defer closeDB(db)
+	defer closeFetchCache()
+	return run(db, args)
+}
+
+// prepare makes c the active configuration and opens the database with the
+// cron's schema, corrections and callbacks in place.
+func prepare(ctx context.Context, c Config) (*gorm.DB, error) {
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	cfg, runCtx = c, ctx
+	var err error
+	if cfg.Logger != nil {
+		logger = cfg.Logger
+	} else if logger, err = newLogger(cfg.LogFormat, cfg.LogLevel); err != nil {
+		return nil, fmt.Errorf("loading configuration: %w", err)
+	}
+	applyPreset(cfg.Preset)
+	if err := loadTransformScript(cfg.TransformScript); err != nil {
+		return nil, fmt.Errorf("loading transform script: %w", err)
+	}
+
+	db, err := openDB()
+	if err != nil {
+		return nil, fmt.Errorf("connecting to the DB: %w", err)
+	}
+	steps := []struct {
+		name string
+		fn   func() error
+	}{
+		{"preparing schema", func() error { return ensureSchema(db) }},
+		{"seeding lookup tables", func() error { return seedLookupTables(db) }},
+		{"opening state store", func() (err error) { state, err = openStateStore(db, cfg.StateStoreURL); return }},
+		{"loading corrections", func() error { return loadCorrections(db, cfg.CorrectionsFile) }},
+		{"pruning removed tag rules", func() error { return pruneMovieTags(db, cfg.TagRules) }},
+		{"migrating release keys", func() error { return migrateReleaseKeys(db) }},
+		{"reading conflict targets", func() error { return loadConflictTargets(db) }},
+		{"registering write statistics", func() error { return registerWriteStats(db, cfg.SlowBatchThreshold) }},
+		{"registering hooks", func() error { return registerBatchHooks(db) }},
+		{"opening fetch cache", openFetchCache},
+	}
+	for _, step := range steps {
+		if err := step.fn(); err != nil {
+			closeDB(db)
+			return nil, fmt.Errorf("%s: %w", step.name, err)
+		}
+	}
+	return db, nil
+}
+
+func closeDB(db *gorm.DB) {
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
+
+func reportOf(run SyncRun) Report {
+	r := Report{
+		RunID:         run.ID,
+		StartedAt:     run.StartedAt,
+		Fetches:       run.Fetches,
+		FetchFailures: run.FetchFailures,
+		Batches:       run.Batches,
+		BatchFailures: run.BatchFailures,
+	}
+	if run.Status != nil {
+		r.Status = *run.Status
+	}
+	if run.FinishedAt != nil {
+		r.FinishedAt = *run.FinishedAt
+	}
+	if run.WindowStart != nil && run.WindowEnd != nil {
+		r.WindowStart, r.WindowEnd = *run.WindowStart, *run.WindowEnd
+	}
+	return r
+}
@@ -0,0 +1,151 @@
+package sync
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+	"gorm.io/gorm"
+)
+
+// With RAW_ARCHIVE=true every details payload fetched during a run is kept
+// for replay and debugging. Payloads go through one zstd stream per run as
+// NDJSON, and the compressed stream is cut into RawPayloadChunk rows as it
+// is produced, so neither the payloads nor the archive ever sit in memory
+// as a whole.
+
+type archivedPayload struct {
+	MovieId uint32          `json:"movieId"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+type payloadArchive struct {
+	ch   chan archivedPayload
+	done chan error
+}
+
+// rawArchive is the archive of the current run, nil when disabled.
+var rawArchive *payloadArchive
+
+func startArchive(db *gorm.DB, runID uint64, chunkSize int) *payloadArchive {
+	a := &payloadArchive{ch: make(chan archivedPayload, 64), done: make(chan error, 1)}
+	go func() {
+		w := &chunkWriter{db: db, runID: runID, size: chunkSize}
+		enc, err := zstd.NewWriter(w)
+		if err != nil {
+			for range a.ch {
+			}
+			a.done <- err
+			return
+		}
+		var writeErr error
+		for p := range a.ch {
+			if writeErr != nil {
+				continue
+			}
+			line, err := json.Marshal(p)
+			if err != nil {
+				outputf("Error archiving payload of movie %d: %v\n", p.MovieId, err)
+				continue
+			}
+			_, writeErr = enc.Write(append(line, '\n'))
+		}
+		a.done <- errors.Join(writeErr, enc.Close(), w.flush())
+	}()
+	return a
+}
+
+// archivePayload queues a raw payload for the current run's archive. It
+// blocks while the archive is behind, which bounds the memory it may hold.
+func archivePayload(movieID uint32, body []byte) {
+	if rawArchive != nil {
+		rawArchive.ch <- archivedPayload{MovieId: movieID, Payload: body}
+	}
+}
+
+func (a *payloadArchive) close() error {
+	close(a.ch)
+	return <-a.done
+}
+
+// chunkWriter stores everything written to it as numbered RawPayloadChunk
+// rows of at most size bytes.
+type chunkWriter struct {
+	db    *gorm.DB
+	runID uint64
+	size  int
+	seq   int
+	buf   []byte
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for len(w.buf) >= w.size {
+		if err := w.insert(w.buf[:w.size]); err != nil {
+			return 0, err
+		}
+		w.buf = append(w.buf[:0], w.buf[w.size:]...)
+	}
+	return len(p), nil
+}
+
+func (w *chunkWriter) flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	err := w.insert(w.buf)
+	w.buf = w.buf[:0]
+	return err
+}
+
+func (w *chunkWriter) insert(data []byte) error {
+	err := w.db.Exec(`INSERT INTO "RawPayloadChunk" ("runId", "seq", "data") VALUES (?, ?, ?)`, w.runID, w.seq, data).Error
+	w.seq++
+	return err
+}
+
+// runArchiveExport writes the archived payloads of a run to stdout as
+// NDJSON, reading one chunk at a time.
+func runArchiveExport(db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("archive-export", flag.ContinueOnError)
+	runID := fs.Uint64("run", 0, "run whose payloads to export")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *runID == 0 {
+		return errors.New("--run is required")
+	}
+
+	rows, err := db.Table("RawPayloadChunk").Select(`"data"`).Where(`"runId" = ?`, *runID).Order(`"seq"`).Rows()
+	if err != nil {
+		return err
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		defer rows.Close()
+		var data []byte
+		for rows.Next() {
+			if err := rows.Scan(&data); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			if _, err := pw.Write(data); err != nil {
+				return
+			}
+		}
+		pw.CloseWithError(rows.Err())
+	}()
+
+	dec, err := zstd.NewReader(pr)
+	if err != nil {
+		pr.Close()
+		return err
+	}
+	defer dec.Close()
+	_, err = io.Copy(os.Stdout, dec)
+	pr.Close()
+	return err
+}
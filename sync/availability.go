@@ -0,0 +1,88 @@
+package sync
+
+import (
+	"fmt"
+	"slices"
+
+	"gorm.io/gorm"
+)
+
+// Each popular provider owns one bit of MovieAvailability.providers, in the
+// order of POPULAR_PROVIDERS, so the site's "watchable now" filter is a
+// single bitwise AND. PopularProvider records which bit is which.
+
+// defaultPopularProviders are TMDB's IDs of Netflix, Amazon Prime Video,
+// Disney Plus, Max, Apple TV Plus and Hulu.
+var defaultPopularProviders = []int{8, 9, 337, 1899, 350, 15}
+
+// maxPopularProviders is the number of bits of a bigint bitmap.
+const maxPopularProviders = 63
+
+// watchableTypes are the offer types that let a viewer start watching
+// without buying or renting.
+var watchableTypes = []string{"flatrate", "free", "ads"}
+
+// availabilityInsert computes the bitmaps of the movies matched by where
+// from the provider offers synced into MovieWatchProvider.
+const availabilityInsert = `
+	INSERT INTO "MovieAvailability" ("movieId", "countryIso", "providers")
+	SELECT wp."movieId", wp."countryIso", bit_or(1::bigint << pp."bit")
+	FROM "MovieWatchProvider" wp
+	JOIN "PopularProvider" pp ON pp."providerId" = wp."providerId"
+	JOIN "Movie" m ON m."id" = wp."movieId" AND m."deletedAt" IS NULL
+	WHERE wp."type" IN ? AND `
+
+// rebuildAvailability recomputes the availability bitmaps of the given
+// movies from the provider offers synced into MovieWatchProvider, see
+// watchproviders.go. When POPULAR_PROVIDERS no longer matches the bits in
+// PopularProvider, every stored bitmap means something else, and all of
+// them are rebuilt in the transaction renumbering the bits.
+func rebuildAvailability(db *gorm.DB, movieIDs []uint32, providers []int) error {
+	if len(movieIDs) == 0 || len(providers) == 0 {
+		return nil
+	}
+	renumbered := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var stored []int
+		if err := tx.Table("PopularProvider").Order(`"bit"`).Pluck(`"providerId"`, &stored).Error; err != nil {
+			return err
+		}
+		if slices.Equal(stored, providers) {
+			return nil
+		}
+		renumbered = true
+		if err := tx.Exec(`DELETE FROM "PopularProvider"`).Error; err != nil {
+			return err
+		}
+		for bit, id := range providers {
+			if err := tx.Exec(`INSERT INTO "PopularProvider" ("bit", "providerId") VALUES (?, ?)`, bit, id).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Exec(`DELETE FROM "MovieAvailability"`).Error; err != nil {
+			return err
+		}
+		return tx.Exec(availabilityInsert+`true GROUP BY wp."movieId", wp."countryIso"`, watchableTypes).Error
+	})
+	if err != nil {
+		return fmt.Errorf("recording popular providers: %w", err)
+	}
+	if renumbered {
+		outputln("Popular providers changed; rebuilt every availability bitmap")
+		return nil
+	}
+
+	for start := 0; start < len(movieIDs); start += denormalizeChunkSize {
+		ids := movieIDs[start:min(start+denormalizeChunkSize, len(movieIDs))]
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(`DELETE FROM "MovieAvailability" WHERE "movieId" IN ?`, ids).Error; err != nil {
+				return err
+			}
+			return tx.Exec(availabilityInsert+`wp."movieId" IN ? GROUP BY wp."movieId", wp."countryIso"`, watchableTypes, ids).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
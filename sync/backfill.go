@@ -0,0 +1,84 @@
+package sync
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+type releaseDatesResponse struct {
+	ID      uint32           `json:"id"`
+	Results []ReleaseCountry `json:"results"`
+}
+
+// runBackfillRegion populates a newly added region for movies already in the
+// DB by refetching only their release_dates, which is far cheaper than a
+// full catalog resync.
+func runBackfillRegion(db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("backfill-region", flag.ContinueOnError)
+	country := fs.String("country", "", "ISO 3166-1 code of the region to backfill")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *country == "" {
+		return errors.New("--country is required")
+	}
+	iso := strings.ToUpper(*country)
+
+	var ids []uint32
+	if err := db.Table("Movie").Order(`"id"`).Pluck(`"id"`, &ids).Error; err != nil {
+		return err
+	}
+	outputf("Backfilling region %s for %d movies\n", iso, len(ids))
+
+	batchSize := cfg.Preset.BatchSize
+	releaseCountryCh := make(chan MReleaseCountry, 1000000)
+	localReleaseCh := make(chan MLocalRelease, 1000000)
+	forEachMovie(ids, workerCount(), func(id uint32) {
+		fetchRegionReleases(id, iso, releaseCountryCh, localReleaseCh)
+	})
+	close(releaseCountryCh)
+	close(localReleaseCh)
+
+	writeReleaseCountryRows(db, releaseCountryCh, batchSize)
+	writeLocalReleaseRows(db, localReleaseCh, batchSize)
+	if n := verifyChecksums(); n > 0 {
+		return fmt.Errorf("fetched and written rows differ in %d tables", n)
+	}
+	return nil
+}
+
+// forEachMovie calls fn for every ID from a fixed pool of workers and returns
+// once all calls have finished.
+func forEachMovie(ids []uint32, workers int, fn func(id uint32)) {
+	runPool(idsChannel(ids), workers, fn)
+}
+
+func fetchRegionReleases(id uint32, iso string, releaseCountryCh chan MReleaseCountry, localReleaseCh chan MLocalRelease) {
+	body, err := fetchTMDB(fmt.Sprintf("/movie/%d/release_dates", id))
+	if err != nil {
+		outputf("Error fetching release dates for ID %d: %v\n", id, err)
+		return
+	}
+	var payload releaseDatesResponse
+	if err := json.Unmarshal(body, &payload); err != nil {
+		outputln("Error parsing JSON data for Movie ID:", id, err)
+		return
+	}
+
+	releaseCountries, localReleases := releaseRows(id, payload.Results)
+	for _, rc := range releaseCountries {
+		if rc.ISO31661 == iso {
+			send(releaseCountryCh, "MReleaseCountry", rc)
+		}
+	}
+	for _, lr := range localReleases {
+		if lr.ISO31661 == iso {
+			send(localReleaseCh, "MLocalRelease", lr)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package sync
+
+import (
+	"sync/atomic"
+)
+
+// flushRequest is closed, and replaced, by FlushBatches to make every
+// writer hand over its pending partial batch.
+var flushRequest atomic.Pointer[chan struct{}]
+
+func init() {
+	ch := make(chan struct{})
+	flushRequest.Store(&ch)
+}
+
+// FlushBatches makes the running writers write what they have collected so
+// far instead of waiting for full batches. Writers of rows referencing
+// others only start once those are written, so they flush when their turn
+// comes. The binary calls it on SIGUSR2.
+func FlushBatches() {
+	next := make(chan struct{})
+	close(*flushRequest.Swap(&next))
+	outputln("Flushing pending batches")
+}
+
+// writeBatches collects the entries of dataChannel into batches of
+// batchSize and writes each with write, the last one possibly short, until
+// dataChannel is closed. Failed batches are reported and skipped. While the
+// watchdog throttles, batches are smaller.
+func writeBatches[T any](dataChannel <-chan T, batchSize int, write func(batch []T) error) {
+	var batch []T
+	flush := func(what string) {
+		if err := write(batch); err != nil {
+			outputf("Error writing %s: %v\n", what, err)
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case entry, ok := <-dataChannel:
+			if !ok {
+				if len(batch) > 0 {
+					flush("final batch")
+				}
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) >= throttled(batchSize) {
+				flush("batch")
+			}
+		case <-*flushRequest.Load():
+			if len(batch) > 0 {
+				flush("flushed batch")
+			}
+		}
+	}
+}
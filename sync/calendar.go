@@ -0,0 +1,35 @@
+package sync
+
+import (
+	"gorm.io/gorm"
+)
+
+// rebuildReleaseCalendar regenerates the ReleaseCalendar table from the local
+// release rows. Each (year, month, countryIso) row holds the movie IDs released
+// that month ordered by date, with releaseDates aligned index-by-index, so the
+// site's calendar view is a single primary-key lookup.
+func rebuildReleaseCalendar(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`DELETE FROM "ReleaseCalendar"`).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`
+			INSERT INTO "ReleaseCalendar" ("year", "month", "countryIso", "movieIds", "releaseDates")
+			SELECT
+				EXTRACT(YEAR FROM r."releaseDate")::int,
+				EXTRACT(MONTH FROM r."releaseDate")::int,
+				r."iso31661",
+				array_agg(r."movieId" ORDER BY r."releaseDate", r."movieId"),
+				array_agg(r."releaseDate" ORDER BY r."releaseDate", r."movieId")
+			FROM (
+				SELECT DISTINCT ON (rc."movieId", rc."iso31661", date_trunc('month', lr."releaseDate"))
+					rc."movieId", rc."iso31661", lr."releaseDate"::date AS "releaseDate"
+				FROM "MLocalRelease" lr
+				JOIN "MReleaseCountry" rc ON ` + releaseJoin + `
+				JOIN "Movie" m ON m."id" = rc."movieId" AND m."deletedAt" IS NULL
+				ORDER BY rc."movieId", rc."iso31661", date_trunc('month', lr."releaseDate"), lr."releaseDate"
+			) r
+			GROUP BY 1, 2, 3
+		`).Error
+	})
+}
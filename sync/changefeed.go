@@ -0,0 +1,170 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	opUpsert = "upsert"
+	opDelete = "delete"
+)
+
+type ChangefeedEntry struct {
+	EntityType string `gorm:"column:entityType"`
+	EntityId   string `gorm:"column:entityId"`
+	Op         string
+	// RunId is nil for changes made outside a run, such as by retention.
+	RunId *uint64 `gorm:"column:runId"`
+}
+
+// ChangefeedDigest is the digest of an entity's rows when its last upsert
+// was recorded.
+type ChangefeedDigest struct {
+	EntityType string `gorm:"column:entityType"`
+	EntityId   string `gorm:"column:entityId"`
+	Digest     string
+}
+
+// recordChanges appends changefeed rows for the given entities. It is called
+// inside the transaction that mutates them, so consumers reading by cursor
+// never see a change before its data is committed. Writers record upserts
+// through a changeSet instead, which skips entities whose rows are unchanged.
+func recordChanges(tx *gorm.DB, entityType, op string, ids []string) error {
+	if len(ids) == 0 || !cfg.Changefeed {
+		return nil
+	}
+	var runID *uint64
+	if currentRun.ID != 0 {
+		id := currentRun.ID
+		runID = &id
+	}
+	entries := make([]ChangefeedEntry, 0, len(ids))
+	for _, id := range ids {
+		entries = append(entries, ChangefeedEntry{
+			EntityType: entityType,
+			EntityId:   id,
+			Op:         op,
+			RunId:      runID,
+		})
+	}
+	if op == opDelete {
+		// A deleted entity written again is a change whatever it held before.
+		err := tx.Exec(`DELETE FROM "ChangefeedDigest" WHERE "entityType" = ? AND "entityId" IN ?`, entityType, ids).Error
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Table("Changefeed").Create(&entries).Error
+}
+
+// digestIgnoredColumns change on every write without the entity changing.
+var digestIgnoredColumns = map[string]bool{"syncedAt": true, "detailsSyncedAt": true}
+
+// changeSet collects the rows a batch writes for each entity of one type.
+// Each entity's digest is the checksum of its rows' column values, so row
+// order doesn't matter and an entity left without rows still has one.
+type changeSet struct {
+	entityType string
+	keys       []string
+	sums       map[string]*entityChecksum
+}
+
+func newChangeSet(entityType string) *changeSet {
+	return &changeSet{entityType: entityType, sums: map[string]*entityChecksum{}}
+}
+
+// touch adds the entity key, also when none of its rows are written, such as
+// a movie whose last keyword was removed.
+func (c *changeSet) touch(key string) *entityChecksum {
+	sum, ok := c.sums[key]
+	if !ok {
+		sum = &entityChecksum{}
+		c.sums[key] = sum
+		c.keys = append(c.keys, key)
+	}
+	return sum
+}
+
+// add counts row towards the entity key.
+func (c *changeSet) add(key string, row any) {
+	c.touch(key).add(columnValues(row))
+}
+
+// addRows counts each of rows towards the entity key.
+func addRows[T any](c *changeSet, key string, rows []T) {
+	for _, row := range rows {
+		c.add(key, row)
+	}
+}
+
+// rowSchemas caches the parsed models columnValues reads. Only the set of
+// columns matters for a digest, so the default naming strategy will do.
+var rowSchemas sync.Map
+
+// columnValues returns the columns GORM writes for row, or the row itself if
+// it isn't a model.
+func columnValues(row any) any {
+	s, err := schema.Parse(row, &rowSchemas, schema.NamingStrategy{})
+	if err != nil {
+		return row
+	}
+	rv := reflect.Indirect(reflect.ValueOf(row))
+	values := map[string]any{}
+	for _, f := range s.Fields {
+		if f.DBName == "" || !f.Creatable || digestIgnoredColumns[f.DBName] {
+			continue
+		}
+		values[f.DBName], _ = f.ValueOf(context.Background(), rv)
+	}
+	return values
+}
+
+// record appends upserts for the entities whose digest differs from the one
+// stored with their last upsert, and stores the new digests.
+func (c *changeSet) record(tx *gorm.DB) error {
+	if len(c.keys) == 0 || !cfg.Changefeed {
+		return nil
+	}
+	var stored []ChangefeedDigest
+	err := tx.Table("ChangefeedDigest").Where(`"entityType" = ? AND "entityId" IN ?`, c.entityType, c.keys).Find(&stored).Error
+	if err != nil {
+		return err
+	}
+	previous := make(map[string]string, len(stored))
+	for _, d := range stored {
+		previous[d.EntityId] = d.Digest
+	}
+	var changed []string
+	var digests []ChangefeedDigest
+	for _, key := range c.keys {
+		sum := c.sums[key]
+		digest := fmt.Sprintf("%d:%x", sum.Count, sum.Sum)
+		if previous[key] == digest {
+			continue
+		}
+		changed = append(changed, key)
+		digests = append(digests, ChangefeedDigest{EntityType: c.entityType, EntityId: key, Digest: digest})
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	err = tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "entityType"}, {Name: "entityId"}},
+		DoUpdates: clause.AssignmentColumns([]string{"digest"}),
+	}).Table("ChangefeedDigest").Create(&digests).Error
+	if err != nil {
+		return err
+	}
+	return recordChanges(tx, c.entityType, opUpsert, changed)
+}
+
+func pairKey(a, b any) string {
+	return fmt.Sprintf("%v:%v", a, b)
+}
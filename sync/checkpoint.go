@@ -0,0 +1,137 @@
+package sync
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// A movie sync checkpoints the changes pages it has read and the movies
+// they listed. Movies are marked done a chunk at a time, once every row of
+// the chunk is written, so a run that dies loses at most one chunk. Resuming
+// moves the checkpoint of the last unfinished run over to the new run and
+// only fetches what is missing.
+
+type checkpointMovie struct {
+	RunId    uint64 `gorm:"column:runId"`
+	MovieId  uint32 `gorm:"column:movieId"`
+	Priority int16
+}
+
+type checkpointPage struct {
+	RunId uint64 `gorm:"column:runId"`
+	Page  int
+}
+
+// resumeOrNextWindow takes over the checkpoint and window of the last run of
+// mode if resume is set and that run never finished or was interrupted.
+// Otherwise it returns the next change window within bounds.
+func resumeOrNextWindow(mode string, resume bool, bounds windowBounds) (changeWindow, bool, error) {
+	if resume {
+		prev, err := state.lastRun(mode, currentRun.ID)
+		if err != nil {
+			return changeWindow{}, false, err
+		}
+		if prev != nil && (prev.Status == nil || *prev.Status == runInterrupted) &&
+			prev.WindowStart != nil && prev.WindowEnd != nil {
+			if err := state.moveCheckpoint(prev.ID, currentRun.ID); err != nil {
+				return changeWindow{}, false, fmt.Errorf("taking over checkpoint of run %d: %w", prev.ID, err)
+			}
+			currentRun.ResumedFrom = &prev.ID
+			outputf("Resuming run %d\n", prev.ID)
+			return changeWindow{Start: *prev.WindowStart, End: *prev.WindowEnd}, true, nil
+		}
+		outputln("No unfinished run to resume, starting a new one")
+	}
+	window, err := nextChangeWindow(mode)
+	if err != nil {
+		return window, false, err
+	}
+	window, err = bounds.apply(window)
+	return window, false, err
+}
+
+// checkpointIDs adds movies to the current run's checkpoint. Movies with a
+// higher priority are synced first.
+func checkpointIDs(ids []uint32, priority int16) error {
+	return state.checkpointMovies(currentRun.ID, ids, priority)
+}
+
+// checkpointIndexPages reads the changes pages the checkpoint lacks and
+// records the movies they list. The first page is always read, as it tells
+// how many pages there are.
+func checkpointIndexPages(window changeWindow) error {
+	done, err := state.checkpointedPages(currentRun.ID)
+	if err != nil {
+		return err
+	}
+	read := map[int]bool{}
+	for _, page := range done {
+		read[page] = true
+	}
+	pagesRead := progressStage(stageIndex)
+	pagesRead.add(len(done))
+
+	readPage := func(page int) {
+		if !read[page] {
+			defer pagesRead.add(1)
+		}
+		ids, ok := fetchIndexPage(page, window)
+		if !ok {
+			return
+		}
+		if err := state.checkpointPage(currentRun.ID, page, ids); err != nil {
+			outputf("Error checkpointing index page %d: %v\n", page, err)
+		}
+	}
+	readPage(1)
+	pagesRead.setTotal(totalPages)
+
+	pages := make(chan int, totalPages)
+	for page := 2; page <= totalPages; page++ {
+		if !read[page] {
+			pages <- page
+		}
+	}
+	close(pages)
+	runPool(pages, workerCount(), readPage)
+	return nil
+}
+
+// syncCheckpointedIDs syncs the movies of the checkpoint not done yet,
+// CHECKPOINT_EVERY at a time, and returns the IDs written.
+func syncCheckpointedIDs(db *gorm.DB) ([]uint32, error) {
+	var written []uint32
+	if pending, err := state.pendingCount(currentRun.ID); err == nil {
+		progressStage(stageMovies).expect(pending)
+	}
+	for !interrupted() {
+		chunk, err := state.pendingMovies(currentRun.ID, cfg.CheckpointEvery)
+		if err != nil {
+			return written, err
+		}
+		if len(chunk) == 0 {
+			break
+		}
+		stale := movieCache.stale(chunk)
+		progressStage(stageMovies).add(len(chunk) - len(stale))
+		chunkWritten := syncMovieIDs(db, idsChannel(stale))
+		written = append(written, chunkWritten...)
+
+		// An interrupted chunk stopped fetching part way; only the movies
+		// written are done.
+		done := chunk
+		if interrupted() {
+			done = chunkWritten
+		}
+		if err := state.markDone(currentRun.ID, done); err != nil {
+			return written, fmt.Errorf("checkpointing: %w", err)
+		}
+	}
+	if !interrupted() {
+		if err := state.clearCheckpoint(currentRun.ID); err != nil {
+			outputln("Error clearing checkpoint:", err)
+		}
+	}
+	return written, nil
+}
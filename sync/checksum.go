@@ -0,0 +1,94 @@
+package sync
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+// Every entity handed to a writer is checksummed once when it is produced
+// and again once the batch carrying it has committed. Each checksum is the
+// count plus the sum of per-entity FNV hashes, so it does not depend on
+// ordering or batching; any difference at the end of a run means rows were
+// dropped between fetching and writing.
+
+type entityChecksum struct {
+	Count int
+	Sum   uint64
+}
+
+func (c *entityChecksum) add(v any) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	h := fnv.New64a()
+	h.Write(b)
+	c.Count++
+	c.Sum += h.Sum64()
+}
+
+var runChecksums = struct {
+	sync.Mutex
+	fetched map[string]*entityChecksum
+	written map[string]*entityChecksum
+}{fetched: map[string]*entityChecksum{}, written: map[string]*entityChecksum{}}
+
+func checksumFor(m map[string]*entityChecksum, table string) *entityChecksum {
+	c, ok := m[table]
+	if !ok {
+		c = &entityChecksum{}
+		m[table] = c
+	}
+	return c
+}
+
+// send checksums v as fetched for table and passes it on to its writer.
+func send[T any](ch chan T, table string, v T) {
+	runChecksums.Lock()
+	checksumFor(runChecksums.fetched, table).add(v)
+	runChecksums.Unlock()
+	ch <- v
+}
+
+// checksumWritten records the entities of a committed batch.
+func checksumWritten[T any](table string, batch []T) {
+	runChecksums.Lock()
+	defer runChecksums.Unlock()
+	c := checksumFor(runChecksums.written, table)
+	for _, v := range batch {
+		c.add(v)
+	}
+}
+
+// verifyChecksums compares fetched and written checksums per table, reports
+// mismatches and resets both for the next run. It returns the number of
+// tables that did not match.
+func verifyChecksums() int {
+	runChecksums.Lock()
+	defer runChecksums.Unlock()
+	tables := make([]string, 0, len(runChecksums.fetched))
+	for table := range runChecksums.fetched {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	mismatches := 0
+	for _, table := range tables {
+		fetched := *runChecksums.fetched[table]
+		written := entityChecksum{}
+		if c, ok := runChecksums.written[table]; ok {
+			written = *c
+		}
+		if fetched == written {
+			continue
+		}
+		mismatches++
+		outputf("Checksum mismatch for %s: fetched %d rows (%016x), wrote %d rows (%016x)\n",
+			table, fetched.Count, fetched.Sum, written.Count, written.Sum)
+	}
+	runChecksums.fetched = map[string]*entityChecksum{}
+	runChecksums.written = map[string]*entityChecksum{}
+	return mismatches
+}
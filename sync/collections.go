@@ -0,0 +1,59 @@
+package sync
+
+import (
+	"context"
+	"strconv"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MovieCollection is a franchise from a movie's belongs_to_collection,
+// which Movie."collectionId" points to. Movies synced before collections
+// were kept may reference one without a row until they are synced again,
+// so there is no foreign key.
+type MovieCollection struct {
+	ID           uint32
+	Name         string
+	PosterPath   *string `gorm:"column:posterPath"`
+	BackdropPath *string `gorm:"column:backdropPath"`
+}
+
+func writeCollectionRows(db *gorm.DB, dataChannel chan MovieCollection, batchSize int) {
+	writeBatches(dataChannel, batchSize, func(batch []MovieCollection) error {
+		if err := writeCollectionsBatch(db, batch); err != nil {
+			return err
+		}
+		checksumWritten("MovieCollection", batch)
+		return nil
+	})
+}
+
+func writeCollectionsBatch(db *gorm.DB, objects []MovieCollection) error {
+	// Every movie of a franchise carries it, and an upsert can't touch the
+	// same row twice; the last copy wins.
+	index := map[uint32]int{}
+	unique := objects[:0:0]
+	for _, o := range objects {
+		if i, ok := index[o.ID]; ok {
+			unique[i] = o
+			continue
+		}
+		index[o.ID] = len(unique)
+		unique = append(unique, o)
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.WithContext(context.Background()).Clauses(clause.OnConflict{
+			Columns:   conflictTarget("MovieCollection"),
+			DoUpdates: clause.AssignmentColumns([]string{"name", "posterPath", "backdropPath"}),
+		}).Table("MovieCollection").Create(&unique).Error
+		if err != nil {
+			return err
+		}
+		changes := newChangeSet("collection")
+		for _, o := range unique {
+			changes.add(strconv.Itoa(int(o.ID)), o)
+		}
+		return changes.record(tx)
+	})
+}
@@ -0,0 +1,39 @@
+package sync
+
+import (
+	"gorm.io/gorm"
+)
+
+// commands maps the first CLI argument to its handler. Running the binary
+// without arguments performs the regular changes sync.
+var commands = map[string]func(db *gorm.DB, args []string) error{
+	"sync":            runSync,
+	"sync-people":     runPersonSync,
+	"retention":       runRetention,
+	"imdb-ratings":    runImdbRatings,
+	"wikidata":        runWikidata,
+	"backfill-region": runBackfillRegion,
+	"backfill-locale": runBackfillLocale,
+	"diff-export":     runDiffExport,
+	"static-export":   runStaticExport,
+	"snapshot":        runSnapshot,
+	"restore":         runRestore,
+	"premieres":       runPremieres,
+	"recent":          runRecent,
+	"check-indexes":   runCheckIndexes,
+	"archive-export":  runArchiveExport,
+	"review":          runReview,
+	"gap-report":      runGapReport,
+	"recrawl":         runRecrawl,
+	"seed":            runSeed,
+	"classify-notes":  runClassifyNotes,
+	"plan":            runPlan,
+	"fill-missing":    runFillMissing,
+	"sweep-deleted":   runSweepDeleted,
+}
+
+// standaloneCommands don't touch the database, so they run without one.
+var standaloneCommands = map[string]func(args []string) error{
+	"tmdb-mock": runTMDBMock,
+	"schema":    runSchema,
+}
@@ -0,0 +1,792 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Region is a country the site publishes release data for, paired with the
+// timezone its "today" is computed in.
+type Region struct {
+	Country  string
+	Location *time.Location
+}
+
+type Config struct {
+	// ReleaseRegions is parsed from RELEASE_REGIONS, e.g.
+	// "US:America/New_York,DE:Europe/Berlin".
+	ReleaseRegions []Region
+	// HotReleaseWindows lists the look-ahead windows, in hours, precomputed
+	// into the HotRelease table.
+	HotReleaseWindows []int
+
+	// RedisURL enables Redis cache priming when set.
+	RedisURL string
+	// RedisHotMovies is how many of the most popular movies get primed.
+	RedisHotMovies int
+	RedisHotTTL    time.Duration
+
+	// DenormalizedTopCast caps the cast list embedded in Movie.denormalized.
+	DenormalizedTopCast int
+
+	// OutboxWebhookURL enables the outbox; events are POSTed here.
+	OutboxWebhookURL string
+
+	// Retention policies are disabled while their age setting is zero.
+	RetentionChangefeedDays  int
+	RetentionOutboxDays      int
+	RetentionReleaseYears    int
+	RetentionPopularityBelow float64
+	// RetentionPeopleGraceDays is how long a person stays after losing
+	// their last credit, see retention.go.
+	RetentionPeopleGraceDays int
+
+	// TraktClientID enables pulling Trakt stats for the most popular
+	// TraktMaxMovies movies of each run.
+	TraktClientID  string
+	TraktMaxMovies int
+
+	Score ScoreWeights
+
+	// StaticExportDir enables static JSON API generation after each run.
+	StaticExportDir          string
+	StaticGenreListSize      int
+	StaticCalendarPastDays   int
+	StaticCalendarFutureDays int
+
+	// ObjectStoreURL is s3://bucket/prefix, gs://bucket/prefix or file:///dir.
+	ObjectStoreURL    string
+	SnapshotRetention int
+
+	// WatchlistTable names the website table of followed movies; its
+	// WatchlistColumn IDs are synced on every run.
+	WatchlistTable  string
+	WatchlistColumn string
+
+	// RecentReleaseDays is the cohort size refreshed by the recent command.
+	RecentReleaseDays int
+
+	Credits CreditCaps
+
+	// SlowBatchThreshold logs batch inserts taking at least this long.
+	SlowBatchThreshold time.Duration
+
+	LogFormat string
+	LogLevel  string
+	// SlowQueryThreshold logs individual SQL statements taking at least
+	// this long; LogQueryParams includes their bound values.
+	SlowQueryThreshold time.Duration
+	LogQueryParams     bool
+
+	// RawArchive keeps every details payload of a run in RawPayloadChunk,
+	// zstd-compressed and split into chunks of RawArchiveChunkSize bytes.
+	RawArchive           bool
+	RawArchiveChunkSize  int
+	RetentionArchiveDays int
+
+	// Preset is selected by PRESET or the --preset flag.
+	Preset Preset
+
+	// A movie's release date moving by QuarantineReleaseJumpYears or more,
+	// or its runtime changing by a factor of QuarantineRuntimeRatio, is held
+	// for review instead of written. Zero disables the check.
+	QuarantineReleaseJumpYears int
+	QuarantineRuntimeRatio     float64
+
+	CorrectionsFile string
+
+	// ReleaseEvents is parsed from RELEASE_EVENTS, see parseReleaseEvents.
+	ReleaseEvents []ReleaseEvent
+	// WeekendStarts maps a country, or "*" for the rest, to the weekday its
+	// cinema weekend starts on, counted from Monday.
+	WeekendStarts map[string]int
+
+	SlackWebhookURL string
+
+	// TagRules are loaded from TAG_RULES_FILE, see tagrules.go.
+	TagRules []TagRule
+
+	// RecrawlLimit is how many of the stalest movies a recrawl run re-syncs.
+	RecrawlLimit int
+
+	// ErrorBudgetPartial and ErrorBudgetFailed are the fetch or batch
+	// failure rates above which a run counts as partial or failed.
+	ErrorBudgetPartial float64
+	ErrorBudgetFailed  float64
+
+	// ChangeWindowOverlap is how far each change window reaches back into
+	// the previous one, to absorb clock skew between us and TMDB. TMDB
+	// windows start on a date, so any overlap reaches back whole days.
+	ChangeWindowOverlap time.Duration
+
+	// TMDBBaseURL is the API root requests go to; tmdb-mock serves one
+	// locally.
+	TMDBBaseURL string
+
+	// HookCommands maps lifecycle events to shell commands, from
+	// HOOK_AFTER_MOVIE_PARSED, HOOK_BEFORE_BATCH_WRITE and HOOK_AFTER_RUN.
+	// An afterMovieParsed command exiting with status 3 vetoes the movie.
+	HookCommands map[string]string
+	HookTimeout  time.Duration
+
+	// TransformScript is a Lua file adjusting or vetoing movies before they
+	// are written, see transform.go.
+	TransformScript string
+
+	// DatabaseDSN is built from the POSTGRES_* variables.
+	DatabaseDSN string
+	// APIAccessToken is the TMDB read access token.
+	APIAccessToken string
+
+	// SyncMedia selects what sync covers: movies, tv or both.
+	SyncMedia string
+
+	// PopularProviders are the TMDB provider IDs whose availability is
+	// precomputed per movie and country, see availability.go.
+	PopularProviders []int
+
+	// PersonDetails enriches the people seen by a run from /person/{id},
+	// with PersonDetailsWorkers fetching at up to PersonDetailsRPS.
+	PersonDetails        bool
+	PersonDetailsWorkers int
+	PersonDetailsRPS     float64
+	// PersonDetailsRefreshDays is how long fetched details stay fresh.
+	PersonDetailsRefreshDays int
+
+	// Festivals are loaded from FESTIVALS_FILE, see festivals.go.
+	Festivals []Festival
+
+	// TMDBMaxRetries bounds the retries of a throttled or failed TMDB
+	// request; waits start below TMDBRetryBase and double up to TMDBRetryMax.
+	TMDBMaxRetries int
+	TMDBRetryBase  time.Duration
+	TMDBRetryMax   time.Duration
+
+	// WorkerCount overrides the preset's number of concurrent fetches.
+	WorkerCount int
+
+	// DetailsAppend lists the sub-resources fetched with every movie, see
+	// details.go.
+	DetailsAppend []string
+	// Language is the locale movies, series and people are fetched in.
+	Language string
+	// TranslationLocales are the site locales written to MovieTranslation
+	// for movies fetched with the translations sub-resource.
+	TranslationLocales []string
+
+	// CheckpointEvery is the number of movies written between checkpoints
+	// of a movie sync.
+	CheckpointEvery int
+
+	// PopularityTiers is parsed from POPULARITY_TIERS, see tiers.go.
+	PopularityTiers []PopularityTier
+
+	// StateStoreURL moves run records, checkpoints and the changes cursor
+	// from Postgres to object storage, see state.go. It takes the same URLs
+	// as ObjectStoreURL. The target DB then stays a pure read model: the
+	// operational tables aren't created, the features writing them default
+	// to off, and enabling one fails Validate.
+	StateStoreURL string
+
+	// MetricsPushgatewayURL receives the run's Prometheus metrics under
+	// MetricsJob when it finishes. MetricsAddr serves them on /metrics for
+	// the duration of a run plus MetricsLinger.
+	MetricsPushgatewayURL string
+	MetricsJob            string
+	MetricsAddr           string
+	MetricsLinger         time.Duration
+
+	// WatchdogMemoryMB and WatchdogGoroutines are the limits the watchdog
+	// throttles a run under, checked every WatchdogInterval; zero disables
+	// a limit. See watchdog.go.
+	WatchdogMemoryMB   int
+	WatchdogGoroutines int
+	WatchdogInterval   time.Duration
+
+	// CrewRoles maps TMDB crew jobs, or departments, to the roles stored in
+	// MovieCrew, see crew.go. Setting CREW_ROLES empty stores none.
+	CrewRoles map[string]string
+
+	// DataDir holds local files such as caches and default export
+	// directories, see paths.go.
+	DataDir string
+
+	// FetchCacheTTL skips the details of movies a previous run fetched
+	// within it, remembered in FetchCacheFile; zero disables the cache. See
+	// fetchcache.go.
+	FetchCacheTTL  time.Duration
+	FetchCacheFile string
+
+	// EnumLabels are loaded from ENUM_LABELS_FILE, see enums.go.
+	EnumLabels EnumLabels
+
+	// RunProgressInterval is how often the stages of a run are written to
+	// RunProgress, see progress.go; zero disables it.
+	RunProgressInterval time.Duration
+
+	// WatchProviders fetches the streaming, rent and buy offers of every
+	// movie written, see watchproviders.go.
+	WatchProviders bool
+
+	// SourcePrecedence orders, per field, the sources a movie's value is
+	// taken from, see sources.go.
+	SourcePrecedence map[string][]string
+
+	// FreshnessManifest publishes when each table was last written after
+	// every run, to the object store and Redis, see freshness.go.
+	FreshnessManifest bool
+
+	// ExchangeRatesURL serves the units of each currency per US dollar,
+	// such as https://api.frankfurter.app/latest?from=USD, converting
+	// foreign budgets, see currency.go; empty, the default, leaves them
+	// unconverted.
+	ExchangeRatesURL string
+
+	// Changefeed, Quarantine and CoverageStats record entity changes,
+	// suspicious values held for review and per-region coverage in the
+	// target DB. They default to on unless STATE_STORE_URL is set.
+	Changefeed    bool
+	Quarantine    bool
+	CoverageStats bool
+
+	// PopularitySnapshots keeps each written movie's popularity of the day in
+	// MoviePopularitySnapshot, pruned by retention after
+	// RetentionPopularitySnapshotDays.
+	PopularitySnapshots             bool
+	RetentionPopularitySnapshotDays int
+
+	// Logger, when set by a library caller, receives the log records and the
+	// console output the binary prints to stdout. It is not read from the
+	// environment.
+	Logger *slog.Logger
+	// OnProgress, when set by a library caller, is called with the stages of
+	// the running sync every RUN_PROGRESS_INTERVAL, or every
+	// defaultProgressInterval when that is zero, and once more when the run
+	// finishes. It is not read from the environment.
+	OnProgress func([]RunProgress)
+}
+
+// cfg is the configuration of the command or run in progress.
+var cfg Config
+
+// LoadConfig reads the configuration from the environment. Library callers
+// typically load it and then override individual fields. The error lists
+// every problem found, one per line, rather than only the first.
+func LoadConfig() (Config, error) {
+	var c Config
+	var problems []error
+
+	var err error
+	if c.ReleaseRegions, err = parseRegions(os.Getenv("RELEASE_REGIONS")); err != nil {
+		problems = append(problems, err)
+	}
+	if c.HotReleaseWindows, err = envIntList("HOT_RELEASE_WINDOWS", []int{24, 48}); err != nil {
+		problems = append(problems, err)
+	}
+
+	c.RedisURL = os.Getenv("REDIS_URL")
+	if c.RedisHotMovies, err = envInt("REDIS_HOT_MOVIES", 500); err != nil {
+		problems = append(problems, err)
+	}
+	if c.RedisHotTTL, err = envDuration("REDIS_HOT_TTL", 6*time.Hour); err != nil {
+		problems = append(problems, err)
+	}
+	if c.DenormalizedTopCast, err = envInt("DENORMALIZED_TOP_CAST", 10); err != nil {
+		problems = append(problems, err)
+	}
+	c.OutboxWebhookURL = os.Getenv("OUTBOX_WEBHOOK_URL")
+
+	if c.RetentionChangefeedDays, err = envInt("RETENTION_CHANGEFEED_DAYS", 90); err != nil {
+		problems = append(problems, err)
+	}
+	if c.RetentionOutboxDays, err = envInt("RETENTION_OUTBOX_DAYS", 14); err != nil {
+		problems = append(problems, err)
+	}
+	if c.RetentionReleaseYears, err = envInt("RETENTION_RELEASE_YEARS", 0); err != nil {
+		problems = append(problems, err)
+	}
+	if c.RetentionPopularityBelow, err = envFloat("RETENTION_POPULARITY_BELOW", 1); err != nil {
+		problems = append(problems, err)
+	}
+	if c.RetentionPeopleGraceDays, err = envInt("RETENTION_PEOPLE_GRACE_DAYS", 0); err != nil {
+		problems = append(problems, err)
+	}
+
+	c.TraktClientID = os.Getenv("TRAKT_CLIENT_ID")
+	if c.TraktMaxMovies, err = envInt("TRAKT_MAX_MOVIES", 1000); err != nil {
+		problems = append(problems, err)
+	}
+
+	if c.Score.Popularity, err = envFloat("SCORE_WEIGHT_POPULARITY", 0.4); err != nil {
+		problems = append(problems, err)
+	}
+	if c.Score.Votes, err = envFloat("SCORE_WEIGHT_VOTES", 0.2); err != nil {
+		problems = append(problems, err)
+	}
+	if c.Score.Recency, err = envFloat("SCORE_WEIGHT_RECENCY", 0.3); err != nil {
+		problems = append(problems, err)
+	}
+	if c.Score.Availability, err = envFloat("SCORE_WEIGHT_AVAILABILITY", 0.1); err != nil {
+		problems = append(problems, err)
+	}
+	if c.Score.RecencyDays, err = envFloat("SCORE_RECENCY_DAYS", 60); err != nil {
+		problems = append(problems, err)
+	}
+
+	c.StaticExportDir = os.Getenv("STATIC_EXPORT_DIR")
+	if c.StaticGenreListSize, err = envInt("STATIC_GENRE_LIST_SIZE", 100); err != nil {
+		problems = append(problems, err)
+	}
+	if c.StaticCalendarPastDays, err = envInt("STATIC_CALENDAR_PAST_DAYS", 30); err != nil {
+		problems = append(problems, err)
+	}
+	if c.StaticCalendarFutureDays, err = envInt("STATIC_CALENDAR_FUTURE_DAYS", 365); err != nil {
+		problems = append(problems, err)
+	}
+
+	c.ObjectStoreURL = os.Getenv("OBJECT_STORE_URL")
+	if c.SnapshotRetention, err = envInt("SNAPSHOT_RETENTION", 14); err != nil {
+		problems = append(problems, err)
+	}
+
+	c.WatchlistTable = os.Getenv("WATCHLIST_TABLE")
+	c.WatchlistColumn = envString("WATCHLIST_COLUMN", "movieId")
+
+	if c.RecentReleaseDays, err = envInt("RECENT_RELEASE_DAYS", 30); err != nil {
+		problems = append(problems, err)
+	}
+
+	if c.Credits.Cast, err = envInt("CREDITS_CAST_CAP", 50); err != nil {
+		problems = append(problems, err)
+	}
+	if c.Credits.CrewDefault, err = envInt("CREDITS_CREW_CAP", 10); err != nil {
+		problems = append(problems, err)
+	}
+	if c.Credits.CrewDepartment, err = envIntMap("CREDITS_CREW_DEPARTMENT_CAPS"); err != nil {
+		problems = append(problems, err)
+	}
+	if c.Credits.FullPopularity, err = envFloat("CREDITS_FULL_POPULARITY", 50); err != nil {
+		problems = append(problems, err)
+	}
+
+	if c.SlowBatchThreshold, err = envDuration("SLOW_BATCH_THRESHOLD", 2*time.Second); err != nil {
+		problems = append(problems, err)
+	}
+
+	c.LogFormat = envString("LOG_FORMAT", "text")
+	c.LogLevel = envString("LOG_LEVEL", "info")
+	if c.SlowQueryThreshold, err = envDuration("SLOW_QUERY_THRESHOLD", 500*time.Millisecond); err != nil {
+		problems = append(problems, err)
+	}
+	c.LogQueryParams = os.Getenv("LOG_QUERY_PARAMS") == "true"
+
+	c.RawArchive = os.Getenv("RAW_ARCHIVE") == "true"
+	if c.RawArchiveChunkSize, err = envInt("RAW_ARCHIVE_CHUNK_SIZE", 1<<20); err != nil {
+		problems = append(problems, err)
+	} else if c.RawArchiveChunkSize <= 0 {
+		problems = append(problems, fmt.Errorf("RAW_ARCHIVE_CHUNK_SIZE: must be positive"))
+	}
+	if c.RetentionArchiveDays, err = envInt("RETENTION_ARCHIVE_DAYS", 7); err != nil {
+		problems = append(problems, err)
+	}
+
+	if c.Preset, err = LookupPreset(envString("PRESET", "standard")); err != nil {
+		problems = append(problems, fmt.Errorf("PRESET: %w", err))
+	}
+
+	if c.QuarantineReleaseJumpYears, err = envInt("QUARANTINE_RELEASE_JUMP_YEARS", 30); err != nil {
+		problems = append(problems, err)
+	}
+	if c.QuarantineRuntimeRatio, err = envFloat("QUARANTINE_RUNTIME_RATIO", 4); err != nil {
+		problems = append(problems, err)
+	}
+
+	c.CorrectionsFile = os.Getenv("CORRECTIONS_FILE")
+
+	if c.ReleaseEvents, err = parseReleaseEvents(envString("RELEASE_EVENTS", defaultReleaseEvents)); err != nil {
+		problems = append(problems, err)
+	}
+	if c.WeekendStarts, err = parseWeekendStarts(envString("WEEKEND_STARTS", defaultWeekendStarts)); err != nil {
+		problems = append(problems, err)
+	}
+
+	c.SlackWebhookURL = os.Getenv("SLACK_WEBHOOK_URL")
+
+	if c.TagRules, err = loadTagRules(os.Getenv("TAG_RULES_FILE")); err != nil {
+		problems = append(problems, err)
+	}
+
+	if c.RecrawlLimit, err = envInt("RECRAWL_LIMIT", 1000); err != nil {
+		problems = append(problems, err)
+	}
+
+	if c.ErrorBudgetPartial, err = envFloat("ERROR_BUDGET_PARTIAL", 0.01); err != nil {
+		problems = append(problems, err)
+	}
+	if c.ErrorBudgetFailed, err = envFloat("ERROR_BUDGET_FAILED", 0.2); err != nil {
+		problems = append(problems, err)
+	}
+	if c.ErrorBudgetFailed < c.ErrorBudgetPartial {
+		problems = append(problems, fmt.Errorf("ERROR_BUDGET_FAILED must not be below ERROR_BUDGET_PARTIAL"))
+	}
+
+	if c.ChangeWindowOverlap, err = envDuration("CHANGE_WINDOW_OVERLAP", 2*time.Hour); err != nil {
+		problems = append(problems, err)
+	} else if c.ChangeWindowOverlap < 0 {
+		problems = append(problems, fmt.Errorf("CHANGE_WINDOW_OVERLAP must not be negative"))
+	}
+
+	c.TMDBBaseURL = strings.TrimSuffix(envString("TMDB_BASE_URL", "https://api.themoviedb.org/3"), "/")
+
+	c.HookCommands = map[string]string{
+		hookAfterMovieParsed: os.Getenv("HOOK_AFTER_MOVIE_PARSED"),
+		hookBeforeBatchWrite: os.Getenv("HOOK_BEFORE_BATCH_WRITE"),
+		hookAfterRun:         os.Getenv("HOOK_AFTER_RUN"),
+	}
+	if c.HookTimeout, err = envDuration("HOOK_TIMEOUT", 30*time.Second); err != nil {
+		problems = append(problems, err)
+	}
+	c.TransformScript = os.Getenv("TRANSFORM_SCRIPT")
+
+	for _, key := range []string{"POSTGRES_HOST", "POSTGRES_USER", "POSTGRES_DATABASE", "POSTGRES_PORT"} {
+		if os.Getenv(key) == "" {
+			problems = append(problems, fmt.Errorf("%s is required", key))
+		}
+	}
+	c.DatabaseDSN = fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=require TimeZone=Asia/Shanghai",
+		os.Getenv("POSTGRES_HOST"), os.Getenv("POSTGRES_USER"), os.Getenv("POSTGRES_PASSWORD"),
+		os.Getenv("POSTGRES_DATABASE"), os.Getenv("POSTGRES_PORT"))
+	c.APIAccessToken = os.Getenv("API_ACCESS_TOKEN")
+
+	c.SyncMedia = envString("SYNC_MEDIA", mediaMovies)
+	if !validMedia(c.SyncMedia) {
+		problems = append(problems, fmt.Errorf("SYNC_MEDIA: %q is not movies, tv or both", c.SyncMedia))
+	}
+	if c.PopularProviders, err = envIntList("POPULAR_PROVIDERS", defaultPopularProviders); err != nil {
+		problems = append(problems, err)
+	}
+	if len(c.PopularProviders) > maxPopularProviders {
+		problems = append(problems, fmt.Errorf("POPULAR_PROVIDERS: at most %d providers fit the bitmap", maxPopularProviders))
+	}
+
+	c.PersonDetails = os.Getenv("PERSON_DETAILS") != "false"
+	if c.PersonDetailsWorkers, err = envInt("PERSON_DETAILS_WORKERS", 4); err != nil {
+		problems = append(problems, err)
+	}
+	if c.PersonDetailsRPS, err = envFloat("PERSON_DETAILS_RPS", 10); err != nil {
+		problems = append(problems, err)
+	}
+	if c.PersonDetailsRefreshDays, err = envInt("PERSON_DETAILS_REFRESH_DAYS", 30); err != nil {
+		problems = append(problems, err)
+	}
+	if c.PersonDetailsWorkers < 1 || c.PersonDetailsRPS <= 0 {
+		problems = append(problems, fmt.Errorf("PERSON_DETAILS_WORKERS and PERSON_DETAILS_RPS must be positive"))
+	}
+	if c.Festivals, err = loadFestivals(os.Getenv("FESTIVALS_FILE")); err != nil {
+		problems = append(problems, err)
+	}
+
+	if c.TMDBMaxRetries, err = envInt("TMDB_MAX_RETRIES", 4); err != nil {
+		problems = append(problems, err)
+	}
+	if c.TMDBRetryBase, err = envDuration("TMDB_RETRY_BASE", 500*time.Millisecond); err != nil {
+		problems = append(problems, err)
+	}
+	if c.TMDBRetryMax, err = envDuration("TMDB_RETRY_MAX", 30*time.Second); err != nil {
+		problems = append(problems, err)
+	}
+	if c.TMDBMaxRetries < 0 {
+		problems = append(problems, fmt.Errorf("TMDB_MAX_RETRIES must not be negative"))
+	}
+	if c.WorkerCount, err = envInt("WORKER_COUNT", 0); err != nil {
+		problems = append(problems, err)
+	} else if c.WorkerCount < 0 {
+		problems = append(problems, fmt.Errorf("WORKER_COUNT must not be negative"))
+	}
+	c.DetailsAppend = envSplit(envString("DETAILS_APPEND", defaultDetailsAppend))
+	c.Language = envString("TMDB_LANGUAGE", "en-US")
+	c.TranslationLocales = envSplit(os.Getenv("TRANSLATION_LOCALES"))
+	if c.CheckpointEvery, err = envInt("CHECKPOINT_EVERY", 1000); err != nil {
+		problems = append(problems, err)
+	} else if c.CheckpointEvery < 1 {
+		problems = append(problems, fmt.Errorf("CHECKPOINT_EVERY must be positive"))
+	}
+	if c.PopularityTiers, err = parsePopularityTiers(os.Getenv("POPULARITY_TIERS")); err != nil {
+		problems = append(problems, err)
+	}
+	c.StateStoreURL = os.Getenv("STATE_STORE_URL")
+	c.MetricsPushgatewayURL = os.Getenv("METRICS_PUSHGATEWAY_URL")
+	c.MetricsJob = envString("METRICS_JOB", "wiitco-db-movies-cron")
+	c.MetricsAddr = os.Getenv("METRICS_ADDR")
+	if c.MetricsLinger, err = envDuration("METRICS_LINGER", 15*time.Second); err != nil {
+		problems = append(problems, err)
+	}
+	if c.WatchdogMemoryMB, err = envInt("WATCHDOG_MEMORY_MB", 0); err != nil {
+		problems = append(problems, err)
+	} else if c.WatchdogMemoryMB < 0 {
+		problems = append(problems, fmt.Errorf("WATCHDOG_MEMORY_MB must not be negative"))
+	}
+	if c.WatchdogGoroutines, err = envInt("WATCHDOG_GOROUTINES", 0); err != nil {
+		problems = append(problems, err)
+	} else if c.WatchdogGoroutines < 0 {
+		problems = append(problems, fmt.Errorf("WATCHDOG_GOROUTINES must not be negative"))
+	}
+	if c.WatchdogInterval, err = envDuration("WATCHDOG_INTERVAL", 5*time.Second); err != nil {
+		problems = append(problems, err)
+	} else if c.WatchdogInterval <= 0 {
+		problems = append(problems, fmt.Errorf("WATCHDOG_INTERVAL must be positive"))
+	}
+	c.DataDir = filepath.Clean(envString("DATA_DIR", defaultDataDir()))
+	crewRoles, set := os.LookupEnv("CREW_ROLES")
+	if !set {
+		crewRoles = defaultCrewRoles
+	}
+	if c.CrewRoles, err = parseCrewRoles(crewRoles); err != nil {
+		problems = append(problems, err)
+	}
+	if c.FetchCacheTTL, err = envDuration("FETCH_CACHE_TTL", 0); err != nil {
+		problems = append(problems, err)
+	} else if c.FetchCacheTTL < 0 {
+		problems = append(problems, fmt.Errorf("FETCH_CACHE_TTL must not be negative"))
+	}
+	if c.EnumLabels, err = loadEnumLabels(os.Getenv("ENUM_LABELS_FILE")); err != nil {
+		problems = append(problems, err)
+	}
+	if c.RunProgressInterval, err = envDuration("RUN_PROGRESS_INTERVAL", 5*time.Second); err != nil {
+		problems = append(problems, err)
+	} else if c.RunProgressInterval < 0 {
+		problems = append(problems, fmt.Errorf("RUN_PROGRESS_INTERVAL must not be negative"))
+	}
+	c.WatchProviders = os.Getenv("WATCH_PROVIDERS") == "true"
+	if c.SourcePrecedence, err = parseSourcePrecedence(envString("SOURCE_PRECEDENCE", defaultSourcePrecedence)); err != nil {
+		problems = append(problems, err)
+	}
+	c.FreshnessManifest = os.Getenv("FRESHNESS_MANIFEST") == "true"
+	c.ExchangeRatesURL = os.Getenv("EXCHANGE_RATES_URL")
+	operational := strconv.FormatBool(c.StateStoreURL == "")
+	c.Changefeed = envString("CHANGEFEED", operational) == "true"
+	c.Quarantine = envString("QUARANTINE", operational) == "true"
+	c.CoverageStats = envString("COVERAGE_STATS", operational) == "true"
+	if c.StateStoreURL != "" && os.Getenv("RUN_PROGRESS_INTERVAL") == "" {
+		c.RunProgressInterval = 0
+	}
+	c.PopularitySnapshots = os.Getenv("POPULARITY_SNAPSHOTS") == "true"
+	if c.RetentionPopularitySnapshotDays, err = envInt("RETENTION_POPULARITY_SNAPSHOT_DAYS", 730); err != nil {
+		problems = append(problems, err)
+	}
+	c.FetchCacheFile = envString("FETCH_CACHE_FILE", filepath.Join(c.DataDir, "fetch-cache.db"))
+
+	if err := c.Validate(); err != nil {
+		problems = append(problems, err)
+	}
+	return c, errors.Join(problems...)
+}
+
+func parseRegions(raw string) ([]Region, error) {
+	var regions []Region
+	for _, entry := range envSplit(raw) {
+		country, tz, found := strings.Cut(entry, ":")
+		if !found {
+			tz = "UTC"
+		}
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("RELEASE_REGIONS: invalid timezone for %s: %w", country, err)
+		}
+		regions = append(regions, Region{Country: strings.ToUpper(country), Location: loc})
+	}
+	return regions, nil
+}
+
+func envSplit(raw string) []string {
+	var out []string
+	for _, part := range strings.Split(raw, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+func envIntList(key string, def []int) ([]int, error) {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def, nil
+	}
+	var out []int
+	for _, part := range envSplit(raw) {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q is not an integer", key, part)
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+func envInt(key string, def int) (int, error) {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %q is not an integer", key, raw)
+	}
+	return n, nil
+}
+
+func envDuration(key string, def time.Duration) (time.Duration, error) {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %q is not a duration", key, raw)
+	}
+	return d, nil
+}
+
+// tmdbMaxRPS is TMDB's documented request rate limit per IP.
+const tmdbMaxRPS = 50
+
+// maxBatchSize keeps insert statements below Postgres' bind parameter limit
+// for the widest tables.
+const maxBatchSize = 1000
+
+// Validate checks required settings and value ranges and returns every
+// problem found, joined. Command and Run validate the configuration they
+// are given, so fields overridden after LoadConfig are checked too.
+func (c Config) Validate() error {
+	var problems []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			problems = append(problems, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.APIAccessToken != "", "API_ACCESS_TOKEN is required")
+	check(c.DatabaseDSN != "", "the database DSN is required")
+	if u, err := url.Parse(c.TMDBBaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+		problems = append(problems, fmt.Errorf("TMDB_BASE_URL: %q is not an absolute URL", c.TMDBBaseURL))
+	}
+
+	check(c.Preset.RequestsPerSecond > 0 && c.Preset.RequestsPerSecond <= tmdbMaxRPS,
+		"preset: %g requests per second is outside TMDB's limit of 1 to %d", c.Preset.RequestsPerSecond, tmdbMaxRPS)
+	check(c.Preset.Workers > 0, "preset: workers must be positive")
+	check(c.Preset.BatchSize > 0 && c.Preset.BatchSize <= maxBatchSize,
+		"preset: batch size %d is outside 1 to %d", c.Preset.BatchSize, maxBatchSize)
+	check(c.PersonDetailsRPS <= tmdbMaxRPS, "PERSON_DETAILS_RPS: %g exceeds TMDB's limit of %d", c.PersonDetailsRPS, tmdbMaxRPS)
+	// The person limiter paces requests on top of the movie limiter.
+	check(!c.PersonDetails || c.Preset.RequestsPerSecond+c.PersonDetailsRPS <= tmdbMaxRPS,
+		"PERSON_DETAILS_RPS: %g on top of the preset's %g requests per second exceeds TMDB's limit of %d",
+		c.PersonDetailsRPS, c.Preset.RequestsPerSecond, tmdbMaxRPS)
+
+	check(c.Score.RecencyDays > 0, "SCORE_RECENCY_DAYS: %g is not a positive number of days", c.Score.RecencyDays)
+
+	check(validLocale(c.Language), "TMDB_LANGUAGE: %q is not a locale such as en-US or de", c.Language)
+	for _, locale := range c.TranslationLocales {
+		check(validLocale(locale), "TRANSLATION_LOCALES: %q is not a locale such as de or pt-BR", locale)
+	}
+	for _, region := range c.ReleaseRegions {
+		check(validCountry(region.Country), "RELEASE_REGIONS: %q is not an ISO 3166-1 country code", region.Country)
+	}
+	for _, festival := range c.Festivals {
+		check(festival.Country == "" || validCountry(festival.Country),
+			"FESTIVALS_FILE: %s: %q is not an ISO 3166-1 country code", festival.Slug, festival.Country)
+	}
+	for country := range c.WeekendStarts {
+		check(country == "*" || validCountry(country), "WEEKEND_STARTS: %q is not an ISO 3166-1 country code", country)
+	}
+	for _, event := range c.ReleaseEvents {
+		check(event.Country == "" || validCountry(event.Country), "RELEASE_EVENTS: %q is not an ISO 3166-1 country code", event.Country)
+	}
+	for _, hours := range c.HotReleaseWindows {
+		check(hours > 0, "HOT_RELEASE_WINDOWS: %d is not a positive number of hours", hours)
+	}
+	for _, id := range c.PopularProviders {
+		check(id > 0, "POPULAR_PROVIDERS: %d is not a provider ID", id)
+	}
+	if c.StateStoreURL != "" {
+		u, err := url.Parse(c.StateStoreURL)
+		check(err == nil && (u.Scheme == "s3" || u.Scheme == "gs" || u.Scheme == "file"),
+			"STATE_STORE_URL: %q is not an s3://, gs:// or file:// URL", c.StateStoreURL)
+		for _, feature := range []struct {
+			name    string
+			enabled bool
+		}{
+			{"CHANGEFEED", c.Changefeed},
+			{"QUARANTINE", c.Quarantine},
+			{"COVERAGE_STATS", c.CoverageStats},
+			{"RUN_PROGRESS_INTERVAL", c.RunProgressInterval > 0},
+			{"RAW_ARCHIVE", c.RawArchive},
+			{"OUTBOX_WEBHOOK_URL", c.OutboxWebhookURL != ""},
+		} {
+			check(!feature.enabled, "%s writes an operational table into the target DB, which STATE_STORE_URL keeps a read model", feature.name)
+		}
+	}
+	check(!c.FreshnessManifest || c.ObjectStoreURL != "" || c.RedisURL != "",
+		"FRESHNESS_MANIFEST needs OBJECT_STORE_URL or REDIS_URL")
+	if c.ExchangeRatesURL != "" {
+		u, err := url.Parse(c.ExchangeRatesURL)
+		check(err == nil && u.Scheme != "" && u.Host != "", "EXCHANGE_RATES_URL: %q is not an absolute URL", c.ExchangeRatesURL)
+	}
+	if c.MetricsPushgatewayURL != "" {
+		u, err := url.Parse(c.MetricsPushgatewayURL)
+		check(err == nil && u.Scheme != "" && u.Host != "", "METRICS_PUSHGATEWAY_URL: %q is not an absolute URL", c.MetricsPushgatewayURL)
+	}
+
+	if _, err := newLogger(c.LogFormat, c.LogLevel); err != nil {
+		problems = append(problems, err)
+	}
+	return errors.Join(problems...)
+}
+
+func (c Config) regionCountries() []string {
+	countries := make([]string, 0, len(c.ReleaseRegions))
+	for _, region := range c.ReleaseRegions {
+		countries = append(countries, region.Country)
+	}
+	return countries
+}
+
+func envFloat(key string, def float64) (float64, error) {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %q is not a number", key, raw)
+	}
+	return f, nil
+}
+
+func envString(key, def string) string {
+	if raw := os.Getenv(key); raw != "" {
+		return raw
+	}
+	return def
+}
+
+// envIntMap parses "Key:1,Other:2" into a map.
+func envIntMap(key string) (map[string]int, error) {
+	out := map[string]int{}
+	for _, part := range envSplit(os.Getenv(key)) {
+		k, v, found := strings.Cut(part, ":")
+		n, err := strconv.Atoi(v)
+		if !found || err != nil {
+			return nil, fmt.Errorf("%s: %q is not a key:integer pair", key, part)
+		}
+		out[k] = n
+	}
+	return out, nil
+}
@@ -0,0 +1,34 @@
+package sync
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseRegions(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    []string
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"US:America/New_York", []string{"US America/New_York"}, false},
+		{"gb:Europe/London, de", []string{"GB Europe/London", "DE UTC"}, false},
+		{" FR:Europe/Paris ,, JP:Asia/Tokyo ", []string{"FR Europe/Paris", "JP Asia/Tokyo"}, false},
+		{"US:Mars/Olympus", nil, true},
+	}
+	for _, tt := range tests {
+		regions, err := parseRegions(tt.raw)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseRegions(%q) error = %v, want error %v", tt.raw, err, tt.wantErr)
+			continue
+		}
+		var got []string
+		for _, r := range regions {
+			got = append(got, r.Country+" "+r.Location.String())
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("parseRegions(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
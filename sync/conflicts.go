@@ -0,0 +1,125 @@
+package sync
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// conflictTargets holds the ON CONFLICT columns of every upserted table,
+// derived at startup from the live table's unique constraints. Without an
+// explicit target GORM assumes the model's primary key, which silently stops
+// matching once the website schema adds or changes a unique index.
+var conflictTargets = map[string][]clause.Column{}
+
+// upsertModels maps each table the cron upserts into to the model it writes.
+func upsertModels() map[string]any {
+	models := map[string]any{
+		"Genre":            &Genre{},
+		"Country":          &Country{},
+		"Language":         &Language{},
+		"MovieCollection":  &MovieCollection{},
+		"Keyword":          &KeywordDB{},
+		"WatchProvider":    &WatchProvider{},
+		"Movie":            &MovieDB{},
+		"CinemaPerson":     &Person{},
+		"MovieActor":       &MovieActor{},
+		"MovieDirector":    &MovieDirector{},
+		"MovieCrew":        &MovieCrew{},
+		"MovieGenre":       &MovieGenre{},
+		"MovieCountry":     &MovieCountry{},
+		"MReleaseCountry":  &MReleaseCountry{},
+		"MLocalRelease":    &MLocalRelease{},
+		"MovieTranslation": &MovieTranslation{},
+		"MovieWikidata":    &MovieWikidata{},
+		"MovieExternalIds": &MovieExternalIds{},
+		"Series":           &SeriesDB{},
+	}
+	return models
+}
+
+type uniqueIndex struct {
+	Name    string
+	Primary bool
+	Columns string
+}
+
+// loadConflictTargets picks, per table, the unique constraint made up only
+// of columns the model writes: the primary key if it qualifies, otherwise
+// the narrowest unique index.
+func loadConflictTargets(db *gorm.DB) error {
+	for table, model := range upsertModels() {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return fmt.Errorf("parsing model of %s: %w", table, err)
+		}
+		written := map[string]bool{}
+		for _, name := range stmt.Schema.DBNames {
+			written[name] = true
+		}
+
+		indexes, err := uniqueIndexes(db, table)
+		if err != nil {
+			return fmt.Errorf("reading unique constraints of %s: %w", table, err)
+		}
+		var target []string
+		for _, idx := range indexes {
+			columns := strings.Split(idx.Columns, ",")
+			if !allWritten(columns, written) {
+				continue
+			}
+			if target == nil || idx.Primary || len(columns) < len(target) {
+				target = columns
+			}
+			if idx.Primary {
+				break
+			}
+		}
+		if target == nil {
+			logger.Warn("no unique constraint covers the written columns; upserts cannot detect existing rows", "table", table)
+			continue
+		}
+		cols := make([]clause.Column, len(target))
+		for i, c := range target {
+			cols[i] = clause.Column{Name: c}
+		}
+		conflictTargets[table] = cols
+	}
+	return nil
+}
+
+func allWritten(columns []string, written map[string]bool) bool {
+	for _, c := range columns {
+		if !written[c] {
+			return false
+		}
+	}
+	return true
+}
+
+// uniqueIndexes lists the valid, non-partial unique indexes on table over
+// plain columns, primary key first.
+func uniqueIndexes(db *gorm.DB, table string) ([]uniqueIndex, error) {
+	var out []uniqueIndex
+	err := db.Raw(`SELECT ic.relname AS name, i.indisprimary AS "primary",
+			string_agg(a.attname, ',' ORDER BY k.ord) AS columns
+		FROM pg_index i
+		JOIN pg_class t ON t.oid = i.indrelid
+		JOIN pg_class ic ON ic.oid = i.indexrelid
+		JOIN LATERAL unnest(i.indkey) WITH ORDINALITY AS k(attnum, ord) ON true
+		JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum
+		WHERE t.relname = ? AND t.relnamespace = current_schema()::regnamespace
+			AND i.indisunique AND i.indisvalid AND i.indpred IS NULL AND NOT (0 = ANY (i.indkey))
+		GROUP BY ic.relname, i.indisprimary`, table).Scan(&out).Error
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Primary && !out[j].Primary })
+	return out, err
+}
+
+// conflictTarget returns the ON CONFLICT columns for table. A nil target
+// leaves DO NOTHING clauses matching any constraint.
+func conflictTarget(table string) []clause.Column {
+	return conflictTargets[table]
+}
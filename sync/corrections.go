@@ -0,0 +1,168 @@
+package sync
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Corrections patch known TMDB mistakes. They come from the MovieCorrection
+// table and, optionally, a CSV file of movieId,field,value lines named by
+// CORRECTIONS_FILE, whose entries win. They are applied to every parsed
+// movie before it is written, so they survive each resync, and corrected
+// fields are exempt from quarantine.
+
+type MovieCorrection struct {
+	MovieId uint32 `gorm:"column:movieId"`
+	Field   string `gorm:"column:field"`
+	Value   string `gorm:"column:value"`
+}
+
+// correctionSetters maps a correctable Movie column to the function writing
+// a corrected value into a parsed movie.
+var correctionSetters = map[string]func(m *MovieDB, value string) error{
+	"title": func(m *MovieDB, v string) error {
+		m.Title = v
+		return nil
+	},
+	"originaltitle": func(m *MovieDB, v string) error {
+		m.OriginalTitle = filterEmptyDates(v)
+		return nil
+	},
+	"originalLanguage": func(m *MovieDB, v string) error {
+		m.OriginalLanguage = filterEmptyDates(v)
+		return nil
+	},
+	"posterPath": func(m *MovieDB, v string) error {
+		m.PosterPath = filterEmptyDates(v)
+		return nil
+	},
+	"imdbId": func(m *MovieDB, v string) error {
+		m.ImdbId = filterEmptyDates(v)
+		return nil
+	},
+	"primaryReleaseDate": func(m *MovieDB, v string) error {
+		m.ReleaseDateStr = filterEmptyDates(v)
+		return nil
+	},
+	"runtime": func(m *MovieDB, v string) error {
+		n, err := strconv.ParseUint(v, 10, 16)
+		m.Runtime = uint16(n)
+		return err
+	},
+	"budget": func(m *MovieDB, v string) error {
+		n, err := strconv.ParseUint(v, 10, 64)
+		m.Budget = n
+		return err
+	},
+	"revenue": func(m *MovieDB, v string) error {
+		n, err := strconv.ParseUint(v, 10, 64)
+		m.Revenue = n
+		return err
+	},
+	"overview": func(m *MovieDB, v string) error {
+		m.Overview = filterEmptyDates(v)
+		return nil
+	},
+	"tagline": func(m *MovieDB, v string) error {
+		m.Tagline = filterEmptyDates(v)
+		return nil
+	},
+	"budgetCurrency": func(m *MovieDB, v string) error {
+		if !currencyPattern.MatchString(v) {
+			return fmt.Errorf("%q is not an ISO 4217 currency code", v)
+		}
+		m.BudgetCurrency = &v
+		return nil
+	},
+	"homepage": func(m *MovieDB, v string) error {
+		homepage, err := normalizeHomepage(v)
+		m.Homepage = filterEmptyDates(homepage)
+		return err
+	},
+}
+
+// corrections holds the loaded corrections by movie, then field.
+var corrections = map[uint32]map[string]string{}
+
+func loadCorrections(db *gorm.DB, file string) error {
+	var rows []MovieCorrection
+	if err := db.Table("MovieCorrection").Find(&rows).Error; err != nil {
+		return err
+	}
+	if file != "" {
+		fromFile, err := readCorrectionsFile(file)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", file, err)
+		}
+		rows = append(rows, fromFile...)
+	}
+
+	loaded := map[uint32]map[string]string{}
+	for _, c := range rows {
+		set, ok := correctionSetters[c.Field]
+		if !ok {
+			return fmt.Errorf("correction for movie %d: unknown field %q", c.MovieId, c.Field)
+		}
+		if err := set(&MovieDB{}, c.Value); err != nil {
+			return fmt.Errorf("correction for movie %d: invalid %s %q", c.MovieId, c.Field, c.Value)
+		}
+		if loaded[c.MovieId] == nil {
+			loaded[c.MovieId] = map[string]string{}
+		}
+		loaded[c.MovieId][c.Field] = c.Value
+	}
+	corrections = loaded
+	if len(rows) > 0 {
+		outputf("Loaded corrections for %d movies\n", len(loaded))
+	}
+	return nil
+}
+
+func readCorrectionsFile(path string) ([]MovieCorrection, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.FieldsPerRecord = 3
+	var out []MovieCorrection
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		id, err := strconv.ParseUint(strings.TrimSpace(record[0]), 10, 32)
+		if err != nil {
+			// Tolerate a header line.
+			if len(out) == 0 && record[0] == "movieId" {
+				continue
+			}
+			return nil, fmt.Errorf("invalid movie ID %q", record[0])
+		}
+		out = append(out, MovieCorrection{MovieId: uint32(id), Field: strings.TrimSpace(record[1]), Value: record[2]})
+	}
+}
+
+// applyCorrections patches m in place with its loaded corrections.
+func applyCorrections(m *MovieDB) {
+	for field, value := range corrections[m.ID] {
+		correctionSetters[field](m, value)
+	}
+}
+
+func isCorrected(movieID uint32, field string) bool {
+	_, ok := corrections[movieID][field]
+	return ok
+}
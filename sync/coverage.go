@@ -0,0 +1,83 @@
+package sync
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Genre IDs used in CoverageStats besides TMDB's own.
+const (
+	coverageAllGenres = 0
+	coverageNoGenre   = -1
+)
+
+type CoverageStat struct {
+	Region      string `gorm:"column:region"`
+	GenreId     int    `gorm:"column:genreId"`
+	Movies      int    `gorm:"column:movies"`
+	WithRelease int    `gorm:"column:withRelease"`
+	WithPoster  int    `gorm:"column:withPoster"`
+	WithCast    int    `gorm:"column:withCast"`
+}
+
+// recordCoverage stores, for the current run, how many movies per region and
+// genre have a release date in that region, a poster and any cast. Rows with
+// genreId 0 cover all genres.
+func recordCoverage(db *gorm.DB, regions []string) error {
+	if len(regions) == 0 || !cfg.CoverageStats {
+		return nil
+	}
+	values := make([]string, len(regions))
+	args := []any{currentRun.ID, coverageAllGenres, coverageNoGenre}
+	for i, r := range regions {
+		values[i] = "(?)"
+		args = append(args, r)
+	}
+
+	err := db.Exec(`
+		WITH flags AS (
+			SELECT m."id", m."posterPath" IS NOT NULL AS poster,
+				EXISTS (SELECT 1 FROM "MovieActor" a WHERE a."movieId" = m."id") AS "hasCast"
+			FROM "Movie" m
+		), released AS (
+			SELECT DISTINCT rc."movieId", rc."iso31661"
+			FROM "MReleaseCountry" rc
+			JOIN "MLocalRelease" lr ON `+releaseJoin+`
+		)
+		INSERT INTO "CoverageStats" ("runId", "region", "genreId", "movies", "withRelease", "withPoster", "withCast")
+		SELECT ?, r.country,
+			CASE WHEN GROUPING(g."genreId") = 1 THEN ? ELSE COALESCE(g."genreId", ?) END,
+			count(DISTINCT f."id"),
+			count(DISTINCT f."id") FILTER (WHERE rel."movieId" IS NOT NULL),
+			count(DISTINCT f."id") FILTER (WHERE f.poster),
+			count(DISTINCT f."id") FILTER (WHERE f."hasCast")
+		FROM flags f
+		CROSS JOIN (VALUES `+strings.Join(values, ", ")+`) AS r(country)
+		LEFT JOIN released rel ON rel."movieId" = f."id" AND rel."iso31661" = r.country
+		LEFT JOIN "MovieGenre" g ON g."movieId" = f."id"
+		GROUP BY GROUPING SETS ((r.country), (r.country, g."genreId"))`, args...).Error
+	if err != nil {
+		return err
+	}
+
+	var totals []CoverageStat
+	err = db.Table("CoverageStats").
+		Where(`"runId" = ? AND "genreId" = ?`, currentRun.ID, coverageAllGenres).
+		Order(`"region"`).Find(&totals).Error
+	if err != nil {
+		return err
+	}
+	for _, t := range totals {
+		outputf("Coverage %s: %.1f%% released, %.1f%% with poster, %.1f%% with cast of %d movies\n",
+			t.Region, percent(t.WithRelease, t.Movies), percent(t.WithPoster, t.Movies), percent(t.WithCast, t.Movies), t.Movies)
+	}
+	return nil
+}
+
+func percent(part, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(part) / float64(total)
+}
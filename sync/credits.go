@@ -0,0 +1,208 @@
+package sync
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type CastMember struct {
+	ID        uint32 `json:"id"`
+	Name      string `json:"name"`
+	Character string `json:"character"`
+	Order     uint16 `json:"order"`
+	CreditId  string `json:"credit_id"`
+}
+
+type CrewMember struct {
+	ID         uint32 `json:"id"`
+	Name       string `json:"name"`
+	Department string `json:"department"`
+	Job        string `json:"job"`
+	CreditId   string `json:"credit_id"`
+}
+
+// CreditCaps bounds how many credits are kept per movie. A cap of zero or
+// less means unlimited.
+type CreditCaps struct {
+	Cast           int
+	CrewDefault    int
+	CrewDepartment map[string]int
+	// FullPopularity lifts all caps for movies at least this popular.
+	FullPopularity float64
+}
+
+func (c CreditCaps) crewCap(department string) int {
+	if n, ok := c.CrewDepartment[department]; ok {
+		return n
+	}
+	return c.CrewDefault
+}
+
+// castRows turns the cast into MovieActor rows, one per actor. An actor
+// playing several parts gets them joined with " / ", at their top billing.
+func castRows(movieID uint32, cast []CastMember) []MovieActor {
+	var rows []MovieActor
+	byActor := map[uint32]int{}
+	for _, member := range cast {
+		credit := MovieActor{
+			MovieId:   movieID,
+			ActorId:   member.ID,
+			Character: member.Character,
+			Order:     member.Order,
+			CreditId:  member.CreditId,
+		}
+		applyCreditNotes(&credit)
+		if i, ok := byActor[member.ID]; ok {
+			row := &rows[i]
+			if credit.Character != "" && credit.Character != row.Character {
+				row.Character = strings.TrimPrefix(row.Character+" / "+credit.Character, " / ")
+			}
+			if credit.Order < row.Order {
+				row.Order, row.CreditId = credit.Order, credit.CreditId
+			}
+			// A role is uncredited or archive footage only if all of it
+			// is; voice and guest parts mark the whole credit.
+			row.IsUncredited = row.IsUncredited && credit.IsUncredited
+			row.IsArchiveFootage = row.IsArchiveFootage && credit.IsArchiveFootage
+			row.IsVoice = row.IsVoice || credit.IsVoice
+			row.IsGuest = row.IsGuest || credit.IsGuest
+			continue
+		}
+		byActor[member.ID] = len(rows)
+		rows = append(rows, credit)
+	}
+	return rows
+}
+
+// parseCredits stream-decodes the credits object, materializing only the
+// entries that fit within the caps. Blockbusters can carry thousands of crew
+// entries and most of them are never stored.
+func parseCredits(raw json.RawMessage, popularity float32, caps CreditCaps) ([]CastMember, []CrewMember, error) {
+	if len(raw) == 0 {
+		return nil, nil, nil
+	}
+	if caps.FullPopularity > 0 && float64(popularity) >= caps.FullPopularity {
+		caps = CreditCaps{}
+	}
+
+	var cast []CastMember
+	var crew []CrewMember
+	perDepartment := map[string]int{}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, nil, err
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		switch key {
+		case "cast":
+			err = decodeArray(dec, func() error {
+				if caps.Cast > 0 && len(cast) >= caps.Cast {
+					return skipValue(dec)
+				}
+				var member CastMember
+				if err := dec.Decode(&member); err != nil {
+					return err
+				}
+				cast = append(cast, member)
+				return nil
+			})
+		case "crew":
+			err = decodeArray(dec, func() error {
+				var member CrewMember
+				if err := dec.Decode(&member); err != nil {
+					return err
+				}
+				// Directors are always kept, even when assistant directors
+				// already exhausted the Directing cap.
+				if limit := caps.crewCap(member.Department); member.Job != "Director" && limit > 0 && perDepartment[member.Department] >= limit {
+					return nil
+				}
+				perDepartment[member.Department]++
+				crew = append(crew, member)
+				return nil
+			})
+		default:
+			err = skipValue(dec)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return cast, crew, nil
+}
+
+func decodeArray(dec *json.Decoder, each func() error) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		return nil
+	}
+	if tok != json.Delim('[') {
+		return fmt.Errorf("expected array, got %v", tok)
+	}
+	for dec.More() {
+		if err := each(); err != nil {
+			return err
+		}
+	}
+	_, err = dec.Token()
+	return err
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != delim {
+		return fmt.Errorf("expected %v, got %v", delim, tok)
+	}
+	return nil
+}
+
+func skipValue(dec *json.Decoder) error {
+	var skip json.RawMessage
+	return dec.Decode(&skip)
+}
+
+// creditNoteFlags maps the parenthesized notes TMDB appends to character
+// names, such as "Narrator (voice) (uncredited)", to the flag they set.
+var creditNoteFlags = map[string]func(*MovieActor){
+	"uncredited":       func(a *MovieActor) { a.IsUncredited = true },
+	"voice":            func(a *MovieActor) { a.IsVoice = true },
+	"voice-over":       func(a *MovieActor) { a.IsVoice = true },
+	"voice over":       func(a *MovieActor) { a.IsVoice = true },
+	"archive footage":  func(a *MovieActor) { a.IsArchiveFootage = true },
+	"archival footage": func(a *MovieActor) { a.IsArchiveFootage = true },
+	"cameo":            func(a *MovieActor) { a.IsGuest = true },
+	"guest":            func(a *MovieActor) { a.IsGuest = true },
+	"guest star":       func(a *MovieActor) { a.IsGuest = true },
+}
+
+// applyCreditNotes strips the recognized notes off the end of the row's
+// character, setting their flags. Other notes stay part of the character.
+func applyCreditNotes(row *MovieActor) {
+	character := strings.TrimSpace(row.Character)
+	for strings.HasSuffix(character, ")") {
+		open := strings.LastIndex(character, "(")
+		if open < 0 {
+			break
+		}
+		set, ok := creditNoteFlags[strings.ToLower(strings.TrimSpace(character[open+1:len(character)-1]))]
+		if !ok {
+			break
+		}
+		set(row)
+		character = strings.TrimSpace(character[:open])
+	}
+	row.Character = character
+}
@@ -0,0 +1,79 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MovieCrew links a movie to crew credited in roles other than director,
+// which keep their own MovieDirector table. Role is what CREW_ROLES maps the
+// TMDB job, or failing that the department, to; other credits aren't kept.
+type MovieCrew struct {
+	MovieId    uint32 `gorm:"column:movieId"`
+	PersonId   uint32 `gorm:"column:personId"`
+	Job        string `gorm:"column:job"`
+	Department string `gorm:"column:department"`
+	Role       string `gorm:"column:role"`
+	CreditId   string `gorm:"column:creditId"`
+}
+
+// defaultCrewRoles keeps the writers, producers and composers.
+const defaultCrewRoles = "Screenplay:writer,Writer:writer,Story:writer,Novel:writer," +
+	"Producer:producer,Executive Producer:producer," +
+	"Original Music Composer:composer,Music:composer"
+
+// parseCrewRoles reads "Job:role,Department:role" pairs.
+func parseCrewRoles(raw string) (map[string]string, error) {
+	roles := map[string]string{}
+	for _, part := range envSplit(raw) {
+		key, role, found := strings.Cut(part, ":")
+		key, role = strings.TrimSpace(key), strings.TrimSpace(role)
+		if !found || key == "" || role == "" {
+			return nil, fmt.Errorf("CREW_ROLES: %q is not a job:role pair", part)
+		}
+		roles[key] = role
+	}
+	return roles, nil
+}
+
+// crewRole returns the role stored for a crew credit, or "" to skip it.
+func crewRole(member CrewMember) string {
+	if member.Job == "Director" {
+		return ""
+	}
+	if role, ok := cfg.CrewRoles[member.Job]; ok {
+		return role
+	}
+	return cfg.CrewRoles[member.Department]
+}
+
+func writeMovieCrewRows(db *gorm.DB, dataChannel chan MovieCrew, batchSize int) {
+	writeBatches(dataChannel, batchSize, func(batch []MovieCrew) error {
+		if err := writeCrewBatch(db, batch); err != nil {
+			return err
+		}
+		checksumWritten("MovieCrew", batch)
+		return nil
+	})
+}
+
+func writeCrewBatch(db *gorm.DB, objects []MovieCrew) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.WithContext(context.Background()).Clauses(clause.OnConflict{
+			Columns:   conflictTarget("MovieCrew"),
+			DoUpdates: clause.AssignmentColumns([]string{"department", "role", "creditId"}),
+		}).Table("MovieCrew").Create(&objects).Error
+		if err != nil {
+			return err
+		}
+		changes := newChangeSet("movieCrew")
+		for _, o := range objects {
+			changes.add(pairKey(o.MovieId, o.PersonId)+":"+o.Job, o)
+		}
+		return changes.record(tx)
+	})
+}
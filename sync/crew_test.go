@@ -0,0 +1,32 @@
+package sync
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestParseCrewRoles(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"", map[string]string{}, false},
+		{"Screenplay:writer", map[string]string{"Screenplay": "writer"}, false},
+		{"Executive Producer : producer, Sound:sound", map[string]string{"Executive Producer": "producer", "Sound": "sound"}, false},
+		{"Writer:writer,Writer:author", map[string]string{"Writer": "author"}, false},
+		{"Writer", nil, true},
+		{":writer", nil, true},
+		{"Writer:", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseCrewRoles(tt.raw)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseCrewRoles(%q) error = %v, want error %v", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !maps.Equal(got, tt.want) {
+			t.Errorf("parseCrewRoles(%q) = %v, want %v", tt.raw, got, tt.want)
+		}
+	}
+}
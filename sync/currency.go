@@ -0,0 +1,139 @@
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// TMDB budgets and revenues are meant to be US dollars, but some movies,
+// mostly from countries with a high-denomination currency, carry the local
+// figure. Movie keeps the figures as TMDB has them and adds the currency
+// they are taken to be in and both in dollars, converted at the rate of
+// currencyRateDate. The currency is the budgetCurrency correction if there
+// is one; otherwise the local currency of a movie made entirely outside the
+// US whose budget is too large to be dollars; otherwise USD.
+
+// maxForeignBudgetUSD is the largest budget in dollars taken at face value
+// for a movie without a US production country; no such movie has cost more.
+const maxForeignBudgetUSD = 300_000_000
+
+// countryCurrencies are the currencies of the production countries whose
+// budgets are checked.
+var countryCurrencies = map[string]string{
+	"AR": "ARS", "AT": "EUR", "AU": "AUD", "BE": "EUR", "BR": "BRL", "CA": "CAD", "CH": "CHF", "CL": "CLP",
+	"CN": "CNY", "CO": "COP", "CZ": "CZK", "DE": "EUR", "DK": "DKK", "EG": "EGP", "ES": "EUR", "FI": "EUR",
+	"FR": "EUR", "GB": "GBP", "GR": "EUR", "HK": "HKD", "HU": "HUF", "ID": "IDR", "IE": "EUR", "IL": "ILS",
+	"IN": "INR", "IR": "IRR", "IS": "ISK", "IT": "EUR", "JP": "JPY", "KR": "KRW", "MX": "MXN", "MY": "MYR",
+	"NG": "NGN", "NL": "EUR", "NO": "NOK", "NZ": "NZD", "PH": "PHP", "PK": "PKR", "PL": "PLN", "PT": "EUR",
+	"RO": "RON", "RU": "RUB", "SE": "SEK", "SG": "SGD", "TH": "THB", "TR": "TRY", "TW": "TWD", "UA": "UAH",
+	"VN": "VND", "ZA": "ZAR",
+}
+
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// exchangeRates are the units of each currency per US dollar, read from
+// EXCHANGE_RATES_URL on first use in a run; withRun clears them, so every
+// run converts at fresh rates and a failed fetch is retried by the next.
+var exchangeRates struct {
+	sync.Mutex
+	loaded bool
+	date   string
+	rates  map[string]float64
+}
+
+type ratesResponse struct {
+	Date  string             `json:"date"`
+	Rates map[string]float64 `json:"rates"`
+}
+
+// exchangeRate returns the rate of currency and the date it is of, zero if
+// there is none.
+func exchangeRate(currency string) (float64, string) {
+	exchangeRates.Lock()
+	defer exchangeRates.Unlock()
+	if !exchangeRates.loaded {
+		exchangeRates.loaded = true
+		if rates, err := fetchExchangeRates(); err != nil {
+			outputln("Error fetching exchange rates, foreign budgets are not converted:", err)
+		} else {
+			exchangeRates.date, exchangeRates.rates = rates.Date, rates.Rates
+		}
+	}
+	return exchangeRates.rates[currency], exchangeRates.date
+}
+
+func resetExchangeRates() {
+	exchangeRates.Lock()
+	exchangeRates.loaded, exchangeRates.date, exchangeRates.rates = false, "", nil
+	exchangeRates.Unlock()
+}
+
+func fetchExchangeRates() (ratesResponse, error) {
+	var body ratesResponse
+	if cfg.ExchangeRatesURL == "" {
+		return body, nil
+	}
+	client := http.Client{Timeout: 30 * time.Second}
+	res, err := client.Get(cfg.ExchangeRatesURL)
+	if err != nil {
+		return body, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return body, fmt.Errorf("unexpected HTTP status code: %d", res.StatusCode)
+	}
+	err = json.NewDecoder(res.Body).Decode(&body)
+	return body, err
+}
+
+// budgetCurrency returns the currency of a movie's figures.
+func budgetCurrency(m *MovieDB, countries []ProductionCountry) string {
+	if v, ok := corrections[m.ID]["budgetCurrency"]; ok {
+		return v
+	}
+	if m.Budget <= maxForeignBudgetUSD || len(countries) == 0 {
+		return "USD"
+	}
+	local := ""
+	for _, c := range countries {
+		currency := countryCurrencies[c.ISO31661]
+		if currency == "" || local != "" && currency != local {
+			return "USD"
+		}
+		local = currency
+	}
+	return local
+}
+
+// setBudgetCurrency sets the currency of a movie's figures and converts
+// them to dollars. Figures in a currency without a known rate are left
+// unconverted.
+func setBudgetCurrency(m *MovieDB, countries []ProductionCountry) {
+	if m.Budget == 0 && m.Revenue == 0 {
+		return
+	}
+	currency := budgetCurrency(m, countries)
+	m.BudgetCurrency = &currency
+	rate := 1.0
+	if currency != "USD" {
+		var date string
+		if rate, date = exchangeRate(currency); rate <= 0 {
+			return
+		}
+		m.CurrencyRateDate = &date
+	}
+	m.BudgetUsd, m.RevenueUsd = toUSD(m.Budget, rate), toUSD(m.Revenue, rate)
+}
+
+func toUSD(amount uint64, rate float64) *uint64 {
+	if amount == 0 {
+		return nil
+	}
+	usd := uint64(math.Round(float64(amount) / rate))
+	return &usd
+}
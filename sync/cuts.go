@@ -0,0 +1,37 @@
+package sync
+
+import (
+	"regexp"
+	"strconv"
+)
+
+var (
+	// "2h 22m", "2 hrs 22 min"
+	hoursMinutesPattern = regexp.MustCompile(`(?i)\b(\d)\s*h(?:ours?|rs?)?\.?\s*(\d{1,2})\s*m`)
+	// "142 min", "(178 minutes)", "131 Minuten", "95'"
+	minutesPattern = regexp.MustCompile(`(?i)\b(\d{2,3})\s*(?:min(?:ute)?s?|minuten|minutos|mn|')(?:\W|$)`)
+)
+
+// Runtimes outside this range are more likely years or other numbers.
+const (
+	minCutRuntime = 20
+	maxCutRuntime = 600
+)
+
+// parseCutRuntime extracts the runtime of a specific version, such as a
+// director's cut, from a release note. It returns nil if the note names none.
+func parseCutRuntime(note string) *uint16 {
+	minutes := 0
+	if m := hoursMinutesPattern.FindStringSubmatch(note); m != nil {
+		h, _ := strconv.Atoi(m[1])
+		min, _ := strconv.Atoi(m[2])
+		minutes = h*60 + min
+	} else if m := minutesPattern.FindStringSubmatch(note); m != nil {
+		minutes, _ = strconv.Atoi(m[1])
+	}
+	if minutes < minCutRuntime || minutes > maxCutRuntime {
+		return nil
+	}
+	runtime := uint16(minutes)
+	return &runtime
+}
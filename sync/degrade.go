@@ -0,0 +1,91 @@
+package sync
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"slices"
+
+	"gorm.io/gorm"
+)
+
+// A movie whose payload lacks a requested sub-resource, or has one that
+// doesn't parse, is still written without that sub-resource's rows; the
+// rows already stored for it stay. Movie."missingResources" has the bit of
+// each sub-resource left out, so fill-missing can fetch those movies again.
+
+// subResources gives each sub-resource its bit in missingResources, by
+// position. Names are only ever appended.
+var subResources = []string{
+	"credits", "release_dates", "alternative_titles", "keywords", "external_ids", "translations",
+	"watch/providers", "images", "videos", "reviews", "recommendations", "similar", "lists",
+}
+
+func missingBits(missing []string) int32 {
+	var bits int32
+	for _, name := range missing {
+		if i := slices.Index(subResources, name); i >= 0 {
+			bits |= 1 << i
+		}
+	}
+	return bits
+}
+
+// decodeDetails parses a details payload, leaving out the requested
+// sub-resources that are absent or malformed and returning their names.
+func decodeDetails(body []byte, resources []string) (Movie, []string, error) {
+	var movie Movie
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return movie, nil, err
+	}
+	var missing []string
+	for _, name := range resources {
+		raw, ok := fields[name]
+		if !ok {
+			missing = append(missing, name)
+			continue
+		}
+		var probe Movie
+		if err := json.Unmarshal([]byte(fmt.Sprintf(`{%q:%s}`, name, raw)), &probe); err != nil {
+			missing = append(missing, name)
+			delete(fields, name)
+		}
+	}
+	if len(missing) > 0 {
+		var err error
+		if body, err = json.Marshal(fields); err != nil {
+			return movie, nil, err
+		}
+	}
+	return movie, missing, json.Unmarshal(body, &movie)
+}
+
+// runFillMissing re-syncs the movies written without some of their
+// sub-resources, most popular first.
+func runFillMissing(db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("fill-missing", flag.ContinueOnError)
+	limit := fs.Int("limit", 1000, "number of movies to re-sync")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var ids []uint32
+	err := db.Table("Movie").
+		Where(`"missingResources" <> 0 AND "deletedAt" IS NULL`).
+		Order(`"popularity" DESC`).
+		Limit(*limit).
+		Pluck(`"id"`, &ids).Error
+	if err != nil {
+		return err
+	}
+	outputf("Filling in sub-resources of %d movies\n", len(ids))
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return withRun(db, "fill-missing", func() error {
+		afterMovieWrites(db, syncMovieIDs(db, idsChannel(ids)))
+		return nil
+	})
+}
@@ -0,0 +1,124 @@
+package sync
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+const denormalizeChunkSize = 1000
+
+// movieJSONSQL builds the fully-joined JSON representation of a movie from
+// the catalog tables. It expects the movie row aliased as m. A positive
+// topCast limits the cast list, and a non-empty countries list restricts the
+// release dates to those regions.
+func movieJSONSQL(topCast int, countries []string) (string, []any) {
+	var args []any
+	castLimit := ""
+	if topCast > 0 {
+		castLimit = fmt.Sprintf("LIMIT %d", topCast)
+	}
+	releaseFilter := ""
+	if len(countries) > 0 {
+		releaseFilter = `AND rc."iso31661" IN ?`
+		args = append(args, countries)
+	}
+
+	return `json_build_object(
+	'id', m."id",
+	'title', m."title",
+	'originalTitle', m."originaltitle",
+	'originalLanguage', m."originalLanguage",
+	'posterPath', m."posterPath",
+	'popularity', m."popularity",
+	'runtime', m."runtime",
+	'budget', m."budget",
+	'revenue', m."revenue",
+	'budgetCurrency', m."budgetCurrency",
+	'budgetUsd', m."budgetUsd",
+	'revenueUsd', m."revenueUsd",
+	'overview', m."overview",
+	'tagline', m."tagline",
+	'status', m."status",
+	'voteAverage', m."voteAverage",
+	'voteCount', m."voteCount",
+	'homepage', m."homepage",
+	'backdropPath', m."backdropPath",
+	'imdbId', m."imdbId",
+	'releaseDate', m."primaryReleaseDate",
+	'collection', (
+		SELECT json_build_object('id', col."id", 'name', col."name", 'posterPath', col."posterPath", 'backdropPath', col."backdropPath")
+		FROM "MovieCollection" col WHERE col."id" = m."collectionId"
+	),
+	'keywords', COALESCE((
+		SELECT json_agg(json_build_object('id', k."id", 'name', k."name") ORDER BY k."name")
+		FROM "MovieKeyword" mk JOIN "Keyword" k ON k."id" = mk."keywordId"
+		WHERE mk."movieId" = m."id"
+	), '[]'::json),
+	'alternativeTitles', COALESCE((
+		SELECT json_agg(json_build_object('country', alt."iso31661", 'title', alt."title", 'type', alt."type") ORDER BY alt."iso31661", alt."title")
+		FROM "MovieAlternativeTitle" alt WHERE alt."movieId" = m."id"
+	), '[]'::json),
+	'genreIds', COALESCE((
+		SELECT json_agg(mg."genreId" ORDER BY mg."genreId")
+		FROM "MovieGenre" mg WHERE mg."movieId" = m."id"
+	), '[]'::json),
+	'cast', COALESCE((
+		SELECT json_agg(c) FROM (
+			SELECT p."id", p."name", ma."character", ma."order",
+				ma."isUncredited", ma."isVoice", ma."isArchiveFootage", ma."isGuest"
+			FROM "MovieActor" ma JOIN "CinemaPerson" p ON p."id" = ma."actorId"
+			WHERE ma."movieId" = m."id"
+			ORDER BY ma."order" NULLS LAST, p."id"
+			` + castLimit + `
+		) c
+	), '[]'::json),
+	'directors', COALESCE((
+		SELECT json_agg(json_build_object('id', p."id", 'name', p."name"))
+		FROM "MovieDirector" md JOIN "CinemaPerson" p ON p."id" = md."directorId"
+		WHERE md."movieId" = m."id"
+	), '[]'::json),
+	'crew', COALESCE((
+		SELECT json_agg(json_build_object('id', p."id", 'name', p."name", 'role', mc."role", 'job', mc."job") ORDER BY mc."role", mc."job", p."name")
+		FROM "MovieCrew" mc JOIN "CinemaPerson" p ON p."id" = mc."personId"
+		WHERE mc."movieId" = m."id"
+	), '[]'::json),
+	'productionCountries', COALESCE((
+		SELECT json_agg(mc."countryIso" ORDER BY mc."countryIso")
+		FROM "MovieCountry" mc WHERE mc."movieId" = m."id"
+	), '[]'::json),
+	'releases', COALESCE((
+		SELECT json_agg(json_build_object(
+			'country', rc."iso31661",
+			'localTitle', rc."localTitle",
+			'date', lr."releaseDate",
+			'type', lr."type",
+			'note', lr."note",
+			'cutRuntime', lr."cutRuntime",
+			'noteCategory', lr."noteCategory",
+			'imax', lr."isImax",
+			'3d', lr."is3d",
+			'70mm', lr."is70mm",
+			'dolby', lr."isDolby",
+			'certification', lr."certification"
+		) ORDER BY rc."iso31661", lr."releaseDate")
+		FROM "MReleaseCountry" rc JOIN "MLocalRelease" lr ON ` + releaseJoin + `
+		WHERE rc."movieId" = m."id" ` + releaseFilter + `
+	), '[]'::json)
+)`, args
+}
+
+// rebuildDenormalized refreshes the denormalized JSONB column for the given
+// movies, so detail pages can be served from a single-row read.
+func rebuildDenormalized(db *gorm.DB, ids []uint32, topCast int, countries []string) error {
+	expr, args := movieJSONSQL(topCast, countries)
+	for start := 0; start < len(ids); start += denormalizeChunkSize {
+		end := min(start+denormalizeChunkSize, len(ids))
+		err := db.Exec(`UPDATE "Movie" m SET "denormalized" = `+expr+`::jsonb WHERE m."id" IN ?`,
+			append(args, ids[start:end])...).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
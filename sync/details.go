@@ -0,0 +1,76 @@
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// TMDB appends at most this many sub-resources to one details request.
+// Movies needing more, such as images, videos, reviews and watch/providers
+// on top of the defaults, are fetched with one request per group of
+// sub-resources, all in parallel through the shared limiter, and merged
+// into a single payload before parsing.
+const tmdbAppendLimit = 20
+
+const defaultDetailsAppend = "release_dates,credits,alternative_titles,keywords,external_ids"
+
+// fetchDetailsData returns a movie's details payload with resources
+// appended.
+func fetchDetailsData(id uint32, resources []string) ([]byte, error) {
+	var groups [][]string
+	for start := 0; start < len(resources); start += tmdbAppendLimit {
+		groups = append(groups, resources[start:min(start+tmdbAppendLimit, len(resources))])
+	}
+	if len(groups) <= 1 {
+		return fetchTMDB(detailsPath(id, resources))
+	}
+
+	bodies := make([][]byte, len(groups))
+	errs := make([]error, len(groups))
+	var wg sync.WaitGroup
+	for i, group := range groups {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bodies[i], errs[i] = fetchTMDB(detailsPath(id, group))
+		}()
+	}
+	wg.Wait()
+	if errs[0] != nil {
+		return nil, errs[0]
+	}
+
+	// The movie goes on without the sub-resources of a failed group, which
+	// decodeDetails finds missing.
+	var merged map[string]json.RawMessage
+	if err := json.Unmarshal(bodies[0], &merged); err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(groups); i++ {
+		var extra map[string]json.RawMessage
+		if errs[i] == nil {
+			errs[i] = json.Unmarshal(bodies[i], &extra)
+		}
+		if errs[i] != nil {
+			outputf("Error fetching sub-resources %s for ID %d: %v\n", strings.Join(groups[i], ","), id, errs[i])
+			continue
+		}
+		for _, name := range groups[i] {
+			if raw, ok := extra[name]; ok {
+				merged[name] = raw
+			}
+		}
+	}
+	return json.Marshal(merged)
+}
+
+func detailsPath(id uint32, resources []string) string {
+	path := fmt.Sprintf("/movie/%d?language=%s", id, cfg.Language)
+	if len(resources) > 0 {
+		path += "&append_to_response=" + url.QueryEscape(strings.Join(resources, ","))
+	}
+	return path
+}
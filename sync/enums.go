@@ -0,0 +1,164 @@
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// The ReleaseType and MovieStatus tables give the codes stored in
+// MLocalRelease."type" and Movie."status" their labels, by locale, so the
+// site reads them from the DB. They are seeded at startup with the English
+// labels below and those of ENUM_LABELS_FILE; rows added by hand are kept.
+// Writers drop values missing from the tables instead of storing codes the
+// site can't label.
+
+// lookupEntry is a row of a lookup table.
+type lookupEntry struct {
+	ID     int
+	Code   string
+	Labels map[string]string
+}
+
+// releaseTypes are TMDB's release types, with their TMDB numbers as IDs.
+var releaseTypes = []lookupEntry{
+	{releasePremiere, "premiere", map[string]string{"en": "Premiere"}},
+	{releaseTheatricalLimited, "theatricalLimited", map[string]string{"en": "Theatrical (limited)"}},
+	{releaseTheatrical, "theatrical", map[string]string{"en": "Theatrical"}},
+	{releaseDigital, "digital", map[string]string{"en": "Digital"}},
+	{releasePhysical, "physical", map[string]string{"en": "Physical"}},
+	{releaseTV, "tv", map[string]string{"en": "TV"}},
+}
+
+// movieStatuses are TMDB's movie statuses. Movie."status" holds the code.
+var movieStatuses = []lookupEntry{
+	{1, "Rumored", map[string]string{"en": "Rumored"}},
+	{2, "Planned", map[string]string{"en": "Planned"}},
+	{3, "In Production", map[string]string{"en": "In production"}},
+	{4, "Post Production", map[string]string{"en": "Post-production"}},
+	{5, "Released", map[string]string{"en": "Released"}},
+	{6, "Canceled", map[string]string{"en": "Canceled"}},
+}
+
+// EnumLabels are labels for more locales, by table, code and locale.
+type EnumLabels struct {
+	ReleaseTypes  map[string]map[string]string `yaml:"releaseTypes"`
+	MovieStatuses map[string]map[string]string `yaml:"movieStatuses"`
+}
+
+func loadEnumLabels(path string) (EnumLabels, error) {
+	var labels EnumLabels
+	if path == "" {
+		return labels, nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return labels, fmt.Errorf("ENUM_LABELS_FILE: %w", err)
+	}
+	if err := yaml.Unmarshal(raw, &labels); err != nil {
+		return labels, fmt.Errorf("ENUM_LABELS_FILE: %w", err)
+	}
+	for _, table := range []struct {
+		name    string
+		entries []lookupEntry
+		labels  map[string]map[string]string
+	}{
+		{"releaseTypes", releaseTypes, labels.ReleaseTypes},
+		{"movieStatuses", movieStatuses, labels.MovieStatuses},
+	} {
+		for code := range table.labels {
+			if lookupID(table.entries, code) == 0 {
+				return labels, fmt.Errorf("ENUM_LABELS_FILE: %s: unknown code %q", table.name, code)
+			}
+		}
+	}
+	return labels, nil
+}
+
+func lookupID(entries []lookupEntry, code string) int {
+	for _, e := range entries {
+		if e.Code == code {
+			return e.ID
+		}
+	}
+	return 0
+}
+
+// Codes present in the lookup tables, loaded by seedLookupTables.
+var (
+	knownReleaseTypes  map[uint8]bool
+	knownMovieStatuses map[string]bool
+)
+
+// seedLookupTables upserts the built-in entries and configured labels, then
+// loads what the tables hold for the writers to check against.
+func seedLookupTables(db *gorm.DB) error {
+	for _, table := range []struct {
+		name    string
+		entries []lookupEntry
+		labels  map[string]map[string]string
+	}{
+		{"ReleaseType", releaseTypes, cfg.EnumLabels.ReleaseTypes},
+		{"MovieStatus", movieStatuses, cfg.EnumLabels.MovieStatuses},
+	} {
+		for _, e := range table.entries {
+			labels := map[string]string{}
+			for locale, label := range e.Labels {
+				labels[locale] = label
+			}
+			for locale, label := range table.labels[e.Code] {
+				labels[locale] = label
+			}
+			raw, err := json.Marshal(labels)
+			if err != nil {
+				return err
+			}
+			// Labels added in the DB for other locales stay.
+			err = db.Exec(`INSERT INTO "`+table.name+`" ("id", "code", "labels") VALUES (?, ?, ?::jsonb)
+				ON CONFLICT ("id") DO UPDATE SET "code" = excluded."code",
+					"labels" = "`+table.name+`"."labels" || excluded."labels"`, e.ID, e.Code, string(raw)).Error
+			if err != nil {
+				return fmt.Errorf("seeding %s: %w", table.name, err)
+			}
+		}
+	}
+
+	var types []uint8
+	if err := db.Table("ReleaseType").Pluck(`"id"`, &types).Error; err != nil {
+		return err
+	}
+	var statuses []string
+	if err := db.Table("MovieStatus").Pluck(`"code"`, &statuses).Error; err != nil {
+		return err
+	}
+	knownReleaseTypes, knownMovieStatuses = map[uint8]bool{}, map[string]bool{}
+	for _, t := range types {
+		knownReleaseTypes[t] = true
+	}
+	for _, s := range statuses {
+		knownMovieStatuses[s] = true
+	}
+	return nil
+}
+
+// validReleaseType reports whether t is in ReleaseType, warning when not.
+func validReleaseType(movieID uint32, t uint8) bool {
+	if knownReleaseTypes == nil || knownReleaseTypes[t] {
+		return true
+	}
+	logger.Warn("dropping release of unknown type", "movieId", movieID, "type", t)
+	return false
+}
+
+// validMovieStatus returns status if it is in MovieStatus, warning and
+// returning nil when not.
+func validMovieStatus(movieID uint32, status *string) *string {
+	if status == nil || knownMovieStatuses == nil || knownMovieStatuses[*status] {
+		return status
+	}
+	logger.Warn("dropping unknown movie status", "movieId", movieID, "status", *status)
+	return nil
+}
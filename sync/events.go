@@ -0,0 +1,91 @@
+package sync
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ReleaseEvent is a yearly date range, such as Christmas, whose releases are
+// tagged for the site's themed collections. An empty Country applies to
+// every region.
+type ReleaseEvent struct {
+	Name    string
+	Country string
+	// Start and End are inclusive "MM-DD" bounds; a range may wrap past the
+	// new year.
+	Start string
+	End   string
+}
+
+const defaultReleaseEvents = "christmas:12-24..12-26,new-year:12-31..01-01,valentines-day:02-14,halloween:10-31"
+
+var monthDayPattern = regexp.MustCompile(`^(0[1-9]|1[0-2])-(0[1-9]|[12][0-9]|3[01])$`)
+
+// parseReleaseEvents parses RELEASE_EVENTS, e.g.
+// "christmas:12-24..12-26,US/independence-day:07-04".
+func parseReleaseEvents(raw string) ([]ReleaseEvent, error) {
+	var events []ReleaseEvent
+	for _, entry := range envSplit(raw) {
+		name, dates, found := strings.Cut(entry, ":")
+		if !found {
+			return nil, fmt.Errorf("RELEASE_EVENTS: %q has no dates", entry)
+		}
+		var event ReleaseEvent
+		if country, rest, scoped := strings.Cut(name, "/"); scoped {
+			event.Country, name = strings.ToUpper(country), rest
+		}
+		event.Name = name
+		event.Start, event.End, found = strings.Cut(dates, "..")
+		if !found {
+			event.End = event.Start
+		}
+		if !monthDayPattern.MatchString(event.Start) || !monthDayPattern.MatchString(event.End) {
+			return nil, fmt.Errorf("RELEASE_EVENTS: %q is not MM-DD or MM-DD..MM-DD", dates)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// tagReleaseEvents replaces the ReleaseEventTag rows of the given movies with
+// one row per local release falling into a configured event.
+func tagReleaseEvents(db *gorm.DB, movieIDs []uint32, events []ReleaseEvent) error {
+	if len(movieIDs) == 0 || len(events) == 0 {
+		return nil
+	}
+	values := make([]string, 0, len(events))
+	var eventArgs []any
+	for _, e := range events {
+		values = append(values, "(?, ?, ?, ?)")
+		eventArgs = append(eventArgs, e.Name, e.Country, e.Start, e.End)
+	}
+
+	for start := 0; start < len(movieIDs); start += denormalizeChunkSize {
+		ids := movieIDs[start:min(start+denormalizeChunkSize, len(movieIDs))]
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(`DELETE FROM "ReleaseEventTag" WHERE "movieId" IN ?`, ids).Error; err != nil {
+				return err
+			}
+			return tx.Exec(`
+				INSERT INTO "ReleaseEventTag" ("movieId", "countryIso", "event", "releaseDate")
+				SELECT DISTINCT rc."movieId", rc."iso31661", e.name, lr."releaseDate"::date
+				FROM "MLocalRelease" lr
+				JOIN "MReleaseCountry" rc ON `+releaseJoin+`
+				JOIN "Movie" m ON m."id" = rc."movieId" AND m."deletedAt" IS NULL
+				JOIN (VALUES `+strings.Join(values, ", ")+`) AS e(name, country, start_day, end_day)
+					ON (e.country = '' OR e.country = rc."iso31661")
+					AND CASE WHEN e.start_day <= e.end_day
+						THEN to_char(lr."releaseDate", 'MM-DD') BETWEEN e.start_day AND e.end_day
+						ELSE to_char(lr."releaseDate", 'MM-DD') >= e.start_day OR to_char(lr."releaseDate", 'MM-DD') <= e.end_day
+					END
+				WHERE rc."movieId" IN ?`, append(eventArgs, ids)...).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
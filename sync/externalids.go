@@ -0,0 +1,73 @@
+package sync
+
+import (
+	"context"
+	"strconv"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ExternalIds is the external_ids sub-resource of a movie.
+type ExternalIds struct {
+	ImdbId      *string `json:"imdb_id"`
+	WikidataId  *string `json:"wikidata_id"`
+	FacebookId  *string `json:"facebook_id"`
+	InstagramId *string `json:"instagram_id"`
+	TwitterId   *string `json:"twitter_id"`
+}
+
+// MovieExternalIds holds a movie's IDs on other sites, written whenever its
+// details came with external_ids. Empty IDs are stored as NULL.
+type MovieExternalIds struct {
+	MovieId     uint32  `gorm:"column:movieId"`
+	ImdbId      *string `gorm:"column:imdbId"`
+	WikidataId  *string `gorm:"column:wikidataId"`
+	FacebookId  *string `gorm:"column:facebookId"`
+	InstagramId *string `gorm:"column:instagramId"`
+	TwitterId   *string `gorm:"column:twitterId"`
+}
+
+func externalIdsRow(movieID uint32, ids ExternalIds) MovieExternalIds {
+	nonEmpty := func(s *string) *string {
+		if s == nil {
+			return nil
+		}
+		return filterEmptyDates(*s)
+	}
+	return MovieExternalIds{
+		MovieId:     movieID,
+		ImdbId:      nonEmpty(ids.ImdbId),
+		WikidataId:  nonEmpty(ids.WikidataId),
+		FacebookId:  nonEmpty(ids.FacebookId),
+		InstagramId: nonEmpty(ids.InstagramId),
+		TwitterId:   nonEmpty(ids.TwitterId),
+	}
+}
+
+func writeExternalIdsRows(db *gorm.DB, dataChannel chan MovieExternalIds, batchSize int) {
+	writeBatches(dataChannel, batchSize, func(batch []MovieExternalIds) error {
+		if err := writeExternalIdsBatch(db, batch); err != nil {
+			return err
+		}
+		checksumWritten("MovieExternalIds", batch)
+		return nil
+	})
+}
+
+func writeExternalIdsBatch(db *gorm.DB, objects []MovieExternalIds) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.WithContext(context.Background()).Clauses(clause.OnConflict{
+			Columns:   conflictTarget("MovieExternalIds"),
+			UpdateAll: true,
+		}).Table("MovieExternalIds").Create(&objects).Error
+		if err != nil {
+			return err
+		}
+		changes := newChangeSet("movieExternalIds")
+		for _, o := range objects {
+			changes.add(strconv.Itoa(int(o.MovieId)), o)
+		}
+		return changes.record(tx)
+	})
+}
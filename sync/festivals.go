@@ -0,0 +1,158 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// Festival editions live in the Festival table, kept in step with the YAML
+// file named by FESTIVALS_FILE when one is configured:
+//
+//	- slug: sundance
+//	  name: Sundance Film Festival
+//	  country: US
+//	  start: 2026-01-22
+//	  end: 2026-02-01
+//	  aliases: [Sundance]
+//
+// A local release is part of an edition's lineup when it falls between
+// start and end, in the festival's country if it has one, and its note
+// mentions the festival's name or an alias.
+
+type Festival struct {
+	Slug    string   `yaml:"slug"`
+	Name    string   `yaml:"name"`
+	Country string   `yaml:"country"`
+	Start   string   `yaml:"start"`
+	End     string   `yaml:"end"`
+	Aliases []string `yaml:"aliases"`
+}
+
+func loadFestivals(path string) ([]Festival, error) {
+	if path == "" {
+		return nil, nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("FESTIVALS_FILE: %w", err)
+	}
+	var festivals []Festival
+	if err := yaml.Unmarshal(raw, &festivals); err != nil {
+		return nil, fmt.Errorf("FESTIVALS_FILE: %w", err)
+	}
+	for i, f := range festivals {
+		if f.Slug == "" || f.Name == "" {
+			return nil, fmt.Errorf("FESTIVALS_FILE: festival %d needs a slug and a name", i+1)
+		}
+		start, err := time.Parse("2006-01-02", f.Start)
+		if err != nil {
+			return nil, fmt.Errorf("FESTIVALS_FILE: %s: start: %w", f.Slug, err)
+		}
+		end, err := time.Parse("2006-01-02", f.End)
+		if err != nil {
+			return nil, fmt.Errorf("FESTIVALS_FILE: %s: end: %w", f.Slug, err)
+		}
+		if end.Before(start) {
+			return nil, fmt.Errorf("FESTIVALS_FILE: %s ends before it starts", f.Slug)
+		}
+		festivals[i].Country = strings.ToUpper(f.Country)
+	}
+	return festivals, nil
+}
+
+// syncFestivals upserts the configured editions into the Festival table.
+func syncFestivals(db *gorm.DB, festivals []Festival) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, f := range festivals {
+			err := tx.Exec(`
+				INSERT INTO "Festival" ("slug", "startDate", "endDate", "name", "countryIso", "aliases")
+				VALUES (?, ?::date, ?::date, ?, NULLIF(?, ''), string_to_array(NULLIF(?, ''), '|'))
+				ON CONFLICT ("slug", "startDate") DO UPDATE SET
+					"endDate" = excluded."endDate", "name" = excluded."name",
+					"countryIso" = excluded."countryIso", "aliases" = excluded."aliases"`,
+				f.Slug, f.Start, f.End, f.Name, f.Country, strings.Join(f.Aliases, "|")).Error
+			if err != nil {
+				return fmt.Errorf("festival %s: %w", f.Slug, err)
+			}
+		}
+		return nil
+	})
+}
+
+// tagFestivalReleases replaces the FestivalScreening rows of the given
+// movies with their releases in a festival lineup.
+func tagFestivalReleases(db *gorm.DB, movieIDs []uint32, festivals []Festival) error {
+	if len(festivals) > 0 {
+		if err := syncFestivals(db, festivals); err != nil {
+			return err
+		}
+	}
+	for start := 0; start < len(movieIDs); start += denormalizeChunkSize {
+		ids := movieIDs[start:min(start+denormalizeChunkSize, len(movieIDs))]
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(`DELETE FROM "FestivalScreening" WHERE "movieId" IN ?`, ids).Error; err != nil {
+				return err
+			}
+			return tx.Exec(`
+				INSERT INTO "FestivalScreening" ("festivalSlug", "festivalStart", "movieId", "countryIso", "releaseDate")
+				SELECT DISTINCT f."slug", f."startDate", rc."movieId", rc."iso31661", lr."releaseDate"::date
+				FROM "MLocalRelease" lr
+				JOIN "MReleaseCountry" rc ON `+releaseJoin+`
+				JOIN "Movie" m ON m."id" = rc."movieId" AND m."deletedAt" IS NULL
+				JOIN "Festival" f ON lr."releaseDate"::date BETWEEN f."startDate" AND f."endDate"
+					AND (f."countryIso" IS NULL OR f."countryIso" = rc."iso31661")
+				WHERE rc."movieId" IN ? AND lr."note" IS NOT NULL
+					AND EXISTS (
+						SELECT 1 FROM unnest(array_append(COALESCE(f."aliases", '{}'), f."name")) AS a(alias)
+						WHERE a.alias <> '' AND position(lower(a.alias) in lower(lr."note")) > 0
+					)`, ids).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type festivalLineup struct {
+	Slug      string
+	StartDate time.Time `gorm:"column:startDate"`
+	Lineup    string
+}
+
+// exportStaticFestivals writes festivals/{slug}/{startDate}.json with the
+// lineup of every festival edition.
+func exportStaticFestivals(db *gorm.DB, dir string) error {
+	var lineups []festivalLineup
+	err := db.Raw(`SELECT f."slug", f."startDate", json_build_object(
+			'name', f."name",
+			'country', f."countryIso",
+			'start', f."startDate",
+			'end', f."endDate",
+			'movies', COALESCE((
+				SELECT json_agg(json_build_object(
+					'movieId', m."id", 'title', m."title", 'posterPath', m."posterPath",
+					'country', fs."countryIso", 'date', fs."releaseDate"
+				) ORDER BY fs."releaseDate", m."title")
+				FROM "FestivalScreening" fs JOIN "Movie" m ON m."id" = fs."movieId" AND m."deletedAt" IS NULL
+				WHERE fs."festivalSlug" = f."slug" AND fs."festivalStart" = f."startDate"
+			), '[]'::json)
+		)::text AS "lineup"
+		FROM "Festival" f`).Scan(&lineups).Error
+	if err != nil {
+		return err
+	}
+	for _, l := range lineups {
+		path := filepath.Join(dir, "festivals", l.Slug, l.StartDate.Format("2006-01-02")+".json")
+		if err := writeFileAtomic(path, []byte(l.Lineup)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
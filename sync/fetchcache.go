@@ -0,0 +1,143 @@
+package sync
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// fetchCache is a local SQLite file remembering when each movie's details
+// were last fetched and written, and a hash of the payload. Movie syncs skip
+// movies fetched within FETCH_CACHE_TTL, so consecutive runs on the same day
+// don't fetch them again. It is independent of the Postgres target, so a
+// restored or rebuilt database doesn't reset it.
+type fetchCache struct {
+	db  *sql.DB
+	ttl time.Duration
+
+	mu sync.Mutex
+	// pending holds the hashes of movies fetched but not yet written.
+	pending map[uint32]string
+}
+
+// movieCache is the cache of the current command, nil when disabled.
+var movieCache *fetchCache
+
+// openFetchCache opens FETCH_CACHE_FILE if FETCH_CACHE_TTL is set. A cache
+// that can't be opened is reported and left out.
+func openFetchCache() error {
+	movieCache = nil
+	if cfg.FetchCacheTTL <= 0 {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.FetchCacheFile), 0o755); err != nil {
+		return err
+	}
+	db, err := sql.Open("sqlite", cfg.FetchCacheFile)
+	if err == nil {
+		_, err = db.Exec(`CREATE TABLE IF NOT EXISTS fetched (
+			movie_id INTEGER PRIMARY KEY,
+			fetched_at INTEGER NOT NULL,
+			payload_hash TEXT NOT NULL
+		)`)
+	}
+	if err != nil {
+		outputf("Fetch cache %s unavailable, fetching every movie: %v\n", cfg.FetchCacheFile, err)
+		if db != nil {
+			db.Close()
+		}
+		return nil
+	}
+	// Writers would otherwise fail with SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+	movieCache = &fetchCache{db: db, ttl: cfg.FetchCacheTTL, pending: map[uint32]string{}}
+	return nil
+}
+
+func closeFetchCache() {
+	if movieCache != nil {
+		movieCache.db.Close()
+		movieCache = nil
+	}
+}
+
+// fresh reports whether id was fetched and written within the TTL.
+func (c *fetchCache) fresh(id uint32) bool {
+	if c == nil {
+		return false
+	}
+	var fetchedAt int64
+	err := c.db.QueryRow(`SELECT fetched_at FROM fetched WHERE movie_id = ?`, id).Scan(&fetchedAt)
+	if err != nil {
+		return false
+	}
+	return time.Since(time.Unix(fetchedAt, 0)) < c.ttl
+}
+
+// fetched remembers the payload fetched for id until commit.
+func (c *fetchCache) fetched(id uint32, payload []byte) {
+	if c == nil {
+		return
+	}
+	sum := sha256.Sum256(payload)
+	c.mu.Lock()
+	c.pending[id] = hex.EncodeToString(sum[:])
+	c.mu.Unlock()
+}
+
+// commit records the movies of ids as fetched now. Only movies whose rows
+// were written are passed, so a failed write is fetched again next run.
+func (c *fetchCache) commit(ids []uint32) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tx, err := c.db.Begin()
+	if err != nil {
+		outputln("Error updating fetch cache:", err)
+		return
+	}
+	now := time.Now().Unix()
+	for _, id := range ids {
+		hash, ok := c.pending[id]
+		if !ok {
+			continue
+		}
+		delete(c.pending, id)
+		_, err := tx.Exec(`INSERT INTO fetched (movie_id, fetched_at, payload_hash) VALUES (?, ?, ?)
+			ON CONFLICT (movie_id) DO UPDATE SET fetched_at = excluded.fetched_at, payload_hash = excluded.payload_hash`,
+			id, now, hash)
+		if err != nil {
+			tx.Rollback()
+			outputln("Error updating fetch cache:", err)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		outputln("Error updating fetch cache:", err)
+	}
+}
+
+// stale returns the ids not fetched within the TTL.
+func (c *fetchCache) stale(ids []uint32) []uint32 {
+	if c == nil {
+		return ids
+	}
+	out := make([]uint32, 0, len(ids))
+	for _, id := range ids {
+		if !c.fresh(id) {
+			out = append(out, id)
+		}
+	}
+	if skipped := len(ids) - len(out); skipped > 0 {
+		outputf("Skipping %d movies fetched in the last %s\n", skipped, c.ttl)
+	}
+	return out
+}
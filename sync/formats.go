@@ -0,0 +1,26 @@
+package sync
+
+import "regexp"
+
+// Format hints in release notes and titles, such as "IMAX 3D", "70mm
+// presentation" or "Dolby Cinema", badge special-format screenings.
+var (
+	imaxPattern   = regexp.MustCompile(`(?i)\bimax\b`)
+	threeDPattern = regexp.MustCompile(`(?i)\b(3-?d|real ?d)\b`)
+	film70Pattern = regexp.MustCompile(`(?i)\b70\s?mm\b`)
+	dolbyPattern  = regexp.MustCompile(`(?i)\bdolby\b`)
+)
+
+// applyFormats sets the format flags of a local release named in any of
+// texts. Flags already set stay set.
+func applyFormats(lr *MLocalRelease, texts ...string) {
+	for _, text := range texts {
+		if text == "" {
+			continue
+		}
+		lr.IsImax = lr.IsImax || imaxPattern.MatchString(text)
+		lr.Is3D = lr.Is3D || threeDPattern.MatchString(text)
+		lr.Is70mm = lr.Is70mm || film70Pattern.MatchString(text)
+		lr.IsDolby = lr.IsDolby || dolbyPattern.MatchString(text)
+	}
+}
@@ -0,0 +1,155 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// With FRESHNESS_MANIFEST on, every run ends by publishing a small JSON
+// document saying when each table was last written, so the website can
+// show how old its data is without querying the DB. It goes to
+// freshness.json in the object store and to the "freshness" key in Redis,
+// whichever are configured. Tables a run didn't write keep the time of the
+// previous manifest.
+
+const (
+	freshnessObjectKey = "freshness.json"
+	freshnessRedisKey  = "freshness"
+)
+
+type freshnessManifest struct {
+	RunId       uint64                    `json:"runId"`
+	Mode        string                    `json:"mode"`
+	Status      string                    `json:"status"`
+	GeneratedAt time.Time                 `json:"generatedAt"`
+	Tables      map[string]tableFreshness `json:"tables"`
+}
+
+type tableFreshness struct {
+	LastSyncedAt time.Time `json:"lastSyncedAt"`
+	LastRunId    uint64    `json:"lastRunId"`
+	// Written is how many rows the run that last synced the table wrote.
+	Written int `json:"written"`
+	// Rows is Postgres' estimate of the rows in the table.
+	Rows int64 `json:"rows"`
+}
+
+// tableRowsWritten returns the rows written so far by table.
+func tableRowsWritten() map[string]int {
+	writeStats.Lock()
+	defer writeStats.Unlock()
+	rows := make(map[string]int, len(writeStats.tables))
+	for table, stats := range writeStats.tables {
+		rows[table] = stats.Rows
+	}
+	return rows
+}
+
+// publishFreshness publishes the manifest of run, given the rows written by
+// table before it started.
+func publishFreshness(db *gorm.DB, run SyncRun, writtenBefore map[string]int) error {
+	ctx := context.Background()
+	var store objectStore
+	if cfg.ObjectStoreURL != "" {
+		var err error
+		if store, err = newObjectStore(cfg.ObjectStoreURL); err != nil {
+			return err
+		}
+	}
+	var rdb *redis.Client
+	if cfg.RedisURL != "" {
+		opts, err := redis.ParseURL(cfg.RedisURL)
+		if err != nil {
+			return fmt.Errorf("parsing REDIS_URL: %w", err)
+		}
+		rdb = redis.NewClient(opts)
+		defer rdb.Close()
+	}
+
+	prev, err := loadFreshness(ctx, store, rdb)
+	if err != nil {
+		return fmt.Errorf("reading previous manifest: %w", err)
+	}
+	manifest := freshnessManifest{RunId: run.ID, Mode: run.Mode, GeneratedAt: time.Now(), Tables: prev.Tables}
+	if run.Status != nil {
+		manifest.Status = *run.Status
+	}
+	if manifest.Tables == nil {
+		manifest.Tables = map[string]tableFreshness{}
+	}
+	synced := manifest.GeneratedAt
+	if run.FinishedAt != nil {
+		synced = *run.FinishedAt
+	}
+	for table, rows := range tableRowsWritten() {
+		if written := rows - writtenBefore[table]; written > 0 {
+			manifest.Tables[table] = tableFreshness{LastSyncedAt: synced, LastRunId: run.ID, Written: written}
+		}
+	}
+
+	var estimates []struct {
+		Table string `gorm:"column:table"`
+		Rows  int64  `gorm:"column:rows"`
+	}
+	err = db.Raw(`SELECT c."relname" AS "table", GREATEST(c."reltuples", 0)::bigint AS "rows"
+		FROM pg_class c JOIN pg_namespace n ON n."oid" = c."relnamespace"
+		WHERE n."nspname" = current_schema() AND c."relkind" = 'r' AND c."relname" IN ?`, managedTables).Scan(&estimates).Error
+	if err != nil {
+		return fmt.Errorf("estimating table sizes: %w", err)
+	}
+	for _, e := range estimates {
+		if t, ok := manifest.Tables[e.Table]; ok {
+			t.Rows = e.Rows
+			manifest.Tables[e.Table] = t
+		}
+	}
+
+	body, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	if store != nil {
+		if err := store.Put(ctx, freshnessObjectKey, bytes.NewReader(body)); err != nil {
+			return fmt.Errorf("writing %s: %w", freshnessObjectKey, err)
+		}
+	}
+	if rdb != nil {
+		if err := rdb.Set(ctx, freshnessRedisKey, body, 0).Err(); err != nil {
+			return fmt.Errorf("setting Redis key %s: %w", freshnessRedisKey, err)
+		}
+	}
+	outputf("Published freshness of %d tables\n", len(manifest.Tables))
+	return nil
+}
+
+// loadFreshness reads the last published manifest, preferring the object
+// store. A missing manifest is an empty one.
+func loadFreshness(ctx context.Context, store objectStore, rdb *redis.Client) (freshnessManifest, error) {
+	var manifest freshnessManifest
+	if store != nil {
+		r, err := store.Get(ctx, freshnessObjectKey)
+		if isNotFound(err) {
+			return manifest, nil
+		}
+		if err != nil {
+			return manifest, err
+		}
+		defer r.Close()
+		return manifest, json.NewDecoder(r).Decode(&manifest)
+	}
+	body, err := rdb.Get(ctx, freshnessRedisKey).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return manifest, nil
+	}
+	if err != nil {
+		return manifest, err
+	}
+	return manifest, json.Unmarshal(body, &manifest)
+}
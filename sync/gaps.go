@@ -0,0 +1,134 @@
+package sync
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"wiitco-db-movies-cron/releasefmt"
+)
+
+// TMDB release types.
+const (
+	releasePremiere          = 1
+	releaseTheatricalLimited = 2
+	releaseTheatrical        = 3
+	releaseDigital           = 4
+	releasePhysical          = 5
+	releaseTV                = 6
+)
+
+type releaseGap struct {
+	MovieId        uint32    `gorm:"column:movieId"`
+	Title          string    `gorm:"column:title"`
+	CountryIso     string    `gorm:"column:countryIso"`
+	TheatricalDate time.Time `gorm:"column:theatricalDate"`
+	Popularity     float64   `gorm:"column:popularity"`
+}
+
+// runGapReport lists movies whose theatrical release in a configured region
+// is more than --months old without any digital or physical release there,
+// so editors can chase the missing home-release dates.
+func runGapReport(db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("gap-report", flag.ContinueOnError)
+	months := fs.Int("months", 6, "minimum age of the theatrical release")
+	limit := fs.Int("limit", 200, "maximum number of movies to report")
+	format := fs.String("format", "csv", `"csv" or "slack"`)
+	out := fs.String("out", "", "CSV output file (defaults to stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var gaps []releaseGap
+	err := db.Raw(`SELECT m."id" AS "movieId", m."title", rc."iso31661" AS "countryIso",
+			min(lr."releaseDate") AS "theatricalDate", m."popularity"
+		FROM "MLocalRelease" lr
+		JOIN "MReleaseCountry" rc ON `+releaseJoin+`
+		JOIN "Movie" m ON m."id" = rc."movieId"
+		WHERE lr."type" IN ? AND rc."iso31661" IN ?
+			AND NOT EXISTS (
+				SELECT 1 FROM "MLocalRelease" h
+				JOIN "MReleaseCountry" hc ON `+strings.NewReplacer("rc.", "hc.", "lr.", "h.").Replace(releaseJoin)+`
+				WHERE hc."movieId" = rc."movieId" AND hc."iso31661" = rc."iso31661" AND h."type" IN ?
+			)
+		GROUP BY m."id", m."title", rc."iso31661", m."popularity"
+		HAVING min(lr."releaseDate") < now() - make_interval(months => ?)
+		ORDER BY m."popularity" DESC
+		LIMIT ?`,
+		[]int{releaseTheatricalLimited, releaseTheatrical}, cfg.regionCountries(),
+		[]int{releaseDigital, releasePhysical}, *months, *limit).Scan(&gaps).Error
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "csv":
+		var w io.Writer = os.Stdout
+		if *out != "" {
+			f, err := os.Create(*out)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		return writeGapsCSV(w, gaps)
+	case "slack":
+		if cfg.SlackWebhookURL == "" {
+			return errors.New("SLACK_WEBHOOK_URL is required for --format slack")
+		}
+		return postGapsToSlack(cfg.SlackWebhookURL, gaps, *months)
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+}
+
+func writeGapsCSV(w io.Writer, gaps []releaseGap) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"movieId", "title", "country", "theatricalDate", "popularity"})
+	for _, g := range gaps {
+		cw.Write([]string{
+			strconv.Itoa(int(g.MovieId)),
+			g.Title,
+			g.CountryIso,
+			g.TheatricalDate.Format("2006-01-02"),
+			strconv.FormatFloat(g.Popularity, 'f', 1, 64),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func postGapsToSlack(webhookURL string, gaps []releaseGap, months int) error {
+	var text strings.Builder
+	fmt.Fprintf(&text, "*%d movies without a home release %d months after theatrical*\n", len(gaps), months)
+	for _, g := range gaps {
+		theatrical := releasefmt.Release{Country: g.CountryIso, Date: g.TheatricalDate}
+		fmt.Fprintf(&text, "• <https://www.themoviedb.org/movie/%d|%s> (%s, in cinemas %s)\n",
+			g.MovieId, g.Title, g.CountryIso, releasefmt.Format(theatrical.Day(time.UTC), "en"))
+	}
+	body, err := json.Marshal(map[string]string{"text": text.String()})
+	if err != nil {
+		return err
+	}
+	res, err := http.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected HTTP status code: %d", res.StatusCode)
+	}
+	return nil
+}
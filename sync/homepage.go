@@ -0,0 +1,89 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// TMDB homepages are free text: some lack a scheme, some carry campaign
+// parameters, a few aren't web links at all. Only http(s) URLs on a domain
+// name are stored, with the host lowercased and in punycode and the
+// tracking parameters removed, so the site can render them as links as is.
+
+// trackingParams are query parameters that only identify a campaign or
+// click; any utm_* parameter is one too.
+var trackingParams = map[string]bool{
+	"fbclid": true, "gclid": true, "dclid": true, "gbraid": true, "wbraid": true, "msclkid": true,
+	"yclid": true, "igshid": true, "mc_cid": true, "mc_eid": true, "_ga": true, "_gl": true,
+}
+
+func isTrackingParam(key string) bool {
+	key = strings.ToLower(key)
+	return trackingParams[key] || strings.HasPrefix(key, "utm_")
+}
+
+// normalizeHomepage returns the canonical form of a homepage URL, or an
+// error if it isn't one the site may link to. An empty homepage stays
+// empty; one without a scheme is taken as https.
+func normalizeHomepage(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+	u, err := url.Parse(raw)
+	if err == nil && u.Scheme == "" {
+		u, err = url.Parse("https://" + strings.TrimPrefix(raw, "//"))
+	}
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme = strings.ToLower(u.Scheme); u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("scheme %q is not http or https", u.Scheme)
+	}
+	if u.User != nil {
+		return "", errors.New("URL carries credentials")
+	}
+	host, err := idna.Lookup.ToASCII(strings.TrimSuffix(u.Hostname(), "."))
+	if err != nil {
+		return "", fmt.Errorf("host %q: %w", u.Hostname(), err)
+	}
+	if !strings.Contains(host, ".") || net.ParseIP(host) != nil {
+		return "", fmt.Errorf("host %q is not a domain name", u.Hostname())
+	}
+	if port := u.Port(); port != "" {
+		host = net.JoinHostPort(host, port)
+	}
+	u.Host = host
+
+	// The query is filtered in place rather than re-encoded, keeping the
+	// order and encoding of the parameters the site expects.
+	if u.RawQuery != "" {
+		var kept []string
+		for _, param := range strings.Split(u.RawQuery, "&") {
+			key, _, _ := strings.Cut(param, "=")
+			if k, err := url.QueryUnescape(key); param == "" || err == nil && isTrackingParam(k) {
+				continue
+			}
+			kept = append(kept, param)
+		}
+		u.RawQuery = strings.Join(kept, "&")
+	}
+	u.ForceQuery = false
+	return u.String(), nil
+}
+
+// validHomepage returns the normalized homepage, warning and returning nil
+// when it can't be linked to.
+func validHomepage(movieID uint32, raw string) *string {
+	homepage, err := normalizeHomepage(raw)
+	if err != nil {
+		logger.Warn("dropping invalid homepage", "movieId", movieID, "homepage", raw, "err", err)
+		return nil
+	}
+	return filterEmptyDates(homepage)
+}
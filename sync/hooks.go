@@ -0,0 +1,116 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Lifecycle events hooks can attach to.
+const (
+	hookAfterMovieParsed = "afterMovieParsed"
+	hookBeforeBatchWrite = "beforeBatchWrite"
+	hookAfterRun         = "afterRun"
+)
+
+// hookPayload is what a hook receives. Only the fields of its event are
+// set: Movie for afterMovieParsed, Table and Rows (a pointer to the batch
+// slice) for beforeBatchWrite and Run for afterRun.
+type hookPayload struct {
+	Event string   `json:"event"`
+	Movie *Movie   `json:"movie,omitempty"`
+	Table string   `json:"table,omitempty"`
+	Rows  any      `json:"rows,omitempty"`
+	Run   *SyncRun `json:"run,omitempty"`
+}
+
+// hookFunc is a hook compiled into the binary. It may modify the payload's
+// movie or rows in place; an error drops the movie or fails the batch.
+type hookFunc func(p *hookPayload) error
+
+// errVetoed is wrapped by afterMovieParsed hooks that drop a movie on
+// purpose, which unlike other hook errors doesn't count as a failed fetch.
+var errVetoed = errors.New("vetoed")
+
+// hookVetoExitCode is the exit status an external afterMovieParsed hook
+// uses to veto the movie; its stderr is kept as the reason.
+const hookVetoExitCode = 3
+
+// goHooks are registered from init functions of site-specific files, so
+// enrichment can live next to the pipeline without patching it.
+var goHooks = map[string][]hookFunc{}
+
+func registerHook(event string, fn hookFunc) {
+	goHooks[event] = append(goHooks[event], fn)
+}
+
+// runHooks runs the Go hooks of the payload's event, then its external
+// command from HOOK_<EVENT>. The command gets the payload as JSON on stdin.
+// For afterMovieParsed a non-empty stdout replaces the movie and exit
+// status 3 vetoes it; other events are notifications, where only the exit
+// status counts.
+func runHooks(p *hookPayload) error {
+	for _, fn := range goHooks[p.Event] {
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	command := cfg.HookCommands[p.Event]
+	if command == "" {
+		return nil
+	}
+	in, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.HookTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdin = bytes.NewReader(in)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if p.Event == hookAfterMovieParsed && errors.As(err, &exitErr) && exitErr.ExitCode() == hookVetoExitCode {
+		return fmt.Errorf("%w: %s", errVetoed, strings.TrimSpace(stderr.String()))
+	}
+	if err != nil {
+		return fmt.Errorf("%s hook: %w: %s", p.Event, err, strings.TrimSpace(stderr.String()))
+	}
+	if p.Event == hookAfterMovieParsed && len(bytes.TrimSpace(out)) > 0 {
+		var movie Movie
+		if err := json.Unmarshal(out, &movie); err != nil {
+			return fmt.Errorf("%s hook: reading movie: %w", p.Event, err)
+		}
+		*p.Movie = movie
+	}
+	return nil
+}
+
+func hasHooks(event string) bool {
+	return len(goHooks[event]) > 0 || cfg.HookCommands[event] != ""
+}
+
+// registerBatchHooks runs the beforeBatchWrite hooks ahead of every GORM
+// insert. A failing hook fails the batch, which is then counted and rolled
+// back like any other write error.
+func registerBatchHooks(db *gorm.DB) error {
+	if !hasHooks(hookBeforeBatchWrite) {
+		return nil
+	}
+	return db.Callback().Create().Before("gorm:create").Register("wiitco:before_batch_write", func(tx *gorm.DB) {
+		if tx.Error != nil {
+			return
+		}
+		p := hookPayload{Event: hookBeforeBatchWrite, Table: tx.Statement.Table, Rows: tx.Statement.Dest}
+		if err := runHooks(&p); err != nil {
+			tx.AddError(err)
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package sync
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// rebuildHotReleases precomputes, for every configured region, the movies
+// releasing within each look-ahead window measured in the region's own
+// timezone. A release counts from local midnight of its date, so titles out
+// today stay listed until the day is over.
+func rebuildHotReleases(db *gorm.DB, regions []Region, windows []int) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`DELETE FROM "HotRelease"`).Error; err != nil {
+			return err
+		}
+		for _, region := range regions {
+			for _, hours := range windows {
+				err := tx.Exec(`
+					INSERT INTO "HotRelease" ("countryIso", "windowHours", "movieId", "releaseAt", "type")
+					SELECT DISTINCT ON (rc."movieId")
+						rc."iso31661", ?, rc."movieId",
+						(lr."releaseDate"::date)::timestamp AT TIME ZONE ?,
+						lr."type"
+					FROM "MLocalRelease" lr
+					JOIN "MReleaseCountry" rc ON `+releaseJoin+`
+					JOIN "Movie" m ON m."id" = rc."movieId" AND m."deletedAt" IS NULL
+					WHERE rc."iso31661" = ?
+						AND (lr."releaseDate"::date)::timestamp AT TIME ZONE ? >= date_trunc('day', now() AT TIME ZONE ?) AT TIME ZONE ?
+						AND (lr."releaseDate"::date)::timestamp AT TIME ZONE ? < now() + make_interval(hours => ?)
+					ORDER BY rc."movieId", lr."releaseDate", lr."type"
+				`, hours, tz(region), region.Country, tz(region), tz(region), tz(region), tz(region), hours).Error
+				if err != nil {
+					return fmt.Errorf("region %s, %dh window: %w", region.Country, hours, err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func tz(region Region) string {
+	return region.Location.String()
+}
@@ -0,0 +1,122 @@
+package sync
+
+import (
+	"bufio"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const (
+	imdbRatingsURL       = "https://datasets.imdbws.com/title.ratings.tsv.gz"
+	imdbRatingsBatchSize = 1000
+)
+
+type imdbRating struct {
+	ImdbId string
+	Rating float64
+	Votes  int
+}
+
+// runImdbRatings downloads IMDb's title.ratings dump and bulk-updates the
+// rating columns of every movie with a known imdbId.
+func runImdbRatings(db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("imdb-ratings", flag.ContinueOnError)
+	url := fs.String("url", imdbRatingsURL, "location of title.ratings.tsv.gz")
+	file := fs.String("file", "", "read a local title.ratings.tsv.gz instead of downloading")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var known []string
+	if err := db.Table("Movie").Where(`"imdbId" IS NOT NULL`).Pluck(`"imdbId"`, &known).Error; err != nil {
+		return err
+	}
+	wanted := make(map[string]bool, len(known))
+	for _, id := range known {
+		wanted[id] = true
+	}
+
+	var src io.ReadCloser
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		src = f
+	} else {
+		res, err := http.Get(*url)
+		if err != nil {
+			return err
+		}
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			return fmt.Errorf("unexpected HTTP status code: %d", res.StatusCode)
+		}
+		src = res.Body
+	}
+	defer src.Close()
+
+	gz, err := gzip.NewReader(src)
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(gz)
+	scanner.Scan() // header: tconst, averageRating, numVotes
+
+	updated := 0
+	var batch []imdbRating
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 3 || !wanted[fields[0]] {
+			continue
+		}
+		rating, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			continue
+		}
+		votes, err := strconv.Atoi(fields[2])
+		if err != nil {
+			continue
+		}
+		batch = append(batch, imdbRating{ImdbId: fields[0], Rating: rating, Votes: votes})
+		if len(batch) >= imdbRatingsBatchSize {
+			if err := writeImdbRatingsBatch(db, batch); err != nil {
+				return err
+			}
+			updated += len(batch)
+			batch = batch[:0]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(batch) > 0 {
+		if err := writeImdbRatingsBatch(db, batch); err != nil {
+			return err
+		}
+		updated += len(batch)
+	}
+
+	outputf("Updated IMDb ratings for %d movies\n", updated)
+	return nil
+}
+
+func writeImdbRatingsBatch(db *gorm.DB, ratings []imdbRating) error {
+	values := make([]string, 0, len(ratings))
+	args := make([]any, 0, len(ratings)*3)
+	for _, r := range ratings {
+		values = append(values, "(?, ?::real, ?::integer)")
+		args = append(args, r.ImdbId, r.Rating, r.Votes)
+	}
+	return db.Exec(`UPDATE "Movie" m SET "imdbRating" = v.rating, "imdbVotes" = v.votes
+		FROM (VALUES `+strings.Join(values, ", ")+`) AS v(imdb, rating, votes)
+		WHERE m."imdbId" = v.imdb`, args...).Error
+}
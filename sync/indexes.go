@@ -0,0 +1,135 @@
+package sync
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// requiredIndex is an index one of the site's hot queries depends on. Any
+// existing index whose leading columns match Columns satisfies it.
+type requiredIndex struct {
+	Table   string
+	Columns []string
+	Reason  string
+}
+
+func (r requiredIndex) name() string {
+	return r.Table + "_" + strings.Join(r.Columns, "_") + "_idx"
+}
+
+func requiredIndexes() []requiredIndex {
+	return []requiredIndex{
+		{"Movie", []string{"primaryReleaseDate"}, "upcoming and recent listings"},
+		{"Movie", []string{"popularity"}, "popular listings"},
+		{"Movie", []string{"slug"}, "movie pages"},
+		{"MovieActor", []string{"actorId"}, "person filmographies"},
+		{"MovieDirector", []string{"directorId"}, "person filmographies"},
+		{"MovieGenre", []string{"movieId"}, "movie pages"},
+		{"MovieCountry", []string{"movieId"}, "movie pages"},
+		{"MReleaseCountry", []string{"iso31661", "movieId"}, "release calendar by country"},
+		{"MLocalRelease", []string{"iso31661", "releaseDate"}, "release calendar by country"},
+	}
+}
+
+// runCheckIndexes reports which required indexes are missing and, with
+// --fix, creates them concurrently so the site keeps serving meanwhile.
+func runCheckIndexes(db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("check-indexes", flag.ContinueOnError)
+	fix := fs.Bool("fix", false, "create missing indexes")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	missing := 0
+	for _, req := range requiredIndexes() {
+		columns, err := tableColumns(db, req.Table)
+		if err != nil {
+			return err
+		}
+		absent := ""
+		for _, c := range req.Columns {
+			if !columns[c] {
+				absent = c
+				break
+			}
+		}
+		if absent != "" {
+			outputf("SKIP %s(%s): column %q does not exist\n", req.Table, strings.Join(req.Columns, ", "), absent)
+			continue
+		}
+
+		existing, err := tableIndexColumns(db, req.Table)
+		if err != nil {
+			return err
+		}
+		if covered := coveringIndex(existing, req.Columns); covered != "" {
+			outputf("OK   %s(%s) via %s\n", req.Table, strings.Join(req.Columns, ", "), covered)
+			continue
+		}
+
+		missing++
+		outputf("MISS %s(%s) needed for %s\n", req.Table, strings.Join(req.Columns, ", "), req.Reason)
+		if !*fix {
+			continue
+		}
+		quoted := make([]string, len(req.Columns))
+		for i, c := range req.Columns {
+			quoted[i] = `"` + c + `"`
+		}
+		stmt := fmt.Sprintf(`CREATE INDEX CONCURRENTLY IF NOT EXISTS "%s" ON "%s" (%s)`,
+			req.name(), req.Table, strings.Join(quoted, ", "))
+		if err := db.Exec(stmt).Error; err != nil {
+			return fmt.Errorf("creating %s: %w", req.name(), err)
+		}
+		outputf("     created %s\n", req.name())
+	}
+
+	if missing > 0 && !*fix {
+		return fmt.Errorf("%d required indexes missing; rerun with --fix to create them", missing)
+	}
+	return nil
+}
+
+func tableColumns(db *gorm.DB, table string) (map[string]bool, error) {
+	var names []string
+	err := db.Raw(`SELECT column_name FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = ?`, table).Scan(&names).Error
+	columns := make(map[string]bool, len(names))
+	for _, n := range names {
+		columns[n] = true
+	}
+	return columns, err
+}
+
+type indexColumns struct {
+	Name    string
+	Columns string
+}
+
+// tableIndexColumns lists the valid indexes on table with their key columns
+// joined by commas, in index order.
+func tableIndexColumns(db *gorm.DB, table string) ([]indexColumns, error) {
+	var out []indexColumns
+	err := db.Raw(`SELECT ic.relname AS name, string_agg(a.attname, ',' ORDER BY k.ord) AS columns
+		FROM pg_index i
+		JOIN pg_class t ON t.oid = i.indrelid
+		JOIN pg_class ic ON ic.oid = i.indexrelid
+		JOIN LATERAL unnest(i.indkey) WITH ORDINALITY AS k(attnum, ord) ON true
+		JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum
+		WHERE t.relname = ? AND t.relnamespace = current_schema()::regnamespace AND i.indisvalid
+		GROUP BY ic.relname`, table).Scan(&out).Error
+	return out, err
+}
+
+func coveringIndex(existing []indexColumns, columns []string) string {
+	want := strings.Join(columns, ",")
+	for _, idx := range existing {
+		if idx.Columns == want || strings.HasPrefix(idx.Columns, want+",") {
+			return idx.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,83 @@
+package sync
+
+import (
+	"context"
+	"strconv"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TMDB keywords are kept in Keyword, linked to movies by MovieKeyword. A
+// movie's links are replaced whenever its details came with the keywords
+// sub-resource, so keywords TMDB removed go too; movies fetched without it
+// keep theirs.
+
+type KeywordDB struct {
+	ID   uint32
+	Name string
+}
+
+type MovieKeyword struct {
+	MovieId   uint32 `gorm:"column:movieId"`
+	KeywordId uint32 `gorm:"column:keywordId"`
+}
+
+// MovieKeywords are the keywords of one movie.
+type MovieKeywords struct {
+	MovieId  uint32
+	Keywords []Keyword
+}
+
+func writeMovieKeywordRows(db *gorm.DB, dataChannel chan MovieKeywords, batchSize int) {
+	writeBatches(dataChannel, batchSize, func(batch []MovieKeywords) error {
+		return writeMovieKeywordsBatch(db, batch)
+	})
+}
+
+func writeMovieKeywordsBatch(db *gorm.DB, objects []MovieKeywords) error {
+	ids := make([]uint32, 0, len(objects))
+	var keywords []KeywordDB
+	var links []MovieKeyword
+	seenKeyword, seenLink := map[uint32]bool{}, map[string]bool{}
+	for _, o := range objects {
+		ids = append(ids, o.MovieId)
+		for _, k := range o.Keywords {
+			if !seenKeyword[k.ID] {
+				seenKeyword[k.ID] = true
+				keywords = append(keywords, KeywordDB{ID: k.ID, Name: k.Name})
+			}
+			if key := pairKey(o.MovieId, k.ID); !seenLink[key] {
+				seenLink[key] = true
+				links = append(links, MovieKeyword{MovieId: o.MovieId, KeywordId: k.ID})
+			}
+		}
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if len(keywords) > 0 {
+			err := tx.WithContext(context.Background()).Clauses(clause.OnConflict{
+				Columns:   conflictTarget("Keyword"),
+				DoUpdates: clause.AssignmentColumns([]string{"name"}),
+			}).Table("Keyword").Create(&keywords).Error
+			if err != nil {
+				return err
+			}
+		}
+		if err := tx.WithContext(context.Background()).Table("MovieKeyword").Where(`"movieId" IN ?`, ids).Delete(&MovieKeyword{}).Error; err != nil {
+			return err
+		}
+		if len(links) > 0 {
+			if err := tx.WithContext(context.Background()).Table("MovieKeyword").Create(&links).Error; err != nil {
+				return err
+			}
+		}
+		changes := newChangeSet("movieKeywords")
+		for _, id := range ids {
+			changes.touch(strconv.Itoa(int(id)))
+		}
+		for _, r := range links {
+			changes.add(strconv.Itoa(int(r.MovieId)), r)
+		}
+		return changes.record(tx)
+	})
+}
@@ -0,0 +1,41 @@
+package sync
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// localTitlesByCountry picks each country's title among TMDB's alternative
+// titles, preferring the first one without a type such as "working title".
+func localTitlesByCountry(titles []AlternativeTitle) map[string]*string {
+	out := map[string]*string{}
+	for _, untyped := range []bool{true, false} {
+		for _, t := range titles {
+			if t.Title == "" || (t.Type == "") != untyped {
+				continue
+			}
+			if _, ok := out[t.ISO31661]; !ok {
+				title := t.Title
+				out[t.ISO31661] = &title
+			}
+		}
+	}
+	return out
+}
+
+// localTitleConflict upserts release countries, updating the local title
+// unless the incoming row has none, as rows from release_dates-only fetches
+// don't.
+func localTitleConflict() clause.OnConflict {
+	target := conflictTarget("MReleaseCountry")
+	if len(target) == 0 {
+		return clause.OnConflict{DoNothing: true}
+	}
+	return clause.OnConflict{
+		Columns: target,
+		DoUpdates: clause.Set{{
+			Column: clause.Column{Name: "localTitle"},
+			Value:  gorm.Expr(`COALESCE(excluded."localTitle", "MReleaseCountry"."localTitle")`),
+		}},
+	}
+}
@@ -0,0 +1,100 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// logger is the structured logger shared by the cron. It is replaced by
+// newLogger once the configuration is loaded.
+var logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+// outputf and outputln write the cron's console output: to stdout for the
+// binary, or as info records of Config.Logger for library callers.
+func outputf(format string, args ...any) {
+	if cfg.Logger != nil {
+		cfg.Logger.Info(strings.TrimSuffix(fmt.Sprintf(format, args...), "\n"))
+		return
+	}
+	fmt.Printf(format, args...)
+}
+
+func outputln(args ...any) {
+	if cfg.Logger != nil {
+		cfg.Logger.Info(strings.TrimSuffix(fmt.Sprintln(args...), "\n"))
+		return
+	}
+	fmt.Println(args...)
+}
+
+func newLogger(format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("LOG_LEVEL: %w", err)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch strings.ToLower(format) {
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts)), nil
+	default:
+		return nil, fmt.Errorf("LOG_FORMAT: unknown format %q", format)
+	}
+}
+
+// gormLogger adapts the structured logger to GORM. Failed statements are
+// logged as errors and statements slower than slow as warnings; everything
+// else only shows up at debug level. Bound parameters are replaced with "?"
+// unless showParams is set, since they carry titles and credentials alike.
+type gormLogger struct {
+	log        *slog.Logger
+	slow       time.Duration
+	showParams bool
+}
+
+func (l gormLogger) LogMode(gormlogger.LogLevel) gormlogger.Interface { return l }
+
+func (l gormLogger) Info(ctx context.Context, msg string, args ...any) {
+	l.log.InfoContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+func (l gormLogger) Warn(ctx context.Context, msg string, args ...any) {
+	l.log.WarnContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+func (l gormLogger) Error(ctx context.Context, msg string, args ...any) {
+	l.log.ErrorContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+func (l gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	elapsed := time.Since(begin)
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		sql, rows := fc()
+		l.log.ErrorContext(ctx, "query failed", "error", err, "elapsed", elapsed, "rows", rows, "sql", sql)
+	case l.slow > 0 && elapsed >= l.slow:
+		sql, rows := fc()
+		l.log.WarnContext(ctx, "slow query", "elapsed", elapsed, "threshold", l.slow, "rows", rows, "sql", sql)
+	case l.log.Enabled(ctx, slog.LevelDebug):
+		sql, rows := fc()
+		l.log.DebugContext(ctx, "query", "elapsed", elapsed, "rows", rows, "sql", sql)
+	}
+}
+
+// ParamsFilter is consulted by GORM before it interpolates parameters into
+// the logged SQL.
+func (l gormLogger) ParamsFilter(ctx context.Context, sql string, params ...any) (string, []any) {
+	if l.showParams {
+		return sql, params
+	}
+	return sql, nil
+}
@@ -0,0 +1,219 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics are kept in memory and rendered in Prometheus' text exposition
+// format: pushed to a Pushgateway at the end of every run and, with
+// METRICS_ADDR, served on /metrics while the run lasts.
+
+// histogram is a cumulative Prometheus histogram over seconds.
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds ...float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	s := d.Seconds()
+	for i, bound := range h.bounds {
+		if s <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += s
+	h.count++
+}
+
+var metrics = struct {
+	sync.Mutex
+	// requests counts TMDB responses by status code, "error" for requests
+	// that got none.
+	requests       map[string]uint64
+	requestLatency *histogram
+	limiterWait    *histogram
+	// run is the last finished run, if any.
+	run *SyncRun
+}{
+	requests:       map[string]uint64{},
+	requestLatency: newHistogram(0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10),
+	limiterWait:    newHistogram(0.001, 0.01, 0.1, 0.5, 1, 5, 10, 30),
+}
+
+// observeRequest records a TMDB request that took d.
+func observeRequest(code string, d time.Duration) {
+	metrics.Lock()
+	defer metrics.Unlock()
+	metrics.requests[code]++
+	metrics.requestLatency.observe(d)
+}
+
+func observeLimiterWait(d time.Duration) {
+	metrics.Lock()
+	defer metrics.Unlock()
+	metrics.limiterWait.observe(d)
+}
+
+// writeMetrics renders every metric to w.
+func writeMetrics(w io.Writer) {
+	metrics.Lock()
+	codes := make([]string, 0, len(metrics.requests))
+	for code := range metrics.requests {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	fmt.Fprintln(w, "# HELP wiitco_tmdb_requests_total TMDB requests by response status.")
+	fmt.Fprintln(w, "# TYPE wiitco_tmdb_requests_total counter")
+	for _, code := range codes {
+		fmt.Fprintf(w, "wiitco_tmdb_requests_total{code=%q} %d\n", code, metrics.requests[code])
+	}
+	writeHistogram(w, "wiitco_tmdb_request_duration_seconds", "Latency of TMDB requests.", metrics.requestLatency)
+	writeHistogram(w, "wiitco_rate_limiter_wait_seconds", "Time spent waiting for the TMDB rate limiter.", metrics.limiterWait)
+	run := metrics.run
+	metrics.Unlock()
+
+	writeStats.Lock()
+	tables := make([]string, 0, len(writeStats.tables))
+	for table := range writeStats.tables {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	for _, counter := range []struct {
+		name, help string
+		value      func(*tableWriteStats) int
+	}{
+		{"wiitco_rows_written_total", "Rows written by table.", func(s *tableWriteStats) int { return s.Rows }},
+		{"wiitco_batches_total", "Batch inserts by table.", func(s *tableWriteStats) int { return s.Batches }},
+		{"wiitco_batch_failures_total", "Failed batch inserts by table.", func(s *tableWriteStats) int { return s.Failures }},
+	} {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", counter.name, counter.help, counter.name)
+		for _, table := range tables {
+			fmt.Fprintf(w, "%s{table=%q} %d\n", counter.name, table, counter.value(writeStats.tables[table]))
+		}
+	}
+	writeStats.Unlock()
+
+	if run == nil || run.FinishedAt == nil {
+		return
+	}
+	status := ""
+	if run.Status != nil {
+		status = *run.Status
+	}
+	fmt.Fprintln(w, "# HELP wiitco_run_info The last finished run.")
+	fmt.Fprintln(w, "# TYPE wiitco_run_info gauge")
+	fmt.Fprintf(w, "wiitco_run_info{mode=%q,status=%q,run_id=\"%d\"} 1\n", run.Mode, status, run.ID)
+	for _, gauge := range []struct {
+		name, help string
+		value      float64
+	}{
+		{"wiitco_run_duration_seconds", "Duration of the last run.", run.FinishedAt.Sub(run.StartedAt).Seconds()},
+		{"wiitco_run_finished_timestamp_seconds", "When the last run finished.", float64(run.FinishedAt.Unix())},
+		{"wiitco_run_fetches", "TMDB fetches of the last run.", float64(run.Fetches)},
+		{"wiitco_run_fetch_failures", "Failed TMDB fetches of the last run.", float64(run.FetchFailures)},
+		{"wiitco_run_batch_failures", "Failed batch inserts of the last run.", float64(run.BatchFailures)},
+	} {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", gauge.name, gauge.help, gauge.name, gauge.name, gauge.value)
+	}
+}
+
+func writeHistogram(w io.Writer, name, help string, h *histogram) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for i, bound := range h.bounds {
+		fmt.Fprintf(w, "%s_bucket{le=\"%g\"} %d\n", name, bound, h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n%s_sum %g\n%s_count %d\n", name, h.count, name, h.sum, name, h.count)
+}
+
+// publishRunMetrics records the finished run and pushes every metric to
+// the Pushgateway, grouped by job and mode so that each mode keeps its
+// last run.
+func publishRunMetrics(run SyncRun) error {
+	metrics.Lock()
+	metrics.run = &run
+	metrics.Unlock()
+	if cfg.MetricsPushgatewayURL == "" {
+		return nil
+	}
+
+	var body bytes.Buffer
+	writeMetrics(&body)
+	target := fmt.Sprintf("%s/metrics/job/%s/mode/%s", strings.TrimSuffix(cfg.MetricsPushgatewayURL, "/"),
+		url.PathEscape(cfg.MetricsJob), url.PathEscape(run.Mode))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "PUT", target, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("pushgateway returned %s", res.Status)
+	}
+	return nil
+}
+
+// serveMetrics serves /metrics on addr until the returned function is
+// called. Stopping keeps serving for METRICS_LINGER first, unless the
+// command was interrupted, so a scrape can pick up the final values.
+func serveMetrics(addr string) (func(), error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w)
+	})
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			outputln("Error serving metrics:", err)
+		}
+	}()
+	return func() {
+		if cfg.MetricsLinger > 0 {
+			outputf("Serving metrics on %s for another %s\n", listener.Addr(), cfg.MetricsLinger)
+			select {
+			case <-time.After(cfg.MetricsLinger):
+			case <-runCtx.Done():
+			}
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}, nil
+}
+
+// requestCode labels a TMDB request in wiitco_tmdb_requests_total.
+func requestCode(res *http.Response) string {
+	if res == nil {
+		return "error"
+	}
+	return strconv.Itoa(res.StatusCode)
+}
@@ -0,0 +1,410 @@
+package sync
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// mockServer serves TMDB-shaped fixtures for local development. Movies are
+// generated from their ID, so every request and restart returns the same
+// payload; a JSON file named <id>.json in the fixtures directory replaces
+// the generated movie, including its appended sub-resources.
+type mockServer struct {
+	movies       int
+	fixtures     string
+	latency      time.Duration
+	jitter       time.Duration
+	errorRate    float64
+	throttleRate float64
+}
+
+// mockPageSize matches the page size of TMDB's changes endpoint.
+const mockPageSize = 100
+
+// mockFirstID offsets generated IDs so they look like real TMDB IDs.
+const mockFirstID = 10000
+
+// mockPeople is the number of people, IDs 1 to mockPeople, credits pick
+// from.
+const mockPeople = 5000
+
+var (
+	mockLanguages = []string{"en", "en", "en", "fr", "de", "ja", "ko", "es", "it"}
+	mockCountries = []string{"US", "GB", "FR", "DE", "JP", "KR", "ES", "IT", "CA", "AU"}
+	mockCompanies = []Company{
+		{1, "Lucasfilm Ltd.", "US"}, {4, "Paramount Pictures", "US"}, {33, "Universal Pictures", "US"},
+		{174, "Warner Bros. Pictures", "US"}, {104, "Canal+", "FR"}, {882, "Toho", "JP"},
+		{7, "DreamWorks Pictures", "US"}, {4171, "Studio Babelsberg", "DE"}, {3268, "BBC Film", "GB"},
+	}
+	mockKeywords = []Keyword{
+		{818, "based on novel or book"}, {9663, "sequel"}, {9714, "remake"}, {9715, "superhero"},
+		{4565, "dystopia"}, {10683, "coming of age"}, {6149, "police"}, {12554, "dragon"},
+		{1701, "hero"}, {9748, "revenge"}, {10714, "serial killer"}, {180547, "marvel cinematic universe (mcu)"},
+	}
+	mockTitleWords = [2][]string{
+		{"Silent", "Last", "Broken", "Midnight", "Golden", "Hidden", "Crimson", "Distant", "Frozen", "Endless"},
+		{"Harbor", "Kingdom", "Signal", "Garden", "Frontier", "Promise", "Empire", "River", "Machine", "Summer"},
+	}
+	mockFirstNames     = []string{"Anna", "James", "Marie", "Kenji", "Sofia", "Lucas", "Min-ji", "Pierre", "Elena", "Tom"}
+	mockLastNames      = []string{"Becker", "Moreau", "Tanaka", "Kim", "Rossi", "Garcia", "Smith", "Novak", "Jensen", "Park"}
+	mockProviders      = []WatchProvider{{ID: 8, Name: "Netflix"}, {ID: 9, Name: "Amazon Prime Video"}, {ID: 337, Name: "Disney Plus"}, {ID: 2, Name: "Apple TV"}}
+	mockNotes          = []string{"", "", "", "", "Premiere", "Cannes Film Festival", "Director's Cut (142 min)", "IMAX", "Re-release"}
+	mockCertifications = []string{"", "", "U", "PG-13", "R", "12", "16", "18"}
+)
+
+// runTMDBMock serves the changes, details, sub-resource and reference list
+// endpoints the cron reads. Point TMDB_BASE_URL at http://<addr>/3 to sync against it.
+func runTMDBMock(args []string) error {
+	fs := flag.NewFlagSet("tmdb-mock", flag.ContinueOnError)
+	addr := fs.String("addr", "localhost:8787", "address to listen on")
+	m := &mockServer{}
+	fs.IntVar(&m.movies, "movies", 1000, "number of movies listed by the changes endpoint")
+	fs.StringVar(&m.fixtures, "fixtures", "", "directory of <id>.json files replacing generated movies")
+	fs.DurationVar(&m.latency, "latency", 50*time.Millisecond, "delay added to every response")
+	fs.DurationVar(&m.jitter, "jitter", 100*time.Millisecond, "random delay added on top of --latency")
+	fs.Float64Var(&m.errorRate, "error-rate", 0.01, "fraction of requests answered with a 5xx")
+	fs.Float64Var(&m.throttleRate, "throttle-rate", 0.01, "fraction of requests answered with a 429")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if m.movies < 0 || m.movies > 65535 {
+		return errors.New("--movies must be between 0 and 65535")
+	}
+	if m.errorRate < 0 || m.throttleRate < 0 || m.errorRate+m.throttleRate > 1 {
+		return errors.New("--error-rate and --throttle-rate must be non-negative and add up to at most 1")
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/3/movie/", m.handleMovie)
+	mux.HandleFunc("/3/person/", m.handlePerson)
+	mux.HandleFunc("/3/genre/", m.handleGenres)
+	mux.HandleFunc("/3/configuration/", m.handleConfiguration)
+	outputf("Serving %d mock movies on http://%s/3\n", m.movies, *addr)
+	return http.ListenAndServe(*addr, mux)
+}
+
+// simulate delays the response and answers a share of requests with an
+// error, reporting whether it did.
+func (m *mockServer) simulate(w http.ResponseWriter) bool {
+	if m.latency > 0 || m.jitter > 0 {
+		delay := m.latency
+		if m.jitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(m.jitter)))
+		}
+		time.Sleep(delay)
+	}
+	switch roll := rand.Float64(); {
+	case roll < m.throttleRate:
+		w.Header().Set("Retry-After", "1")
+		writeMockError(w, http.StatusTooManyRequests, 25, "Your request count (#) is over the allowed limit of (40).")
+		return true
+	case roll < m.throttleRate+m.errorRate:
+		writeMockError(w, http.StatusServiceUnavailable, 9, "Service offline.")
+		return true
+	}
+	return false
+}
+
+func (m *mockServer) handleMovie(w http.ResponseWriter, r *http.Request) {
+	if m.simulate(w) {
+		return
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/3/movie/"), "/")
+	if rest == "changes" {
+		writeMockChanges(w, r, mockFirstID, m.movies)
+		return
+	}
+	idPart, resource, _ := strings.Cut(rest, "/")
+	id, err := strconv.ParseUint(idPart, 10, 32)
+	if err != nil {
+		writeMockError(w, http.StatusNotFound, 34, "The resource you requested could not be found.")
+		return
+	}
+	movie, err := m.movie(uint32(id))
+	if err != nil {
+		writeMockError(w, http.StatusInternalServerError, 11, err.Error())
+		return
+	}
+	if movie == nil {
+		writeMockError(w, http.StatusNotFound, 34, "The resource you requested could not be found.")
+		return
+	}
+
+	if resource == "" {
+		appended := map[string]bool{}
+		for _, name := range strings.Split(r.URL.Query().Get("append_to_response"), ",") {
+			appended[name] = true
+		}
+		for _, name := range []string{"release_dates", "credits", "alternative_titles", "keywords", "translations", "external_ids", "watch/providers"} {
+			if !appended[name] {
+				delete(movie, name)
+			}
+		}
+		writeMockJSON(w, movie)
+		return
+	}
+	sub, ok := movie[resource].(map[string]any)
+	if !ok {
+		writeMockError(w, http.StatusNotFound, 34, "The resource you requested could not be found.")
+		return
+	}
+	sub["id"] = id
+	writeMockJSON(w, sub)
+}
+
+// handlePerson serves the details of the pooled people credited by
+// generated movies.
+func (m *mockServer) handlePerson(w http.ResponseWriter, r *http.Request) {
+	if m.simulate(w) {
+		return
+	}
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/3/person/"), "/")
+	if rest == "changes" {
+		writeMockChanges(w, r, 1, mockPeople)
+		return
+	}
+	id, err := strconv.ParseUint(rest, 10, 32)
+	if err != nil || id < 1 || id > mockPeople {
+		writeMockError(w, http.StatusNotFound, 34, "The resource you requested could not be found.")
+		return
+	}
+	rnd := rand.New(rand.NewSource(int64(id)))
+	name := mockFirstNames[id%10] + " " + mockLastNames[id/10%10]
+	born := time.Date(1930, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, rnd.Intn(70*365))
+	writeMockJSON(w, map[string]any{
+		"id":                   id,
+		"name":                 name,
+		"biography":            name + " is a performer and filmmaker.",
+		"birthday":             born.Format("2006-01-02"),
+		"deathday":             nil,
+		"place_of_birth":       mockCountries[rnd.Intn(len(mockCountries))],
+		"profile_path":         fmt.Sprintf("/mock-person-%d.jpg", id),
+		"known_for_department": []string{"Acting", "Acting", "Directing"}[rnd.Intn(3)],
+	})
+}
+
+// handleGenres serves tmdbGenres as both the movie and the TV genre list.
+func (m *mockServer) handleGenres(w http.ResponseWriter, r *http.Request) {
+	if m.simulate(w) {
+		return
+	}
+	writeMockJSON(w, map[string]any{"genres": tmdbGenres})
+}
+
+// handleConfiguration lists the countries and languages the mock movies
+// use, named by their codes.
+func (m *mockServer) handleConfiguration(w http.ResponseWriter, r *http.Request) {
+	if m.simulate(w) {
+		return
+	}
+	switch strings.Trim(strings.TrimPrefix(r.URL.Path, "/3/configuration/"), "/") {
+	case "countries":
+		countries := []Country{}
+		for _, iso := range mockCountries {
+			countries = append(countries, Country{ISO31661: iso, EnglishName: iso, NativeName: iso})
+		}
+		writeMockJSON(w, countries)
+	case "languages":
+		languages := []Language{}
+		for _, iso := range mockLanguages {
+			if !slices.ContainsFunc(languages, func(l Language) bool { return l.ISO6391 == iso }) {
+				languages = append(languages, Language{ISO6391: iso, EnglishName: iso, Name: iso})
+			}
+		}
+		writeMockJSON(w, languages)
+	default:
+		writeMockError(w, http.StatusNotFound, 34, "The resource you requested could not be found.")
+	}
+}
+
+// writeMockChanges serves a changes feed listing count IDs from firstID.
+func writeMockChanges(w http.ResponseWriter, r *http.Request, firstID, count int) {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	totalPages := (count + mockPageSize - 1) / mockPageSize
+	results := []MovieIndex{}
+	for i := (page - 1) * mockPageSize; i < page*mockPageSize && i < count; i++ {
+		id := uint32(firstID + i)
+		results = append(results, MovieIndex{ID: id, Adult: id%97 == 0})
+	}
+	writeMockJSON(w, map[string]any{
+		"results":       results,
+		"page":          page,
+		"total_pages":   totalPages,
+		"total_results": count,
+	})
+}
+
+// movie returns the fixture for id with every sub-resource appended, or nil
+// if the mock doesn't know the movie.
+func (m *mockServer) movie(id uint32) (map[string]any, error) {
+	if m.fixtures != "" {
+		body, err := os.ReadFile(filepath.Join(m.fixtures, strconv.FormatUint(uint64(id), 10)+".json"))
+		if err == nil {
+			var movie map[string]any
+			if err := json.Unmarshal(body, &movie); err != nil {
+				return nil, fmt.Errorf("fixture %d: %w", id, err)
+			}
+			return movie, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	if id < mockFirstID || id >= mockFirstID+uint32(m.movies) {
+		return nil, nil
+	}
+	return generateMockMovie(id), nil
+}
+
+// generateMockMovie builds a details payload shaped like TMDB's, seeded by
+// the movie ID. People come from a shared pool so credits overlap across
+// movies the way they do in the real catalog.
+func generateMockMovie(id uint32) map[string]any {
+	r := rand.New(rand.NewSource(int64(id)))
+	pick := func(n int) []int { return r.Perm(n)[:1+r.Intn(min(3, n))] }
+
+	title := "The " + mockTitleWords[0][r.Intn(len(mockTitleWords[0]))] + " " + mockTitleWords[1][r.Intn(len(mockTitleWords[1]))]
+	if id%7 == 0 {
+		title += " " + strconv.Itoa(2+r.Intn(3))
+	}
+	language := mockLanguages[r.Intn(len(mockLanguages))]
+	released := time.Date(1950, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, r.Intn(78*365))
+
+	var genres []Genre
+	for _, i := range pick(len(tmdbGenres)) {
+		genres = append(genres, tmdbGenres[i])
+	}
+	var countries []map[string]string
+	for _, i := range pick(len(mockCountries)) {
+		countries = append(countries, map[string]string{"iso_3166_1": mockCountries[i], "name": mockCountries[i]})
+	}
+	var companies []Company
+	for _, i := range pick(len(mockCompanies)) {
+		companies = append(companies, mockCompanies[i])
+	}
+	var keywords []Keyword
+	for _, i := range pick(len(mockKeywords)) {
+		keywords = append(keywords, mockKeywords[i])
+	}
+
+	person := func() (uint32, string) {
+		pid := uint32(1 + r.Intn(mockPeople))
+		return pid, mockFirstNames[pid%10] + " " + mockLastNames[pid/10%10]
+	}
+	var cast []map[string]any
+	for i := 0; i < 5+r.Intn(16); i++ {
+		pid, name := person()
+		cast = append(cast, map[string]any{
+			"id": pid, "name": name, "character": mockFirstNames[r.Intn(10)],
+			"order": i, "credit_id": fmt.Sprintf("%x%04x", id, i),
+		})
+	}
+	var crew []map[string]any
+	for i, job := range [][2]string{{"Directing", "Director"}, {"Writing", "Screenplay"}, {"Production", "Producer"}, {"Camera", "Director of Photography"}, {"Sound", "Original Music Composer"}} {
+		pid, name := person()
+		crew = append(crew, map[string]any{
+			"id": pid, "name": name, "department": job[0], "job": job[1],
+			"credit_id": fmt.Sprintf("%x%04x", id, 100+i),
+		})
+	}
+
+	var releases, altTitles, translations []map[string]any
+	for _, i := range r.Perm(len(mockCountries))[:2+r.Intn(6)] {
+		country := mockCountries[i]
+		var dates []map[string]any
+		date := released.AddDate(0, 0, r.Intn(120))
+		for typ := 3; typ <= 6; typ++ {
+			if typ != 3 && r.Intn(2) == 0 {
+				continue
+			}
+			dates = append(dates, map[string]any{
+				"certification": mockCertifications[r.Intn(len(mockCertifications))], "note": mockNotes[r.Intn(len(mockNotes))],
+				"release_date": date.Format(time.RFC3339), "type": typ,
+			})
+			date = date.AddDate(0, 0, 30+r.Intn(90))
+		}
+		releases = append(releases, map[string]any{"iso_3166_1": country, "release_dates": dates})
+		if country != "US" && r.Intn(2) == 0 {
+			altTitles = append(altTitles, map[string]any{"iso_3166_1": country, "title": title + " (" + country + ")", "type": ""})
+		}
+		translations = append(translations, map[string]any{
+			"iso_3166_1": country, "iso_639_1": strings.ToLower(country), "name": country, "english_name": country,
+			"data": map[string]any{"title": title + " (" + country + ")", "overview": "A mock overview of " + title + ".", "tagline": ""},
+		})
+	}
+
+	movie := map[string]any{
+		"id":                   id,
+		"adult":                false,
+		"title":                title,
+		"original_title":       title,
+		"original_language":    language,
+		"poster_path":          fmt.Sprintf("/mock%d.jpg", id),
+		"popularity":           float32(r.ExpFloat64() * 20),
+		"runtime":              80 + r.Intn(90),
+		"budget":               r.Intn(200) * 1_000_000,
+		"release_date":         released.Format("2006-01-02"),
+		"imdb_id":              fmt.Sprintf("tt%07d", id),
+		"genres":               genres,
+		"production_countries": countries,
+		"production_companies": companies,
+		"credits":              map[string]any{"cast": cast, "crew": crew},
+		"release_dates":        map[string]any{"results": releases},
+		"alternative_titles":   map[string]any{"titles": altTitles},
+		"keywords":             map[string]any{"keywords": keywords},
+		"translations":         map[string]any{"translations": translations},
+		"external_ids": map[string]any{"imdb_id": fmt.Sprintf("tt%07d", id), "wikidata_id": fmt.Sprintf("Q%d", 100000+id),
+			"facebook_id": nil, "instagram_id": fmt.Sprintf("mockmovie%d", id), "twitter_id": ""},
+		"revenue":       r.Intn(3000) * 1_000_000,
+		"overview":      fmt.Sprintf("Overview of %s.", title),
+		"tagline":       "",
+		"status":        "Released",
+		"vote_average":  float32(r.Intn(100)) / 10,
+		"vote_count":    r.Intn(20000),
+		"homepage":      fmt.Sprintf("https://example.com/movies/%d", id),
+		"backdrop_path": fmt.Sprintf("/mock%d-backdrop.jpg", id),
+	}
+	if id%5 == 0 {
+		collection := id / 50
+		movie["belongs_to_collection"] = map[string]any{"id": collection, "name": fmt.Sprintf("Mock Collection %d", collection),
+			"poster_path": fmt.Sprintf("/mock-collection%d.jpg", collection), "backdrop_path": fmt.Sprintf("/mock-collection%d-backdrop.jpg", collection)}
+	}
+	offers := map[string]any{}
+	for _, country := range mockCountries[:1+r.Intn(len(mockCountries))] {
+		provider := mockProviders[r.Intn(len(mockProviders))]
+		offer := []map[string]any{{"provider_id": provider.ID, "provider_name": provider.Name,
+			"logo_path": fmt.Sprintf("/provider%d.jpg", provider.ID), "display_priority": r.Intn(20)}}
+		offers[country] = map[string]any{
+			"link": fmt.Sprintf("https://example.com/movies/%d/watch?locale=%s", id, country),
+			[]string{"flatrate", "rent", "buy"}[r.Intn(3)]: offer,
+		}
+	}
+	movie["watch/providers"] = map[string]any{"results": offers}
+	return movie
+}
+
+func writeMockJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeMockError answers in TMDB's error format.
+func writeMockError(w http.ResponseWriter, status, code int, message string) {
+	w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"success": false, "status_code": code, "status_message": message})
+}
@@ -0,0 +1,94 @@
+package sync
+
+import (
+	"flag"
+	"regexp"
+
+	"gorm.io/gorm"
+)
+
+// Release note categories, stored in the ReleaseNoteCategory enum.
+const (
+	noteFestival  = "festival"
+	noteRerelease = "re-release"
+	notePremiere  = "premiere"
+	noteLimited   = "limited"
+	noteWide      = "wide"
+	noteSpecial   = "special"
+)
+
+// noteRules classify free-text release notes. The first matching rule wins,
+// so "Sundance Premiere" is a festival screening and "Limited 4K re-release"
+// a re-release.
+var noteRules = []struct {
+	category string
+	pattern  *regexp.Regexp
+}{
+	{noteFestival, regexp.MustCompile(`(?i)festival|festiwal|film ?fest\b|fantastic fest|\b(sundance|cannes|berlinale|venice|venezia|mostra|tiff|sxsw|tribeca|telluride|locarno|karlovy vary|rotterdam|busan|san sebasti[aá]n|annecy|sitges|fantasia)\b`)},
+	{noteRerelease, regexp.MustCompile(`(?i)re-?(release|issue|edition)|\b(anniversary|remaster(ed)?|restor(ed|ation)|reestreno|reprise|wiederaufführung|ressortie)\b`)},
+	{notePremiere, regexp.MustCompile(`(?i)premi[eè]re?|premiera|estreno|avant-premi`)},
+	{noteLimited, regexp.MustCompile(`(?i)\b(limited|exclusive|platform release|select(ed)? (cities|theaters|theatres|cinemas))\b`)},
+	{noteWide, regexp.MustCompile(`(?i)\b(wide|nationwide|general release|everywhere)\b`)},
+	{noteSpecial, regexp.MustCompile(`(?i)\b(imax|dolby|4dx|screenx|70 ?mm|3d|one[- ]night|special (screening|event)|fathom|encore)\b`)},
+}
+
+// classifyNote returns the category of a release note, or nil if no rule
+// matches.
+func classifyNote(note string) *string {
+	if note == "" {
+		return nil
+	}
+	for _, rule := range noteRules {
+		if rule.pattern.MatchString(note) {
+			category := rule.category
+			return &category
+		}
+	}
+	return nil
+}
+
+// runClassifyNotes reclassifies every stored release note, for rows written
+// before a rule was added or changed.
+func runClassifyNotes(db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("classify-notes", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var notes []string
+	if err := db.Raw(`SELECT DISTINCT "note" FROM "MLocalRelease" WHERE "note" IS NOT NULL`).Scan(&notes).Error; err != nil {
+		return err
+	}
+	byCategory := map[string][]string{}
+	var unmatched []string
+	for _, note := range notes {
+		if category := classifyNote(note); category != nil {
+			byCategory[*category] = append(byCategory[*category], note)
+		} else {
+			unmatched = append(unmatched, note)
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for category, notes := range byCategory {
+			for start := 0; start < len(notes); start += denormalizeChunkSize {
+				chunk := notes[start:min(start+denormalizeChunkSize, len(notes))]
+				if err := tx.Exec(`UPDATE "MLocalRelease" SET "noteCategory" = ? WHERE "note" IN ?`, category, chunk).Error; err != nil {
+					return err
+				}
+			}
+		}
+		for start := 0; start < len(unmatched); start += denormalizeChunkSize {
+			chunk := unmatched[start:min(start+denormalizeChunkSize, len(unmatched))]
+			if err := tx.Exec(`UPDATE "MLocalRelease" SET "noteCategory" = NULL WHERE "note" IN ?`, chunk).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	outputf("Classified %d of %d distinct release notes\n", len(notes)-len(unmatched), len(notes))
+	return nil
+}
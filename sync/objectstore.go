@@ -0,0 +1,237 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// objectStore is the minimal blob storage used for snapshots and other
+// artifacts. Keys always use forward slashes.
+type objectStore interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	// PutIfAbsent is Put failing with errObjectExists when key exists.
+	PutIfAbsent(ctx context.Context, key string, r io.Reader) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	List(ctx context.Context, prefix string) ([]string, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// newObjectStore opens the store described by rawURL: s3://bucket/prefix for
+// S3-compatible storage (including GCS through its interoperability API) or
+// file:///dir (file:///C:/dir on Windows) for a local directory.
+func newObjectStore(rawURL string) (objectStore, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing object store URL: %w", err)
+	}
+	switch u.Scheme {
+	case "s3", "gs":
+		endpoint := os.Getenv("S3_ENDPOINT")
+		if endpoint == "" {
+			endpoint = "s3.amazonaws.com"
+			if u.Scheme == "gs" {
+				endpoint = "storage.googleapis.com"
+			}
+		}
+		client, err := minio.New(endpoint, &minio.Options{
+			Creds:  credentials.NewStaticV4(os.Getenv("S3_ACCESS_KEY_ID"), os.Getenv("S3_SECRET_ACCESS_KEY"), ""),
+			Secure: os.Getenv("S3_INSECURE") != "true",
+			Region: os.Getenv("S3_REGION"),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &s3Store{client: client, bucket: u.Host, prefix: strings.Trim(u.Path, "/")}, nil
+	case "file":
+		return &fileStore{dir: fileURLPath(u)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported object store scheme %q", u.Scheme)
+	}
+}
+
+type s3Store struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func (s *s3Store) key(key string) string {
+	return path.Join(s.prefix, key)
+}
+
+func (s *s3Store) Put(ctx context.Context, key string, r io.Reader) error {
+	_, err := s.client.PutObject(ctx, s.bucket, s.key(key), r, -1, minio.PutObjectOptions{PartSize: 16 << 20})
+	return err
+}
+
+// PutIfAbsent sends a conditional write, If-None-Match: *, through a
+// presigned URL, as the client library can only set that header quoted.
+func (s *s3Store) PutIfAbsent(ctx context.Context, key string, r io.Reader) error {
+	// Presigned puts need a Content-Length.
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	u, err := s.client.PresignedPutObject(ctx, s.bucket, s.key(key), time.Minute)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("If-None-Match", "*")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		return errObjectExists
+	default:
+		return fmt.Errorf("conditional put of %s: %s", key, resp.Status)
+	}
+}
+
+func (s *s3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, s.key(key), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (s *s3Store) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: s.key(prefix), Recursive: true}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		keys = append(keys, strings.TrimPrefix(strings.TrimPrefix(obj.Key, s.prefix), "/"))
+	}
+	return keys, nil
+}
+
+func (s *s3Store) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, s.key(key), minio.RemoveObjectOptions{})
+}
+
+type fileStore struct {
+	dir string
+}
+
+func (f *fileStore) path(key string) string {
+	return filepath.Join(f.dir, filepath.FromSlash(key))
+}
+
+func (f *fileStore) Put(ctx context.Context, key string, r io.Reader) error {
+	p := f.path(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	out, err := os.Create(p + ".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(p+".tmp", p)
+}
+
+// PutIfAbsent links the written file into place, which fails if the key
+// exists.
+func (f *fileStore) PutIfAbsent(ctx context.Context, key string, r io.Reader) error {
+	p := f.path(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	out, err := os.CreateTemp(filepath.Dir(p), filepath.Base(p)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	err = os.Link(out.Name(), p)
+	if errors.Is(err, fs.ErrExist) {
+		return errObjectExists
+	}
+	return err
+}
+
+func (f *fileStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return os.Open(f.path(key))
+}
+
+func (f *fileStore) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	err := filepath.WalkDir(f.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(f.dir, p)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	sort.Strings(keys)
+	return keys, err
+}
+
+// errObjectExists is returned by PutIfAbsent for a key that exists.
+var errObjectExists = errors.New("object exists")
+
+// isNotFound reports whether err means the object does not exist.
+func isNotFound(err error) bool {
+	return errors.Is(err, fs.ErrNotExist) || minio.ToErrorResponse(err).Code == "NoSuchKey"
+}
+
+func (f *fileStore) Delete(ctx context.Context, key string) error {
+	err := os.Remove(f.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,140 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	outboxBatchSize   = 100
+	outboxMaxAttempts = 10
+)
+
+type OutboxEvent struct {
+	ID            uint64
+	Topic         string
+	Payload       string `gorm:"type:jsonb"`
+	Attempts      int
+	NextAttemptAt time.Time `gorm:"column:nextAttemptAt"`
+}
+
+// eventSink delivers a single outbox event. Implementations must be safe to
+// call again with the same event, since delivery is at-least-once.
+type eventSink interface {
+	Deliver(ctx context.Context, event OutboxEvent) error
+}
+
+type webhookSink struct {
+	url string
+}
+
+func (w webhookSink) Deliver(ctx context.Context, event OutboxEvent) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", w.url, bytes.NewBufferString(event.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Event-Topic", event.Topic)
+	req.Header.Set("X-Event-Id", fmt.Sprint(event.ID))
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected HTTP status code: %d", res.StatusCode)
+	}
+	return nil
+}
+
+// enqueueEvent writes an event to the outbox. It must be given the
+// transaction performing the data writes the event describes, so both are
+// committed or rolled back together.
+func enqueueEvent(tx *gorm.DB, topic string, payload any) error {
+	if cfg.OutboxWebhookURL == "" {
+		return nil
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return tx.Table("Outbox").Create(&OutboxEvent{
+		Topic:         topic,
+		Payload:       string(body),
+		NextAttemptAt: time.Now(),
+	}).Error
+}
+
+// runOutboxDispatcher delivers pending events every interval until ctx is
+// cancelled. Events left over from a crashed run are picked up on the next
+// start.
+func runOutboxDispatcher(ctx context.Context, db *gorm.DB, sink eventSink, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := dispatchOutbox(ctx, db, sink); err != nil {
+			outputln("Error dispatching outbox:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatchOutbox delivers due events until none are left and returns how
+// many were delivered. Failed events are rescheduled with exponential backoff
+// and given up on after outboxMaxAttempts.
+func dispatchOutbox(ctx context.Context, db *gorm.DB, sink eventSink) (int, error) {
+	delivered := 0
+	for {
+		var n int
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var events []OutboxEvent
+			err := tx.Table("Outbox").
+				Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where(`"deliveredAt" IS NULL AND "attempts" < ? AND "nextAttemptAt" <= now()`, outboxMaxAttempts).
+				Order(`"id"`).Limit(outboxBatchSize).
+				Find(&events).Error
+			if err != nil {
+				return err
+			}
+			n = len(events)
+			for _, event := range events {
+				if err := sink.Deliver(ctx, event); err != nil {
+					backoff := time.Duration(1<<event.Attempts) * time.Second
+					n--
+					err = tx.Table("Outbox").Where(`"id" = ?`, event.ID).Updates(map[string]any{
+						"attempts":      event.Attempts + 1,
+						"nextAttemptAt": time.Now().Add(backoff),
+						"lastError":     err.Error(),
+					}).Error
+					if err != nil {
+						return err
+					}
+					continue
+				}
+				err := tx.Table("Outbox").Where(`"id" = ?`, event.ID).Update("deliveredAt", time.Now()).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return delivered, err
+		}
+		delivered += n
+		if n == 0 {
+			return delivered, nil
+		}
+	}
+}
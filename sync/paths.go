@@ -0,0 +1,43 @@
+package sync
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// appName names the cron's directories under the platform's cache dir.
+const appName = "wiitco-db-movies-cron"
+
+// defaultDataDir is where local state such as caches and exports goes
+// unless DATA_DIR says otherwise: the user cache dir, that is
+// $XDG_CACHE_HOME or ~/.cache on Linux, ~/Library/Caches on macOS and
+// %LocalAppData% on Windows, or the temp dir when there is none.
+func defaultDataDir() string {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		base = os.TempDir()
+	}
+	return filepath.Join(base, appName)
+}
+
+// dataPath returns name inside DATA_DIR.
+func dataPath(name ...string) string {
+	return filepath.Join(append([]string{cfg.DataDir}, name...)...)
+}
+
+// fileURLPath turns a file:// URL into a local path. Windows paths come as
+// file:///C:/dir or file://C:/dir.
+func fileURLPath(u *url.URL) string {
+	p := u.Path
+	if runtime.GOOS == "windows" {
+		if u.Host != "" && u.Host != "localhost" {
+			p = u.Host + p
+		}
+		if len(p) >= 3 && p[0] == '/' && p[2] == ':' {
+			p = p[1:]
+		}
+	}
+	return filepath.FromSlash(p)
+}
@@ -0,0 +1,182 @@
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Movie credits only carry a person's ID and name. Once a run's movies are
+// written, the people it saw are enriched from /person/{id} with their own
+// workers and rate limit, so a cast-heavy run doesn't starve movie fetches.
+
+type PersonDetails struct {
+	ID                 uint32  `json:"id"`
+	Name               string  `json:"name"`
+	Biography          string  `json:"biography"`
+	Birthday           *string `json:"birthday"`
+	Deathday           *string `json:"deathday"`
+	PlaceOfBirth       *string `json:"place_of_birth"`
+	ProfilePath        *string `json:"profile_path"`
+	KnownForDepartment string  `json:"known_for_department"`
+}
+
+type PersonDetailsDB struct {
+	ID                 uint32
+	Name               string
+	Biography          *string
+	Birthday           *string   `gorm:"type:date"`
+	Deathday           *string   `gorm:"type:date"`
+	PlaceOfBirth       *string   `gorm:"column:placeOfBirth"`
+	ProfilePath        *string   `gorm:"column:profilePath"`
+	KnownForDepartment *string   `gorm:"column:knownForDepartment"`
+	DetailsSyncedAt    time.Time `gorm:"column:detailsSyncedAt"`
+}
+
+// personLimiter paces person requests separately from the movie limiter.
+var personLimiter = rate.NewLimiter(rate.Every(time.Second/10), 1)
+
+// personDetailColumns are the CinemaPerson columns owned by this stage.
+var personDetailColumns = []string{"name", "biography", "birthday", "deathday", "placeOfBirth", "profilePath", "knownForDepartment", "detailsSyncedAt"}
+
+// enrichedPeople caches the IDs of people known to have fresh details, so
+// prolific actors are looked up once per process rather than per chunk.
+var enrichedPeople = struct {
+	sync.Mutex
+	ids map[uint32]bool
+}{ids: map[uint32]bool{}}
+
+// syncPersonDetails fetches and writes the details of every person in ids
+// not enriched within PERSON_DETAILS_REFRESH_DAYS.
+func syncPersonDetails(db *gorm.DB, ids []uint32) {
+	seen := len(ids)
+	ids, err := stalePeople(db, ids, cfg.PersonDetailsRefreshDays)
+	if err != nil {
+		outputln("Error checking enriched people:", err)
+		return
+	}
+	if len(ids) == 0 {
+		return
+	}
+	outputf("Fetching details of %d people, %d are fresh\n", len(ids), seen-len(ids))
+	refreshPersonDetails(db, ids)
+}
+
+// refreshPersonDetails fetches and writes the details of every person in
+// ids.
+func refreshPersonDetails(db *gorm.DB, ids []uint32) {
+	personLimiter.SetLimit(rate.Limit(cfg.PersonDetailsRPS))
+	detailsCh := make(chan PersonDetailsDB, 10000)
+	defer trackQueue("personDetails", detailsCh)()
+	peopleDone := progressStage(stagePeople)
+	peopleDone.expect(len(ids))
+	go func() {
+		runPool(idsChannel(ids), cfg.PersonDetailsWorkers, func(id uint32) {
+			defer peopleDone.add(1)
+			details, err := fetchPersonDetails(id)
+			recordFetch(err)
+			if err != nil {
+				outputf("Error fetching person ID %d: %v\n", id, err)
+				return
+			}
+			send(detailsCh, "CinemaPerson", personDetailsRow(details))
+			enrichedPeople.Lock()
+			enrichedPeople.ids[id] = true
+			enrichedPeople.Unlock()
+		})
+		close(detailsCh)
+	}()
+	writePersonDetailsRows(db, detailsCh, cfg.Preset.BatchSize)
+}
+
+// stalePeople returns the people of ids whose details weren't synced within
+// the last days, remembering the fresh ones.
+func stalePeople(db *gorm.DB, ids []uint32, days int) ([]uint32, error) {
+	enrichedPeople.Lock()
+	defer enrichedPeople.Unlock()
+	var unknown []uint32
+	for _, id := range ids {
+		if !enrichedPeople.ids[id] {
+			unknown = append(unknown, id)
+		}
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -days)
+	for start := 0; start < len(unknown); start += denormalizeChunkSize {
+		chunk := unknown[start:min(start+denormalizeChunkSize, len(unknown))]
+		var fresh []uint32
+		err := db.Table("CinemaPerson").Where(`"id" IN ? AND "detailsSyncedAt" >= ?`, chunk, cutoff).Pluck(`"id"`, &fresh).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range fresh {
+			enrichedPeople.ids[id] = true
+		}
+	}
+
+	stale := unknown[:0]
+	for _, id := range unknown {
+		if !enrichedPeople.ids[id] {
+			stale = append(stale, id)
+		}
+	}
+	return stale, nil
+}
+
+func fetchPersonDetails(id uint32) (PersonDetails, error) {
+	var details PersonDetails
+	body, err := fetchTMDBLimited(personLimiter, fmt.Sprintf("/person/%d?language=%s", id, cfg.Language))
+	if err != nil {
+		return details, err
+	}
+	err = json.Unmarshal(body, &details)
+	return details, err
+}
+
+func personDetailsRow(p PersonDetails) PersonDetailsDB {
+	row := PersonDetailsDB{
+		ID:                 p.ID,
+		Name:               p.Name,
+		Biography:          filterEmptyDates(p.Biography),
+		PlaceOfBirth:       p.PlaceOfBirth,
+		ProfilePath:        p.ProfilePath,
+		KnownForDepartment: filterEmptyDates(p.KnownForDepartment),
+		DetailsSyncedAt:    time.Now(),
+	}
+	if p.Birthday != nil {
+		row.Birthday = filterEmptyDates(*p.Birthday)
+	}
+	if p.Deathday != nil {
+		row.Deathday = filterEmptyDates(*p.Deathday)
+	}
+	return row
+}
+
+func writePersonDetailsRows(db *gorm.DB, dataChannel chan PersonDetailsDB, batchSize int) {
+	writeBatches(dataChannel, batchSize, func(batch []PersonDetailsDB) error {
+		if err := writePersonDetailsBatch(db, batch); err != nil {
+			return err
+		}
+		checksumWritten("CinemaPerson", batch)
+		return nil
+	})
+}
+
+func writePersonDetailsBatch(db *gorm.DB, objects []PersonDetailsDB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{Columns: conflictTarget("CinemaPerson"), DoUpdates: clause.AssignmentColumns(personDetailColumns)}).Table("CinemaPerson").Create(&objects).Error; err != nil {
+			return err
+		}
+		changes := newChangeSet("person")
+		for _, o := range objects {
+			changes.add(strconv.Itoa(int(o.ID)), o)
+		}
+		return changes.record(tx)
+	})
+}
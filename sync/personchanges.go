@@ -0,0 +1,85 @@
+package sync
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// runPersonSync walks TMDB's person changes feed and refreshes the details
+// of the changed people already in CinemaPerson, whatever
+// PERSON_DETAILS_REFRESH_DAYS says: names change and people die without
+// any of their movies changing. People no stored credit refers to aren't
+// added. The run keeps its own change window, as sync-tv does.
+func runPersonSync(db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("sync-people", flag.ContinueOnError)
+	since := fs.String("since", "", "start of the change window, a date or RFC 3339 timestamp (default: end of the last successful run)")
+	until := fs.String("until", "", "end of the change window (default: now)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	var bounds windowBounds
+	var err error
+	if bounds.Since, err = parseWindowBound("since", *since); err != nil {
+		return err
+	}
+	if bounds.Until, err = parseWindowBound("until", *until); err != nil {
+		return err
+	}
+
+	return withRun(db, "sync-people", func() error {
+		window, err := nextChangeWindow("sync-people")
+		if err != nil {
+			return err
+		}
+		if window, err = bounds.apply(window); err != nil {
+			return err
+		}
+		if err := setRunWindow(window); err != nil {
+			return err
+		}
+		outputf("Syncing person changes from %s to %s\n", window.Start.Format(time.RFC3339), window.End.Format(time.RFC3339))
+
+		idsCh := make(chan uint32, 20000)
+		go func() {
+			defer close(idsCh)
+			pages := fetchChangesPage("person", 1, window, idsCh)
+			for page := 2; page <= pages && !interrupted(); page++ {
+				fetchChangesPage("person", page, window, idsCh)
+			}
+		}()
+		var changed []uint32
+		for id := range idsCh {
+			changed = append(changed, id)
+		}
+		slices.Sort(changed)
+		changed = slices.Compact(changed)
+
+		ids, err := storedPeople(db, changed)
+		if err != nil {
+			return fmt.Errorf("reading stored people: %w", err)
+		}
+		outputf("Refreshing %d of %d changed people\n", len(ids), len(changed))
+		if len(ids) > 0 {
+			refreshPersonDetails(db, ids)
+		}
+		return nil
+	})
+}
+
+// storedPeople returns the people of ids that are in CinemaPerson.
+func storedPeople(db *gorm.DB, ids []uint32) ([]uint32, error) {
+	var stored []uint32
+	for start := 0; start < len(ids); start += denormalizeChunkSize {
+		chunk := ids[start:min(start+denormalizeChunkSize, len(ids))]
+		var found []uint32
+		if err := db.Table("CinemaPerson").Where(`"id" IN ?`, chunk).Pluck(`"id"`, &found).Error; err != nil {
+			return nil, err
+		}
+		stored = append(stored, found...)
+	}
+	return stored, nil
+}
@@ -0,0 +1,37 @@
+package sync
+
+import (
+	"gorm.io/gorm"
+)
+
+// rebuildPersonStats regenerates the PersonStats table from the credits, so
+// the site's person lists can sort by relevance without aggregating. Each
+// person credited as actor, director or crew on a visible movie gets the
+// number of those movies, how many are upcoming (releasing after today, or
+// undated and not released) and their average popularity.
+func rebuildPersonStats(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`DELETE FROM "PersonStats"`).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`
+			INSERT INTO "PersonStats" ("personId", "movieCount", "upcomingCount", "avgPopularity", "updatedAt")
+			SELECT
+				c."personId",
+				count(*),
+				count(*) FILTER (WHERE m."primaryReleaseDate" > current_date
+					OR m."primaryReleaseDate" IS NULL AND m."status" IS DISTINCT FROM 'Released'),
+				avg(m."popularity"),
+				now()
+			FROM (
+				SELECT "actorId" AS "personId", "movieId" FROM "MovieActor"
+				UNION
+				SELECT "directorId", "movieId" FROM "MovieDirector"
+				UNION
+				SELECT "personId", "movieId" FROM "MovieCrew"
+			) c
+			JOIN "Movie" m ON m."id" = c."movieId" AND m."deletedAt" IS NULL
+			GROUP BY c."personId"
+		`).Error
+	})
+}
@@ -0,0 +1,192 @@
+package sync
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// planHistory is how many finished syncs the plan's rates come from.
+const planHistory = 10
+
+// planTables are the tables a movie sync writes per movie, whose size
+// relative to Movie gives the rows to expect.
+var planTables = []string{
+	"Movie", "MovieActor", "MovieDirector", "MovieCrew", "MovieGenre", "MovieCountry", "MReleaseCountry",
+	"MLocalRelease", "MovieKeyword", "MovieExternalIds", "MovieTranslation", "MovieTag", "MovieWatchProvider",
+	"MovieAlternativeTitle",
+}
+
+// syncRates are the rates of past syncs.
+type syncRates struct {
+	Runs          int
+	Movies        int64
+	Fetches       int64
+	Duration      time.Duration
+	CallsPerMovie float64
+	PerCall       time.Duration
+}
+
+// historicalRates averages the last finished movie syncs that counted
+// their movies in RunProgress. Without that table, which isn't created when
+// the state lives in object storage, there are no rates and the plan goes
+// by the configuration.
+func historicalRates(db *gorm.DB) (syncRates, error) {
+	var rates syncRates
+	if cfg.StateStoreURL != "" {
+		return rates, nil
+	}
+	var progress bool
+	if err := db.Raw(`SELECT to_regclass('"RunProgress"') IS NOT NULL`).Scan(&progress).Error; err != nil || !progress {
+		return rates, err
+	}
+	runs, err := state.finishedRuns("sync", planHistory)
+	if err != nil || len(runs) == 0 {
+		return rates, err
+	}
+	ids := make([]uint64, 0, len(runs))
+	for _, run := range runs {
+		ids = append(ids, run.ID)
+	}
+	var done []struct {
+		RunId uint64 `gorm:"column:runId"`
+		Done  int64  `gorm:"column:done"`
+	}
+	err = db.Table("RunProgress").Select(`"runId", "done"`).
+		Where(`"stage" = ? AND "runId" IN ?`, stageMovies, ids).Scan(&done).Error
+	if err != nil {
+		return rates, err
+	}
+	movies := map[uint64]int64{}
+	for _, d := range done {
+		movies[d.RunId] = d.Done
+	}
+	for _, run := range runs {
+		if movies[run.ID] == 0 || run.Fetches == 0 {
+			continue
+		}
+		rates.Runs++
+		rates.Movies += movies[run.ID]
+		rates.Fetches += int64(run.Fetches)
+		rates.Duration += run.FinishedAt.Sub(run.StartedAt)
+	}
+	if rates.Runs > 0 {
+		rates.CallsPerMovie = float64(rates.Fetches) / float64(rates.Movies)
+		rates.PerCall = rates.Duration / time.Duration(rates.Fetches)
+	}
+	return rates, nil
+}
+
+// runPlan reads the first page of the changes feed the next movie sync
+// would page through and prints the API calls, rows and time it would
+// take, going by past syncs or, without any, by the configuration. With
+// --max-calls it fails when the estimate is over, so a wrapper script can
+// skip an oversized run.
+func runPlan(db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("plan", flag.ContinueOnError)
+	since := fs.String("since", "", "start of the change window, as for sync")
+	until := fs.String("until", "", "end of the change window, as for sync")
+	maxCalls := fs.Int("max-calls", 0, "fail when the estimated API calls exceed this (0: no limit)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	var bounds windowBounds
+	var err error
+	if bounds.Since, err = parseWindowBound("since", *since); err != nil {
+		return err
+	}
+	if bounds.Until, err = parseWindowBound("until", *until); err != nil {
+		return err
+	}
+	window, err := nextChangeWindow("sync")
+	if err != nil {
+		return err
+	}
+	if window, err = bounds.apply(window); err != nil {
+		return err
+	}
+
+	body, err := fetchIndexData(1, window)
+	if err != nil {
+		return fmt.Errorf("fetching the first changes page: %w", err)
+	}
+	var page Response
+	if err := json.Unmarshal(body, &page); err != nil {
+		return fmt.Errorf("parsing the first changes page: %w", err)
+	}
+	movies := 0
+	if len(page.Results) > 0 {
+		adult := 0
+		for _, entry := range page.Results {
+			if entry.Adult {
+				adult++
+			}
+		}
+		movies = int(page.TotalResults) * (len(page.Results) - adult) / len(page.Results)
+	}
+	watchlisted := 0
+	if cfg.WatchlistTable != "" {
+		ids, err := loadWatchlistIDs(db, cfg.WatchlistTable, cfg.WatchlistColumn)
+		if err != nil {
+			return fmt.Errorf("loading watchlist: %w", err)
+		}
+		watchlisted = len(ids)
+	}
+
+	rates, err := historicalRates(db)
+	if err != nil {
+		return fmt.Errorf("reading past runs: %w", err)
+	}
+	callsPerMovie, perCall := rates.CallsPerMovie, rates.PerCall
+	basis := fmt.Sprintf("%d past syncs", rates.Runs)
+	if rates.Runs == 0 {
+		// Person details and retries are unaccounted for without history.
+		callsPerMovie = float64(max(1, (len(cfg.DetailsAppend)+tmdbAppendLimit-1)/tmdbAppendLimit))
+		if cfg.WatchProviders {
+			callsPerMovie++
+		}
+		perCall = time.Duration(float64(time.Second) / cfg.Preset.RequestsPerSecond)
+		basis = "the configuration, without past syncs"
+	}
+	total := movies + watchlisted
+	calls := int(page.TotalPages) + int(float64(total)*callsPerMovie+0.5)
+	duration := time.Duration(calls) * perCall
+
+	var sizes []struct {
+		Table string  `gorm:"column:table"`
+		Rows  float64 `gorm:"column:rows"`
+	}
+	err = db.Raw(`SELECT c."relname" AS "table", GREATEST(c."reltuples", 0) AS "rows"
+		FROM pg_class c JOIN pg_namespace n ON n."oid" = c."relnamespace"
+		WHERE n."nspname" = current_schema() AND c."relkind" = 'r' AND c."relname" IN ?`, planTables).Scan(&sizes).Error
+	if err != nil {
+		return fmt.Errorf("estimating table sizes: %w", err)
+	}
+	byTable := map[string]float64{}
+	for _, s := range sizes {
+		byTable[s.Table] = s.Rows
+	}
+
+	outputf("Plan for changes from %s to %s\n", window.Start.Format(time.RFC3339), window.End.Format(time.RFC3339))
+	outputf("  Changes pages:   %d\n", page.TotalPages)
+	outputf("  Movies:          %d changed, %d watchlisted\n", movies, watchlisted)
+	outputf("  API calls:       %d (%.1f per movie)\n", calls, callsPerMovie)
+	outputf("  Duration:        %s (%s per call)\n", duration.Round(time.Second), perCall.Round(time.Millisecond))
+	outputf("  Rates from:      %s\n", basis)
+	if moviesRows := byTable["Movie"]; moviesRows > 0 {
+		outputln("  Expected rows:")
+		for _, table := range planTables {
+			if perMovie := byTable[table] / moviesRows; perMovie > 0 {
+				outputf("    %-20s %d\n", table, int(float64(total)*perMovie+0.5))
+			}
+		}
+	}
+
+	if *maxCalls > 0 && calls > *maxCalls {
+		return fmt.Errorf("%d estimated API calls exceed --max-calls %d", calls, *maxCalls)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package sync
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// A playbook runs several commands in order, so the external scheduler
+// needs a single entry:
+//
+//	steps:
+//	  - command: sync
+//	    args: [--media, both]
+//	    retries: 2
+//	  - command: recent
+//	    onError: continue
+//	  - command: gap-report
+//	    onError: ignore
+//
+// onError decides what a failed step does to the rest: stop (the default)
+// skips the remaining steps, continue runs them but fails the playbook,
+// ignore runs them as if the step had succeeded. A step is attempted up to
+// retries more times, retryDelay apart, before its policy applies. An
+// interrupted playbook always stops.
+
+type Playbook struct {
+	Steps []PlaybookStep `yaml:"steps"`
+}
+
+type PlaybookStep struct {
+	// Name labels the step in logs; it defaults to the command.
+	Name       string        `yaml:"name"`
+	Command    string        `yaml:"command"`
+	Args       []string      `yaml:"args"`
+	OnError    string        `yaml:"onError"`
+	Retries    int           `yaml:"retries"`
+	RetryDelay time.Duration `yaml:"retryDelay"`
+}
+
+const (
+	onErrorStop     = "stop"
+	onErrorContinue = "continue"
+	onErrorIgnore   = "ignore"
+)
+
+// The playbook command refers to the commands map, so it is registered
+// once the map is initialized.
+func init() {
+	commands["playbook"] = runPlaybook
+}
+
+func loadPlaybook(path string) (Playbook, error) {
+	var p Playbook
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return p, err
+	}
+	if err := yaml.Unmarshal(raw, &p); err != nil {
+		return p, err
+	}
+	var problems []error
+	for i := range p.Steps {
+		step := &p.Steps[i]
+		if step.Name == "" {
+			step.Name = step.Command
+		}
+		if step.OnError == "" {
+			step.OnError = onErrorStop
+		}
+		if _, ok := commands[step.Command]; !ok || step.Command == "playbook" {
+			problems = append(problems, fmt.Errorf("step %d: %q is not a command a playbook can run", i+1, step.Command))
+		}
+		switch step.OnError {
+		case onErrorStop, onErrorContinue, onErrorIgnore:
+		default:
+			problems = append(problems, fmt.Errorf("step %d: onError %q is not stop, continue or ignore", i+1, step.OnError))
+		}
+		if step.Retries < 0 || step.RetryDelay < 0 {
+			problems = append(problems, fmt.Errorf("step %d: retries and retryDelay must not be negative", i+1))
+		}
+	}
+	return p, errors.Join(problems...)
+}
+
+// runPlaybook runs the steps of the playbook file in order.
+func runPlaybook(db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("playbook", flag.ContinueOnError)
+	file := fs.String("file", os.Getenv("PLAYBOOK_FILE"), "playbook YAML file (default PLAYBOOK_FILE)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return errors.New("--file or PLAYBOOK_FILE is required")
+	}
+	playbook, err := loadPlaybook(*file)
+	if err != nil {
+		return fmt.Errorf("playbook %s:\n%w", *file, err)
+	}
+
+	var failed []string
+	for i, step := range playbook.Steps {
+		if interrupted() {
+			return fmt.Errorf("playbook stopped before step %s: %w", step.Name, ErrInterrupted)
+		}
+		outputf("Playbook step %d/%d: %s %s\n", i+1, len(playbook.Steps), step.Command, strings.Join(step.Args, " "))
+		err := runPlaybookStep(db, step)
+		if err == nil {
+			continue
+		}
+		outputf("Playbook step %s failed: %v\n", step.Name, err)
+		if interrupted() || step.OnError == onErrorStop {
+			return fmt.Errorf("step %s: %w", step.Name, err)
+		}
+		if step.OnError == onErrorContinue {
+			failed = append(failed, step.Name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("playbook steps failed: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func runPlaybookStep(db *gorm.DB, step PlaybookStep) error {
+	var err error
+	for attempt := 0; attempt <= step.Retries; attempt++ {
+		if attempt > 0 {
+			outputf("Retrying step %s (%d/%d) in %s\n", step.Name, attempt, step.Retries, step.RetryDelay)
+			select {
+			case <-time.After(step.RetryDelay):
+			case <-runCtx.Done():
+				return err
+			}
+		}
+		if err = commands[step.Command](db, step.Args); err == nil || interrupted() {
+			return err
+		}
+	}
+	return err
+}
@@ -0,0 +1,68 @@
+package sync
+
+import (
+	"sync"
+	"time"
+)
+
+// runPool calls fn from a fixed number of worker goroutines for every value
+// received on in, skipping values already seen, and returns once in is
+// closed and all calls have returned. Once the command is interrupted the
+// remaining values are drained without calling fn, so senders never block.
+// While the watchdog throttles, fewer than workers calls run at a time.
+func runPool[T comparable](in <-chan T, workers int, fn func(T)) {
+	var mu sync.Mutex
+	seen := map[T]bool{}
+	active := 0
+	first := func(v T) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if seen[v] {
+			return false
+		}
+		seen[v] = true
+		return true
+	}
+	acquire := func() {
+		for {
+			mu.Lock()
+			if active < throttled(workers) || interrupted() {
+				active++
+				mu.Unlock()
+				return
+			}
+			mu.Unlock()
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	release := func() {
+		mu.Lock()
+		active--
+		mu.Unlock()
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < max(workers, 1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for v := range in {
+				if first(v) && !interrupted() {
+					acquire()
+					fn(v)
+					release()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// workerCount is the number of movies fetched concurrently: WORKER_COUNT if
+// set, otherwise the preset's.
+func workerCount() int {
+	if cfg.WorkerCount > 0 {
+		return cfg.WorkerCount
+	}
+	return cfg.Preset.Workers
+}
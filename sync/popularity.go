@@ -0,0 +1,31 @@
+package sync
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PopularitySnapshot is a movie's TMDB popularity on the day it was written,
+// kept for trends; a movie written twice a day keeps the later value.
+type PopularitySnapshot struct {
+	MovieId    uint32 `gorm:"column:movieId"`
+	Day        string `gorm:"column:day;type:date"`
+	Popularity float32
+}
+
+func writePopularitySnapshots(tx *gorm.DB, movies []MovieDB) error {
+	if !cfg.PopularitySnapshots || len(movies) == 0 {
+		return nil
+	}
+	day := time.Now().UTC().Format(time.DateOnly)
+	rows := make([]PopularitySnapshot, 0, len(movies))
+	for _, m := range movies {
+		rows = append(rows, PopularitySnapshot{MovieId: m.ID, Day: day, Popularity: m.Popularity})
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "movieId"}, {Name: "day"}},
+		DoUpdates: clause.AssignmentColumns([]string{"popularity"}),
+	}).Table("MoviePopularitySnapshot").Create(&rows).Error
+}
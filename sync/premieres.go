@@ -0,0 +1,56 @@
+package sync
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// runPremieres force-refreshes every movie with a release on the given date
+// in the given country, ahead of premiere-day traffic.
+func runPremieres(db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("premieres", flag.ContinueOnError)
+	date := fs.String("date", "", "release date, YYYY-MM-DD")
+	country := fs.String("country", "", "ISO 3166-1 country code")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *date == "" || *country == "" {
+		return errors.New("--date and --country are required")
+	}
+	day, err := time.Parse("2006-01-02", *date)
+	if err != nil {
+		return fmt.Errorf("--date: %w", err)
+	}
+
+	var ids []uint32
+	err = db.Table(`"MLocalRelease" lr`).
+		Joins(`JOIN "MReleaseCountry" rc ON `+releaseJoin).
+		Where(`rc."iso31661" = ? AND lr."releaseDate"::date = ?`, strings.ToUpper(*country), day.Format("2006-01-02")).
+		Distinct(`rc."movieId"`).
+		Pluck(`rc."movieId"`, &ids).Error
+	if err != nil {
+		return err
+	}
+	outputf("Refreshing %d movies premiering %s in %s\n", len(ids), *date, strings.ToUpper(*country))
+
+	return withRun(db, "premieres", func() error {
+		afterMovieWrites(db, syncMovieIDs(db, idsChannel(ids)))
+		return nil
+	})
+}
+
+// idsChannel returns a closed channel pre-filled with ids, for feeding a
+// fixed set of movies into syncMovieIDs.
+func idsChannel(ids []uint32) chan uint32 {
+	ch := make(chan uint32, len(ids))
+	for _, id := range ids {
+		ch <- id
+	}
+	close(ch)
+	return ch
+}
@@ -0,0 +1,48 @@
+package sync
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/time/rate"
+)
+
+// Preset bundles the knobs that trade run time against load on TMDB and
+// the database.
+type Preset struct {
+	// RequestsPerSecond caps TMDB requests across all workers.
+	RequestsPerSecond float64
+	// Workers is the number of movies fetched concurrently.
+	Workers int
+	// BatchSize is the number of rows per insert statement.
+	BatchSize int
+}
+
+// presets leave TMDB's limit of tmdbMaxRPS room for the person limiter at
+// its default PERSON_DETAILS_RPS.
+var presets = map[string]Preset{
+	"gentle":     {RequestsPerSecond: 10, Workers: 4, BatchSize: 200},
+	"standard":   {RequestsPerSecond: 40, Workers: 16, BatchSize: 500},
+	"aggressive": {RequestsPerSecond: 40, Workers: 32, BatchSize: 1000},
+}
+
+// LookupPreset returns the preset called name.
+func LookupPreset(name string) (Preset, error) {
+	p, ok := presets[name]
+	if !ok {
+		names := make([]string, 0, len(presets))
+		for n := range presets {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return p, fmt.Errorf("unknown preset %q, expected one of %s", name, strings.Join(names, ", "))
+	}
+	return p, nil
+}
+
+// applyPreset makes p the active preset and retunes the shared TMDB limiter.
+func applyPreset(p Preset) {
+	cfg.Preset = p
+	limiter.SetLimit(rate.Limit(p.RequestsPerSecond))
+}
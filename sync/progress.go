@@ -0,0 +1,170 @@
+package sync
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RunProgress rows tell the admin dashboard how far each stage of the
+// running sync got, refreshed every RUN_PROGRESS_INTERVAL. A finished run
+// keeps its last rows with finishedAt set; rows older than a week are
+// dropped when a run starts.
+type RunProgress struct {
+	RunId      uint64     `gorm:"column:runId"`
+	Stage      string     `gorm:"column:stage"`
+	Mode       string     `gorm:"column:mode"`
+	Done       int64      `gorm:"column:done"`
+	Total      int64      `gorm:"column:total"`
+	UpdatedAt  time.Time  `gorm:"column:updatedAt"`
+	FinishedAt *time.Time `gorm:"column:finishedAt"`
+}
+
+// Progress stages.
+const (
+	stageIndex  = "index"
+	stageMovies = "movies"
+	stagePeople = "people"
+)
+
+// stageProgress counts the items a stage handled out of those it expects.
+type stageProgress struct {
+	done, total atomic.Int64
+}
+
+func (p *stageProgress) add(n int) { p.done.Add(int64(n)) }
+
+func (p *stageProgress) setTotal(n int) { p.total.Store(int64(n)) }
+
+// expect makes room for n more items beyond those done. Stages fed in
+// chunks whose total is known up front are not grown by their chunks.
+func (p *stageProgress) expect(n int) {
+	want := p.done.Load() + int64(n)
+	for {
+		total := p.total.Load()
+		if total >= want || p.total.CompareAndSwap(total, want) {
+			return
+		}
+	}
+}
+
+// progress holds the stages of the current run.
+var progress = struct {
+	sync.Mutex
+	stages map[string]*stageProgress
+}{stages: map[string]*stageProgress{}}
+
+func progressStage(name string) *stageProgress {
+	progress.Lock()
+	defer progress.Unlock()
+	p, ok := progress.stages[name]
+	if !ok {
+		p = &stageProgress{}
+		progress.stages[name] = p
+	}
+	return p
+}
+
+func progressRows(finished bool) []RunProgress {
+	progress.Lock()
+	defer progress.Unlock()
+	now := time.Now()
+	rows := make([]RunProgress, 0, len(progress.stages))
+	for name, p := range progress.stages {
+		row := RunProgress{
+			RunId: currentRun.ID, Stage: name, Mode: currentRun.Mode,
+			Done: p.done.Load(), Total: p.total.Load(), UpdatedAt: now,
+		}
+		if finished {
+			row.FinishedAt = &now
+		}
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Stage < rows[j].Stage })
+	return rows
+}
+
+// progressSummary formats the stages for status dumps.
+func progressSummary() string {
+	var parts []string
+	for _, row := range progressRows(false) {
+		parts = append(parts, fmt.Sprintf("%s=%d/%d", row.Stage, row.Done, row.Total))
+	}
+	return strings.Join(parts, " ")
+}
+
+func writeProgress(db *gorm.DB, finished bool) error {
+	rows := progressRows(finished)
+	if len(rows) == 0 {
+		return nil
+	}
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "runId"}, {Name: "stage"}},
+		DoUpdates: clause.AssignmentColumns([]string{"done", "total", "updatedAt", "finishedAt"}),
+	}).Table("RunProgress").Create(&rows).Error
+}
+
+// defaultProgressInterval paces Config.OnProgress when RUN_PROGRESS_INTERVAL
+// is zero.
+const defaultProgressInterval = 5 * time.Second
+
+// startProgress resets the stages for the current run and, unless
+// RUN_PROGRESS_INTERVAL is zero, writes them periodically until the
+// returned function writes them a last time. Config.OnProgress gets them
+// at the same points.
+func startProgress(db *gorm.DB) func() {
+	progress.Lock()
+	progress.stages = map[string]*stageProgress{}
+	progress.Unlock()
+	if cfg.RunProgressInterval <= 0 && cfg.OnProgress == nil {
+		return func() {}
+	}
+	if cfg.RunProgressInterval > 0 {
+		if err := db.Exec(`DELETE FROM "RunProgress" WHERE "updatedAt" < now() - interval '7 days'`).Error; err != nil {
+			outputln("Error pruning run progress:", err)
+		}
+	}
+	interval := cfg.RunProgressInterval
+	if interval <= 0 {
+		interval = defaultProgressInterval
+	}
+	publish := func(finished bool) {
+		if cfg.OnProgress != nil {
+			cfg.OnProgress(progressRows(finished))
+		}
+		if cfg.RunProgressInterval <= 0 {
+			return
+		}
+		if err := writeProgress(db, finished); err != nil {
+			outputln("Error writing run progress:", err)
+		}
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				publish(false)
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		wg.Wait()
+		publish(true)
+	}
+}
@@ -0,0 +1,231 @@
+package sync
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Suspicious field values are not written. The movie is stored with the
+// field it already had and the proposed value waits in Quarantine until the
+// review command accepts or rejects it. Rejected values are remembered, so
+// the next resync doesn't queue them again.
+
+const (
+	quarantinePending  = "pending"
+	quarantineAccepted = "accepted"
+	quarantineRejected = "rejected"
+)
+
+type QuarantineEntry struct {
+	ID         uint64
+	EntityType string     `gorm:"column:entityType"`
+	EntityId   string     `gorm:"column:entityId"`
+	Field      string     `gorm:"column:field"`
+	OldValue   *string    `gorm:"column:oldValue"`
+	NewValue   string     `gorm:"column:newValue"`
+	Reason     string     `gorm:"column:reason"`
+	Status     string     `gorm:"column:status"`
+	RunId      uint64     `gorm:"column:runId"`
+	CreatedAt  time.Time  `gorm:"column:createdAt"`
+	ReviewedAt *time.Time `gorm:"column:reviewedAt"`
+}
+
+type storedMovieFields struct {
+	ID          uint32
+	Runtime     uint16
+	ReleaseDate *string `gorm:"column:releaseDate"`
+}
+
+// earliestReleaseYear rejects release dates before the first films.
+const earliestReleaseYear = 1870
+
+// screenMovies returns objects with quarantined fields reset to their stored
+// values and queues the proposed values for review.
+func screenMovies(tx *gorm.DB, objects []MovieDB) ([]MovieDB, error) {
+	if !cfg.Quarantine {
+		return objects, nil
+	}
+	ids := make([]uint32, 0, len(objects))
+	keys := make([]string, 0, len(objects))
+	for _, o := range objects {
+		ids = append(ids, o.ID)
+		keys = append(keys, strconv.Itoa(int(o.ID)))
+	}
+
+	var stored []storedMovieFields
+	err := tx.Table("Movie").
+		Select(`"id", "runtime", to_char("primaryReleaseDate"::date, 'YYYY-MM-DD') AS "releaseDate"`).
+		Where(`"id" IN ?`, ids).Scan(&stored).Error
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[uint32]storedMovieFields, len(stored))
+	for _, s := range stored {
+		existing[s.ID] = s
+	}
+
+	var rejectedRows []QuarantineEntry
+	err = tx.Table("Quarantine").
+		Where(`"entityType" = 'movie' AND "status" = ? AND "entityId" IN ?`, quarantineRejected, keys).
+		Find(&rejectedRows).Error
+	if err != nil {
+		return nil, err
+	}
+	rejected := map[string]bool{}
+	for _, r := range rejectedRows {
+		rejected[r.EntityId+"/"+r.Field+"/"+r.NewValue] = true
+	}
+
+	screened := make([]MovieDB, 0, len(objects))
+	var entries []QuarantineEntry
+	for _, o := range objects {
+		old, known := existing[o.ID]
+		key := strconv.Itoa(int(o.ID))
+		hold := func(field, newValue string, oldValue *string, reason string) {
+			if rejected[key+"/"+field+"/"+newValue] {
+				return
+			}
+			entries = append(entries, QuarantineEntry{
+				EntityType: "movie",
+				EntityId:   key,
+				Field:      field,
+				OldValue:   oldValue,
+				NewValue:   newValue,
+				Reason:     reason,
+				Status:     quarantinePending,
+				RunId:      currentRun.ID,
+				CreatedAt:  time.Now(),
+			})
+		}
+
+		if o.ReleaseDateStr != nil && !isCorrected(o.ID, "primaryReleaseDate") {
+			if reason := releaseDateProblem(*o.ReleaseDateStr, old.ReleaseDate); reason != "" {
+				hold("primaryReleaseDate", *o.ReleaseDateStr, old.ReleaseDate, reason)
+				o.ReleaseDateStr = old.ReleaseDate
+				delete(o.sources, "primaryReleaseDate")
+			}
+		}
+		if known && !isCorrected(o.ID, "runtime") && runtimeJumped(old.Runtime, o.Runtime) {
+			prev := strconv.Itoa(int(old.Runtime))
+			hold("runtime", strconv.Itoa(int(o.Runtime)), &prev, fmt.Sprintf("runtime changed from %d to %d minutes", old.Runtime, o.Runtime))
+			o.Runtime = old.Runtime
+			delete(o.sources, "runtime")
+		}
+		screened = append(screened, o)
+	}
+
+	if len(entries) > 0 {
+		err := tx.Clauses(clause.OnConflict{
+			Columns:     []clause.Column{{Name: "entityType"}, {Name: "entityId"}, {Name: "field"}, {Name: "newValue"}},
+			TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: `"status" = 'pending'`}}},
+			DoNothing:   true,
+		}).Table("Quarantine").Create(&entries).Error
+		if err != nil {
+			return nil, err
+		}
+		outputf("Quarantined %d suspicious values\n", len(entries))
+	}
+	return screened, nil
+}
+
+func releaseDateProblem(value string, old *string) string {
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return "release date is not a date"
+	}
+	if date.Year() < earliestReleaseYear {
+		return fmt.Sprintf("release year %d predates cinema", date.Year())
+	}
+	if old == nil || cfg.QuarantineReleaseJumpYears <= 0 {
+		return ""
+	}
+	prev, err := time.Parse("2006-01-02", *old)
+	if err != nil {
+		return ""
+	}
+	if years := math.Abs(date.Sub(prev).Hours()) / 24 / 365.25; years >= float64(cfg.QuarantineReleaseJumpYears) {
+		return fmt.Sprintf("release date moved %.0f years from %s", years, *old)
+	}
+	return ""
+}
+
+func runtimeJumped(old, next uint16) bool {
+	if old == 0 || next == 0 || cfg.QuarantineRuntimeRatio <= 0 {
+		return false
+	}
+	ratio := float64(old) / float64(next)
+	return ratio >= cfg.QuarantineRuntimeRatio || 1/ratio >= cfg.QuarantineRuntimeRatio
+}
+
+// quarantineColumns lists the Movie columns a review may write.
+var quarantineColumns = map[string]bool{"primaryReleaseDate": true, "runtime": true}
+
+// runReview lists pending quarantine entries, or accepts or rejects one.
+// Accepting writes the proposed value into the main table.
+func runReview(db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("review", flag.ContinueOnError)
+	accept := fs.Uint64("accept", 0, "quarantine entry to apply")
+	reject := fs.Uint64("reject", 0, "quarantine entry to discard")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	switch {
+	case *accept != 0 && *reject != 0:
+		return errors.New("pass only one of --accept and --reject")
+	case *accept != 0:
+		return reviewEntry(db, *accept, quarantineAccepted)
+	case *reject != 0:
+		return reviewEntry(db, *reject, quarantineRejected)
+	}
+
+	var pending []QuarantineEntry
+	if err := db.Table("Quarantine").Where(`"status" = ?`, quarantinePending).Order(`"id"`).Find(&pending).Error; err != nil {
+		return err
+	}
+	for _, e := range pending {
+		old := "<none>"
+		if e.OldValue != nil {
+			old = *e.OldValue
+		}
+		outputf("%d\t%s %s\t%s: %s -> %s\t%s\n", e.ID, e.EntityType, e.EntityId, e.Field, old, e.NewValue, e.Reason)
+	}
+	outputf("%d entries pending review\n", len(pending))
+	return nil
+}
+
+func reviewEntry(db *gorm.DB, id uint64, status string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var entry QuarantineEntry
+		if err := tx.Table("Quarantine").Clauses(clause.Locking{Strength: "UPDATE"}).Where(`"id" = ?`, id).Take(&entry).Error; err != nil {
+			return fmt.Errorf("quarantine entry %d: %w", id, err)
+		}
+		if entry.Status != quarantinePending {
+			return fmt.Errorf("quarantine entry %d is already %s", id, entry.Status)
+		}
+		if status == quarantineAccepted {
+			if entry.EntityType != "movie" || !quarantineColumns[entry.Field] {
+				return fmt.Errorf("quarantine entry %d: cannot apply %s.%s", id, entry.EntityType, entry.Field)
+			}
+			if err := tx.Table("Movie").Where(`"id" = ?`, entry.EntityId).Update(entry.Field, entry.NewValue).Error; err != nil {
+				return err
+			}
+			if err := recordChanges(tx, "movie", opUpsert, []string{entry.EntityId}); err != nil {
+				return err
+			}
+		}
+		err := tx.Table("Quarantine").Where(`"id" = ?`, id).
+			Updates(map[string]any{"status": status, "reviewedAt": time.Now()}).Error
+		if err == nil {
+			outputf("Quarantine entry %d %s\n", id, status)
+		}
+		return err
+	})
+}
@@ -0,0 +1,58 @@
+package sync
+
+import (
+	"flag"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// runRecent re-syncs every movie released in the last RecentReleaseDays days,
+// either worldwide or in one of the configured regions, independently of the
+// changes feed. It is meant to be scheduled daily and skips itself when a
+// recent refresh already finished today, unless --force is given.
+func runRecent(db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("recent", flag.ContinueOnError)
+	days := fs.Int("days", cfg.RecentReleaseDays, "size of the recent-release cohort in days")
+	force := fs.Bool("force", false, "run even if a recent refresh already finished today")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if !*force {
+		last, err := lastFinishedRun("recent")
+		if err != nil {
+			return err
+		}
+		if last != nil && sameDay(*last, time.Now()) {
+			outputf("Recent releases already refreshed at %s, skipping\n", last.Format(time.RFC3339))
+			return nil
+		}
+	}
+
+	query := db.Table(`"Movie" m`).
+		Where(`m."primaryReleaseDate"::date BETWEEN current_date - make_interval(days => ?) AND current_date`, *days)
+	if countries := cfg.regionCountries(); len(countries) > 0 {
+		query = query.Or(`EXISTS (
+			SELECT 1 FROM "MReleaseCountry" rc JOIN "MLocalRelease" lr ON `+releaseJoin+`
+			WHERE rc."movieId" = m."id" AND rc."iso31661" IN ?
+				AND lr."releaseDate"::date BETWEEN current_date - make_interval(days => ?) AND current_date
+		)`, countries, *days)
+	}
+	var ids []uint32
+	if err := query.Pluck(`m."id"`, &ids).Error; err != nil {
+		return err
+	}
+	outputf("Refreshing %d movies released in the last %d days\n", len(ids), *days)
+
+	return withRun(db, "recent", func() error {
+		afterMovieWrites(db, syncMovieIDs(db, idsChannel(ids)))
+		return nil
+	})
+}
+
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Local().Date()
+	by, bm, bd := b.Local().Date()
+	return ay == by && am == bm && ad == bd
+}
@@ -0,0 +1,118 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// A movie's actors, directors, crew, genres, countries and release rows are
+// upserted row by row, so rows TMDB dropped since the last sync would
+// linger. Instead each parsed movie carries the keys of its fresh rows, and
+// the transaction upserting the movie deletes every other row of it in
+// those tables. The fresh rows
+// themselves go through their own writers and may land before or after;
+// either way they are kept. Credits and releases are only reconciled when
+// the payload came with them, and rows dropped by CREDITS or CREW_ROLES
+// count as gone.
+
+// reconciledTable is a join table reconciled against the fresh rows of
+// its movies.
+type reconciledTable struct {
+	Table string
+	// Entity names the table's rows in the changefeed.
+	Entity string
+	// Columns key a row, movieId first.
+	Columns []string
+}
+
+var reconciledTables = []reconciledTable{
+	{"MovieActor", "movieActor", []string{"movieId", "actorId"}},
+	{"MovieDirector", "movieDirector", []string{"movieId", "directorId"}},
+	{"MovieCrew", "movieCrew", []string{"movieId", "personId", "job"}},
+	{"MovieGenre", "movieGenre", []string{"movieId", "genreId"}},
+	{"MovieCountry", "movieCountry", []string{"movieId", "countryIso"}},
+	{"MReleaseCountry", "releaseCountry", []string{"movieId", "iso31661"}},
+	{"MLocalRelease", "localRelease", []string{"movieId", "iso31661", "type", "releaseDate"}},
+}
+
+// reconcileParams bounds the bind parameters of one delete, well under
+// Postgres' limit of 65535.
+const reconcileParams = 30000
+
+// setFresh records the keys of a movie's fresh rows in table, each in the
+// order of the table's Columns.
+func (m *MovieDB) setFresh(table string, keys [][]any) {
+	if m.fresh == nil {
+		m.fresh = map[string][][]any{}
+	}
+	m.fresh[table] = keys
+}
+
+// reconcileAssociations deletes the rows of movies that aren't among their
+// fresh rows, recording the deletions in the changefeed.
+func reconcileAssociations(tx *gorm.DB, movies []MovieDB) error {
+	for _, t := range reconciledTables {
+		var ids []uint32
+		var fresh [][]any
+		flush := func() error {
+			err := deleteStaleRows(tx, t, ids, fresh)
+			ids, fresh = nil, nil
+			return err
+		}
+		for _, m := range movies {
+			keys, ok := m.fresh[t.Table]
+			if !ok {
+				continue
+			}
+			if (len(fresh)+len(keys))*len(t.Columns)+len(ids) > reconcileParams && len(ids) > 0 {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+			ids = append(ids, m.ID)
+			fresh = append(fresh, keys...)
+		}
+		if len(ids) > 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func deleteStaleRows(tx *gorm.DB, t reconciledTable, ids []uint32, fresh [][]any) error {
+	columns := `"` + strings.Join(t.Columns, `", "`) + `"`
+	query := `DELETE FROM "` + t.Table + `" WHERE "movieId" IN ?`
+	args := []any{ids}
+	if len(fresh) > 0 {
+		query += ` AND (` + columns + `) NOT IN ?`
+		args = append(args, fresh)
+	}
+	var deleted []map[string]any
+	if err := tx.Raw(query+` RETURNING `+columns, args...).Scan(&deleted).Error; err != nil {
+		return fmt.Errorf("reconciling %s: %w", t.Table, err)
+	}
+	return recordChanges(tx, t.Entity, opDelete, changeKeys(t.Columns, deleted))
+}
+
+// changeKeys joins the columns of each row into its changefeed key, in the
+// format the writers use.
+func changeKeys(columns []string, rows []map[string]any) []string {
+	keys := make([]string, 0, len(rows))
+	for _, row := range rows {
+		parts := make([]string, len(columns))
+		for i, c := range columns {
+			if at, ok := row[c].(time.Time); ok {
+				parts[i] = at.Format(time.RFC3339)
+			} else {
+				parts[i] = fmt.Sprint(row[c])
+			}
+		}
+		keys = append(keys, strings.Join(parts, ":"))
+	}
+	return keys
+}
@@ -0,0 +1,50 @@
+package sync
+
+import (
+	"flag"
+
+	"gorm.io/gorm"
+)
+
+// stalenessSQL scores how overdue a movie is for a refresh: hours since its
+// last sync, weighted by popularity and boosted up to eightfold as its
+// release approaches within the next 60 days. Movies never synced by this
+// cron count as a year old.
+const stalenessSQL = `
+	extract(epoch FROM now() - COALESCE("syncedAt", now() - interval '365 days')) / 3600
+	* (1 + ln(1 + GREATEST("popularity", 0)))
+	* CASE
+		WHEN "primaryReleaseDate"::date BETWEEN current_date AND current_date + 60
+		THEN 1 + 7 * (60 - ("primaryReleaseDate"::date - current_date)) / 60.0
+		ELSE 1
+	END`
+
+// runRecrawl refreshes the staleness score of every movie and re-syncs the
+// --limit stalest ones, so movies absent from the changes feed still get
+// refreshed eventually.
+func runRecrawl(db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("recrawl", flag.ContinueOnError)
+	limit := fs.Int("limit", cfg.RecrawlLimit, "number of movies to re-sync")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if err := db.Exec(`UPDATE "Movie" SET "stalenessScore" = ` + stalenessSQL).Error; err != nil {
+		return err
+	}
+	var ids []uint32
+	err := db.Table("Movie").
+		Where(`"deletedAt" IS NULL`).
+		Order(`"stalenessScore" DESC NULLS LAST`).
+		Limit(*limit).
+		Pluck(`"id"`, &ids).Error
+	if err != nil {
+		return err
+	}
+	outputf("Re-crawling the %d stalest movies\n", len(ids))
+
+	return withRun(db, "recrawl", func() error {
+		afterMovieWrites(db, syncMovieIDs(db, idsChannel(ids)))
+		return nil
+	})
+}
@@ -0,0 +1,66 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+type moviePayload struct {
+	ID      uint32
+	Payload string
+}
+
+// primeRedisHotMovies serializes the most popular movies into Redis under
+// movie:{id} so the API layer can serve hot titles straight after a sync
+// without reading Postgres.
+func primeRedisHotMovies(db *gorm.DB, redisURL string, limit int, ttl time.Duration) error {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return fmt.Errorf("parsing REDIS_URL: %w", err)
+	}
+	rdb := redis.NewClient(opts)
+	defer rdb.Close()
+
+	expr, args := movieJSONSQL(0, nil)
+	var payloads []moviePayload
+	err = db.Raw(`SELECT m."id", `+expr+`::text AS "payload"
+		FROM "Movie" m
+		WHERE m."deletedAt" IS NULL
+		ORDER BY m."popularity" DESC
+		LIMIT ?`, append(args, limit)...).Scan(&payloads).Error
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	pipe := rdb.Pipeline()
+	for _, p := range payloads {
+		pipe.Set(ctx, "movie:"+strconv.Itoa(int(p.ID)), p.Payload, ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+	outputf("Primed %d hot movies in Redis\n", len(payloads))
+	return nil
+}
+
+// dropRedisMovies deletes the movie:{id} entries of ids.
+func dropRedisMovies(redisURL string, ids []uint32) error {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return fmt.Errorf("parsing REDIS_URL: %w", err)
+	}
+	rdb := redis.NewClient(opts)
+	defer rdb.Close()
+
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, "movie:"+strconv.Itoa(int(id)))
+	}
+	return rdb.Del(context.Background(), keys...).Err()
+}
@@ -0,0 +1,95 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Genre, Country and Language hold TMDB's reference lists, which
+// MovieGenre, SeriesGenre, MovieCountry and the original languages point
+// into. Every run refreshes them before it writes anything, so a genre or
+// country TMDB added since the last run exists before the first movie
+// using it. A list that can't be fetched keeps the rows of earlier runs;
+// the movie genres fall back to tmdbGenres.
+
+type Country struct {
+	ISO31661    string `gorm:"column:iso31661" json:"iso_3166_1"`
+	EnglishName string `gorm:"column:englishName" json:"english_name"`
+	NativeName  string `gorm:"column:nativeName" json:"native_name"`
+}
+
+type Language struct {
+	ISO6391     string `gorm:"column:iso6391" json:"iso_639_1"`
+	EnglishName string `gorm:"column:englishName" json:"english_name"`
+	Name        string `gorm:"column:name" json:"name"`
+}
+
+type genresResponse struct {
+	Genres []Genre `json:"genres"`
+}
+
+// bootstrapReferences upserts the reference lists, logging the ones that
+// failed instead of failing the run.
+func bootstrapReferences(db *gorm.DB) {
+	language := url.QueryEscape(cfg.Language)
+	var genres []Genre
+	seen := map[uint32]bool{}
+	for _, media := range []string{"movie", "tv"} {
+		var list genresResponse
+		if err := fetchReference(fmt.Sprintf("/genre/%s/list?language=%s", media, language), &list); err != nil {
+			logger.Warn("fetching genres failed", "media", media, "err", err)
+			if media == "movie" {
+				list.Genres = tmdbGenres
+			}
+		}
+		for _, g := range list.Genres {
+			if !seen[g.ID] {
+				seen[g.ID] = true
+				genres = append(genres, g)
+			}
+		}
+	}
+	if err := upsertReference(db, "Genre", &genres, []string{"name"}); err != nil {
+		logger.Error("writing genres failed", "err", err)
+	}
+
+	var countries []Country
+	if err := fetchReference("/configuration/countries?language="+language, &countries); err != nil {
+		logger.Warn("fetching countries failed", "err", err)
+	} else if err := upsertReference(db, "Country", &countries, []string{"englishName", "nativeName"}); err != nil {
+		logger.Error("writing countries failed", "err", err)
+	}
+
+	var languages []Language
+	if err := fetchReference("/configuration/languages", &languages); err != nil {
+		logger.Warn("fetching languages failed", "err", err)
+	} else if err := upsertReference(db, "Language", &languages, []string{"englishName", "name"}); err != nil {
+		logger.Error("writing languages failed", "err", err)
+	}
+	outputf("Reference tables: %d genres, %d countries, %d languages\n", len(genres), len(countries), len(languages))
+}
+
+func fetchReference(path string, v any) error {
+	body, err := fetchTMDB(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+// upsertReference writes rows into table, updating the updated columns of
+// the rows already there.
+func upsertReference[T any](db *gorm.DB, table string, rows *[]T, updated []string) error {
+	if len(*rows) == 0 {
+		return nil
+	}
+	return db.WithContext(context.Background()).Clauses(clause.OnConflict{
+		Columns:   conflictTarget(table),
+		DoUpdates: clause.AssignmentColumns(updated),
+	}).Table(table).Create(rows).Error
+}
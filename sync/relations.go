@@ -0,0 +1,134 @@
+package sync
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// MovieRelation types and the sources they are derived from.
+const (
+	relationSequelOf  = "sequelOf"
+	relationPrequelOf = "prequelOf"
+	relationRemakeOf  = "remakeOf"
+	relationRemadeAs  = "remadeAs"
+	// relationSameNovelAs links adaptations of the same novel.
+	relationSameNovelAs = "sameNovelAs"
+
+	relationSourceCollection = "collection"
+	relationSourceWikidata   = "wikidata"
+)
+
+// TMDB keywords marking remakes and literary adaptations.
+const (
+	keywordRemake       = "remake"
+	keywordBasedOnNovel = "based on novel or book"
+)
+
+func keywordFlags(keywords []Keyword) (remake, basedOnNovel bool) {
+	for _, k := range keywords {
+		switch strings.ToLower(k.Name) {
+		case keywordRemake:
+			remake = true
+		case keywordBasedOnNovel:
+			basedOnNovel = true
+		}
+	}
+	return remake, basedOnNovel
+}
+
+type Collection struct {
+	ID           uint32  `json:"id"`
+	Name         string  `json:"name"`
+	PosterPath   *string `json:"poster_path"`
+	BackdropPath *string `json:"backdrop_path"`
+}
+
+// rebuildSequelRelations recomputes the sequel and prequel relations of every
+// collection touched by the given movies. Members are ordered by primary
+// release date, each being the sequel of the one before; unreleased members
+// without a date are left out until they get one.
+func rebuildSequelRelations(db *gorm.DB, movieIDs []uint32) error {
+	if len(movieIDs) == 0 {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		// Collections the movies belong to now, or belonged to when their
+		// relations were last computed.
+		var collections []uint32
+		err := tx.Raw(`SELECT DISTINCT m."collectionId" FROM "Movie" m
+			WHERE m."collectionId" IS NOT NULL AND (m."id" IN ? OR m."id" IN (
+				SELECT r."relatedMovieId" FROM "MovieRelation" r
+				WHERE r."source" = ? AND r."movieId" IN ?
+			))`, movieIDs, relationSourceCollection, movieIDs).Scan(&collections).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Exec(`DELETE FROM "MovieRelation" WHERE "source" = ? AND ("movieId" IN ? OR "movieId" IN (
+				SELECT "id" FROM "Movie" WHERE "collectionId" IN ?
+			))`, relationSourceCollection, movieIDs, append(collections, 0)).Error
+		if err != nil || len(collections) == 0 {
+			return err
+		}
+
+		return tx.Exec(`
+			WITH ordered AS (
+				SELECT "id", lag("id") OVER (
+					PARTITION BY "collectionId" ORDER BY "primaryReleaseDate", "id"
+				) AS prev
+				FROM "Movie"
+				WHERE "collectionId" IN ? AND "primaryReleaseDate" IS NOT NULL AND "deletedAt" IS NULL
+			)
+			INSERT INTO "MovieRelation" ("movieId", "relatedMovieId", "type", "source")
+			SELECT "id", prev, ?, ? FROM ordered WHERE prev IS NOT NULL
+			UNION ALL
+			SELECT prev, "id", ?, ? FROM ordered WHERE prev IS NOT NULL
+			ON CONFLICT DO NOTHING`,
+			collections,
+			relationSequelOf, relationSourceCollection,
+			relationPrequelOf, relationSourceCollection).Error
+	})
+}
+
+// rebuildWorkRelations recomputes the relations derived from Wikidata's
+// "based on" statements. A movie based on a work that is itself a movie in
+// the catalog is a remake of it when TMDB tags it as a remake or the work
+// was released earlier. Movies flagged as novel adaptations that are based
+// on the same work are linked to each other, keeping the work in workId.
+func rebuildWorkRelations(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`DELETE FROM "MovieRelation" WHERE "source" = ?`, relationSourceWikidata).Error; err != nil {
+			return err
+		}
+		err := tx.Exec(`
+			WITH remakes AS (
+				SELECT b."movieId" AS remake, w."movieId" AS original, b."workId"
+				FROM "MovieBasedOn" b
+				JOIN "MovieWikidata" w ON w."wikidataId" = b."workId"
+				JOIN "Movie" rm ON rm."id" = b."movieId"
+				JOIN "Movie" om ON om."id" = w."movieId"
+				WHERE b."movieId" <> w."movieId"
+					AND (rm."isRemake" OR om."primaryReleaseDate" < rm."primaryReleaseDate")
+			)
+			INSERT INTO "MovieRelation" ("movieId", "relatedMovieId", "type", "source", "workId")
+			SELECT remake, original, ?, ?, "workId" FROM remakes
+			UNION ALL
+			SELECT original, remake, ?, ?, "workId" FROM remakes
+			ON CONFLICT DO NOTHING`,
+			relationRemakeOf, relationSourceWikidata, relationRemadeAs, relationSourceWikidata).Error
+		if err != nil {
+			return err
+		}
+		return tx.Exec(`
+			INSERT INTO "MovieRelation" ("movieId", "relatedMovieId", "type", "source", "workId")
+			SELECT a."movieId", b."movieId", ?, ?, a."workId"
+			FROM "MovieBasedOn" a
+			JOIN "MovieBasedOn" b ON b."workId" = a."workId" AND b."movieId" <> a."movieId"
+			JOIN "Movie" am ON am."id" = a."movieId"
+			JOIN "Movie" bm ON bm."id" = b."movieId"
+			WHERE am."basedOnNovel" AND bm."basedOnNovel"
+			ON CONFLICT DO NOTHING`,
+			relationSameNovelAs, relationSourceWikidata).Error
+	})
+}
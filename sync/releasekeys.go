@@ -0,0 +1,161 @@
+package sync
+
+import (
+	"gorm.io/gorm"
+)
+
+// MReleaseCountry is keyed by (movieId, iso31661) and MLocalRelease by
+// (movieId, iso31661, type, releaseDate). Earlier versions gave both
+// synthetic IDs concatenating the movie ID and the index in the payload,
+// which collided between movies (12 and 34 against 123 and 4) and moved
+// when TMDB reordered a movie's releases. Natural-key writes are true
+// upserts, and a movie's stale release rows are deleted along with it, see
+// reconcile.go. Tables still in the synthetic-ID layout are migrated when
+// the cron starts; the website schema must follow the same layout.
+
+// releaseJoin is the condition joining MReleaseCountry rc to MLocalRelease lr.
+const releaseJoin = `rc."movieId" = lr."movieId" AND rc."iso31661" = lr."iso31661"`
+
+// migrateReleaseKeys moves release tables still in the synthetic-ID layout,
+// recognised by MReleaseCountry's "id" column, to natural keys.
+func migrateReleaseKeys(db *gorm.DB) error {
+	var surrogate bool
+	err := db.Raw(`SELECT EXISTS (SELECT 1 FROM information_schema.columns
+		WHERE "table_schema" = current_schema() AND "table_name" = 'MReleaseCountry' AND "column_name" = 'id')`).Scan(&surrogate).Error
+	if err != nil || !surrogate {
+		return err
+	}
+	logger.Info("migrating release tables from synthetic IDs to natural keys")
+	if err := migrateNaturalKeys(db); err != nil {
+		return err
+	}
+	logger.Info("release tables migrated to natural keys")
+	return nil
+}
+
+// migrateNaturalKeys rebuilds the release tables in the natural-key layout. The surrogate tables are kept as MReleaseCountry_surrogate and
+// MLocalRelease_surrogate for rollback, their indexes renamed with the same
+// suffix; duplicate local releases collapse onto the one with the longest
+// note. The new tables get the old tables' indexes on columns they still
+// have, and the old tables' cascading foreign key to Movie.
+func migrateNaturalKeys(db *gorm.DB) error {
+	build := []string{
+		`CREATE TABLE "MReleaseCountry_natural" (
+			"movieId" integer NOT NULL,
+			"iso31661" text NOT NULL,
+			"localTitle" text,
+			PRIMARY KEY ("movieId", "iso31661")
+		)`,
+		`INSERT INTO "MReleaseCountry_natural" ("movieId", "iso31661", "localTitle")
+			SELECT DISTINCT ON ("movieId", "iso31661") "movieId", "iso31661", "localTitle"
+			FROM "MReleaseCountry"
+			ORDER BY "movieId", "iso31661", "localTitle" NULLS LAST`,
+		`CREATE TABLE "MLocalRelease_natural" (
+			"movieId" integer NOT NULL,
+			"iso31661" text NOT NULL,
+			"type" smallint NOT NULL,
+			"releaseDate" timestamp(3) NOT NULL,
+			"note" text,
+			"cutRuntime" smallint,
+			"noteCategory" "ReleaseNoteCategory",
+			"isImax" boolean NOT NULL DEFAULT false,
+			"is3d" boolean NOT NULL DEFAULT false,
+			"is70mm" boolean NOT NULL DEFAULT false,
+			"isDolby" boolean NOT NULL DEFAULT false,
+			"certification" text,
+			PRIMARY KEY ("movieId", "iso31661", "type", "releaseDate")
+		)`,
+		`INSERT INTO "MLocalRelease_natural" ("movieId", "iso31661", "type", "releaseDate", "note", "cutRuntime", "noteCategory", "isImax", "is3d", "is70mm", "isDolby", "certification")
+			SELECT DISTINCT ON (rc."movieId", rc."iso31661", lr."type", lr."releaseDate")
+				rc."movieId", rc."iso31661", lr."type", lr."releaseDate", lr."note", lr."cutRuntime", lr."noteCategory",
+				lr."isImax", lr."is3d", lr."is70mm", lr."isDolby", lr."certification"
+			FROM "MLocalRelease" lr JOIN "MReleaseCountry" rc ON rc."id" = lr."releaseCountryId"
+			ORDER BY rc."movieId", rc."iso31661", lr."type", lr."releaseDate", length(lr."note") DESC NULLS LAST`,
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, stmt := range build {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+
+		// Index names are schema-wide, so the old indexes have to make way
+		// before the new tables can have them.
+		var recreate, foreignKeys []string
+		for _, table := range []string{"MReleaseCountry", "MLocalRelease"} {
+			indexes, err := surrogateIndexes(tx, table)
+			if err != nil {
+				return err
+			}
+			for _, idx := range indexes {
+				if !idx.Primary && idx.Portable {
+					recreate = append(recreate, idx.Def)
+				}
+				if err := tx.Exec(`ALTER INDEX "` + idx.Name + `" RENAME TO "` + idx.Name + `_surrogate"`).Error; err != nil {
+					return err
+				}
+			}
+			var defs []string
+			err = tx.Raw(`SELECT pg_get_constraintdef(c."oid") FROM pg_constraint c
+				WHERE c."contype" = 'f' AND c."conrelid" = ?::regclass AND c."confrelid" = '"Movie"'::regclass`, `"`+table+`"`).
+				Scan(&defs).Error
+			if err != nil {
+				return err
+			}
+			foreignKeys = append(foreignKeys, defs...)
+		}
+
+		rename := []string{
+			`ALTER TABLE "MLocalRelease" RENAME TO "MLocalRelease_surrogate"`,
+			`ALTER TABLE "MReleaseCountry" RENAME TO "MReleaseCountry_surrogate"`,
+			`ALTER TABLE "MReleaseCountry_natural" RENAME TO "MReleaseCountry"`,
+			`ALTER TABLE "MLocalRelease_natural" RENAME TO "MLocalRelease"`,
+			`ALTER INDEX "MReleaseCountry_natural_pkey" RENAME TO "MReleaseCountry_pkey"`,
+			`ALTER INDEX "MLocalRelease_natural_pkey" RENAME TO "MLocalRelease_pkey"`,
+		}
+		// The index definitions name their table, which now is the new one.
+		for _, stmt := range append(rename, recreate...) {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		// The surrogate MLocalRelease reached Movie through its country; both
+		// new tables refer to Movie directly.
+		if len(foreignKeys) > 0 {
+			for _, table := range []string{"MReleaseCountry", "MLocalRelease"} {
+				stmt := `ALTER TABLE "` + table + `" ADD CONSTRAINT "` + table + `_movieId_fkey" ` + foreignKeys[0]
+				if err := tx.Exec(stmt).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// surrogateIndex is an index of a release table about to be replaced.
+type surrogateIndex struct {
+	Name    string
+	Def     string
+	Primary bool
+	// Portable reports whether every column the index covers exists in the
+	// natural-key table too.
+	Portable bool
+}
+
+func surrogateIndexes(tx *gorm.DB, table string) ([]surrogateIndex, error) {
+	var indexes []surrogateIndex
+	err := tx.Raw(`SELECT ic.relname AS name, pg_get_indexdef(i.indexrelid) AS def, i.indisprimary AS "primary",
+			NOT EXISTS (
+				SELECT 1 FROM unnest(i.indkey) AS k(attnum)
+				JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum
+				WHERE a.attname NOT IN (SELECT column_name FROM information_schema.columns
+					WHERE table_schema = current_schema() AND table_name = ?)
+			) AS portable
+		FROM pg_index i
+		JOIN pg_class t ON t.oid = i.indrelid
+		JOIN pg_class ic ON ic.oid = i.indexrelid
+		WHERE t.relname = ? AND t.relnamespace = current_schema()::regnamespace`, table+"_natural", table).
+		Scan(&indexes).Error
+	return indexes, err
+}
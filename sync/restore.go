@@ -0,0 +1,154 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/klauspost/compress/zstd"
+	"gorm.io/gorm"
+)
+
+// integrityChecks are queries counting rows whose references point nowhere.
+// They run after a restore, since the catalog tables don't all carry real
+// foreign keys.
+func integrityChecks() map[string]string {
+	return map[string]string{
+		"MovieActor.movieId":            `SELECT count(*) FROM "MovieActor" x WHERE NOT EXISTS (SELECT 1 FROM "Movie" m WHERE m."id" = x."movieId")`,
+		"MovieActor.actorId":            `SELECT count(*) FROM "MovieActor" x WHERE NOT EXISTS (SELECT 1 FROM "CinemaPerson" p WHERE p."id" = x."actorId")`,
+		"MovieDirector.movieId":         `SELECT count(*) FROM "MovieDirector" x WHERE NOT EXISTS (SELECT 1 FROM "Movie" m WHERE m."id" = x."movieId")`,
+		"MovieDirector.directorId":      `SELECT count(*) FROM "MovieDirector" x WHERE NOT EXISTS (SELECT 1 FROM "CinemaPerson" p WHERE p."id" = x."directorId")`,
+		"MovieCrew.movieId":             `SELECT count(*) FROM "MovieCrew" x WHERE NOT EXISTS (SELECT 1 FROM "Movie" m WHERE m."id" = x."movieId")`,
+		"MovieCrew.personId":            `SELECT count(*) FROM "MovieCrew" x WHERE NOT EXISTS (SELECT 1 FROM "CinemaPerson" p WHERE p."id" = x."personId")`,
+		"MovieGenre.movieId":            `SELECT count(*) FROM "MovieGenre" x WHERE NOT EXISTS (SELECT 1 FROM "Movie" m WHERE m."id" = x."movieId")`,
+		"MovieCountry.movieId":          `SELECT count(*) FROM "MovieCountry" x WHERE NOT EXISTS (SELECT 1 FROM "Movie" m WHERE m."id" = x."movieId")`,
+		"MReleaseCountry.movieId":       `SELECT count(*) FROM "MReleaseCountry" x WHERE NOT EXISTS (SELECT 1 FROM "Movie" m WHERE m."id" = x."movieId")`,
+		"MLocalRelease.releaseCountry":  `SELECT count(*) FROM "MLocalRelease" lr WHERE NOT EXISTS (SELECT 1 FROM "MReleaseCountry" rc WHERE ` + releaseJoin + `)`,
+		"MovieTranslation.movieId":      `SELECT count(*) FROM "MovieTranslation" x WHERE NOT EXISTS (SELECT 1 FROM "Movie" m WHERE m."id" = x."movieId")`,
+		"MovieExternalIds.movieId":      `SELECT count(*) FROM "MovieExternalIds" x WHERE NOT EXISTS (SELECT 1 FROM "Movie" m WHERE m."id" = x."movieId")`,
+		"MovieKeyword.movieId":          `SELECT count(*) FROM "MovieKeyword" x WHERE NOT EXISTS (SELECT 1 FROM "Movie" m WHERE m."id" = x."movieId")`,
+		"MovieAlternativeTitle.movieId": `SELECT count(*) FROM "MovieAlternativeTitle" x WHERE NOT EXISTS (SELECT 1 FROM "Movie" m WHERE m."id" = x."movieId")`,
+		"MovieWatchProvider.movieId":    `SELECT count(*) FROM "MovieWatchProvider" x WHERE NOT EXISTS (SELECT 1 FROM "Movie" m WHERE m."id" = x."movieId")`,
+		"MovieKeyword.keywordId":        `SELECT count(*) FROM "MovieKeyword" x WHERE NOT EXISTS (SELECT 1 FROM "Keyword" k WHERE k."id" = x."keywordId")`,
+		"MovieGenre.genreId":            `SELECT count(*) FROM "MovieGenre" x WHERE NOT EXISTS (SELECT 1 FROM "Genre" g WHERE g."id" = x."genreId")`,
+		"MovieCountry.countryIso":       `SELECT count(*) FROM "MovieCountry" x WHERE NOT EXISTS (SELECT 1 FROM "Country" c WHERE c."iso31661" = x."countryIso")`,
+		"PersonStats.personId":          `SELECT count(*) FROM "PersonStats" x WHERE NOT EXISTS (SELECT 1 FROM "CinemaPerson" p WHERE p."id" = x."personId")`,
+	}
+}
+
+// runRestore truncates the managed tables and reloads them from a snapshot in
+// a single transaction. Row counts must match the snapshot manifest and no
+// orphaned references may remain, otherwise nothing is changed.
+func runRestore(db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	name := fs.String("snapshot", "", `snapshot to restore, or "latest"`)
+	confirm := fs.Bool("confirm", false, "acknowledge that all managed tables will be replaced")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *name == "" {
+		return errors.New("--snapshot is required")
+	}
+	if !*confirm {
+		return errors.New("restore replaces all managed tables; pass --confirm to proceed")
+	}
+	if cfg.ObjectStoreURL == "" {
+		return errors.New("OBJECT_STORE_URL is required")
+	}
+	store, err := newObjectStore(cfg.ObjectStoreURL)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if *name == "latest" {
+		names, err := listSnapshots(ctx, store)
+		if err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			return errors.New("no snapshots found")
+		}
+		*name = names[0]
+	}
+	manifest, err := readSnapshotManifest(ctx, store, *name)
+	if err != nil {
+		return err
+	}
+
+	err = withPgxConn(ctx, db, func(conn *pgx.Conn) error {
+		return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			return restoreSnapshot(ctx, tx, store, manifest)
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("restoring snapshot %s: %w", *name, err)
+	}
+	outputf("Restored snapshot %s\n", *name)
+	return nil
+}
+
+func readSnapshotManifest(ctx context.Context, store objectStore, name string) (snapshotManifest, error) {
+	var manifest snapshotManifest
+	r, err := store.Get(ctx, snapshotPrefix+name+"/manifest.json")
+	if err != nil {
+		return manifest, fmt.Errorf("reading manifest of snapshot %s: %w", name, err)
+	}
+	defer r.Close()
+	err = json.NewDecoder(r).Decode(&manifest)
+	return manifest, err
+}
+
+func restoreSnapshot(ctx context.Context, tx pgx.Tx, store objectStore, manifest snapshotManifest) error {
+	quoted := make([]string, 0, len(manifest.Tables))
+	for _, t := range manifest.Tables {
+		quoted = append(quoted, `"`+t.Name+`"`)
+	}
+	if _, err := tx.Exec(ctx, `TRUNCATE `+strings.Join(quoted, ", ")); err != nil {
+		return err
+	}
+
+	for _, t := range manifest.Tables {
+		if err := restoreTable(ctx, tx, store, t); err != nil {
+			return fmt.Errorf("table %s: %w", t.Name, err)
+		}
+		var count int64
+		if err := tx.QueryRow(ctx, `SELECT count(*) FROM "`+t.Name+`"`).Scan(&count); err != nil {
+			return err
+		}
+		if count != t.Rows {
+			return fmt.Errorf("table %s: restored %d rows, snapshot has %d", t.Name, count, t.Rows)
+		}
+		outputf("Restored %s: %d rows\n", t.Name, count)
+	}
+
+	for name, query := range integrityChecks() {
+		var orphans int64
+		if err := tx.QueryRow(ctx, query).Scan(&orphans); err != nil {
+			return fmt.Errorf("integrity check %s: %w", name, err)
+		}
+		if orphans > 0 {
+			return fmt.Errorf("integrity check %s: %d orphaned rows", name, orphans)
+		}
+	}
+	return nil
+}
+
+func restoreTable(ctx context.Context, tx pgx.Tx, store objectStore, t snapshotTable) error {
+	r, err := store.Get(ctx, t.Key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	dec, err := zstd.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer dec.Close()
+	_, err = tx.Conn().PgConn().CopyFrom(ctx, dec, `COPY "`+t.Name+`" `+copyColumns(t.Columns)+`FROM STDIN`)
+	return err
+}
@@ -0,0 +1,179 @@
+package sync
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// errDryRun rolls back a transaction whose effects were only being measured.
+var errDryRun = errors.New("dry run")
+
+// retentionPolicy deletes rows that are no longer worth keeping in the hosted
+// DB. Statements must be safe to re-run. Policies deleting changefeed
+// entities name the entity and its key columns, read from the rows of alias.
+type retentionPolicy struct {
+	name  string
+	query string
+	args  []any
+
+	entity string
+	alias  string
+	keys   []string
+}
+
+func retentionPolicies(c Config) []retentionPolicy {
+	var policies []retentionPolicy
+	if c.RetentionChangefeedDays > 0 && c.StateStoreURL == "" {
+		policies = append(policies, retentionPolicy{
+			name:  "changefeed",
+			query: `DELETE FROM "Changefeed" WHERE "ts" < now() - make_interval(days => ?)`,
+			args:  []any{c.RetentionChangefeedDays},
+		})
+	}
+	if c.RetentionOutboxDays > 0 && c.StateStoreURL == "" {
+		policies = append(policies, retentionPolicy{
+			name:  "delivered outbox events",
+			query: `DELETE FROM "Outbox" WHERE "deliveredAt" < now() - make_interval(days => ?)`,
+			args:  []any{c.RetentionOutboxDays},
+		})
+	}
+	if c.RetentionArchiveDays > 0 && c.StateStoreURL == "" {
+		policies = append(policies, retentionPolicy{
+			name:  "raw payload archives",
+			query: `DELETE FROM "RawPayloadChunk" WHERE "createdAt" < now() - make_interval(days => ?)`,
+			args:  []any{c.RetentionArchiveDays},
+		})
+	}
+	if c.RetentionReleaseYears > 0 {
+		policies = append(policies, retentionPolicy{
+			name: "local releases of old unpopular movies",
+			query: `DELETE FROM "MLocalRelease" lr
+				USING "Movie" m
+				WHERE lr."movieId" = m."id"
+					AND m."primaryReleaseDate"::date < now() - make_interval(years => ?)
+					AND m."popularity" < ?`,
+			args:   []any{c.RetentionReleaseYears, c.RetentionPopularityBelow},
+			entity: "localRelease",
+			alias:  "lr",
+			keys:   []string{"movieId", "iso31661", "type", "releaseDate"},
+		}, retentionPolicy{
+			// The countries of those releases would be left empty.
+			name: "release countries without local releases",
+			query: `DELETE FROM "MReleaseCountry" rc
+				USING "Movie" m
+				WHERE rc."movieId" = m."id"
+					AND m."primaryReleaseDate"::date < now() - make_interval(years => ?)
+					AND m."popularity" < ?
+					AND NOT EXISTS (SELECT 1 FROM "MLocalRelease" lr WHERE ` + releaseJoin + `)`,
+			args:   []any{c.RetentionReleaseYears, c.RetentionPopularityBelow},
+			entity: "releaseCountry",
+			alias:  "rc",
+			keys:   []string{"movieId", "iso31661"},
+		})
+	}
+	if c.RetentionPopularitySnapshotDays > 0 {
+		policies = append(policies, retentionPolicy{
+			name:  "popularity snapshots",
+			query: `DELETE FROM "MoviePopularitySnapshot" WHERE "day" < current_date - ?::int`,
+			args:  []any{c.RetentionPopularitySnapshotDays},
+		})
+	}
+	if c.RetentionPeopleGraceDays > 0 {
+		// People are deleted only after going uncredited for the whole
+		// grace period, so a credit TMDB drops and restores between runs
+		// doesn't cost the person their enriched details.
+		policies = append(policies,
+			retentionPolicy{
+				name:  "people credited again",
+				query: `UPDATE "CinemaPerson" p SET "uncreditedSince" = NULL WHERE p."uncreditedSince" IS NOT NULL AND ` + personCredited,
+			},
+			retentionPolicy{
+				name:  "newly uncredited people",
+				query: `UPDATE "CinemaPerson" p SET "uncreditedSince" = now() WHERE p."uncreditedSince" IS NULL AND NOT ` + personCredited,
+			},
+			retentionPolicy{
+				name: "people uncredited past the grace period",
+				query: `DELETE FROM "CinemaPerson" p
+					WHERE p."uncreditedSince" < now() - make_interval(days => ?) AND NOT ` + personCredited,
+				args:   []any{c.RetentionPeopleGraceDays},
+				entity: "person",
+				alias:  "p",
+				keys:   []string{"id"},
+			},
+		)
+	}
+	return policies
+}
+
+// personCredited holds for a CinemaPerson p with any movie or series credit.
+const personCredited = `(EXISTS (SELECT 1 FROM "MovieActor" x WHERE x."actorId" = p."id")
+	OR EXISTS (SELECT 1 FROM "MovieDirector" x WHERE x."directorId" = p."id")
+	OR EXISTS (SELECT 1 FROM "MovieCrew" x WHERE x."personId" = p."id")
+	OR EXISTS (SELECT 1 FROM "SeriesCreator" x WHERE x."creatorId" = p."id"))`
+
+// runRetention applies the configured retention policies, each in its own
+// transaction. With --dry-run it only reports how many rows each policy
+// would remove: the policies run in one transaction rolled back at the end,
+// so each sees the rows the ones before it would have removed gone.
+func runRetention(db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("retention", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "report affected rows without deleting")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	policies := retentionPolicies(cfg)
+	if *dryRun {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, policy := range policies {
+				if err := applyRetention(tx, policy); err != nil {
+					return err
+				}
+			}
+			return errDryRun
+		})
+		if errors.Is(err, errDryRun) {
+			return nil
+		}
+		return err
+	}
+	for _, policy := range policies {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return applyRetention(tx, policy)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyRetention applies policy in tx, recording the rows it deletes in the
+// changefeed.
+func applyRetention(tx *gorm.DB, policy retentionPolicy) error {
+	if policy.entity == "" {
+		res := tx.Exec(policy.query, policy.args...)
+		if res.Error != nil {
+			return fmt.Errorf("retention %s: %w", policy.name, res.Error)
+		}
+		outputf("Retention %s: %d rows\n", policy.name, res.RowsAffected)
+		return nil
+	}
+	returning := make([]string, len(policy.keys))
+	for i, k := range policy.keys {
+		returning[i] = policy.alias + `."` + k + `"`
+	}
+	var deleted []map[string]any
+	if err := tx.Raw(policy.query+` RETURNING `+strings.Join(returning, ", "), policy.args...).Scan(&deleted).Error; err != nil {
+		return fmt.Errorf("retention %s: %w", policy.name, err)
+	}
+	outputf("Retention %s: %d rows\n", policy.name, len(deleted))
+	if err := recordChanges(tx, policy.entity, opDelete, changeKeys(policy.keys, deleted)); err != nil {
+		return fmt.Errorf("retention %s: %w", policy.name, err)
+	}
+	return nil
+}
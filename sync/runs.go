@@ -0,0 +1,292 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Run statuses. A partial run finished but lost more fetches or writes than
+// the error budget allows; its change window is fetched again by the next
+// run, as is that of an interrupted one.
+const (
+	runSuccess     = "success"
+	runPartial     = "partial"
+	runFailed      = "failed"
+	runInterrupted = "interrupted"
+)
+
+// ErrInterrupted is returned for a run whose context was cancelled. The
+// movies fetched until then were written.
+var ErrInterrupted = errors.New("run interrupted")
+
+// interrupted reports whether the current command was asked to stop. Work
+// already fetched is still written, but nothing new is scheduled.
+func interrupted() bool {
+	return runCtx.Err() != nil
+}
+
+type SyncRun struct {
+	ID            uint64
+	Mode          string
+	StartedAt     time.Time  `gorm:"column:startedAt"`
+	FinishedAt    *time.Time `gorm:"column:finishedAt"`
+	Status        *string    `gorm:"column:status"`
+	Fetches       int        `gorm:"column:fetches"`
+	FetchFailures int        `gorm:"column:fetchFailures"`
+	Batches       int        `gorm:"column:batches"`
+	BatchFailures int        `gorm:"column:batchFailures"`
+	WindowStart   *time.Time `gorm:"column:windowStart"`
+	WindowEnd     *time.Time `gorm:"column:windowEnd"`
+	ResumedFrom   *uint64    `gorm:"column:resumedFrom"`
+}
+
+// currentRun is the run being executed by this process.
+var currentRun SyncRun
+
+// finishedRuns are the runs finished since Run started, in order.
+var finishedRuns []SyncRun
+
+// runFetches counts the TMDB fetches of the current run.
+var runFetches struct {
+	ok, failed atomic.Int64
+}
+
+func recordFetch(err error) {
+	if errors.Is(err, context.Canceled) {
+		// Requests aborted by a shutdown say nothing about TMDB's health.
+		return
+	}
+	if err != nil {
+		runFetches.failed.Add(1)
+	} else {
+		runFetches.ok.Add(1)
+	}
+}
+
+func startRun(mode string) (SyncRun, error) {
+	run := SyncRun{Mode: mode, StartedAt: time.Now()}
+	err := state.createRun(&run)
+	return run, err
+}
+
+func finishRun(run *SyncRun) error {
+	now := time.Now()
+	run.FinishedAt = &now
+	return state.saveRun(*run)
+}
+
+// runStatus grades a run against the error budget: failure rates up to
+// ErrorBudgetPartial count as success, up to ErrorBudgetFailed as partial.
+// Rows lost between fetching and writing make a run partial at best.
+func runStatus(run SyncRun, runErr error, checksumMismatches int) string {
+	if runErr != nil {
+		return runFailed
+	}
+	rate := max(failureRate(run.FetchFailures, run.Fetches), failureRate(run.BatchFailures, run.Batches))
+	switch {
+	case rate > cfg.ErrorBudgetFailed:
+		return runFailed
+	case rate > cfg.ErrorBudgetPartial || checksumMismatches > 0:
+		return runPartial
+	default:
+		return runSuccess
+	}
+}
+
+func failureRate(failed, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(failed) / float64(total)
+}
+
+// withRun records a SyncRun of the given mode around fn and runs the outbox dispatcher for its
+// duration, flushing pending events once fn returns.
+func withRun(db *gorm.DB, mode string, fn func() error) error {
+	var err error
+	currentRun, err = startRun(mode)
+	if err != nil {
+		return fmt.Errorf("starting sync run: %w", err)
+	}
+	runFetches.ok.Store(0)
+	runFetches.failed.Store(0)
+	resetExchangeRates()
+	run := currentRun
+	activeRun.Store(&run)
+	defer activeRun.Store(nil)
+	batchesBefore, failuresBefore := writeTotals()
+	rowsBefore := tableRowsWritten()
+
+	var sink eventSink
+	dispatchCtx, stopDispatcher := context.WithCancel(context.Background())
+	defer stopDispatcher()
+	if cfg.OutboxWebhookURL != "" {
+		sink = webhookSink{url: cfg.OutboxWebhookURL}
+		go runOutboxDispatcher(dispatchCtx, db, sink, 5*time.Second)
+	}
+
+	if cfg.RawArchive {
+		rawArchive = startArchive(db, currentRun.ID, cfg.RawArchiveChunkSize)
+	}
+	if cfg.WatchdogMemoryMB > 0 || cfg.WatchdogGoroutines > 0 {
+		defer startWatchdog()()
+	}
+	if cfg.MetricsAddr != "" {
+		stopMetrics, err := serveMetrics(cfg.MetricsAddr)
+		if err != nil {
+			outputln("Error serving metrics:", err)
+		} else {
+			defer stopMetrics()
+		}
+	}
+
+	bootstrapReferences(db)
+	stopProgress := startProgress(db)
+	runErr := fn()
+	stopProgress()
+	printWriteSummary()
+	mismatches := verifyChecksums()
+	if mismatches > 0 {
+		logger.Error("fetched and written rows differ", "runId", currentRun.ID, "tables", mismatches)
+	}
+
+	if rawArchive != nil {
+		if err := rawArchive.close(); err != nil {
+			outputln("Error archiving raw payloads:", err)
+		}
+		rawArchive = nil
+	}
+
+	batches, failures := writeTotals()
+	currentRun.Fetches = int(runFetches.ok.Load() + runFetches.failed.Load())
+	currentRun.FetchFailures = int(runFetches.failed.Load())
+	currentRun.Batches = batches - batchesBefore
+	currentRun.BatchFailures = failures - failuresBefore
+	status := runStatus(currentRun, runErr, mismatches)
+	if interrupted() {
+		status = runInterrupted
+	}
+	currentRun.Status = &status
+	outputf("Run %d finished with status %s: %d/%d fetches and %d/%d batches failed\n",
+		currentRun.ID, status, currentRun.FetchFailures, currentRun.Fetches, currentRun.BatchFailures, currentRun.Batches)
+
+	if err := finishRun(&currentRun); err != nil {
+		outputln("Error finishing sync run:", err)
+	}
+	finishedRuns = append(finishedRuns, currentRun)
+	if err := publishRunMetrics(currentRun); err != nil {
+		outputln("Error pushing metrics:", err)
+	}
+	if cfg.FreshnessManifest {
+		if err := publishFreshness(db, currentRun, rowsBefore); err != nil {
+			outputln("Error publishing freshness manifest:", err)
+		}
+	}
+	if hasHooks(hookAfterRun) {
+		run := currentRun
+		if err := runHooks(&hookPayload{Event: hookAfterRun, Run: &run}); err != nil {
+			outputln("Error running afterRun hooks:", err)
+		}
+	}
+	if sink != nil {
+		if err := enqueueEvent(db, "run.finished", map[string]any{"runId": currentRun.ID, "status": status}); err != nil {
+			outputln("Error enqueueing run event:", err)
+		}
+		stopDispatcher()
+		if _, err := dispatchOutbox(context.Background(), db, sink); err != nil {
+			outputln("Error dispatching outbox:", err)
+		}
+	}
+	if status == runInterrupted {
+		return fmt.Errorf("run %d: %w", currentRun.ID, ErrInterrupted)
+	}
+	if runErr == nil && status == runFailed {
+		return fmt.Errorf("run %d exceeded its error budget", currentRun.ID)
+	}
+	return runErr
+}
+
+// lastFinishedRun returns when a run of the given mode last finished
+// successfully, or nil if it never has.
+func lastFinishedRun(mode string) (*time.Time, error) {
+	finished, _, err := state.cursor(mode)
+	return finished, err
+}
+
+// changeWindow is the span of TMDB's changes feed a sync covers.
+type changeWindow struct {
+	Start, End time.Time
+}
+
+// maxChangeWindow is the longest span TMDB's changes endpoint accepts.
+const maxChangeWindow = 14 * 24 * time.Hour
+
+// nextChangeWindow starts where the last successful run of mode ended, so
+// the window of a partial or failed run is covered again. Without one it
+// covers the last day. The start is pulled back by CHANGE_WINDOW_OVERLAP
+// rounded up to whole days, as TMDB only takes the date of the start;
+// movies changed in the overlap are simply upserted twice.
+func nextChangeWindow(mode string) (changeWindow, error) {
+	now := time.Now()
+	window := changeWindow{Start: now.Add(-24 * time.Hour), End: now}
+	_, end, err := state.cursor(mode)
+	if err != nil {
+		return window, err
+	}
+	if end != nil {
+		const day = 24 * time.Hour
+		window.Start = end.Add(-(cfg.ChangeWindowOverlap + day - 1) / day * day)
+	}
+	if window.End.Sub(window.Start) > maxChangeWindow {
+		window.Start = window.End.Add(-maxChangeWindow)
+	}
+	return window, nil
+}
+
+// windowBounds are the --since and --until overrides of a sync; zero
+// values keep the computed bound.
+type windowBounds struct {
+	Since, Until time.Time
+}
+
+func (b windowBounds) apply(window changeWindow) (changeWindow, error) {
+	if !b.Since.IsZero() {
+		window.Start = b.Since
+	}
+	if !b.Until.IsZero() {
+		window.End = b.Until
+	}
+	if !window.Start.Before(window.End) {
+		return window, fmt.Errorf("change window from %s to %s is empty", window.Start.Format(time.RFC3339), window.End.Format(time.RFC3339))
+	}
+	if window.End.Sub(window.Start) > maxChangeWindow {
+		return window, fmt.Errorf("change window from %s to %s exceeds TMDB's %d days", window.Start.Format(time.RFC3339), window.End.Format(time.RFC3339), int(maxChangeWindow.Hours()/24))
+	}
+	return window, nil
+}
+
+// parseWindowBound reads a --since or --until value, a date or an RFC 3339
+// timestamp.
+func parseWindowBound(name, raw string) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", raw)
+	if err != nil {
+		return t, fmt.Errorf("--%s: %q is neither a date nor an RFC 3339 timestamp", name, raw)
+	}
+	return t, nil
+}
+
+func setRunWindow(window changeWindow) error {
+	currentRun.WindowStart, currentRun.WindowEnd = &window.Start, &window.End
+	return state.saveRun(currentRun)
+}
@@ -0,0 +1,51 @@
+package sync
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextChangeWindow(t *testing.T) {
+	defer func(c Config, s stateStore) { cfg, state = c, s }(cfg, state)
+	const day = 24 * time.Hour
+	now := time.Now()
+	ago := func(d time.Duration) *time.Time {
+		at := now.Add(-d)
+		return &at
+	}
+	tests := []struct {
+		name      string
+		windowEnd *time.Time
+		overlap   time.Duration
+		// start is how long before now the window starts.
+		start time.Duration
+	}{
+		{"first run covers a day", nil, 0, day},
+		{"continues at the last window's end", ago(3 * day), 0, 3 * day},
+		{"overlap rounds up to whole days", ago(3 * day), time.Hour, 4 * day},
+		{"two days of overlap", ago(3 * day), 2 * day, 5 * day},
+		{"capped at TMDB's limit", ago(30 * day), 0, maxChangeWindow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &objectState{store: &fileStore{dir: t.TempDir()}, checkpoints: map[uint64]*objectCheckpoint{}}
+			if tt.windowEnd != nil {
+				if err := s.putJSON(statePrefix+"cursors/sync.json", objectCursor{WindowEnd: tt.windowEnd}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			state = s
+			cfg.ChangeWindowOverlap = tt.overlap
+			window, err := nextChangeWindow("sync")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if window.End.Before(now) || window.End.Sub(now) > time.Second {
+				t.Errorf("window ends at %s, want about %s", window.End, now)
+			}
+			if got := window.End.Sub(window.Start); got < tt.start || got > tt.start+time.Second {
+				t.Errorf("window spans %s, want %s", got, tt.start)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package sync
+
+import (
+	"sort"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+var savepointFailures = struct {
+	sync.Mutex
+	steps map[string]int
+}{steps: map[string]int{}}
+
+// inSavepoint runs a secondary step of a batch inside a nested transaction,
+// which GORM backs with a savepoint. If the step fails only its own changes
+// are rolled back; the failure is logged and counted under step, and the
+// enclosing batch carries on.
+func inSavepoint(tx *gorm.DB, step string, fn func(tx *gorm.DB) error) {
+	err := tx.Transaction(fn)
+	if err == nil {
+		return
+	}
+	logger.Error("batch step rolled back", "step", step, "error", err)
+	savepointFailures.Lock()
+	savepointFailures.steps[step]++
+	savepointFailures.Unlock()
+}
+
+// savepointSummary returns the rolled-back step counts sorted by step name.
+func savepointSummary() ([]string, map[string]int) {
+	savepointFailures.Lock()
+	defer savepointFailures.Unlock()
+	steps := make([]string, 0, len(savepointFailures.steps))
+	counts := make(map[string]int, len(savepointFailures.steps))
+	for step, n := range savepointFailures.steps {
+		steps = append(steps, step)
+		counts[step] = n
+	}
+	sort.Strings(steps)
+	return steps, counts
+}
@@ -0,0 +1,527 @@
+package sync
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// managedTables lists every table this cron writes to, parents before the
+// tables referencing them.
+var managedTables = []string{
+	"Genre",
+	"Country",
+	"Language",
+	"MovieCollection",
+	"Keyword",
+	"Movie",
+	"CinemaPerson",
+	"MovieActor",
+	"MovieDirector",
+	"MovieCrew",
+	"MovieGenre",
+	"MovieCountry",
+	"MReleaseCountry",
+	"MLocalRelease",
+	"MovieTranslation",
+	"MovieWikidata",
+	"MovieExternalIds",
+	"MovieAward",
+	"MovieBasedOn",
+	"ReleaseCalendar",
+	"HotRelease",
+	"ReleaseEventTag",
+	"ReleaseWeekend",
+	"MovieTag",
+	"MoviePopularitySnapshot",
+	"MovieKeyword",
+	"MovieAlternativeTitle",
+	"MovieRelation",
+	"PersonStats",
+	"Series",
+	"Season",
+	"Episode",
+	"SeriesGenre",
+	"SeriesCountry",
+	"SeriesCreator",
+	"WatchProvider",
+	"MovieWatchProvider",
+	"PopularProvider",
+	"MovieAvailability",
+	"Festival",
+	"FestivalScreening",
+	"ReleaseType",
+	"MovieStatus",
+}
+
+// schemaStatements holds idempotent DDL for the tables owned by this cron
+// and for what it adds to the website's tables. Of those, the Genre, Country
+// and Language lookups and MovieCrew, which only the cron writes, are
+// created here if missing. Movie, CinemaPerson, MovieActor and the release
+// tables come from the website's Prisma schema and only gain columns and
+// indexes here; the release tables' key layout is migrated by
+// migrateReleaseKeys.
+var schemaStatements = []string{
+	`CREATE TABLE IF NOT EXISTS "ReleaseCalendar" (
+		"year" integer NOT NULL,
+		"month" integer NOT NULL,
+		"countryIso" text NOT NULL,
+		"movieIds" integer[] NOT NULL,
+		"releaseDates" date[] NOT NULL,
+		"updatedAt" timestamptz NOT NULL DEFAULT now(),
+		PRIMARY KEY ("year", "month", "countryIso")
+	)`,
+	`CREATE TABLE IF NOT EXISTS "HotRelease" (
+		"countryIso" text NOT NULL,
+		"windowHours" integer NOT NULL,
+		"movieId" integer NOT NULL,
+		"releaseAt" timestamptz NOT NULL,
+		"type" smallint NOT NULL,
+		PRIMARY KEY ("countryIso", "windowHours", "movieId")
+	)`,
+	`ALTER TABLE "Movie" ADD COLUMN IF NOT EXISTS "denormalized" jsonb`,
+	`CREATE TABLE IF NOT EXISTS "SyncRun" (
+		"id" bigserial PRIMARY KEY,
+		"startedAt" timestamptz NOT NULL,
+		"finishedAt" timestamptz
+	)`,
+	`CREATE TABLE IF NOT EXISTS "Changefeed" (
+		"id" bigserial PRIMARY KEY,
+		"entityType" text NOT NULL,
+		"entityId" text NOT NULL,
+		"op" text NOT NULL,
+		"runId" bigint,
+		"ts" timestamptz NOT NULL DEFAULT now()
+	)`,
+	`CREATE INDEX IF NOT EXISTS "Changefeed_runId_idx" ON "Changefeed" ("runId")`,
+	`ALTER TABLE "Changefeed" ALTER COLUMN "runId" DROP NOT NULL`,
+	`CREATE TABLE IF NOT EXISTS "ChangefeedDigest" (
+		"entityType" text NOT NULL,
+		"entityId" text NOT NULL,
+		"digest" text NOT NULL,
+		PRIMARY KEY ("entityType", "entityId")
+	)`,
+	`ALTER TABLE "SyncRun" ADD COLUMN IF NOT EXISTS "mode" text NOT NULL DEFAULT 'sync'`,
+	`ALTER TABLE "SyncRun" ADD COLUMN IF NOT EXISTS "status" text`,
+	`ALTER TABLE "SyncRun" ADD COLUMN IF NOT EXISTS "fetches" integer NOT NULL DEFAULT 0`,
+	`ALTER TABLE "SyncRun" ADD COLUMN IF NOT EXISTS "fetchFailures" integer NOT NULL DEFAULT 0`,
+	`ALTER TABLE "SyncRun" ADD COLUMN IF NOT EXISTS "batches" integer NOT NULL DEFAULT 0`,
+	`ALTER TABLE "SyncRun" ADD COLUMN IF NOT EXISTS "batchFailures" integer NOT NULL DEFAULT 0`,
+	`ALTER TABLE "SyncRun" ADD COLUMN IF NOT EXISTS "windowStart" timestamptz`,
+	`ALTER TABLE "SyncRun" ADD COLUMN IF NOT EXISTS "windowEnd" timestamptz`,
+	`CREATE TABLE IF NOT EXISTS "Outbox" (
+		"id" bigserial PRIMARY KEY,
+		"topic" text NOT NULL,
+		"payload" jsonb NOT NULL,
+		"createdAt" timestamptz NOT NULL DEFAULT now(),
+		"attempts" integer NOT NULL DEFAULT 0,
+		"nextAttemptAt" timestamptz NOT NULL DEFAULT now(),
+		"deliveredAt" timestamptz,
+		"lastError" text
+	)`,
+	`CREATE INDEX IF NOT EXISTS "Outbox_pending_idx" ON "Outbox" ("nextAttemptAt") WHERE "deliveredAt" IS NULL`,
+	`ALTER TABLE "Movie" ADD COLUMN IF NOT EXISTS "imdbId" text`,
+	`ALTER TABLE "Movie" ADD COLUMN IF NOT EXISTS "imdbRating" real`,
+	`ALTER TABLE "Movie" ADD COLUMN IF NOT EXISTS "imdbVotes" integer`,
+	`CREATE INDEX IF NOT EXISTS "Movie_imdbId_idx" ON "Movie" ("imdbId")`,
+	`CREATE TABLE IF NOT EXISTS "MovieWikidata" (
+		"movieId" integer PRIMARY KEY,
+		"wikidataId" text,
+		"seriesId" text,
+		"seriesLabel" text,
+		"seriesOrdinal" text,
+		"fetchedAt" timestamptz NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS "MovieAward" (
+		"movieId" integer NOT NULL,
+		"awardId" text NOT NULL,
+		"awardLabel" text NOT NULL,
+		PRIMARY KEY ("movieId", "awardId")
+	)`,
+	`CREATE TABLE IF NOT EXISTS "MovieBasedOn" (
+		"movieId" integer NOT NULL,
+		"workId" text NOT NULL,
+		"workLabel" text NOT NULL,
+		PRIMARY KEY ("movieId", "workId")
+	)`,
+	`ALTER TABLE "Movie" ADD COLUMN IF NOT EXISTS "traktWatchers" integer`,
+	`ALTER TABLE "Movie" ADD COLUMN IF NOT EXISTS "traktPlays" integer`,
+	`ALTER TABLE "Movie" ADD COLUMN IF NOT EXISTS "traktCollectors" integer`,
+	`ALTER TABLE "Movie" ADD COLUMN IF NOT EXISTS "traktLists" integer`,
+	`ALTER TABLE "Movie" ADD COLUMN IF NOT EXISTS "wiitcoScore" real`,
+	`CREATE INDEX IF NOT EXISTS "Movie_wiitcoScore_idx" ON "Movie" ("wiitcoScore" DESC NULLS LAST)`,
+	`CREATE TABLE IF NOT EXISTS "MovieTranslation" (
+		"movieId" integer NOT NULL,
+		"locale" text NOT NULL,
+		"title" text,
+		"overview" text,
+		"tagline" text,
+		PRIMARY KEY ("movieId", "locale")
+	)`,
+	`CREATE TABLE IF NOT EXISTS "RawPayloadChunk" (
+		"runId" bigint NOT NULL,
+		"seq" integer NOT NULL,
+		"data" bytea NOT NULL,
+		PRIMARY KEY ("runId", "seq")
+	)`,
+	`ALTER TABLE "RawPayloadChunk" ADD COLUMN IF NOT EXISTS "createdAt" timestamptz NOT NULL DEFAULT now()`,
+	`CREATE TABLE IF NOT EXISTS "Quarantine" (
+		"id" bigserial PRIMARY KEY,
+		"entityType" text NOT NULL,
+		"entityId" text NOT NULL,
+		"field" text NOT NULL,
+		"oldValue" text,
+		"newValue" text NOT NULL,
+		"reason" text NOT NULL,
+		"status" text NOT NULL DEFAULT 'pending',
+		"runId" bigint NOT NULL,
+		"createdAt" timestamptz NOT NULL DEFAULT now(),
+		"reviewedAt" timestamptz
+	)`,
+	`CREATE TABLE IF NOT EXISTS "MovieCorrection" (
+		"movieId" integer NOT NULL,
+		"field" text NOT NULL,
+		"value" text NOT NULL,
+		"note" text,
+		PRIMARY KEY ("movieId", "field")
+	)`,
+	`CREATE TABLE IF NOT EXISTS "ReleaseEventTag" (
+		"movieId" integer NOT NULL,
+		"countryIso" text NOT NULL,
+		"event" text NOT NULL,
+		"releaseDate" date NOT NULL,
+		PRIMARY KEY ("movieId", "countryIso", "event", "releaseDate")
+	)`,
+	`CREATE INDEX IF NOT EXISTS "ReleaseEventTag_event_idx" ON "ReleaseEventTag" ("event", "countryIso", "releaseDate")`,
+	`CREATE TABLE IF NOT EXISTS "ReleaseWeekend" (
+		"countryIso" text NOT NULL,
+		"weekendStart" date NOT NULL,
+		"movieId" integer NOT NULL,
+		"releaseDate" date NOT NULL,
+		PRIMARY KEY ("countryIso", "weekendStart", "movieId")
+	)`,
+	`CREATE INDEX IF NOT EXISTS "ReleaseWeekend_movieId_idx" ON "ReleaseWeekend" ("movieId")`,
+	`ALTER TABLE "MLocalRelease" ADD COLUMN IF NOT EXISTS "cutRuntime" smallint`,
+	`ALTER TABLE "MReleaseCountry" ADD COLUMN IF NOT EXISTS "localTitle" text`,
+	`CREATE TABLE IF NOT EXISTS "MovieTag" (
+		"movieId" integer NOT NULL,
+		"tag" text NOT NULL,
+		PRIMARY KEY ("movieId", "tag")
+	)`,
+	`CREATE INDEX IF NOT EXISTS "MovieTag_tag_idx" ON "MovieTag" ("tag")`,
+	`CREATE TABLE IF NOT EXISTS "MoviePopularitySnapshot" (
+		"movieId" integer NOT NULL,
+		"day" date NOT NULL,
+		"popularity" real NOT NULL,
+		PRIMARY KEY ("movieId", "day")
+	)`,
+	`CREATE INDEX IF NOT EXISTS "MoviePopularitySnapshot_day_idx" ON "MoviePopularitySnapshot" ("day")`,
+	`ALTER TABLE "Movie" ADD COLUMN IF NOT EXISTS "collectionId" integer`,
+	`CREATE INDEX IF NOT EXISTS "Movie_collectionId_idx" ON "Movie" ("collectionId")`,
+	`ALTER TABLE "Movie" ADD COLUMN IF NOT EXISTS "isRemake" boolean NOT NULL DEFAULT false`,
+	`ALTER TABLE "Movie" ADD COLUMN IF NOT EXISTS "basedOnNovel" boolean NOT NULL DEFAULT false`,
+	`ALTER TABLE "Movie" ADD COLUMN IF NOT EXISTS "syncedAt" timestamptz`,
+	`ALTER TABLE "Movie" ADD COLUMN IF NOT EXISTS "stalenessScore" double precision`,
+	`CREATE INDEX IF NOT EXISTS "Movie_stalenessScore_idx" ON "Movie" ("stalenessScore" DESC NULLS LAST)`,
+	`CREATE TABLE IF NOT EXISTS "MovieRelation" (
+		"movieId" integer NOT NULL,
+		"relatedMovieId" integer NOT NULL,
+		"type" text NOT NULL,
+		"source" text NOT NULL,
+		PRIMARY KEY ("movieId", "relatedMovieId", "type")
+	)`,
+	`ALTER TABLE "MovieRelation" ADD COLUMN IF NOT EXISTS "workId" text`,
+	`CREATE TABLE IF NOT EXISTS "CoverageStats" (
+		"runId" bigint NOT NULL,
+		"region" text NOT NULL,
+		"genreId" integer NOT NULL,
+		"movies" integer NOT NULL,
+		"withRelease" integer NOT NULL,
+		"withPoster" integer NOT NULL,
+		"withCast" integer NOT NULL,
+		"computedAt" timestamptz NOT NULL DEFAULT now(),
+		PRIMARY KEY ("runId", "region", "genreId")
+	)`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS "Quarantine_pending_key" ON "Quarantine" ("entityType", "entityId", "field", "newValue") WHERE "status" = 'pending'`,
+	`CREATE TABLE IF NOT EXISTS "Series" (
+		"id" integer PRIMARY KEY,
+		"name" text NOT NULL,
+		"originalName" text,
+		"originalLanguage" text,
+		"posterPath" text,
+		"popularity" real NOT NULL DEFAULT 0,
+		"firstAirDate" date,
+		"lastAirDate" date,
+		"status" text NOT NULL DEFAULT '',
+		"inProduction" boolean NOT NULL DEFAULT false,
+		"numberOfSeasons" integer NOT NULL DEFAULT 0,
+		"numberOfEpisodes" integer NOT NULL DEFAULT 0,
+		"syncedAt" timestamptz NOT NULL DEFAULT now()
+	)`,
+	`CREATE TABLE IF NOT EXISTS "Season" (
+		"id" integer PRIMARY KEY,
+		"seriesId" integer NOT NULL REFERENCES "Series" ("id") ON DELETE CASCADE,
+		"seasonNumber" integer NOT NULL,
+		"name" text NOT NULL,
+		"airDate" date,
+		"episodeCount" integer NOT NULL DEFAULT 0,
+		"posterPath" text,
+		UNIQUE ("seriesId", "seasonNumber")
+	)`,
+	`CREATE TABLE IF NOT EXISTS "Episode" (
+		"id" integer PRIMARY KEY,
+		"seriesId" integer NOT NULL REFERENCES "Series" ("id") ON DELETE CASCADE,
+		"seasonId" integer NOT NULL REFERENCES "Season" ("id") ON DELETE CASCADE,
+		"seasonNumber" integer NOT NULL,
+		"episodeNumber" integer NOT NULL,
+		"name" text NOT NULL,
+		"airDate" date,
+		"runtime" integer,
+		UNIQUE ("seriesId", "seasonNumber", "episodeNumber")
+	)`,
+	`CREATE TABLE IF NOT EXISTS "SeriesGenre" (
+		"seriesId" integer NOT NULL REFERENCES "Series" ("id") ON DELETE CASCADE,
+		"genreId" integer NOT NULL,
+		PRIMARY KEY ("seriesId", "genreId")
+	)`,
+	`CREATE TABLE IF NOT EXISTS "SeriesCountry" (
+		"seriesId" integer NOT NULL REFERENCES "Series" ("id") ON DELETE CASCADE,
+		"countryIso" text NOT NULL,
+		PRIMARY KEY ("seriesId", "countryIso")
+	)`,
+	`CREATE TABLE IF NOT EXISTS "SeriesCreator" (
+		"seriesId" integer NOT NULL REFERENCES "Series" ("id") ON DELETE CASCADE,
+		"creatorId" integer NOT NULL,
+		PRIMARY KEY ("seriesId", "creatorId")
+	)`,
+	`CREATE TABLE IF NOT EXISTS "PopularProvider" (
+		"bit" smallint PRIMARY KEY,
+		"providerId" integer NOT NULL UNIQUE
+	)`,
+	`CREATE TABLE IF NOT EXISTS "MovieAvailability" (
+		"movieId" integer NOT NULL,
+		"countryIso" text NOT NULL,
+		"providers" bigint NOT NULL,
+		PRIMARY KEY ("movieId", "countryIso")
+	)`,
+	`ALTER TABLE "CinemaPerson" ADD COLUMN IF NOT EXISTS "biography" text`,
+	`ALTER TABLE "CinemaPerson" ADD COLUMN IF NOT EXISTS "birthday" date`,
+	`ALTER TABLE "CinemaPerson" ADD COLUMN IF NOT EXISTS "deathday" date`,
+	`ALTER TABLE "CinemaPerson" ADD COLUMN IF NOT EXISTS "placeOfBirth" text`,
+	`ALTER TABLE "CinemaPerson" ADD COLUMN IF NOT EXISTS "profilePath" text`,
+	`ALTER TABLE "CinemaPerson" ADD COLUMN IF NOT EXISTS "knownForDepartment" text`,
+	`ALTER TABLE "CinemaPerson" ADD COLUMN IF NOT EXISTS "detailsSyncedAt" timestamptz`,
+	`DO $$ BEGIN
+		CREATE TYPE "ReleaseNoteCategory" AS ENUM ('festival', 're-release', 'premiere', 'limited', 'wide', 'special');
+	EXCEPTION WHEN duplicate_object THEN NULL;
+	END $$`,
+	`ALTER TABLE "MLocalRelease" ADD COLUMN IF NOT EXISTS "noteCategory" "ReleaseNoteCategory"`,
+	`ALTER TABLE "MLocalRelease" ADD COLUMN IF NOT EXISTS "isImax" boolean NOT NULL DEFAULT false`,
+	`ALTER TABLE "MLocalRelease" ADD COLUMN IF NOT EXISTS "is3d" boolean NOT NULL DEFAULT false`,
+	`ALTER TABLE "MLocalRelease" ADD COLUMN IF NOT EXISTS "is70mm" boolean NOT NULL DEFAULT false`,
+	`ALTER TABLE "MLocalRelease" ADD COLUMN IF NOT EXISTS "isDolby" boolean NOT NULL DEFAULT false`,
+	`CREATE TABLE IF NOT EXISTS "Festival" (
+		"slug" text NOT NULL,
+		"startDate" date NOT NULL,
+		"endDate" date NOT NULL,
+		"name" text NOT NULL,
+		"countryIso" text,
+		"aliases" text[],
+		PRIMARY KEY ("slug", "startDate")
+	)`,
+	`CREATE TABLE IF NOT EXISTS "FestivalScreening" (
+		"festivalSlug" text NOT NULL,
+		"festivalStart" date NOT NULL,
+		"movieId" integer NOT NULL,
+		"countryIso" text NOT NULL,
+		"releaseDate" date NOT NULL,
+		PRIMARY KEY ("festivalSlug", "festivalStart", "movieId", "countryIso", "releaseDate"),
+		FOREIGN KEY ("festivalSlug", "festivalStart") REFERENCES "Festival" ("slug", "startDate") ON DELETE CASCADE
+	)`,
+	`CREATE INDEX IF NOT EXISTS "FestivalScreening_movieId_idx" ON "FestivalScreening" ("movieId")`,
+	`ALTER TABLE "SyncRun" ADD COLUMN IF NOT EXISTS "resumedFrom" bigint`,
+	`CREATE TABLE IF NOT EXISTS "SyncCheckpointPage" (
+		"runId" bigint NOT NULL,
+		"page" integer NOT NULL,
+		PRIMARY KEY ("runId", "page")
+	)`,
+	`CREATE TABLE IF NOT EXISTS "SyncCheckpointMovie" (
+		"runId" bigint NOT NULL,
+		"movieId" integer NOT NULL,
+		"priority" smallint NOT NULL DEFAULT 0,
+		"done" boolean NOT NULL DEFAULT false,
+		PRIMARY KEY ("runId", "movieId")
+	)`,
+	`CREATE TABLE IF NOT EXISTS "MovieCrew" (
+		"movieId" integer NOT NULL,
+		"personId" integer NOT NULL,
+		"job" text NOT NULL,
+		"department" text NOT NULL,
+		"role" text NOT NULL,
+		"creditId" text NOT NULL DEFAULT '',
+		PRIMARY KEY ("movieId", "personId", "job")
+	)`,
+	`CREATE INDEX IF NOT EXISTS "MovieCrew_personId_idx" ON "MovieCrew" ("personId")`,
+	`ALTER TABLE "MovieActor" ADD COLUMN IF NOT EXISTS "character" text NOT NULL DEFAULT ''`,
+	`ALTER TABLE "MovieActor" ADD COLUMN IF NOT EXISTS "order" smallint`,
+	`ALTER TABLE "MovieActor" ADD COLUMN IF NOT EXISTS "creditId" text NOT NULL DEFAULT ''`,
+	`CREATE INDEX IF NOT EXISTS "MovieActor_movieId_order_idx" ON "MovieActor" ("movieId", "order")`,
+	`ALTER TABLE "Movie" ADD COLUMN IF NOT EXISTS "revenue" bigint NOT NULL DEFAULT 0`,
+	`ALTER TABLE "Movie" ADD COLUMN IF NOT EXISTS "overview" text`,
+	`ALTER TABLE "Movie" ADD COLUMN IF NOT EXISTS "tagline" text`,
+	`ALTER TABLE "Movie" ADD COLUMN IF NOT EXISTS "status" text`,
+	`ALTER TABLE "Movie" ADD COLUMN IF NOT EXISTS "voteAverage" real NOT NULL DEFAULT 0`,
+	`ALTER TABLE "Movie" ADD COLUMN IF NOT EXISTS "voteCount" integer NOT NULL DEFAULT 0`,
+	`ALTER TABLE "Movie" ADD COLUMN IF NOT EXISTS "homepage" text`,
+	`ALTER TABLE "Movie" ADD COLUMN IF NOT EXISTS "backdropPath" text`,
+	// Blockbuster budgets no longer fit an int4.
+	`DO $$ BEGIN
+		IF (SELECT data_type FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = 'Movie' AND column_name = 'budget') = 'integer' THEN
+			ALTER TABLE "Movie" ALTER COLUMN "budget" TYPE bigint;
+		END IF;
+	END $$`,
+	`CREATE TABLE IF NOT EXISTS "MovieCollection" (
+		"id" integer PRIMARY KEY,
+		"name" text NOT NULL,
+		"posterPath" text,
+		"backdropPath" text
+	)`,
+	`CREATE TABLE IF NOT EXISTS "ReleaseType" (
+		"id" smallint PRIMARY KEY,
+		"code" text NOT NULL UNIQUE,
+		"labels" jsonb NOT NULL DEFAULT '{}'
+	)`,
+	`CREATE TABLE IF NOT EXISTS "MovieStatus" (
+		"id" smallint PRIMARY KEY,
+		"code" text NOT NULL UNIQUE,
+		"labels" jsonb NOT NULL DEFAULT '{}'
+	)`,
+	`CREATE TABLE IF NOT EXISTS "RunProgress" (
+		"runId" bigint NOT NULL,
+		"stage" text NOT NULL,
+		"mode" text NOT NULL,
+		"done" bigint NOT NULL,
+		"total" bigint NOT NULL,
+		"updatedAt" timestamptz NOT NULL,
+		"finishedAt" timestamptz,
+		PRIMARY KEY ("runId", "stage")
+	)`,
+	`CREATE TABLE IF NOT EXISTS "Keyword" (
+		"id" integer PRIMARY KEY,
+		"name" text NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS "MovieKeyword" (
+		"movieId" integer NOT NULL,
+		"keywordId" integer NOT NULL,
+		PRIMARY KEY ("movieId", "keywordId")
+	)`,
+	`CREATE INDEX IF NOT EXISTS "MovieKeyword_keywordId_idx" ON "MovieKeyword" ("keywordId")`,
+	`ALTER TABLE "CinemaPerson" ADD COLUMN IF NOT EXISTS "uncreditedSince" timestamptz`,
+	`ALTER TABLE "MovieActor" ADD COLUMN IF NOT EXISTS "isUncredited" boolean NOT NULL DEFAULT false`,
+	`ALTER TABLE "MovieActor" ADD COLUMN IF NOT EXISTS "isVoice" boolean NOT NULL DEFAULT false`,
+	`ALTER TABLE "MovieActor" ADD COLUMN IF NOT EXISTS "isArchiveFootage" boolean NOT NULL DEFAULT false`,
+	`ALTER TABLE "MovieActor" ADD COLUMN IF NOT EXISTS "isGuest" boolean NOT NULL DEFAULT false`,
+	`CREATE TABLE IF NOT EXISTS "WatchProvider" (
+		"id" integer PRIMARY KEY,
+		"name" text NOT NULL,
+		"logoPath" text
+	)`,
+	`CREATE TABLE IF NOT EXISTS "MovieWatchProvider" (
+		"movieId" integer NOT NULL,
+		"countryIso" text NOT NULL,
+		"providerId" integer NOT NULL,
+		"type" text NOT NULL,
+		"displayPriority" integer NOT NULL DEFAULT 0,
+		PRIMARY KEY ("movieId", "countryIso", "providerId", "type")
+	)`,
+	`CREATE INDEX IF NOT EXISTS "MovieWatchProvider_providerId_countryIso_idx" ON "MovieWatchProvider" ("providerId", "countryIso")`,
+	`CREATE TABLE IF NOT EXISTS "MovieExternalIds" (
+		"movieId" integer PRIMARY KEY,
+		"imdbId" text,
+		"wikidataId" text,
+		"facebookId" text,
+		"instagramId" text,
+		"twitterId" text
+	)`,
+	`CREATE INDEX IF NOT EXISTS "MovieExternalIds_wikidataId_idx" ON "MovieExternalIds" ("wikidataId")`,
+	`ALTER TABLE "MovieWikidata" ADD COLUMN IF NOT EXISTS "runtime" integer`,
+	`ALTER TABLE "MovieWikidata" ADD COLUMN IF NOT EXISTS "releaseDate" date`,
+	`ALTER TABLE "Movie" ADD COLUMN IF NOT EXISTS "provenance" jsonb`,
+	`ALTER TABLE "MLocalRelease" ADD COLUMN IF NOT EXISTS "certification" text`,
+	`CREATE INDEX IF NOT EXISTS "MLocalRelease_certification_idx" ON "MLocalRelease" ("certification") WHERE "certification" IS NOT NULL`,
+	`CREATE TABLE IF NOT EXISTS "MovieAlternativeTitle" (
+		"movieId" integer NOT NULL,
+		"iso31661" text NOT NULL,
+		"title" text NOT NULL,
+		"type" text,
+		PRIMARY KEY ("movieId", "iso31661", "title")
+	)`,
+	`CREATE INDEX IF NOT EXISTS "MovieAlternativeTitle_title_idx" ON "MovieAlternativeTitle" (lower("title") text_pattern_ops)`,
+	`ALTER TABLE "Movie" ADD COLUMN IF NOT EXISTS "missingResources" integer NOT NULL DEFAULT 0`,
+	`CREATE INDEX IF NOT EXISTS "Movie_missingResources_idx" ON "Movie" ("popularity" DESC) WHERE "missingResources" <> 0`,
+	`ALTER TABLE "Movie" ADD COLUMN IF NOT EXISTS "deletedAt" timestamptz`,
+	`CREATE TABLE IF NOT EXISTS "MovieDeletion" (
+		"id" bigserial PRIMARY KEY,
+		"movieId" integer NOT NULL,
+		"title" text NOT NULL,
+		"mode" text NOT NULL,
+		"source" text NOT NULL,
+		"runId" bigint NOT NULL,
+		"deletedAt" timestamptz NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS "MovieDeletion_movieId_idx" ON "MovieDeletion" ("movieId")`,
+	`CREATE TABLE IF NOT EXISTS "Genre" (
+		"id" integer PRIMARY KEY,
+		"name" text NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS "Country" (
+		"iso31661" text PRIMARY KEY,
+		"englishName" text NOT NULL,
+		"nativeName" text NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS "Language" (
+		"iso6391" text PRIMARY KEY,
+		"englishName" text NOT NULL,
+		"name" text NOT NULL
+	)`,
+	`ALTER TABLE "Movie" ADD COLUMN IF NOT EXISTS "budgetCurrency" text`,
+	`ALTER TABLE "Movie" ADD COLUMN IF NOT EXISTS "budgetUsd" bigint`,
+	`ALTER TABLE "Movie" ADD COLUMN IF NOT EXISTS "revenueUsd" bigint`,
+	`ALTER TABLE "Movie" ADD COLUMN IF NOT EXISTS "currencyRateDate" date`,
+	`CREATE TABLE IF NOT EXISTS "PersonStats" (
+		"personId" integer PRIMARY KEY,
+		"movieCount" integer NOT NULL,
+		"upcomingCount" integer NOT NULL,
+		"avgPopularity" real NOT NULL,
+		"updatedAt" timestamptz NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS "PersonStats_movieCount_idx" ON "PersonStats" ("movieCount" DESC)`,
+	`CREATE INDEX IF NOT EXISTS "PersonStats_avgPopularity_idx" ON "PersonStats" ("avgPopularity" DESC)`,
+}
+
+func ensureSchema(db *gorm.DB) error {
+	for _, stmt := range schemaStatements {
+		if cfg.StateStoreURL != "" && touchesStateTable(stmt) {
+			continue
+		}
+		if err := db.Exec(stmt).Error; err != nil {
+			return fmt.Errorf("applying schema statement: %w", err)
+		}
+	}
+	return nil
+}
+
+// touchesStateTable reports whether stmt creates or alters one of the state
+// or operational tables, which are left out when the state lives in object
+// storage.
+func touchesStateTable(stmt string) bool {
+	for _, table := range slices.Concat(stateTables, operationalTables) {
+		if strings.Contains(stmt, `"`+table+`" (`) || strings.HasPrefix(stmt, `ALTER TABLE "`+table+`"`) {
+			return true
+		}
+	}
+	return false
+}
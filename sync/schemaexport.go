@@ -0,0 +1,280 @@
+package sync
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"gorm.io/gorm/schema"
+)
+
+// modelTable is a managed table as the cron's Go models see it. A table
+// written by several models, such as CinemaPerson, has the union of their
+// columns.
+type modelTable struct {
+	Table  string
+	Models []any
+	Key    []string
+	Unique [][]string
+}
+
+// modelTables lists the managed tables that have Go models, in
+// managedTables order.
+func modelTables() []modelTable {
+	return []modelTable{
+		{"Genre", []any{&Genre{}}, []string{"id"}, nil},
+		{"Country", []any{&Country{}}, []string{"iso31661"}, nil},
+		{"Language", []any{&Language{}}, []string{"iso6391"}, nil},
+		{"MovieCollection", []any{&MovieCollection{}}, []string{"id"}, nil},
+		{"Keyword", []any{&KeywordDB{}}, []string{"id"}, nil},
+		{"Movie", []any{&MovieDB{}}, []string{"id"}, nil},
+		{"CinemaPerson", []any{&Person{}, &PersonDetailsDB{}}, []string{"id"}, nil},
+		{"MovieActor", []any{&MovieActor{}}, []string{"movieId", "actorId"}, nil},
+		{"MovieDirector", []any{&MovieDirector{}}, []string{"movieId", "directorId"}, nil},
+		{"MovieCrew", []any{&MovieCrew{}}, []string{"movieId", "personId", "job"}, nil},
+		{"MovieGenre", []any{&MovieGenre{}}, []string{"movieId", "genreId"}, nil},
+		{"MovieCountry", []any{&MovieCountry{}}, []string{"movieId", "countryIso"}, nil},
+		{"MReleaseCountry", []any{&MReleaseCountry{}}, []string{"movieId", "iso31661"}, nil},
+		{"MLocalRelease", []any{&MLocalRelease{}}, []string{"movieId", "iso31661", "type", "releaseDate"}, nil},
+		{"MovieTranslation", []any{&MovieTranslation{}}, []string{"movieId", "locale"}, nil},
+		{"MovieWikidata", []any{&MovieWikidata{}}, []string{"movieId"}, nil},
+		{"MovieExternalIds", []any{&MovieExternalIds{}}, []string{"movieId"}, nil},
+		{"MovieAward", []any{&MovieAward{}}, []string{"movieId", "awardId"}, nil},
+		{"MovieBasedOn", []any{&MovieBasedOn{}}, []string{"movieId", "workId"}, nil},
+		{"MovieTag", []any{&MovieTag{}}, []string{"movieId", "tag"}, nil},
+		{"MovieKeyword", []any{&MovieKeyword{}}, []string{"movieId", "keywordId"}, nil},
+		{"MovieAlternativeTitle", []any{&MovieAlternativeTitle{}}, []string{"movieId", "iso31661", "title"}, nil},
+		{"Series", []any{&SeriesDB{}}, []string{"id"}, nil},
+		{"Season", []any{&SeasonDB{}}, []string{"id"}, [][]string{{"seriesId", "seasonNumber"}}},
+		{"Episode", []any{&EpisodeDB{}}, []string{"id"}, [][]string{{"seriesId", "seasonNumber", "episodeNumber"}}},
+		{"SeriesGenre", []any{&SeriesGenre{}}, []string{"seriesId", "genreId"}, nil},
+		{"SeriesCountry", []any{&SeriesCountry{}}, []string{"seriesId", "countryIso"}, nil},
+		{"SeriesCreator", []any{&SeriesCreator{}}, []string{"seriesId", "creatorId"}, nil},
+		{"WatchProvider", []any{&WatchProvider{}}, []string{"id"}, nil},
+		{"MovieWatchProvider", []any{&MovieWatchProvider{}}, []string{"movieId", "countryIso", "providerId", "type"}, nil},
+	}
+}
+
+// modelColumn is a column derived from a model field.
+type modelColumn struct {
+	Name     string
+	SQLType  string
+	Nullable bool
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// sqlType maps a Go field type to the Postgres type the cron writes it as.
+// Fields whose column has another type, such as dates held as strings, say
+// so with a gorm type tag.
+func sqlType(t reflect.Type) (string, error) {
+	if t == timeType {
+		return "timestamptz", nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "text", nil
+	case reflect.Bool:
+		return "boolean", nil
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int:
+		return "integer", nil
+	case reflect.Uint64, reflect.Int64, reflect.Uint:
+		return "bigint", nil
+	case reflect.Float32:
+		return "real", nil
+	case reflect.Float64:
+		return "double precision", nil
+	}
+	return "", fmt.Errorf("no column type for %s", t)
+}
+
+// columns parses the models of t into its columns, first model first.
+func (t modelTable) columns() ([]modelColumn, error) {
+	var cols []modelColumn
+	seen := map[string]bool{}
+	for _, model := range t.Models {
+		s, err := schema.Parse(model, &sync.Map{}, schema.NamingStrategy{})
+		if err != nil {
+			return nil, fmt.Errorf("parsing model of %s: %w", t.Table, err)
+		}
+		for _, f := range s.Fields {
+			if f.DBName == "" || seen[f.DBName] {
+				continue
+			}
+			seen[f.DBName] = true
+			typ, nullable := f.FieldType, false
+			if typ.Kind() == reflect.Pointer {
+				typ, nullable = typ.Elem(), true
+			}
+			col := modelColumn{f.DBName, f.TagSettings["TYPE"], nullable}
+			if col.SQLType == "" {
+				if col.SQLType, err = sqlType(typ); err != nil {
+					return nil, fmt.Errorf("%s.%s: %w", t.Table, f.DBName, err)
+				}
+			}
+			cols = append(cols, col)
+		}
+	}
+	for _, key := range append([][]string{t.Key}, t.Unique...) {
+		for _, c := range key {
+			if !seen[c] {
+				return nil, fmt.Errorf("%s: key column %q is not in the model", t.Table, c)
+			}
+		}
+	}
+	return cols, nil
+}
+
+func quotedList(cols []string) string {
+	quoted := make([]string, len(cols))
+	for i, c := range cols {
+		quoted[i] = `"` + c + `"`
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func writeSQLSchema(w io.Writer, tables []modelTable) error {
+	for _, t := range tables {
+		cols, err := t.columns()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "CREATE TABLE \"%s\" (\n", t.Table)
+		for _, c := range cols {
+			null := " NOT NULL"
+			if c.Nullable {
+				null = ""
+			}
+			fmt.Fprintf(w, "\t\"%s\" %s%s,\n", c.Name, c.SQLType, null)
+		}
+		for _, unique := range t.Unique {
+			fmt.Fprintf(w, "\tUNIQUE (%s),\n", quotedList(unique))
+		}
+		fmt.Fprintf(w, "\tPRIMARY KEY (%s)\n);\n\n", quotedList(t.Key))
+	}
+	return nil
+}
+
+// prismaTypes maps column types to Prisma's, with the native type
+// attribute when Prisma's default differs.
+var prismaTypes = map[string][2]string{
+	"text":             {"String", ""},
+	"boolean":          {"Boolean", ""},
+	"smallint":         {"Int", "@db.SmallInt"},
+	"integer":          {"Int", ""},
+	"bigint":           {"BigInt", ""},
+	"real":             {"Float", "@db.Real"},
+	"double precision": {"Float", ""},
+	"timestamptz":      {"DateTime", "@db.Timestamptz(6)"},
+	"date":             {"DateTime", "@db.Date"},
+	"jsonb":            {"Json", ""},
+}
+
+func writePrismaSchema(w io.Writer, tables []modelTable) error {
+	for _, t := range tables {
+		cols, err := t.columns()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "model %s {\n", t.Table)
+		var fields strings.Builder
+		tw := tabwriter.NewWriter(&fields, 0, 0, 1, ' ', 0)
+		for _, c := range cols {
+			typ, ok := prismaTypes[c.SQLType]
+			if !ok {
+				return fmt.Errorf("%s.%s: no Prisma type for %s", t.Table, c.Name, c.SQLType)
+			}
+			name := typ[0]
+			if c.Nullable {
+				name += "?"
+			}
+			attrs := []string{}
+			if len(t.Key) == 1 && t.Key[0] == c.Name {
+				attrs = append(attrs, "@id")
+			}
+			if typ[1] != "" {
+				attrs = append(attrs, typ[1])
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%s\n", c.Name, name, strings.Join(attrs, " "))
+		}
+		tw.Flush()
+		for _, line := range strings.SplitAfter(fields.String(), "\n") {
+			if line != "" {
+				fmt.Fprintln(w, strings.TrimRight(line, " \n"))
+			}
+		}
+		if len(t.Key) > 1 || len(t.Unique) > 0 {
+			fmt.Fprintln(w)
+		}
+		if len(t.Key) > 1 {
+			fmt.Fprintf(w, "  @@id([%s])\n", strings.Join(t.Key, ", "))
+		}
+		for _, unique := range t.Unique {
+			fmt.Fprintf(w, "  @@unique([%s])\n", strings.Join(unique, ", "))
+		}
+		fmt.Fprintf(w, "}\n\n")
+	}
+	return nil
+}
+
+// runSchema handles "schema export", which prints the managed tables that
+// have Go models as SQL DDL and as a Prisma schema fragment, so the
+// website's schema can be diffed against what the cron writes. Tables the
+// cron only fills with SQL are listed but not generated.
+func runSchema(args []string) error {
+	if len(args) == 0 || args[0] != "export" {
+		return fmt.Errorf("usage: schema export [--format sql|prisma|both] [--out file]")
+	}
+	fs := flag.NewFlagSet("schema export", flag.ContinueOnError)
+	format := fs.String("format", "both", "sql, prisma or both")
+	out := fs.String("out", "", "file to write instead of stdout")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *format != "sql" && *format != "prisma" && *format != "both" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	tables := modelTables()
+	modeled := map[string]bool{}
+	for _, t := range tables {
+		modeled[t.Table] = true
+	}
+	var unmodeled []string
+	for _, table := range managedTables {
+		if !modeled[table] {
+			unmodeled = append(unmodeled, table)
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	if *format != "prisma" {
+		fmt.Fprintf(w, "-- Generated by `schema export` from the cron's Go models.\n")
+		fmt.Fprintf(w, "-- Without models, not generated: %s\n\n", strings.Join(unmodeled, ", "))
+		if err := writeSQLSchema(w, tables); err != nil {
+			return err
+		}
+	}
+	if *format != "sql" {
+		fmt.Fprintf(w, "// Generated by `schema export` from the cron's Go models.\n")
+		fmt.Fprintf(w, "// Without models, not generated: %s\n\n", strings.Join(unmodeled, ", "))
+		if err := writePrismaSchema(w, tables); err != nil {
+			return err
+		}
+	}
+	return nil
+}
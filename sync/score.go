@@ -0,0 +1,47 @@
+package sync
+
+import (
+	"gorm.io/gorm"
+)
+
+// ScoreWeights configures the composite wiitco score. Each signal is
+// normalized to roughly 0..1 before weighting, so weights are comparable.
+type ScoreWeights struct {
+	Popularity   float64
+	Votes        float64
+	Recency      float64
+	Availability float64
+	// RecencyDays is the decay constant of the recency signal: a movie
+	// released this many days ago (or ahead) scores 1/e on recency.
+	RecencyDays float64
+}
+
+// updateWiitcoScores recomputes the composite score for every movie and only
+// rewrites rows whose score changed. Votes are TMDB's, which every synced
+// movie has, unlike IMDb's. Recency decays daily, so unchanged
+// movies still need a fresh score.
+func updateWiitcoScores(db *gorm.DB, w ScoreWeights, countries []string) error {
+	availability := `0`
+	var args []any
+	if len(countries) > 0 {
+		availability = `(
+			SELECT count(DISTINCT rc."iso31661")
+			FROM "MReleaseCountry" rc
+			WHERE rc."movieId" = m."id" AND rc."iso31661" IN ?
+		)::real / ?`
+		args = append(args, countries, len(countries))
+	}
+
+	query := `UPDATE "Movie" m SET "wiitcoScore" = s.score
+		FROM (
+			SELECT m."id",
+				(? * ln(1 + m."popularity") / ln(1001)
+				+ ? * ln(1 + m."voteCount") / ln(100001)
+				+ ? * COALESCE(exp(-abs(current_date - m."primaryReleaseDate"::date)::float8 / ?::float8), 0)
+				+ ? * ` + availability + `)::real AS score
+			FROM "Movie" m
+		) s
+		WHERE s."id" = m."id" AND m."wiitcoScore" IS DISTINCT FROM s.score`
+	args = append([]any{w.Popularity, w.Votes, w.Recency, w.RecencyDays, w.Availability}, args...)
+	return db.Exec(query, args...).Error
+}
@@ -0,0 +1,209 @@
+package sync
+
+import (
+	"embed"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// seedFiles hold the demo catalog: movies.tsv lists well-known movies with
+// their genres, countries, directors, leading cast and collection, and
+// people.tsv names everyone referenced. IDs are TMDB's, so a later sync
+// simply fills in the rest.
+//
+//go:embed seed/movies.tsv seed/people.tsv
+var seedFiles embed.FS
+
+// runSeed loads the embedded demo catalog through the regular write path,
+// giving an empty database something to show without an API key.
+func runSeed(db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	payloads, err := seedPayloads()
+	if err != nil {
+		return err
+	}
+	ids := make([]uint32, 0, len(payloads))
+	for id := range payloads {
+		ids = append(ids, id)
+	}
+	// The seed people are only known by name. Both are restored for the
+	// steps of a playbook running after seed.
+	defer func(source func(uint32, []string) ([]byte, error), personDetails bool) {
+		detailsSource, cfg.PersonDetails = source, personDetails
+	}(detailsSource, cfg.PersonDetails)
+	detailsSource = func(id uint32, _ []string) ([]byte, error) {
+		return payloads[id], nil
+	}
+	cfg.PersonDetails = false
+	outputf("Seeding %d movies\n", len(ids))
+
+	return withRun(db, "seed", func() error {
+		afterMovieWrites(db, syncMovieIDs(db, idsChannel(ids)))
+		return nil
+	})
+}
+
+// seedPayloads builds a TMDB-shaped details payload for every seed movie.
+// Each movie gets a theatrical release in its first production country on
+// its release date.
+func seedPayloads() (map[uint32][]byte, error) {
+	people := map[uint32]string{}
+	rows, err := readSeedFile("seed/people.tsv")
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		id, err := strconv.ParseUint(row[0], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("seed/people.tsv: %w", err)
+		}
+		people[uint32(id)] = row[1]
+	}
+
+	genres := map[uint32]Genre{}
+	for _, g := range tmdbGenres {
+		genres[g.ID] = g
+	}
+
+	rows, err = readSeedFile("seed/movies.tsv")
+	if err != nil {
+		return nil, err
+	}
+	payloads := make(map[uint32][]byte, len(rows))
+	for _, row := range rows {
+		movie, err := seedMovie(row, people, genres)
+		if err != nil {
+			return nil, fmt.Errorf("seed/movies.tsv: movie %s: %w", row[0], err)
+		}
+		body, err := json.Marshal(movie)
+		if err != nil {
+			return nil, err
+		}
+		payloads[movie.ID] = body
+	}
+	return payloads, nil
+}
+
+// seedMovie converts a movies.tsv row: id, title, original title (empty if
+// the same), language, release date, runtime, genre IDs, country codes,
+// director IDs, cast IDs and collection ID.
+func seedMovie(row []string, people map[uint32]string, genres map[uint32]Genre) (Movie, error) {
+	var movie Movie
+	id, err := strconv.ParseUint(row[0], 10, 32)
+	if err != nil {
+		return movie, err
+	}
+	runtime, err := strconv.ParseUint(row[5], 10, 16)
+	if err != nil {
+		return movie, err
+	}
+	released, err := time.Parse("2006-01-02", row[4])
+	if err != nil {
+		return movie, err
+	}
+	movie.ID, movie.Title, movie.Runtime, movie.ReleaseDateStr = uint32(id), row[1], uint16(runtime), row[4]
+	originalTitle, language := row[1], row[3]
+	if row[2] != "" {
+		originalTitle = row[2]
+	}
+	movie.OriginalTitle, movie.OriginalLanguage = &originalTitle, &language
+
+	genreIDs, err := seedIDs(row[6])
+	if err != nil {
+		return movie, err
+	}
+	for _, gid := range genreIDs {
+		g, ok := genres[gid]
+		if !ok {
+			return movie, fmt.Errorf("unknown genre %d", gid)
+		}
+		movie.Genres = append(movie.Genres, g)
+	}
+	for _, iso := range strings.Split(row[7], ",") {
+		movie.ProductionCountries = append(movie.ProductionCountries, ProductionCountry{ISO31661: iso, Name: iso})
+	}
+	movie.ReleaseDates.Results = []ReleaseCountry{{
+		ISO31661:          movie.ProductionCountries[0].ISO31661,
+		LocalReleaseDates: []LocalReleaseDate{{ReleaseDate: released, Type: releaseTheatrical}},
+	}}
+
+	var credits struct {
+		Cast []CastMember `json:"cast"`
+		Crew []CrewMember `json:"crew"`
+	}
+	directors, err := seedIDs(row[8])
+	if err != nil {
+		return movie, err
+	}
+	cast, err := seedIDs(row[9])
+	if err != nil {
+		return movie, err
+	}
+	for _, pid := range directors {
+		if people[pid] == "" {
+			return movie, fmt.Errorf("unknown person %d", pid)
+		}
+		credits.Crew = append(credits.Crew, CrewMember{ID: pid, Name: people[pid], Department: "Directing", Job: "Director"})
+	}
+	for i, pid := range cast {
+		if people[pid] == "" {
+			return movie, fmt.Errorf("unknown person %d", pid)
+		}
+		credits.Cast = append(credits.Cast, CastMember{ID: pid, Name: people[pid], Order: uint16(i)})
+	}
+	if movie.Credits, err = json.Marshal(credits); err != nil {
+		return movie, err
+	}
+
+	if row[10] != "" {
+		collection, err := strconv.ParseUint(row[10], 10, 32)
+		if err != nil {
+			return movie, err
+		}
+		movie.Collection = &Collection{ID: uint32(collection)}
+	}
+	return movie, nil
+}
+
+// readSeedFile returns the rows of an embedded TSV file without its header.
+func readSeedFile(name string) ([][]string, error) {
+	f, err := seedFiles.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.Comma = '\t'
+	r.LazyQuotes = true
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return rows[1:], nil
+}
+
+func seedIDs(field string) ([]uint32, error) {
+	var ids []uint32
+	for _, part := range envSplit(field) {
+		id, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, uint32(id))
+	}
+	return ids, nil
+}
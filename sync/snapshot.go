@@ -0,0 +1,195 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/klauspost/compress/zstd"
+	"gorm.io/gorm"
+)
+
+const snapshotPrefix = "snapshots/"
+
+type snapshotManifest struct {
+	CreatedAt time.Time       `json:"createdAt"`
+	Tables    []snapshotTable `json:"tables"`
+}
+
+type snapshotTable struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+	Rows int64  `json:"rows"`
+	// Columns are the columns copied, in order, so a restore still lines
+	// up once later versions add columns. Older snapshots have none.
+	Columns []string `json:"columns,omitempty"`
+}
+
+// runSnapshot dumps every managed table with COPY into zstd-compressed
+// objects under snapshots/{timestamp}/ and prunes snapshots beyond the
+// configured retention count. All tables are copied in one repeatable-read
+// transaction, so rows referring to each other are captured at the same
+// point in time.
+func runSnapshot(db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("snapshot", flag.ContinueOnError)
+	keep := fs.Int("keep", cfg.SnapshotRetention, "number of snapshots to retain")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if cfg.ObjectStoreURL == "" {
+		return fmt.Errorf("OBJECT_STORE_URL is required")
+	}
+	store, err := newObjectStore(cfg.ObjectStoreURL)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	name := time.Now().UTC().Format("20060102T150405Z")
+	manifest := snapshotManifest{CreatedAt: time.Now()}
+	err = withPgxConn(ctx, db, func(conn *pgx.Conn) error {
+		opts := pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly}
+		return pgx.BeginTxFunc(ctx, conn, opts, func(tx pgx.Tx) error {
+			for _, table := range managedTables {
+				t := snapshotTable{Name: table, Key: snapshotPrefix + name + "/" + table + ".copy.zst"}
+				rows, err := tx.Query(ctx, `SELECT column_name FROM information_schema.columns
+					WHERE table_schema = current_schema() AND table_name = $1 ORDER BY ordinal_position`, table)
+				if err != nil {
+					return err
+				}
+				if t.Columns, err = pgx.CollectRows(rows, pgx.RowTo[string]); err != nil {
+					return err
+				}
+				if t.Rows, err = snapshotTableTo(ctx, tx, store, t); err != nil {
+					return fmt.Errorf("snapshotting %s: %w", table, err)
+				}
+				manifest.Tables = append(manifest.Tables, t)
+				outputf("Snapshotted %s: %d rows\n", table, t.Rows)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	body, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := store.Put(ctx, snapshotPrefix+name+"/manifest.json", bytes.NewReader(body)); err != nil {
+		return err
+	}
+	outputf("Snapshot %s written\n", name)
+
+	return pruneSnapshots(ctx, store, *keep)
+}
+
+func snapshotTableTo(ctx context.Context, tx pgx.Tx, store objectStore, t snapshotTable) (int64, error) {
+	pr, pw := io.Pipe()
+	var rows int64
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		enc, err := zstd.NewWriter(pw)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		tag, err := tx.Conn().PgConn().CopyTo(ctx, enc, `COPY "`+t.Name+`" `+copyColumns(t.Columns)+`TO STDOUT`)
+		rows = tag.RowsAffected()
+		if closeErr := enc.Close(); err == nil {
+			err = closeErr
+		}
+		pw.CloseWithError(err)
+	}()
+	err := store.Put(ctx, t.Key, pr)
+	pr.CloseWithError(err)
+	// The connection is free for the next table only once COPY returned.
+	<-done
+	return rows, err
+}
+
+// copyColumns is the column list of a COPY statement, empty for none.
+func copyColumns(columns []string) string {
+	if len(columns) == 0 {
+		return ""
+	}
+	return `("` + strings.Join(columns, `", "`) + `") `
+}
+
+// withPgxConn runs fn on a raw pgx connection from the pool, for protocol
+// features such as COPY that database/sql doesn't expose.
+func withPgxConn(ctx context.Context, db *gorm.DB, fn func(conn *pgx.Conn) error) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Raw(func(driverConn any) error {
+		c, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("unexpected driver connection %T", driverConn)
+		}
+		return fn(c.Conn())
+	})
+}
+
+// listSnapshots returns snapshot names, newest first.
+func listSnapshots(ctx context.Context, store objectStore) ([]string, error) {
+	keys, err := store.List(ctx, snapshotPrefix)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var names []string
+	for _, key := range keys {
+		name, _, _ := strings.Cut(strings.TrimPrefix(key, snapshotPrefix), "/")
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	return names, nil
+}
+
+func pruneSnapshots(ctx context.Context, store objectStore, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	names, err := listSnapshots(ctx, store)
+	if err != nil {
+		return err
+	}
+	if len(names) <= keep {
+		return nil
+	}
+	for _, name := range names[keep:] {
+		keys, err := store.List(ctx, path.Join(snapshotPrefix, name)+"/")
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err := store.Delete(ctx, key); err != nil {
+				return err
+			}
+		}
+		outputf("Pruned snapshot %s\n", name)
+	}
+	return nil
+}
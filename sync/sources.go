@@ -0,0 +1,174 @@
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Some Movie columns are known to more than one source: TMDB, the
+// corrections table and, once the wikidata command has enriched a movie,
+// Wikidata. SOURCE_PRECEDENCE names, per field, the order the sources are
+// tried in when a movie is written; the first one with a value wins and is
+// recorded in Movie."provenance", a JSON object of field to source. Fields
+// left out keep TMDB's value with any correction applied.
+
+// Sources a field can be resolved from.
+const (
+	sourceCorrection = "correction"
+	sourceTMDB       = "tmdb"
+	sourceWikidata   = "wikidata"
+)
+
+var knownSources = []string{sourceCorrection, sourceTMDB, sourceWikidata}
+
+const defaultSourcePrecedence = "runtime:correction>tmdb>wikidata,primaryReleaseDate:correction>tmdb>wikidata"
+
+// resolvedFields read the value of a resolvable field from a parsed movie,
+// "" when it has none. Values are written back with correctionSetters.
+var resolvedFields = map[string]func(m *MovieDB) string{
+	"runtime": func(m *MovieDB) string {
+		if m.Runtime == 0 {
+			return ""
+		}
+		return strconv.Itoa(int(m.Runtime))
+	},
+	"primaryReleaseDate": func(m *MovieDB) string {
+		if m.ReleaseDateStr == nil {
+			return ""
+		}
+		return *m.ReleaseDateStr
+	},
+}
+
+// parseSourcePrecedence parses "field:source>source,..." into the sources
+// of each field, in order.
+func parseSourcePrecedence(raw string) (map[string][]string, error) {
+	out := map[string][]string{}
+	for _, part := range envSplit(raw) {
+		field, order, found := strings.Cut(part, ":")
+		if !found {
+			return nil, fmt.Errorf("SOURCE_PRECEDENCE: %q is not a field:source>source entry", part)
+		}
+		if _, ok := resolvedFields[field]; !ok {
+			return nil, fmt.Errorf("SOURCE_PRECEDENCE: unknown field %q", field)
+		}
+		var sources []string
+		for _, source := range strings.Split(order, ">") {
+			source = strings.TrimSpace(source)
+			if !slices.Contains(knownSources, source) {
+				return nil, fmt.Errorf("SOURCE_PRECEDENCE: %s: unknown source %q", field, source)
+			}
+			if slices.Contains(sources, source) {
+				return nil, fmt.Errorf("SOURCE_PRECEDENCE: %s: source %q listed twice", field, source)
+			}
+			sources = append(sources, source)
+		}
+		out[field] = sources
+	}
+	return out, nil
+}
+
+// tmdbValues keeps what TMDB said for the resolvable fields of m, before
+// corrections overwrite them.
+func tmdbValues(m *MovieDB) map[string]string {
+	values := map[string]string{}
+	for field, get := range resolvedFields {
+		if v := get(m); v != "" {
+			values[field] = v
+		}
+	}
+	return values
+}
+
+type wikidataFacts struct {
+	MovieId     uint32  `gorm:"column:movieId"`
+	Runtime     *uint16 `gorm:"column:runtime"`
+	ReleaseDate *string `gorm:"column:releaseDate"`
+}
+
+func (f wikidataFacts) values() map[string]string {
+	values := map[string]string{}
+	if f.Runtime != nil && *f.Runtime > 0 {
+		values["runtime"] = strconv.Itoa(int(*f.Runtime))
+	}
+	if f.ReleaseDate != nil {
+		values["primaryReleaseDate"] = (*f.ReleaseDate)[:min(len(*f.ReleaseDate), 10)]
+	}
+	return values
+}
+
+// resolveSources applies the configured precedence to the movies about to
+// be written and notes the source of each resolved field.
+func resolveSources(tx *gorm.DB, objects []MovieDB) error {
+	if len(cfg.SourcePrecedence) == 0 {
+		return nil
+	}
+	ids := make([]uint32, 0, len(objects))
+	for _, o := range objects {
+		ids = append(ids, o.ID)
+	}
+	var facts []wikidataFacts
+	err := tx.Table("MovieWikidata").Select(`"movieId", "runtime", "releaseDate"::text AS "releaseDate"`).
+		Where(`"movieId" IN ?`, ids).Scan(&facts).Error
+	if err != nil {
+		return fmt.Errorf("loading Wikidata facts: %w", err)
+	}
+	wikidata := make(map[uint32]map[string]string, len(facts))
+	for _, f := range facts {
+		wikidata[f.MovieId] = f.values()
+	}
+
+	for i := range objects {
+		m := &objects[i]
+		if m.tmdb == nil {
+			continue
+		}
+		m.sources = map[string]string{}
+		for field, order := range cfg.SourcePrecedence {
+			for _, source := range order {
+				var v string
+				switch source {
+				case sourceCorrection:
+					v = corrections[m.ID][field]
+				case sourceTMDB:
+					v = m.tmdb[field]
+				case sourceWikidata:
+					v = wikidata[m.ID][field]
+				}
+				if v == "" {
+					continue
+				}
+				if err := correctionSetters[field](m, v); err != nil {
+					logger.Warn("skipping invalid source value", "movieId", m.ID, "field", field, "source", source, "value", v)
+					continue
+				}
+				m.sources[field] = source
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// setProvenance stores the sources resolveSources picked, minus the fields
+// screening held back, in Movie."provenance".
+func setProvenance(objects []MovieDB) error {
+	for i := range objects {
+		m := &objects[i]
+		if m.sources == nil {
+			continue
+		}
+		raw, err := json.Marshal(m.sources)
+		if err != nil {
+			return err
+		}
+		provenance := string(raw)
+		m.Provenance = &provenance
+	}
+	return nil
+}
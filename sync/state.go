@@ -0,0 +1,539 @@
+package sync
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// stateStore keeps the operational state of the cron: the SyncRun records,
+// whose successful windows make up the changes cursor, and the checkpoints
+// of movie syncs. It lives in Postgres unless STATE_STORE_URL moves it to
+// object storage, which leaves the target database a pure read model.
+type stateStore interface {
+	createRun(run *SyncRun) error
+	saveRun(run SyncRun) error
+	// lastRun returns the newest run of mode other than exclude.
+	lastRun(mode string, exclude uint64) (*SyncRun, error)
+	// finishedRuns returns up to limit of the newest finished runs of mode.
+	finishedRuns(mode string, limit int) ([]SyncRun, error)
+	// cursor returns when a run of mode last succeeded and the furthest
+	// window end such runs covered.
+	cursor(mode string) (lastSuccess, windowEnd *time.Time, err error)
+
+	moveCheckpoint(from, to uint64) error
+	checkpointedPages(runID uint64) ([]int, error)
+	// checkpointPage records the movies listed on a changes page together
+	// with the page itself.
+	checkpointPage(runID uint64, page int, ids []uint32) error
+	checkpointMovies(runID uint64, ids []uint32, priority int16) error
+	// pendingMovies returns up to limit movies not done yet, highest
+	// priority first.
+	pendingMovies(runID uint64, limit int) ([]uint32, error)
+	pendingCount(runID uint64) (int, error)
+	markDone(runID uint64, ids []uint32) error
+	clearCheckpoint(runID uint64) error
+}
+
+// state is the store of the current command, opened by prepare.
+var state stateStore
+
+// stateTables are the tables of the Postgres state store, and
+// operationalTables those of the run's other bookkeeping. Neither is created
+// when the state lives in object storage.
+var (
+	stateTables       = []string{"SyncRun", "SyncCheckpointPage", "SyncCheckpointMovie"}
+	operationalTables = []string{"Changefeed", "ChangefeedDigest", "Outbox", "Quarantine", "RunProgress", "CoverageStats", "RawPayloadChunk"}
+)
+
+func openStateStore(db *gorm.DB, rawURL string) (stateStore, error) {
+	if rawURL == "" {
+		return dbState{db: db}, nil
+	}
+	store, err := newObjectStore(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &objectState{store: store, checkpoints: map[uint64]*objectCheckpoint{}}, nil
+}
+
+type dbState struct {
+	db *gorm.DB
+}
+
+func (s dbState) createRun(run *SyncRun) error {
+	return s.db.Table("SyncRun").Create(run).Error
+}
+
+func (s dbState) saveRun(run SyncRun) error {
+	return s.db.Table("SyncRun").Where(`"id" = ?`, run.ID).Updates(map[string]any{
+		"finishedAt":    run.FinishedAt,
+		"status":        run.Status,
+		"fetches":       run.Fetches,
+		"fetchFailures": run.FetchFailures,
+		"batches":       run.Batches,
+		"batchFailures": run.BatchFailures,
+		"windowStart":   run.WindowStart,
+		"windowEnd":     run.WindowEnd,
+		"resumedFrom":   run.ResumedFrom,
+	}).Error
+}
+
+func (s dbState) lastRun(mode string, exclude uint64) (*SyncRun, error) {
+	var last []SyncRun
+	err := s.db.Table("SyncRun").
+		Where(`"mode" = ? AND "id" <> ?`, mode, exclude).
+		Order(`"id" DESC`).Limit(1).Find(&last).Error
+	if err != nil || len(last) == 0 {
+		return nil, err
+	}
+	return &last[0], nil
+}
+
+func (s dbState) finishedRuns(mode string, limit int) ([]SyncRun, error) {
+	var runs []SyncRun
+	err := s.db.Table("SyncRun").
+		Where(`"mode" = ? AND "finishedAt" IS NOT NULL`, mode).
+		Order(`"id" DESC`).Limit(limit).Find(&runs).Error
+	return runs, err
+}
+
+func (s dbState) cursor(mode string) (*time.Time, *time.Time, error) {
+	var finished, ends []time.Time
+	err := s.db.Table("SyncRun").
+		Where(`"mode" = ? AND "finishedAt" IS NOT NULL AND "status" = ?`, mode, runSuccess).
+		Order(`"finishedAt" DESC`).Limit(1).
+		Pluck(`"finishedAt"`, &finished).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	err = s.db.Table("SyncRun").
+		Where(`"mode" = ? AND "status" = ? AND "windowEnd" IS NOT NULL`, mode, runSuccess).
+		Order(`"windowEnd" DESC`).Limit(1).
+		Pluck(`"windowEnd"`, &ends).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	var lastSuccess, windowEnd *time.Time
+	if len(finished) > 0 {
+		lastSuccess = &finished[0]
+	}
+	if len(ends) > 0 {
+		windowEnd = &ends[0]
+	}
+	return lastSuccess, windowEnd, nil
+}
+
+func (s dbState) moveCheckpoint(from, to uint64) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for _, table := range []string{"SyncCheckpointPage", "SyncCheckpointMovie"} {
+			if err := tx.Exec(`UPDATE "`+table+`" SET "runId" = ? WHERE "runId" = ?`, to, from).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s dbState) checkpointedPages(runID uint64) ([]int, error) {
+	var pages []int
+	err := s.db.Table("SyncCheckpointPage").Where(`"runId" = ?`, runID).Pluck(`"page"`, &pages).Error
+	return pages, err
+}
+
+func (s dbState) checkpointPage(runID uint64, page int, ids []uint32) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := (dbState{db: tx}).checkpointMovies(runID, ids, 0); err != nil {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Table("SyncCheckpointPage").
+			Create(&checkpointPage{RunId: runID, Page: page}).Error
+	})
+}
+
+func (s dbState) checkpointMovies(runID uint64, ids []uint32, priority int16) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	rows := make([]checkpointMovie, 0, len(ids))
+	for _, id := range ids {
+		rows = append(rows, checkpointMovie{RunId: runID, MovieId: id, Priority: priority})
+	}
+	return s.db.Clauses(clause.OnConflict{DoNothing: true}).Table("SyncCheckpointMovie").
+		CreateInBatches(&rows, cfg.Preset.BatchSize).Error
+}
+
+func (s dbState) pendingMovies(runID uint64, limit int) ([]uint32, error) {
+	var ids []uint32
+	err := s.db.Table("SyncCheckpointMovie").
+		Where(`"runId" = ? AND NOT "done"`, runID).
+		Order(`"priority" DESC, "movieId"`).Limit(limit).
+		Pluck(`"movieId"`, &ids).Error
+	return ids, err
+}
+
+func (s dbState) pendingCount(runID uint64) (int, error) {
+	var n int64
+	err := s.db.Table("SyncCheckpointMovie").Where(`"runId" = ? AND NOT "done"`, runID).Count(&n).Error
+	return int(n), err
+}
+
+func (s dbState) markDone(runID uint64, ids []uint32) error {
+	for start := 0; start < len(ids); start += denormalizeChunkSize {
+		chunk := ids[start:min(start+denormalizeChunkSize, len(ids))]
+		err := s.db.Exec(`UPDATE "SyncCheckpointMovie" SET "done" = true WHERE "runId" = ? AND "movieId" IN ?`, runID, chunk).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s dbState) clearCheckpoint(runID uint64) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`DELETE FROM "SyncCheckpointPage" WHERE "runId" = ?`, runID).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`DELETE FROM "SyncCheckpointMovie" WHERE "runId" = ?`, runID).Error
+	})
+}
+
+// objectState keeps the state as JSON objects under state/:
+//
+//	state/run-ids/{id}            one claim per run ID handed out, zero-padded
+//	state/runs/{mode}/{id}.json   one SyncRun each, IDs zero-padded
+//	state/cursors/{mode}.json     the cursor of mode
+//	state/checkpoints/{id}.json   the checkpoint of a run
+//
+// Stores written before the claims have state/run-id, the last run ID
+// handed out, which the claims continue from. Checkpoints are cached and
+// written back whole on every change.
+type objectState struct {
+	store objectStore
+
+	mu          sync.Mutex
+	checkpoints map[uint64]*objectCheckpoint
+}
+
+const statePrefix = "state/"
+
+type objectCursor struct {
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+	WindowEnd   *time.Time `json:"windowEnd,omitempty"`
+}
+
+type objectCheckpoint struct {
+	Pages  []int                         `json:"pages"`
+	Movies map[uint32]*checkpointedMovie `json:"movies"`
+}
+
+type checkpointedMovie struct {
+	Priority int16 `json:"priority"`
+	Done     bool  `json:"done"`
+}
+
+func runKey(mode string, id uint64) string {
+	return fmt.Sprintf("%sruns/%s/%020d.json", statePrefix, mode, id)
+}
+
+func checkpointKey(runID uint64) string {
+	return fmt.Sprintf("%scheckpoints/%d.json", statePrefix, runID)
+}
+
+// getJSON decodes the object at key into v and reports whether it exists.
+func (s *objectState) getJSON(key string, v any) (bool, error) {
+	r, err := s.store.Get(context.Background(), key)
+	if isNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+	if err := json.NewDecoder(r).Decode(v); err != nil {
+		return false, fmt.Errorf("decoding %s: %w", key, err)
+	}
+	return true, nil
+}
+
+func (s *objectState) putJSON(key string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.store.Put(context.Background(), key, bytes.NewReader(data))
+}
+
+func runIDKey(id uint64) string {
+	return fmt.Sprintf("%srun-ids/%020d", statePrefix, id)
+}
+
+// createRun claims the ID after the highest claimed one with a create-only
+// write, so of two runs starting together one fails instead of both getting
+// the same ID.
+func (s *objectState) createRun(run *SyncRun) error {
+	last, err := s.lastRunID()
+	if err != nil {
+		return err
+	}
+	run.ID = last + 1
+	err = s.store.PutIfAbsent(context.Background(), runIDKey(run.ID), strings.NewReader(run.Mode))
+	if errors.Is(err, errObjectExists) {
+		return fmt.Errorf("run ID %d was claimed by a concurrent run; runs sharing a state store must not overlap", run.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("claiming run ID %d: %w", run.ID, err)
+	}
+	return s.putJSON(runKey(run.Mode, run.ID), run)
+}
+
+// lastRunID returns the highest run ID claimed, or recorded in the legacy
+// state/run-id.
+func (s *objectState) lastRunID() (uint64, error) {
+	var last uint64
+	r, err := s.store.Get(context.Background(), statePrefix+"run-id")
+	switch {
+	case isNotFound(err):
+	case err != nil:
+		return 0, err
+	default:
+		raw, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return 0, err
+		}
+		if last, err = strconv.ParseUint(strings.TrimSpace(string(raw)), 10, 64); err != nil {
+			return 0, fmt.Errorf("reading the last run ID: %w", err)
+		}
+	}
+	keys, err := s.store.List(context.Background(), statePrefix+"run-ids/")
+	if err != nil {
+		return 0, err
+	}
+	for _, key := range keys {
+		id, err := strconv.ParseUint(path.Base(key), 10, 64)
+		if err != nil {
+			continue
+		}
+		last = max(last, id)
+	}
+	return last, nil
+}
+
+func (s *objectState) saveRun(run SyncRun) error {
+	if err := s.putJSON(runKey(run.Mode, run.ID), run); err != nil {
+		return err
+	}
+	if run.Status == nil || *run.Status != runSuccess {
+		return nil
+	}
+	key := statePrefix + "cursors/" + run.Mode + ".json"
+	var cursor objectCursor
+	if _, err := s.getJSON(key, &cursor); err != nil {
+		return err
+	}
+	if run.FinishedAt != nil && (cursor.LastSuccess == nil || run.FinishedAt.After(*cursor.LastSuccess)) {
+		cursor.LastSuccess = run.FinishedAt
+	}
+	if run.WindowEnd != nil && (cursor.WindowEnd == nil || run.WindowEnd.After(*cursor.WindowEnd)) {
+		cursor.WindowEnd = run.WindowEnd
+	}
+	return s.putJSON(key, cursor)
+}
+
+func (s *objectState) lastRun(mode string, exclude uint64) (*SyncRun, error) {
+	keys, err := s.store.List(context.Background(), statePrefix+"runs/"+mode+"/")
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(keys)
+	for i := len(keys) - 1; i >= 0; i-- {
+		if keys[i] == runKey(mode, exclude) || path.Ext(keys[i]) != ".json" {
+			continue
+		}
+		var run SyncRun
+		if _, err := s.getJSON(keys[i], &run); err != nil {
+			return nil, err
+		}
+		return &run, nil
+	}
+	return nil, nil
+}
+
+func (s *objectState) finishedRuns(mode string, limit int) ([]SyncRun, error) {
+	keys, err := s.store.List(context.Background(), statePrefix+"runs/"+mode+"/")
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(keys)
+	var runs []SyncRun
+	for i := len(keys) - 1; i >= 0 && len(runs) < limit; i-- {
+		if path.Ext(keys[i]) != ".json" {
+			continue
+		}
+		var run SyncRun
+		if _, err := s.getJSON(keys[i], &run); err != nil {
+			return nil, err
+		}
+		if run.FinishedAt != nil {
+			runs = append(runs, run)
+		}
+	}
+	return runs, nil
+}
+
+func (s *objectState) cursor(mode string) (*time.Time, *time.Time, error) {
+	var cursor objectCursor
+	_, err := s.getJSON(statePrefix+"cursors/"+mode+".json", &cursor)
+	return cursor.LastSuccess, cursor.WindowEnd, err
+}
+
+// checkpoint returns the cached checkpoint of runID, loading it first if
+// needed. The caller holds s.mu.
+func (s *objectState) checkpoint(runID uint64) (*objectCheckpoint, error) {
+	if cp, ok := s.checkpoints[runID]; ok {
+		return cp, nil
+	}
+	cp := &objectCheckpoint{}
+	if _, err := s.getJSON(checkpointKey(runID), cp); err != nil {
+		return nil, err
+	}
+	if cp.Movies == nil {
+		cp.Movies = map[uint32]*checkpointedMovie{}
+	}
+	s.checkpoints[runID] = cp
+	return cp, nil
+}
+
+// update applies fn to the checkpoint of runID and writes it back.
+func (s *objectState) update(runID uint64, fn func(cp *objectCheckpoint)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp, err := s.checkpoint(runID)
+	if err != nil {
+		return err
+	}
+	fn(cp)
+	return s.putJSON(checkpointKey(runID), cp)
+}
+
+func (s *objectState) moveCheckpoint(from, to uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp, err := s.checkpoint(from)
+	if err != nil {
+		return err
+	}
+	if err := s.putJSON(checkpointKey(to), cp); err != nil {
+		return err
+	}
+	s.checkpoints[to] = cp
+	delete(s.checkpoints, from)
+	return s.store.Delete(context.Background(), checkpointKey(from))
+}
+
+func (s *objectState) checkpointedPages(runID uint64) ([]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp, err := s.checkpoint(runID)
+	if err != nil {
+		return nil, err
+	}
+	return slices.Clone(cp.Pages), nil
+}
+
+func (s *objectState) checkpointPage(runID uint64, page int, ids []uint32) error {
+	return s.update(runID, func(cp *objectCheckpoint) {
+		addCheckpointed(cp, ids, 0)
+		if !slices.Contains(cp.Pages, page) {
+			cp.Pages = append(cp.Pages, page)
+		}
+	})
+}
+
+func (s *objectState) checkpointMovies(runID uint64, ids []uint32, priority int16) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return s.update(runID, func(cp *objectCheckpoint) {
+		addCheckpointed(cp, ids, priority)
+	})
+}
+
+// addCheckpointed adds the movies not in cp yet, like the ON CONFLICT DO
+// NOTHING of the Postgres store.
+func addCheckpointed(cp *objectCheckpoint, ids []uint32, priority int16) {
+	for _, id := range ids {
+		if _, ok := cp.Movies[id]; !ok {
+			cp.Movies[id] = &checkpointedMovie{Priority: priority}
+		}
+	}
+}
+
+func (s *objectState) pendingMovies(runID uint64, limit int) ([]uint32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp, err := s.checkpoint(runID)
+	if err != nil {
+		return nil, err
+	}
+	var ids []uint32
+	for id, movie := range cp.Movies {
+		if !movie.Done {
+			ids = append(ids, id)
+		}
+	}
+	slices.SortFunc(ids, func(a, b uint32) int {
+		if c := cmp.Compare(cp.Movies[b].Priority, cp.Movies[a].Priority); c != 0 {
+			return c
+		}
+		return cmp.Compare(a, b)
+	})
+	return ids[:min(limit, len(ids))], nil
+}
+
+func (s *objectState) pendingCount(runID uint64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp, err := s.checkpoint(runID)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, movie := range cp.Movies {
+		if !movie.Done {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *objectState) markDone(runID uint64, ids []uint32) error {
+	return s.update(runID, func(cp *objectCheckpoint) {
+		for _, id := range ids {
+			if movie, ok := cp.Movies[id]; ok {
+				movie.Done = true
+			}
+		}
+	})
+}
+
+func (s *objectState) clearCheckpoint(runID uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.checkpoints, runID)
+	return s.store.Delete(context.Background(), checkpointKey(runID))
+}
@@ -0,0 +1,192 @@
+package sync
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type calendarRow struct {
+	CountryIso  string    `gorm:"column:countryIso" json:"-"`
+	Day         time.Time `gorm:"column:day" json:"-"`
+	MovieId     uint32    `gorm:"column:movieId" json:"movieId"`
+	Title       string    `json:"title"`
+	PosterPath  *string   `gorm:"column:posterPath" json:"posterPath"`
+	Type        uint8     `json:"type"`
+	WiitcoScore *float32  `gorm:"column:wiitcoScore" json:"score"`
+}
+
+type genreList struct {
+	GenreId uint32 `gorm:"column:genreId"`
+	Movies  string
+}
+
+// exportStatic writes the static JSON API into dir: movies/{id}.json for the
+// given movies, removing those of hidden or deleted ones,
+// calendar/{country}/{day}.json, genres/{id}.json and
+// festivals/{slug}/{start}.json. Calendar, genre and festival files are
+// always regenerated in full.
+func exportStatic(db *gorm.DB, dir string, ids []uint32, c Config) error {
+	if err := exportStaticMovies(db, dir, ids); err != nil {
+		return fmt.Errorf("movies: %w", err)
+	}
+	if err := exportStaticCalendar(db, dir, c); err != nil {
+		return fmt.Errorf("calendar: %w", err)
+	}
+	if err := exportStaticGenres(db, dir, c.StaticGenreListSize); err != nil {
+		return fmt.Errorf("genres: %w", err)
+	}
+	if err := exportStaticFestivals(db, dir); err != nil {
+		return fmt.Errorf("festivals: %w", err)
+	}
+	return nil
+}
+
+func exportStaticMovies(db *gorm.DB, dir string, ids []uint32) error {
+	expr, args := movieJSONSQL(0, nil)
+	for start := 0; start < len(ids); start += denormalizeChunkSize {
+		chunk := ids[start:min(start+denormalizeChunkSize, len(ids))]
+		var payloads []moviePayload
+		err := db.Raw(`SELECT m."id", `+expr+`::text AS "payload" FROM "Movie" m WHERE m."id" IN ? AND m."deletedAt" IS NULL`,
+			append(args, chunk)...).Scan(&payloads).Error
+		if err != nil {
+			return err
+		}
+		exported := map[uint32]bool{}
+		for _, p := range payloads {
+			exported[p.ID] = true
+			path := filepath.Join(dir, "movies", strconv.Itoa(int(p.ID))+".json")
+			if err := writeFileAtomic(path, []byte(p.Payload)); err != nil {
+				return err
+			}
+		}
+		// Hidden and deleted movies lose their files.
+		for _, id := range chunk {
+			if exported[id] {
+				continue
+			}
+			path := filepath.Join(dir, "movies", strconv.Itoa(int(id))+".json")
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func exportStaticCalendar(db *gorm.DB, dir string, c Config) error {
+	query := db.Table(`"MLocalRelease" lr`).
+		Select(`rc."iso31661" AS "countryIso", lr."releaseDate"::date AS "day", m."id" AS "movieId", m."title", m."posterPath", lr."type", m."wiitcoScore"`).
+		Joins(`JOIN "MReleaseCountry" rc ON `+releaseJoin).
+		Joins(`JOIN "Movie" m ON m."id" = rc."movieId" AND m."deletedAt" IS NULL`).
+		Where(`lr."releaseDate" >= current_date - make_interval(days => ?)`, c.StaticCalendarPastDays).
+		Where(`lr."releaseDate" < current_date + make_interval(days => ?)`, c.StaticCalendarFutureDays).
+		Order(`rc."iso31661", "day", m."wiitcoScore" DESC NULLS LAST, m."id"`)
+	if countries := c.regionCountries(); len(countries) > 0 {
+		query = query.Where(`rc."iso31661" IN ?`, countries)
+	}
+	var rows []calendarRow
+	if err := query.Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	// The calendar is built next to the live one and swapped in whole, so
+	// readers keep the previous calendar until the new one is complete.
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	calendarDir, err := os.MkdirTemp(dir, ".calendar-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(calendarDir)
+	if err := os.Chmod(calendarDir, 0o755); err != nil {
+		return err
+	}
+	for start := 0; start < len(rows); {
+		end := start
+		for end < len(rows) && rows[end].CountryIso == rows[start].CountryIso && rows[end].Day.Equal(rows[start].Day) {
+			end++
+		}
+		body, err := json.Marshal(rows[start:end])
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(calendarDir, rows[start].CountryIso, rows[start].Day.Format("2006-01-02")+".json")
+		if err := writeFileAtomic(path, body); err != nil {
+			return err
+		}
+		start = end
+	}
+
+	live := filepath.Join(dir, "calendar")
+	old := calendarDir + ".old"
+	if err := os.Rename(live, old); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Rename(calendarDir, live); err != nil {
+		os.Rename(old, live)
+		return err
+	}
+	return os.RemoveAll(old)
+}
+
+func exportStaticGenres(db *gorm.DB, dir string, size int) error {
+	var lists []genreList
+	err := db.Raw(`SELECT "genreId", json_agg(json_build_object(
+			'movieId', "id", 'title', "title", 'posterPath', "posterPath", 'score', "wiitcoScore"
+		) ORDER BY rn)::text AS "movies"
+		FROM (
+			SELECT mg."genreId", m."id", m."title", m."posterPath", m."wiitcoScore",
+				row_number() OVER (PARTITION BY mg."genreId" ORDER BY m."wiitcoScore" DESC NULLS LAST, m."id") AS rn
+			FROM "MovieGenre" mg JOIN "Movie" m ON m."id" = mg."movieId" AND m."deletedAt" IS NULL
+		) ranked
+		WHERE rn <= ?
+		GROUP BY "genreId"`, size).Scan(&lists).Error
+	if err != nil {
+		return err
+	}
+	for _, l := range lists {
+		path := filepath.Join(dir, "genres", strconv.Itoa(int(l.GenreId))+".json")
+		if err := writeFileAtomic(path, []byte(l.Movies)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic writes through a temporary file and renames it into place,
+// so a CDN upload running concurrently never picks up a truncated file.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// runStaticExport regenerates the complete static JSON API.
+func runStaticExport(db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("static-export", flag.ContinueOnError)
+	dir := fs.String("dir", cfg.StaticExportDir, "output directory (default STATIC_EXPORT_DIR or static under DATA_DIR)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dir == "" {
+		*dir = dataPath("static")
+	}
+	var ids []uint32
+	if err := db.Table("Movie").Order(`"id"`).Pluck(`"id"`, &ids).Error; err != nil {
+		return err
+	}
+	return exportStatic(db, *dir, ids, cfg)
+}
@@ -0,0 +1,76 @@
+package sync
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// activeRun is a copy of the run in progress for DumpStatus, which reads it
+// from the signal handler.
+var activeRun atomic.Pointer[SyncRun]
+
+// queues are the channels between the fetchers and the writers of the
+// running pipeline, by name.
+var queues = struct {
+	sync.Mutex
+	depths map[string]func() (int, int)
+}{depths: map[string]func() (int, int){}}
+
+// trackQueue reports ch in status dumps until the returned function is
+// called.
+func trackQueue[T any](name string, ch chan T) func() {
+	queues.Lock()
+	defer queues.Unlock()
+	queues.depths[name] = func() (int, int) { return len(ch), cap(ch) }
+	return func() {
+		queues.Lock()
+		defer queues.Unlock()
+		delete(queues.depths, name)
+	}
+}
+
+// DumpStatus logs the current run, its fetch and write counts, the depth of
+// every queue and the memory in use. The binary calls it on SIGUSR1.
+func DumpStatus() {
+	if logger == nil {
+		return
+	}
+	queues.Lock()
+	names := make([]string, 0, len(queues.depths))
+	for name := range queues.depths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	depths := make([]string, 0, len(names))
+	for _, name := range names {
+		n, c := queues.depths[name]()
+		depths = append(depths, fmt.Sprintf("%s=%d/%d", name, n, c))
+	}
+	queues.Unlock()
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	batches, failures := writeTotals()
+	attrs := []any{
+		"fetches", runFetches.ok.Load() + runFetches.failed.Load(),
+		"fetchFailures", runFetches.failed.Load(),
+		"batches", batches,
+		"batchFailures", failures,
+		"queues", strings.Join(depths, " "),
+		"progress", progressSummary(),
+		"goroutines", runtime.NumGoroutine(),
+		"heapMiB", mem.HeapAlloc >> 20,
+		"sysMiB", mem.Sys >> 20,
+		"gcCycles", mem.NumGC,
+		"throttle", throttle.Load(),
+	}
+	if run := activeRun.Load(); run != nil {
+		attrs = append([]any{"runId", run.ID, "mode", run.Mode, "elapsed", time.Since(run.StartedAt).Round(time.Second)}, attrs...)
+	}
+	logger.Info("pipeline status", attrs...)
+}
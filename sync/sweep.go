@@ -0,0 +1,367 @@
+package sync
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// tmdbExportURL is TMDB's daily export of every movie ID, published for
+// the previous day around 08:00 UTC.
+const tmdbExportURL = "https://files.tmdb.org/p/exports/movie_ids_%s.json.gz"
+
+// Sweep modes.
+const (
+	sweepDelete = "delete"
+	sweepHide   = "hide"
+)
+
+// MovieDeletion is the audit trail of sweep-deleted, one row per movie
+// deleted or hidden.
+type MovieDeletion struct {
+	MovieId   uint32 `gorm:"column:movieId"`
+	Title     string
+	Mode      string
+	Source    string
+	RunId     uint64    `gorm:"column:runId"`
+	DeletedAt time.Time `gorm:"column:deletedAt"`
+}
+
+type exportEntry struct {
+	ID uint32 `json:"id"`
+}
+
+// runSweepDeleted removes the movies TMDB deleted. Candidates are the
+// stored movies missing from a TMDB ID export, or the IDs of an --ids file;
+// each is only swept once TMDB answers 404 for it, so a truncated export or
+// a stale list can't take live movies down. With --mode hide the movies
+// get Movie."deletedAt" instead and keep their rows until a later sync
+// finds them again.
+func runSweepDeleted(db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("sweep-deleted", flag.ContinueOnError)
+	exportURL := fs.String("export-url", "", "TMDB movie ID export to diff against (default: yesterday's)")
+	exportFile := fs.String("export-file", "", "read a local movie_ids_*.json.gz instead of downloading")
+	idsFile := fs.String("ids", "", "file of deleted movie IDs, one per line, instead of an export")
+	mode := fs.String("mode", sweepDelete, "delete or hide")
+	maxMovies := fs.Int("max", 1000, "refuse to sweep more movies than this")
+	dryRun := fs.Bool("dry-run", false, "report the confirmed deletions without applying them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *mode != sweepDelete && *mode != sweepHide {
+		return fmt.Errorf("--mode: %q is not delete or hide", *mode)
+	}
+
+	// Hidden movies are still deleted by a later sweep in delete mode.
+	stored := db.Table("Movie")
+	if *mode == sweepHide {
+		stored = stored.Where(`"deletedAt" IS NULL`)
+	}
+	var known []uint32
+	if err := stored.Order(`"id"`).Pluck(`"id"`, &known).Error; err != nil {
+		return err
+	}
+	var candidates []uint32
+	source := "export"
+	if *idsFile != "" {
+		source = "list"
+		listed, err := readIDList(*idsFile)
+		if err != nil {
+			return err
+		}
+		for _, id := range listed {
+			if _, found := slices.BinarySearch(known, id); found {
+				candidates = append(candidates, id)
+			}
+		}
+	} else {
+		exported, err := readExportIDs(*exportFile, *exportURL)
+		if err != nil {
+			return err
+		}
+		for _, id := range known {
+			if !exported[id] {
+				candidates = append(candidates, id)
+			}
+		}
+	}
+	outputf("Checking %d movies missing from TMDB\n", len(candidates))
+	if len(candidates) > *maxMovies {
+		return fmt.Errorf("%d candidates exceed --max %d; check the %s", len(candidates), *maxMovies, source)
+	}
+
+	return withRun(db, "sweep-deleted", func() error {
+		deleted := confirmDeleted(candidates)
+		outputf("TMDB confirmed %d of %d movies deleted\n", len(deleted), len(candidates))
+		if len(deleted) == 0 {
+			return nil
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := sweepMovies(tx, deleted, *mode, source); err != nil {
+				return err
+			}
+			if *dryRun {
+				return errDryRun
+			}
+			return nil
+		})
+		if errors.Is(err, errDryRun) {
+			outputf("Dry run: would %s %d movies\n", *mode, len(deleted))
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		outputf("Swept %d movies (%s)\n", len(deleted), *mode)
+		return unpublishSwept(db, deleted)
+	})
+}
+
+func readIDList(path string) ([]uint32, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var ids []uint32
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		id, err := strconv.ParseUint(line, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q is not a movie ID", path, line)
+		}
+		ids = append(ids, uint32(id))
+	}
+	return ids, scanner.Err()
+}
+
+// readExportIDs reads the IDs of a TMDB export, one JSON object per line.
+func readExportIDs(file, exportURL string) (map[uint32]bool, error) {
+	var src io.ReadCloser
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		src = f
+	} else {
+		if exportURL == "" {
+			exportURL = fmt.Sprintf(tmdbExportURL, time.Now().UTC().AddDate(0, 0, -1).Format("01_02_2006"))
+		}
+		res, err := http.Get(exportURL)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			return nil, fmt.Errorf("%s: unexpected HTTP status code: %d", exportURL, res.StatusCode)
+		}
+		src = res.Body
+	}
+	defer src.Close()
+
+	gz, err := gzip.NewReader(src)
+	if err != nil {
+		return nil, err
+	}
+	ids := map[uint32]bool{}
+	scanner := bufio.NewScanner(gz)
+	for line := 1; scanner.Scan(); line++ {
+		var entry exportEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("export line %d: %w", line, err)
+		}
+		ids[entry.ID] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, errors.New("the export lists no movies")
+	}
+	return ids, nil
+}
+
+// confirmDeleted returns the movies of ids TMDB answers 404 for.
+func confirmDeleted(ids []uint32) []uint32 {
+	var mu sync.Mutex
+	var deleted []uint32
+	runPool(idsChannel(ids), workerCount(), func(id uint32) {
+		_, err := fetchTMDB(fmt.Sprintf("/movie/%d", id))
+		switch {
+		case notFound(err):
+			mu.Lock()
+			deleted = append(deleted, id)
+			mu.Unlock()
+		case err != nil:
+			outputf("Error checking movie ID %d: %v\n", id, err)
+		}
+	})
+	slices.Sort(deleted)
+	return deleted
+}
+
+// goneMovies collects the movies whose details TMDB answered 404 for
+// during a run. The changes feed routinely lists movies TMDB has since
+// deleted or marked adult; they aren't fetch failures, and the run hides
+// them as sweep-deleted --mode hide would once its movies are written.
+var goneMovies struct {
+	sync.Mutex
+	ids []uint32
+}
+
+func markGone(id uint32) {
+	goneMovies.Lock()
+	goneMovies.ids = append(goneMovies.ids, id)
+	goneMovies.Unlock()
+}
+
+// sweepGoneMovies hides the stored movies collected by markGone since the
+// last call.
+func sweepGoneMovies(db *gorm.DB) error {
+	goneMovies.Lock()
+	ids := goneMovies.ids
+	goneMovies.ids = nil
+	goneMovies.Unlock()
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+
+	var stored []uint32
+	for start := 0; start < len(ids); start += denormalizeChunkSize {
+		chunk := ids[start:min(start+denormalizeChunkSize, len(ids))]
+		var found []uint32
+		err := db.Table("Movie").Where(`"id" IN ? AND "deletedAt" IS NULL`, chunk).Pluck(`"id"`, &found).Error
+		if err != nil {
+			return err
+		}
+		stored = append(stored, found...)
+	}
+	if len(stored) == 0 {
+		return nil
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return sweepMovies(tx, stored, sweepHide, "details")
+	})
+	if err != nil {
+		return err
+	}
+	outputf("Hid %d movies TMDB no longer serves\n", len(stored))
+	return unpublishSwept(db, stored)
+}
+
+// sweepMovies deletes or hides the movies of ids with an audit row each.
+// Deleting removes every row of the managed tables that refers to them;
+// either way the derived tables are rebuilt without them.
+func sweepMovies(tx *gorm.DB, ids []uint32, mode, source string) error {
+	var titles []struct {
+		ID    uint32
+		Title string
+	}
+	if err := tx.Table("Movie").Select(`"id", "title"`).Where(`"id" IN ?`, ids).Scan(&titles).Error; err != nil {
+		return err
+	}
+	now := time.Now()
+	audit := make([]MovieDeletion, 0, len(titles))
+	for _, t := range titles {
+		audit = append(audit, MovieDeletion{MovieId: t.ID, Title: t.Title, Mode: mode, Source: source, RunId: currentRun.ID, DeletedAt: now})
+	}
+	if err := tx.Table("MovieDeletion").Create(&audit).Error; err != nil {
+		return err
+	}
+
+	if mode == sweepHide {
+		if err := tx.Exec(`UPDATE "Movie" SET "deletedAt" = ? WHERE "id" IN ?`, now, ids).Error; err != nil {
+			return err
+		}
+	} else {
+		var tables []string
+		err := tx.Raw(`SELECT "table_name" FROM information_schema.columns
+			WHERE "table_schema" = current_schema() AND "column_name" = 'movieId' AND "table_name" IN ?`, managedTables).
+			Scan(&tables).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Exec(`DELETE FROM "MovieRelation" WHERE "relatedMovieId" IN ?`, ids).Error; err != nil {
+			return err
+		}
+		for _, table := range tables {
+			if err := tx.Exec(`DELETE FROM "`+table+`" WHERE "movieId" IN ?`, ids).Error; err != nil {
+				return fmt.Errorf("deleting from %s: %w", table, err)
+			}
+		}
+		if err := tx.Exec(`DELETE FROM "Movie" WHERE "id" IN ?`, ids).Error; err != nil {
+			return err
+		}
+	}
+
+	if err := rebuildSwept(tx, ids); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, strconv.Itoa(int(id)))
+	}
+	if err := recordChanges(tx, "movie", opDelete, keys); err != nil {
+		return err
+	}
+	return enqueueEvent(tx, "movies.deleted", map[string]any{"runId": currentRun.ID, "movieIds": ids, "mode": mode})
+}
+
+// rebuildSwept rebuilds the derived tables that list movies. Their queries
+// skip hidden movies and find no rows of deleted ones, so the swept movies
+// drop out.
+func rebuildSwept(tx *gorm.DB, ids []uint32) error {
+	steps := []struct {
+		name string
+		fn   func() error
+	}{
+		{"availability", func() error { return rebuildAvailability(tx, ids, cfg.PopularProviders) }},
+		{"release calendar", func() error { return rebuildReleaseCalendar(tx) }},
+		{"person stats", func() error { return rebuildPersonStats(tx) }},
+		{"release events", func() error { return tagReleaseEvents(tx, ids, cfg.ReleaseEvents) }},
+		{"festival screenings", func() error { return tagFestivalReleases(tx, ids, nil) }},
+		{"release weekends", func() error { return rebuildReleaseWeekends(tx, ids, cfg.WeekendStarts) }},
+		{"sequel relations", func() error { return rebuildSequelRelations(tx, ids) }},
+		{"hot releases", func() error { return rebuildHotReleases(tx, cfg.ReleaseRegions, cfg.HotReleaseWindows) }},
+	}
+	for _, step := range steps {
+		if err := step.fn(); err != nil {
+			return fmt.Errorf("rebuilding %s: %w", step.name, err)
+		}
+	}
+	return nil
+}
+
+// unpublishSwept takes the swept movies out of the static export and Redis
+// once the sweep is committed.
+func unpublishSwept(db *gorm.DB, ids []uint32) error {
+	if cfg.StaticExportDir != "" {
+		if err := exportStatic(db, cfg.StaticExportDir, ids, cfg); err != nil {
+			return fmt.Errorf("exporting static JSON: %w", err)
+		}
+	}
+	if cfg.RedisURL != "" {
+		if err := dropRedisMovies(cfg.RedisURL, ids); err != nil {
+			return fmt.Errorf("dropping movies from Redis: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,1095 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Response struct {
+	Results      []MovieIndex `json:"results"`
+	Page         uint16       `json:"page"`
+	TotalPages   uint16       `json:"total_pages"`
+	TotalResults uint16       `json:"total_results"`
+}
+
+type MovieIndex struct {
+	ID    uint32 `json:"id"`
+	Adult bool   `json:"adult"`
+}
+
+type Movie struct {
+	ID                  uint32              `json:"id"`
+	OriginalLanguage    *string             `json:"original_language"`
+	OriginalTitle       *string             `json:"original_title"`
+	Title               string              `json:"title"`
+	PosterPath          *string             `json:"poster_path"`
+	Popularity          float32             `json:"popularity"`
+	Runtime             uint16              `json:"runtime"`
+	Budget              uint64              `json:"budget"`
+	Revenue             uint64              `json:"revenue"`
+	ReleaseDateStr      string              `json:"release_date"`
+	ImdbId              string              `json:"imdb_id"`
+	Overview            string              `json:"overview"`
+	Tagline             string              `json:"tagline"`
+	Status              string              `json:"status"`
+	VoteAverage         float32             `json:"vote_average"`
+	VoteCount           uint32              `json:"vote_count"`
+	Homepage            string              `json:"homepage"`
+	BackdropPath        *string             `json:"backdrop_path"`
+	Credits             json.RawMessage     `json:"credits"`
+	ReleaseDates        ReleaseDates        `json:"release_dates"`
+	AlternativeTitles   AlternativeTitles   `json:"alternative_titles"`
+	Genres              []Genre             `json:"genres"`
+	ProductionCountries []ProductionCountry `json:"production_countries"`
+	ProductionCompanies []Company           `json:"production_companies"`
+	Keywords            Keywords            `json:"keywords"`
+	Collection          *Collection         `json:"belongs_to_collection"`
+	ExternalIds         ExternalIds         `json:"external_ids"`
+	Translations        Translations        `json:"translations"`
+}
+
+type MovieDB struct {
+	ID               uint32  `json:"id"`
+	OriginalLanguage *string `json:"original_language" gorm:"column:originalLanguage"`
+	OriginalTitle    *string `json:"original_title" gorm:"column:originaltitle"`
+	Title            string  `json:"title"`
+	PosterPath       *string `json:"poster_path" gorm:"column:posterPath"`
+	Popularity       float32 `json:"popularity"`
+	Runtime          uint16  `json:"runtime"`
+	Budget           uint64  `json:"budget"`
+	Revenue          uint64  `json:"revenue" gorm:"column:revenue"`
+	ReleaseDateStr   *string `json:"release_date" gorm:"column:primaryReleaseDate;type:date"`
+	ImdbId           *string `json:"imdb_id" gorm:"column:imdbId"`
+	Overview         *string `json:"overview" gorm:"column:overview"`
+	Tagline          *string `json:"tagline" gorm:"column:tagline"`
+	Status           *string `json:"status" gorm:"column:status"`
+	VoteAverage      float32 `json:"vote_average" gorm:"column:voteAverage"`
+	VoteCount        uint32  `json:"vote_count" gorm:"column:voteCount"`
+	Homepage         *string `json:"homepage" gorm:"column:homepage"`
+	BackdropPath     *string `json:"backdrop_path" gorm:"column:backdropPath"`
+	CollectionId     *uint32 `json:"-" gorm:"column:collectionId"`
+	IsRemake         bool    `json:"-" gorm:"column:isRemake"`
+	BasedOnNovel     bool    `json:"-" gorm:"column:basedOnNovel"`
+	// SyncedAt is when the movie was last fetched from TMDB.
+	SyncedAt time.Time `json:"-" gorm:"column:syncedAt"`
+	// MissingResources has a bit set for each sub-resource the movie was
+	// written without, see degrade.go.
+	MissingResources int32 `json:"-" gorm:"column:missingResources"`
+	// DeletedAt is set by sweep-deleted --mode hide; writing the movie
+	// again clears it.
+	DeletedAt *time.Time `json:"-" gorm:"column:deletedAt"`
+	// Provenance names the source of each field resolved by
+	// SOURCE_PRECEDENCE, see sources.go.
+	Provenance *string `json:"-" gorm:"column:provenance;type:jsonb"`
+	// BudgetCurrency is the currency Budget and Revenue are taken to be
+	// in, and BudgetUsd and RevenueUsd are them in dollars at the rate of
+	// CurrencyRateDate, see currency.go.
+	BudgetCurrency   *string `json:"-" gorm:"column:budgetCurrency"`
+	BudgetUsd        *uint64 `json:"-" gorm:"column:budgetUsd"`
+	RevenueUsd       *uint64 `json:"-" gorm:"column:revenueUsd"`
+	CurrencyRateDate *string `json:"-" gorm:"column:currencyRateDate;type:date"`
+
+	tmdb    map[string]string
+	sources map[string]string
+	// fresh holds the keys of the movie's rows in the reconciled join
+	// tables, see reconcile.go.
+	fresh map[string][][]any
+}
+
+type Genre struct {
+	ID   uint32 `json:"id"`
+	Name string `json:"name"`
+}
+
+type ReleaseDates struct {
+	Results []ReleaseCountry `json:"results"`
+}
+
+type AlternativeTitles struct {
+	Titles []AlternativeTitle `json:"titles"`
+}
+
+type AlternativeTitle struct {
+	ISO31661 string `json:"iso_3166_1"`
+	Title    string `json:"title"`
+	Type     string `json:"type"`
+}
+
+type ReleaseCountry struct {
+	ISO31661          string             `json:"iso_3166_1"`
+	LocalReleaseDates []LocalReleaseDate `json:"release_dates"`
+}
+
+type LocalReleaseDate struct {
+	Certification string    `json:"certification"`
+	Note          string    `json:"note"`
+	ReleaseDate   time.Time `json:"release_date"`
+	Type          uint8     `json:"type"`
+}
+
+type Company struct {
+	ID            uint32 `json:"id"`
+	Name          string `json:"name"`
+	OriginCountry string `json:"origin_country"`
+}
+
+type Keywords struct {
+	Keywords []Keyword `json:"keywords"`
+}
+
+type Translations struct {
+	Translations []Translation `json:"translations"`
+}
+
+type Keyword struct {
+	ID   uint32 `json:"id"`
+	Name string `json:"name"`
+}
+
+type ProductionCountry struct {
+	ISO31661 string `json:"iso_3166_1"`
+	Name     string `json:"name"`
+}
+
+type Person struct {
+	ID   uint32 `json:"id"`
+	Name string `json:"name"`
+}
+
+type MovieActor struct {
+	MovieId   uint32 `gorm:"column:movieId"`
+	ActorId   uint32 `gorm:"column:actorId"`
+	Character string `gorm:"column:character"`
+	Order     uint16 `gorm:"column:order;type:smallint"`
+	CreditId  string `gorm:"column:creditId"`
+	// The flags come from notes on the character, see applyCreditNotes.
+	IsUncredited     bool `gorm:"column:isUncredited"`
+	IsVoice          bool `gorm:"column:isVoice"`
+	IsArchiveFootage bool `gorm:"column:isArchiveFootage"`
+	IsGuest          bool `gorm:"column:isGuest"`
+}
+
+type MovieDirector struct {
+	MovieId    uint32 `gorm:"column:movieId"`
+	DirectorId uint32 `gorm:"column:directorId"`
+}
+
+type MovieGenre struct {
+	MovieId uint32 `gorm:"column:movieId"`
+	GenreId uint32 `gorm:"column:genreId"`
+}
+
+type MovieCountry struct {
+	MovieId    uint32 `gorm:"column:movieId"`
+	CountryIso string `gorm:"column:countryIso"`
+}
+
+// MReleaseCountry and MLocalRelease are keyed by their natural keys, see
+// releasekeys.go.
+type MReleaseCountry struct {
+	MovieId    uint32  `gorm:"column:movieId"`
+	ISO31661   string  `gorm:"column:iso31661"`
+	LocalTitle *string `gorm:"column:localTitle"`
+}
+
+type MLocalRelease struct {
+	MovieId     uint32    `gorm:"column:movieId"`
+	ISO31661    string    `gorm:"column:iso31661"`
+	Type        uint8     `gorm:"column:type"`
+	ReleaseDate time.Time `gorm:"column:releaseDate"`
+	Note        *string
+	// CutRuntime is the runtime in minutes of the version named in the note.
+	CutRuntime *uint16 `gorm:"column:cutRuntime"`
+	// NoteCategory classifies the note, see notes.go.
+	NoteCategory *string `gorm:"column:noteCategory"`
+	// The format flags are set from the note and titles, see formats.go.
+	IsImax  bool `gorm:"column:isImax"`
+	Is3D    bool `gorm:"column:is3d"`
+	Is70mm  bool `gorm:"column:is70mm"`
+	IsDolby bool `gorm:"column:isDolby"`
+	// Certification is the age rating of the release in its country, such
+	// as "PG-13" or "16".
+	Certification *string `gorm:"column:certification"`
+}
+
+var (
+	limiter    = rate.NewLimiter(rate.Every(time.Second/40), 1)
+	totalPages = 500
+	// runCtx is the context of the command or run in progress; cancelling
+	// it aborts outstanding TMDB requests.
+	runCtx = context.Background()
+)
+
+func fetchIndexData(PageNum int, window changeWindow) ([]byte, error) {
+	return fetchTMDB(fmt.Sprintf("/movie/changes?page=%d&start_date=%s&end_date=%s",
+		PageNum, window.Start.UTC().Format("2006-01-02"), window.End.UTC().Format("2006-01-02")))
+}
+
+// fetchIndexPage returns the IDs of the non-adult movies on one page of
+// the changes feed. ok is false if the page couldn't be read.
+func fetchIndexPage(pageNum int, window changeWindow) (ids []uint32, ok bool) {
+	body, err := fetchIndexData(pageNum, window)
+	if err != nil {
+		outputf("Error fetching index page %d: %v\n", pageNum, err)
+		recordFetch(err)
+		return nil, false
+	}
+	var rawInitData Response
+	err = json.Unmarshal(body, &rawInitData)
+	if err != nil {
+		outputf("Error unmarshalling index page %d: %v\n", pageNum, err)
+		recordFetch(err)
+		return nil, false
+	}
+	recordFetch(nil)
+	if pageNum == 1 {
+		totalPages = int(rawInitData.TotalPages)
+	}
+	for _, entry := range rawInitData.Results {
+		if !entry.Adult {
+			ids = append(ids, entry.ID)
+		}
+	}
+	return ids, true
+}
+
+// detailsSource returns a movie's details payload with the given
+// sub-resources appended. seed replaces it with the embedded fixtures.
+var detailsSource = fetchDetailsData
+
+func filterEmptyDates(input string) *string {
+	if input != "" {
+		return &input
+	} else {
+		return nil
+	}
+}
+
+func fetchAndProcessDetailsData(id uint32, resources []string, movieBaseCh chan MovieDB, peopleRefCh chan Person, actorCh chan MovieActor, directorCh chan MovieDirector, crewCh chan MovieCrew, genreCh chan MovieGenre, countryCh chan MovieCountry, releaseCountryCh chan MReleaseCountry, localReleaseCh chan MLocalRelease, tagCh chan MovieTags, collectionCh chan MovieCollection, keywordCh chan MovieKeywords, externalIdsCh chan MovieExternalIds, translationCh chan MovieTranslation, altTitleCh chan MovieAlternativeTitles) {
+	body, err := detailsSource(id, resources)
+	if notFound(err) {
+		outputf("Movie ID %d is gone from TMDB\n", id)
+		recordFetch(nil)
+		markGone(id)
+		return
+	}
+	if err != nil {
+		outputf("Error fetching details for ID %d: %v\n", id, err)
+		recordFetch(err)
+		return
+	}
+	archivePayload(id, body)
+	movie, missing, err := decodeDetails(body, resources)
+	if err != nil {
+		outputln("Error parsing JSON data for Movie ID:", id, err)
+		recordFetch(err)
+		return
+	}
+	if hasHooks(hookAfterMovieParsed) {
+		if err := runHooks(&hookPayload{Event: hookAfterMovieParsed, Movie: &movie}); errors.Is(err, errVetoed) {
+			outputf("Skipping movie ID %d: %v\n", id, err)
+			recordFetch(nil)
+			return
+		} else if err != nil {
+			outputf("Dropping movie ID %d: %v\n", id, err)
+			recordFetch(err)
+			return
+		}
+	}
+	recordFetch(nil)
+
+	base := MovieDB{
+		ID:               movie.ID,
+		OriginalLanguage: movie.OriginalLanguage,
+		OriginalTitle:    movie.OriginalTitle,
+		Title:            movie.Title,
+		PosterPath:       movie.PosterPath,
+		Popularity:       movie.Popularity,
+		Runtime:          movie.Runtime,
+		Budget:           movie.Budget,
+		Revenue:          movie.Revenue,
+		ReleaseDateStr:   filterEmptyDates(movie.ReleaseDateStr),
+		ImdbId:           filterEmptyDates(movie.ImdbId),
+		Overview:         filterEmptyDates(movie.Overview),
+		Tagline:          filterEmptyDates(movie.Tagline),
+		Status:           validMovieStatus(movie.ID, filterEmptyDates(movie.Status)),
+		VoteAverage:      movie.VoteAverage,
+		VoteCount:        movie.VoteCount,
+		Homepage:         validHomepage(movie.ID, movie.Homepage),
+		BackdropPath:     movie.BackdropPath,
+		SyncedAt:         time.Now(),
+	}
+	if c := movie.Collection; c != nil {
+		base.CollectionId = &c.ID
+		send(collectionCh, "MovieCollection", MovieCollection{ID: c.ID, Name: c.Name, PosterPath: c.PosterPath, BackdropPath: c.BackdropPath})
+	}
+	base.IsRemake, base.BasedOnNovel = keywordFlags(movie.Keywords.Keywords)
+	base.tmdb = tmdbValues(&base)
+	applyCorrections(&base)
+	setBudgetCurrency(&base, movie.ProductionCountries)
+
+	cast, crew, err := parseCredits(movie.Credits, movie.Popularity, cfg.Credits)
+	if err != nil {
+		outputln("Error parsing credits for Movie ID:", id, err)
+		missing = append(missing, "credits")
+	}
+	base.MissingResources = missingBits(missing)
+	if len(missing) > 0 {
+		logger.Warn("writing movie without sub-resources", "movieId", id, "missing", missing)
+	} else {
+		movieCache.fetched(id, body)
+	}
+	// has reports whether the payload came with the sub-resource name.
+	has := func(name string) bool {
+		return slices.Contains(resources, name) && !slices.Contains(missing, name)
+	}
+
+	actors := castRows(movie.ID, cast)
+	var directors []MovieDirector
+	var crewRows []MovieCrew
+	var credited []Person
+	crewSeen := map[string]bool{}
+	for _, member := range crew {
+		if member.Job == "Director" {
+			credited = append(credited, Person{ID: member.ID, Name: member.Name})
+			directors = append(directors, MovieDirector{
+				MovieId:    movie.ID,
+				DirectorId: member.ID,
+			})
+			continue
+		}
+		role, key := crewRole(member), pairKey(member.ID, member.Job)
+		// TMDB occasionally lists the same credit twice.
+		if role == "" || crewSeen[key] {
+			continue
+		}
+		crewSeen[key] = true
+		credited = append(credited, Person{ID: member.ID, Name: member.Name})
+		crewRows = append(crewRows, MovieCrew{
+			MovieId:    movie.ID,
+			PersonId:   member.ID,
+			Job:        member.Job,
+			Department: member.Department,
+			Role:       role,
+			CreditId:   member.CreditId,
+		})
+	}
+
+	if has("credits") {
+		keys := make([][]any, 0, len(actors))
+		for _, a := range actors {
+			keys = append(keys, []any{a.MovieId, a.ActorId})
+		}
+		base.setFresh("MovieActor", keys)
+		keys = make([][]any, 0, len(directors))
+		for _, d := range directors {
+			keys = append(keys, []any{d.MovieId, d.DirectorId})
+		}
+		base.setFresh("MovieDirector", keys)
+		keys = make([][]any, 0, len(crewRows))
+		for _, c := range crewRows {
+			keys = append(keys, []any{c.MovieId, c.PersonId, c.Job})
+		}
+		base.setFresh("MovieCrew", keys)
+	}
+	genreKeys := make([][]any, 0, len(movie.Genres))
+	for _, genre := range movie.Genres {
+		genreKeys = append(genreKeys, []any{movie.ID, genre.ID})
+	}
+	base.setFresh("MovieGenre", genreKeys)
+	countryKeys := make([][]any, 0, len(movie.ProductionCountries))
+	for _, country := range movie.ProductionCountries {
+		countryKeys = append(countryKeys, []any{movie.ID, country.ISO31661})
+	}
+	base.setFresh("MovieCountry", countryKeys)
+
+	var releaseCountries []MReleaseCountry
+	var localReleases []MLocalRelease
+	if has("release_dates") {
+		releaseCountries, localReleases = releaseRows(movie.ID, movie.ReleaseDates.Results)
+		keys := make([][]any, 0, len(releaseCountries))
+		for _, rc := range releaseCountries {
+			keys = append(keys, []any{rc.MovieId, rc.ISO31661})
+		}
+		base.setFresh("MReleaseCountry", keys)
+		keys = make([][]any, 0, len(localReleases))
+		for _, lr := range localReleases {
+			keys = append(keys, []any{lr.MovieId, lr.ISO31661, lr.Type, lr.ReleaseDate})
+		}
+		base.setFresh("MLocalRelease", keys)
+	}
+	send(movieBaseCh, "Movie", base)
+
+	for _, actor := range cast {
+		send(peopleRefCh, "CinemaPerson", Person{ID: actor.ID, Name: actor.Name})
+	}
+	for _, row := range actors {
+		send(actorCh, "MovieActor", row)
+	}
+	for _, person := range credited {
+		send(peopleRefCh, "CinemaPerson", person)
+	}
+	for _, row := range directors {
+		send(directorCh, "MovieDirector", row)
+	}
+	for _, row := range crewRows {
+		send(crewCh, "MovieCrew", row)
+	}
+
+	for _, genre := range movie.Genres {
+		send(genreCh, "MovieGenre", MovieGenre{
+			MovieId: movie.ID,
+			GenreId: genre.ID,
+		})
+	}
+
+	for _, country := range movie.ProductionCountries {
+		send(countryCh, "MovieCountry", MovieCountry{
+			MovieId:    movie.ID,
+			CountryIso: country.ISO31661,
+		})
+	}
+
+	localTitles := localTitlesByCountry(movie.AlternativeTitles.Titles)
+	for i := range releaseCountries {
+		releaseCountries[i].LocalTitle = localTitles[releaseCountries[i].ISO31661]
+	}
+	for _, localRelease := range localReleases {
+		// A title naming a format only speaks for screenings, not for the
+		// digital, physical or TV releases of the movie.
+		if localRelease.Type == releaseTheatricalLimited || localRelease.Type == releaseTheatrical {
+			if title := localTitles[localRelease.ISO31661]; title != nil {
+				applyFormats(&localRelease, *title)
+			}
+			applyFormats(&localRelease, movie.Title)
+		}
+		send(localReleaseCh, "MLocalRelease", localRelease)
+	}
+	for _, releaseCountry := range releaseCountries {
+		send(releaseCountryCh, "MReleaseCountry", releaseCountry)
+	}
+
+	if len(cfg.TagRules) > 0 {
+		tagCh <- MovieTags{MovieId: movie.ID, Tags: applyTagRules(cfg.TagRules, movie)}
+	}
+	if has("keywords") {
+		keywordCh <- MovieKeywords{MovieId: movie.ID, Keywords: movie.Keywords.Keywords}
+	}
+	if has("external_ids") {
+		send(externalIdsCh, "MovieExternalIds", externalIdsRow(movie.ID, movie.ExternalIds))
+	}
+	if has("alternative_titles") {
+		altTitleCh <- MovieAlternativeTitles{MovieId: movie.ID, Titles: movie.AlternativeTitles.Titles}
+	}
+	if has("translations") {
+		for _, locale := range cfg.TranslationLocales {
+			if t, ok := matchTranslation(movie.Translations.Translations, locale); ok {
+				send(translationCh, "MovieTranslation", translationRow(movie.ID, locale, t))
+			}
+		}
+	}
+}
+
+// releaseRows converts a movie's release_dates payload into table rows.
+func releaseRows(movieID uint32, countries []ReleaseCountry) ([]MReleaseCountry, []MLocalRelease) {
+	var releaseCountries []MReleaseCountry
+	var localReleases []MLocalRelease
+	for _, releaseCountry := range countries {
+		for _, localRelease := range releaseCountry.LocalReleaseDates {
+			if !validReleaseType(movieID, localRelease.Type) {
+				continue
+			}
+			release := MLocalRelease{
+				MovieId:       movieID,
+				ISO31661:      releaseCountry.ISO31661,
+				Type:          localRelease.Type,
+				ReleaseDate:   localRelease.ReleaseDate,
+				Note:          filterEmptyDates(localRelease.Note),
+				CutRuntime:    parseCutRuntime(localRelease.Note),
+				NoteCategory:  classifyNote(localRelease.Note),
+				Certification: filterEmptyDates(localRelease.Certification),
+			}
+			applyFormats(&release, localRelease.Note)
+			localReleases = append(localReleases, release)
+		}
+
+		releaseCountries = append(releaseCountries, MReleaseCountry{
+			MovieId:  movieID,
+			ISO31661: releaseCountry.ISO31661,
+		})
+	}
+	return releaseCountries, localReleases
+}
+
+func openDB() (*gorm.DB, error) {
+	return gorm.Open(postgres.Open(cfg.DatabaseDSN), &gorm.Config{
+		PrepareStmt:            true,
+		SkipDefaultTransaction: true,
+		Logger:                 gormLogger{log: logger, slow: cfg.SlowQueryThreshold, showParams: cfg.LogQueryParams},
+	})
+}
+
+// runSync syncs TMDB's changes feeds: movies plus the watchlist, TV series
+// or both, per --media.
+func runSync(db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ContinueOnError)
+	media := fs.String("media", cfg.SyncMedia, "what to sync: movies, tv or both")
+	resume := fs.Bool("resume", false, "continue the last unfinished movie sync from its checkpoint")
+	since := fs.String("since", "", "start of the change window, a date or RFC 3339 timestamp (default: end of the last successful run)")
+	until := fs.String("until", "", "end of the change window (default: now)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !validMedia(*media) {
+		return fmt.Errorf("--media: %q is not movies, tv or both", *media)
+	}
+	var bounds windowBounds
+	var err error
+	if bounds.Since, err = parseWindowBound("since", *since); err != nil {
+		return err
+	}
+	if bounds.Until, err = parseWindowBound("until", *until); err != nil {
+		return err
+	}
+
+	outputf("Started executing at %s \n", time.Now().Format("15:04:05"))
+	if *media != mediaTV {
+		if err := runMovieSync(db, *resume, bounds); err != nil {
+			return err
+		}
+	}
+	if *media != mediaMovies {
+		return runTVSync(db, bounds)
+	}
+	return nil
+}
+
+// runMovieSync syncs every movie in TMDB's changes feed plus the watchlist.
+// The movies are written in chunks of CHECKPOINT_EVERY, each checkpointed
+// once all its rows are in, so with resume a run continues an unfinished
+// one instead of starting over, see checkpoint.go.
+func runMovieSync(db *gorm.DB, resume bool, bounds windowBounds) error {
+	return withRun(db, "sync", func() error {
+		window, resumed, err := resumeOrNextWindow("sync", resume, bounds)
+		if err != nil {
+			return err
+		}
+		if err := setRunWindow(window); err != nil {
+			return err
+		}
+		if resumed {
+			outputf("Resuming changes from %s to %s\n", window.Start.Format(time.RFC3339), window.End.Format(time.RFC3339))
+		} else {
+			outputf("Syncing changes from %s to %s\n", window.Start.Format(time.RFC3339), window.End.Format(time.RFC3339))
+		}
+
+		if cfg.WatchlistTable != "" && !resumed {
+			watchlistIDs, err := loadWatchlistIDs(db, cfg.WatchlistTable, cfg.WatchlistColumn)
+			if err != nil {
+				outputln("Error loading watchlist:", err)
+			}
+			outputf("Priority syncing %d watchlisted movies\n", len(watchlistIDs))
+			if err := checkpointIDs(watchlistIDs, 1); err != nil {
+				return err
+			}
+		}
+		if err := checkpointIndexPages(window); err != nil {
+			return err
+		}
+
+		writtenIDs, err := syncCheckpointedIDs(db)
+		if err != nil {
+			return err
+		}
+		afterMovieWrites(db, writtenIDs)
+
+		outputln("Successfully fetched data and written to the DB")
+		return nil
+	})
+}
+
+// syncMovieIDs fetches details for every ID received on idsCh until it is
+// closed, writes all rows and returns the IDs of the movies written.
+func syncMovieIDs(db *gorm.DB, idsCh chan uint32) []uint32 {
+	batchSize := cfg.Preset.BatchSize
+	movieBaseCh := make(chan MovieDB, 20000)
+	peopleRefCh := make(chan Person, 200000)
+	actorCh := make(chan MovieActor, 100000)
+	directorCh := make(chan MovieDirector, 100000)
+	crewCh := make(chan MovieCrew, 100000)
+	genreCh := make(chan MovieGenre, 50000)
+	countryCh := make(chan MovieCountry, 100000)
+	releaseCountryCh := make(chan MReleaseCountry, 1000000)
+	localReleaseCh := make(chan MLocalRelease, 1000000)
+	tagCh := make(chan MovieTags, 20000)
+	collectionCh := make(chan MovieCollection, 20000)
+	keywordCh := make(chan MovieKeywords, 20000)
+	externalIdsCh := make(chan MovieExternalIds, 20000)
+	translationCh := make(chan MovieTranslation, 100000)
+	altTitleCh := make(chan MovieAlternativeTitles, 20000)
+	for _, untrack := range []func(){
+		trackQueue("ids", idsCh),
+		trackQueue("Movie", movieBaseCh),
+		trackQueue("CinemaPerson", peopleRefCh),
+		trackQueue("MovieActor", actorCh),
+		trackQueue("MovieDirector", directorCh),
+		trackQueue("MovieCrew", crewCh),
+		trackQueue("MovieGenre", genreCh),
+		trackQueue("MovieCountry", countryCh),
+		trackQueue("MReleaseCountry", releaseCountryCh),
+		trackQueue("MLocalRelease", localReleaseCh),
+		trackQueue("MovieTag", tagCh),
+		trackQueue("MovieCollection", collectionCh),
+		trackQueue("MovieKeyword", keywordCh),
+		trackQueue("MovieExternalIds", externalIdsCh),
+		trackQueue("MovieTranslation", translationCh),
+		trackQueue("MovieAlternativeTitle", altTitleCh),
+	} {
+		defer untrack()
+	}
+
+	moviesDone := progressStage(stageMovies)
+	moviesDone.expect(len(idsCh))
+	go func() {
+		tiers := newTierResolver(db)
+		runPool(idsCh, workerCount(), func(id uint32) {
+			defer moviesDone.add(1)
+			fetchAndProcessDetailsData(id, tiers.resources(id), movieBaseCh, peopleRefCh, actorCh, directorCh, crewCh, genreCh, countryCh, releaseCountryCh, localReleaseCh, tagCh, collectionCh, keywordCh, externalIdsCh, translationCh, altTitleCh)
+		})
+		close(movieBaseCh)
+		close(peopleRefCh)
+		close(actorCh)
+		close(directorCh)
+		close(crewCh)
+		close(genreCh)
+		close(countryCh)
+		close(releaseCountryCh)
+		close(localReleaseCh)
+		close(tagCh)
+		close(collectionCh)
+		close(keywordCh)
+		close(externalIdsCh)
+		close(translationCh)
+		close(altTitleCh)
+	}()
+
+	var writtenIDs []uint32
+	var wgWriteBase sync.WaitGroup
+	wgWriteBase.Add(1)
+	go func() {
+		defer wgWriteBase.Done()
+		writtenIDs = writeBaseRows(db, movieBaseCh, batchSize)
+	}()
+
+	var personIDs []uint32
+	wgWriteBase.Add(1)
+	go func() {
+		defer wgWriteBase.Done()
+		personIDs = writePeopleRefRows(db, peopleRefCh, batchSize)
+	}()
+
+	wgWriteBase.Add(1)
+	go func() {
+		defer wgWriteBase.Done()
+		writeCollectionRows(db, collectionCh, batchSize)
+	}()
+	wgWriteBase.Wait()
+
+	var wgWrite sync.WaitGroup
+	wgWrite.Add(1)
+	go func() {
+		defer wgWrite.Done()
+		writeMovieActorRows(db, actorCh, batchSize)
+		writeMovieDirectorRows(db, directorCh, batchSize)
+		writeMovieCrewRows(db, crewCh, batchSize)
+		writeMovieTagRows(db, tagCh, batchSize)
+		writeMovieKeywordRows(db, keywordCh, batchSize)
+		writeExternalIdsRows(db, externalIdsCh, batchSize)
+		writeTranslationRows(db, translationCh, batchSize)
+		writeAlternativeTitleRows(db, altTitleCh, batchSize)
+	}()
+	wgWrite.Wait()
+
+	var wgWriteSecond sync.WaitGroup
+	wgWriteSecond.Add(1)
+	go func() {
+		defer wgWriteSecond.Done()
+		writeMovieGenreRows(db, genreCh, batchSize)
+		writeMovieCountryRows(db, countryCh, batchSize)
+		writeReleaseCountryRows(db, releaseCountryCh, batchSize)
+	}()
+	wgWriteSecond.Wait()
+
+	var wgWriteChild sync.WaitGroup
+	wgWriteChild.Add(1)
+	go func() {
+		defer wgWriteChild.Done()
+		writeLocalReleaseRows(db, localReleaseCh, batchSize)
+	}()
+	wgWriteChild.Wait()
+	movieCache.commit(writtenIDs)
+
+	if cfg.PersonDetails {
+		syncPersonDetails(db, personIDs)
+	}
+	if cfg.WatchProviders {
+		syncWatchProviders(db, writtenIDs)
+	}
+
+	return writtenIDs
+}
+
+// afterMovieWrites refreshes everything derived from the catalog once a
+// batch of movies has been written.
+func afterMovieWrites(db *gorm.DB, writtenIDs []uint32) {
+	if err := sweepGoneMovies(db); err != nil {
+		outputln("Error hiding gone movies:", err)
+	}
+	if interrupted() {
+		// The next run fetches the window again and rebuilds these.
+		outputln("Skipping derived tables of an interrupted run")
+		return
+	}
+	if err := rebuildDenormalized(db, writtenIDs, cfg.DenormalizedTopCast, cfg.regionCountries()); err != nil {
+		outputln("Error rebuilding denormalized movies:", err)
+	}
+	if cfg.TraktClientID != "" && len(writtenIDs) > 0 {
+		if err := syncTraktStats(db, writtenIDs, cfg.TraktClientID, cfg.TraktMaxMovies); err != nil {
+			outputln("Error syncing Trakt stats:", err)
+		}
+	}
+	if err := updateWiitcoScores(db, cfg.Score, cfg.regionCountries()); err != nil {
+		outputln("Error updating wiitco scores:", err)
+	}
+	if err := rebuildAvailability(db, writtenIDs, cfg.PopularProviders); err != nil {
+		outputln("Error rebuilding availability:", err)
+	}
+	if err := rebuildReleaseCalendar(db); err != nil {
+		outputln("Error rebuilding release calendar:", err)
+	}
+	if err := rebuildPersonStats(db); err != nil {
+		outputln("Error rebuilding person stats:", err)
+	}
+	if err := tagReleaseEvents(db, writtenIDs, cfg.ReleaseEvents); err != nil {
+		outputln("Error tagging release events:", err)
+	}
+	if err := tagFestivalReleases(db, writtenIDs, cfg.Festivals); err != nil {
+		outputln("Error tagging festival releases:", err)
+	}
+	if err := rebuildReleaseWeekends(db, writtenIDs, cfg.WeekendStarts); err != nil {
+		outputln("Error rebuilding release weekends:", err)
+	}
+	if err := rebuildSequelRelations(db, writtenIDs); err != nil {
+		outputln("Error rebuilding sequel relations:", err)
+	}
+	if err := recordCoverage(db, cfg.regionCountries()); err != nil {
+		outputln("Error recording coverage:", err)
+	}
+	if err := rebuildHotReleases(db, cfg.ReleaseRegions, cfg.HotReleaseWindows); err != nil {
+		outputln("Error rebuilding hot releases:", err)
+	}
+	if cfg.StaticExportDir != "" {
+		if err := exportStatic(db, cfg.StaticExportDir, writtenIDs, cfg); err != nil {
+			outputln("Error exporting static JSON:", err)
+		}
+	}
+	if cfg.RedisURL != "" && cfg.RedisHotMovies > 0 {
+		if err := primeRedisHotMovies(db, cfg.RedisURL, cfg.RedisHotMovies, cfg.RedisHotTTL); err != nil {
+			outputln("Error priming Redis:", err)
+		}
+	}
+}
+
+// writeBaseRows drains the movie channel in batches and returns the IDs of
+// the movies that were written successfully.
+func writeBaseRows(db *gorm.DB, dataChannel chan MovieDB, batchSize int) []uint32 {
+	var written []uint32
+	writeBatches(dataChannel, batchSize, func(batch []MovieDB) error {
+		if err := writeBasesBatch(db, batch); err != nil {
+			return err
+		}
+		written = appendMovieIDs(written, batch)
+		checksumWritten("Movie", batch)
+		return nil
+	})
+	return written
+}
+
+func appendMovieIDs(ids []uint32, batch []MovieDB) []uint32 {
+	for _, movie := range batch {
+		ids = append(ids, movie.ID)
+	}
+	return ids
+}
+
+func writeBasesBatch(db *gorm.DB, objects []MovieDB) error {
+	// Source resolution and provenance rewrite the movies; the caller's batch
+	// stays as fetched so its written checksum matches the fetched one.
+	objects = slices.Clone(objects)
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := resolveSources(tx, objects); err != nil {
+			return err
+		}
+		objects, err := screenMovies(tx, objects)
+		if err != nil {
+			return err
+		}
+		if err := setProvenance(objects); err != nil {
+			return err
+		}
+		if err := tx.WithContext(context.Background()).Clauses(clause.OnConflict{Columns: conflictTarget("Movie"), UpdateAll: true}).Table("Movie").Model(&MovieDB{}).Create(&objects).Error; err != nil {
+			return err
+		}
+		if err := reconcileAssociations(tx, objects); err != nil {
+			return err
+		}
+		changes := newChangeSet("movie")
+		ids := make([]uint32, 0, len(objects))
+		for _, o := range objects {
+			changes.add(strconv.Itoa(int(o.ID)), o)
+			ids = append(ids, o.ID)
+		}
+		if err := changes.record(tx); err != nil {
+			return err
+		}
+		if err := writePopularitySnapshots(tx, objects); err != nil {
+			return err
+		}
+		return enqueueEvent(tx, "movies.upserted", map[string]any{"runId": currentRun.ID, "movieIds": ids})
+	})
+}
+
+// writePeopleRefRows writes the people credited by a run and returns their
+// IDs, each once.
+func writePeopleRefRows(db *gorm.DB, dataChannel chan Person, batchSize int) []uint32 {
+	var written []uint32
+	seen := map[uint32]bool{}
+	markWritten := func(batch []Person) {
+		checksumWritten("CinemaPerson", batch)
+		for _, p := range batch {
+			if !seen[p.ID] {
+				seen[p.ID] = true
+				written = append(written, p.ID)
+			}
+		}
+	}
+	writeBatches(dataChannel, batchSize, func(batch []Person) error {
+		if err := writePeopleRefsBatch(db, batch); err != nil {
+			return err
+		}
+		markWritten(batch)
+		return nil
+	})
+	return written
+}
+func writePeopleRefsBatch(db *gorm.DB, objects []Person) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		// Stored people are left alone, so only new ones are changes.
+		ids := make([]uint32, 0, len(objects))
+		for _, o := range objects {
+			ids = append(ids, o.ID)
+		}
+		var stored []uint32
+		if err := tx.Table("CinemaPerson").Where(`"id" IN ?`, ids).Pluck("id", &stored).Error; err != nil {
+			return err
+		}
+		if err := tx.WithContext(context.Background()).Clauses(clause.OnConflict{Columns: conflictTarget("CinemaPerson"), DoNothing: true}).Table("CinemaPerson").Model(&Person{}).Create(&objects).Error; err != nil {
+			return err
+		}
+		known := map[uint32]bool{}
+		for _, id := range stored {
+			known[id] = true
+		}
+		var keys []string
+		for _, id := range ids {
+			if !known[id] {
+				known[id] = true
+				keys = append(keys, strconv.Itoa(int(id)))
+			}
+		}
+		return recordChanges(tx, "person", opUpsert, keys)
+	})
+}
+
+func writeMovieActorRows(db *gorm.DB, dataChannel chan MovieActor, batchSize int) {
+	writeBatches(dataChannel, batchSize, func(batch []MovieActor) error {
+		if err := writeActorsBatch(db, batch); err != nil {
+			return err
+		}
+		checksumWritten("MovieActor", batch)
+		return nil
+	})
+}
+
+func writeActorsBatch(db *gorm.DB, objects []MovieActor) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.WithContext(context.Background()).Clauses(clause.OnConflict{Columns: conflictTarget("MovieActor"), DoUpdates: clause.AssignmentColumns([]string{"character", "order", "creditId", "isUncredited", "isVoice", "isArchiveFootage", "isGuest"})}).Table("MovieActor").Model(&MovieActor{}).Create(&objects).Error; err != nil {
+			return err
+		}
+		changes := newChangeSet("movieActor")
+		for _, o := range objects {
+			changes.add(pairKey(o.MovieId, o.ActorId), o)
+		}
+		return changes.record(tx)
+	})
+}
+
+func writeMovieDirectorRows(db *gorm.DB, dataChannel chan MovieDirector, batchSize int) {
+	writeBatches(dataChannel, batchSize, func(batch []MovieDirector) error {
+		if err := writeDirectorsBatch(db, batch); err != nil {
+			return err
+		}
+		checksumWritten("MovieDirector", batch)
+		return nil
+	})
+}
+
+func writeDirectorsBatch(db *gorm.DB, objects []MovieDirector) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.WithContext(context.Background()).Clauses(clause.OnConflict{Columns: conflictTarget("MovieDirector"), DoNothing: true}).Table("MovieDirector").Model(&MovieDirector{}).Create(&objects).Error; err != nil {
+			return err
+		}
+		changes := newChangeSet("movieDirector")
+		for _, o := range objects {
+			changes.add(pairKey(o.MovieId, o.DirectorId), o)
+		}
+		return changes.record(tx)
+	})
+}
+
+func writeMovieGenreRows(db *gorm.DB, dataChannel chan MovieGenre, batchSize int) {
+	writeBatches(dataChannel, batchSize, func(batch []MovieGenre) error {
+		if err := writeGenresBatch(db, batch); err != nil {
+			return err
+		}
+		checksumWritten("MovieGenre", batch)
+		return nil
+	})
+}
+
+func writeGenresBatch(db *gorm.DB, objects []MovieGenre) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.WithContext(context.Background()).Clauses(clause.OnConflict{Columns: conflictTarget("MovieGenre"), DoNothing: true}).Table("MovieGenre").Model(&MovieGenre{}).Create(&objects).Error; err != nil {
+			return err
+		}
+		changes := newChangeSet("movieGenre")
+		for _, o := range objects {
+			changes.add(pairKey(o.MovieId, o.GenreId), o)
+		}
+		return changes.record(tx)
+	})
+}
+
+func writeMovieCountryRows(db *gorm.DB, dataChannel chan MovieCountry, batchSize int) {
+	writeBatches(dataChannel, batchSize, func(batch []MovieCountry) error {
+		if err := writeCountriesBatch(db, batch); err != nil {
+			return err
+		}
+		checksumWritten("MovieCountry", batch)
+		return nil
+	})
+}
+
+func writeCountriesBatch(db *gorm.DB, objects []MovieCountry) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.WithContext(context.Background()).Clauses(clause.OnConflict{Columns: conflictTarget("MovieCountry"), DoNothing: true}).Table("MovieCountry").Model(&MovieCountry{}).Create(&objects).Error; err != nil {
+			return err
+		}
+		changes := newChangeSet("movieCountry")
+		for _, o := range objects {
+			changes.add(pairKey(o.MovieId, o.CountryIso), o)
+		}
+		return changes.record(tx)
+	})
+}
+
+func writeReleaseCountryRows(db *gorm.DB, dataChannel chan MReleaseCountry, batchSize int) {
+	writeBatches(dataChannel, batchSize, func(batch []MReleaseCountry) error {
+		if err := writeReleaseCountriesBatch(db, batch); err != nil {
+			return err
+		}
+		checksumWritten("MReleaseCountry", batch)
+		return nil
+	})
+}
+
+func writeReleaseCountriesBatch(db *gorm.DB, objects []MReleaseCountry) error {
+	// A statement may not upsert the same key twice.
+	rows := make([]MReleaseCountry, 0, len(objects))
+	keys := make([]string, 0, len(objects))
+	seen := map[string]bool{}
+	for _, o := range objects {
+		key := pairKey(o.MovieId, o.ISO31661)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		keys = append(keys, key)
+		rows = append(rows, o)
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.WithContext(context.Background()).Clauses(localTitleConflict()).Table("MReleaseCountry").Create(&rows).Error; err != nil {
+			return err
+		}
+		changes := newChangeSet("releaseCountry")
+		for i, key := range keys {
+			changes.add(key, rows[i])
+		}
+		return changes.record(tx)
+	})
+}
+
+func writeLocalReleaseRows(db *gorm.DB, dataChannel chan MLocalRelease, batchSize int) {
+	writeBatches(dataChannel, batchSize, func(batch []MLocalRelease) error {
+		if err := writeLocalReleasesBatch(db, batch); err != nil {
+			return err
+		}
+		checksumWritten("MLocalRelease", batch)
+		return nil
+	})
+}
+
+func writeLocalReleasesBatch(db *gorm.DB, objects []MLocalRelease) error {
+	// A statement may not upsert the same key twice, so duplicates within the
+	// batch collapse onto the last one.
+	byKey := map[string]MLocalRelease{}
+	var keys []string
+	for _, o := range objects {
+		key := fmt.Sprintf("%d:%s:%d:%s", o.MovieId, o.ISO31661, o.Type, o.ReleaseDate.Format(time.RFC3339))
+		if _, ok := byKey[key]; !ok {
+			keys = append(keys, key)
+		}
+		byKey[key] = o
+	}
+	rows := make([]MLocalRelease, 0, len(keys))
+	for _, key := range keys {
+		rows = append(rows, byKey[key])
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.WithContext(context.Background()).Clauses(clause.OnConflict{
+			Columns:   conflictTarget("MLocalRelease"),
+			DoUpdates: clause.AssignmentColumns([]string{"note", "cutRuntime", "noteCategory", "isImax", "is3d", "is70mm", "isDolby", "certification"}),
+		}).Table("MLocalRelease").Create(&rows).Error
+		if err != nil {
+			return err
+		}
+		changes := newChangeSet("localRelease")
+		for i, key := range keys {
+			changes.add(key, rows[i])
+		}
+		return changes.record(tx)
+	})
+}
@@ -0,0 +1,246 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// Tag rules are read from the YAML file named by TAG_RULES_FILE:
+//
+//	- tag: A24
+//	  any:
+//	    companies: [A24]
+//	- tag: oscar-contenders
+//	  all:
+//	    genres: [Drama]
+//	  none:
+//	    genres: [Animation]
+//	  releaseMonths: [9, 10, 11, 12]
+//
+// Values match names case-insensitively or TMDB IDs. A rule applies when
+// every value under "all" is present, at least one under "any" is, none
+// under "none" is and the primary release month is listed; empty parts are
+// ignored.
+
+type TagRule struct {
+	Tag           string       `yaml:"tag"`
+	All           TagCondition `yaml:"all"`
+	Any           TagCondition `yaml:"any"`
+	None          TagCondition `yaml:"none"`
+	ReleaseMonths []int        `yaml:"releaseMonths"`
+}
+
+type TagCondition struct {
+	Genres    []string `yaml:"genres"`
+	Keywords  []string `yaml:"keywords"`
+	Companies []string `yaml:"companies"`
+	Countries []string `yaml:"countries"`
+}
+
+// movieFacts holds the lower-cased names and IDs a movie's rules match on.
+type movieFacts struct {
+	Genres       map[string]bool
+	Keywords     map[string]bool
+	Companies    map[string]bool
+	Countries    map[string]bool
+	ReleaseMonth int
+}
+
+type MovieTags struct {
+	MovieId uint32
+	Tags    []string
+}
+
+type MovieTag struct {
+	MovieId uint32 `gorm:"column:movieId"`
+	Tag     string `gorm:"column:tag"`
+}
+
+func loadTagRules(path string) ([]TagRule, error) {
+	if path == "" {
+		return nil, nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("TAG_RULES_FILE: %w", err)
+	}
+	var rules []TagRule
+	if err := yaml.Unmarshal(raw, &rules); err != nil {
+		return nil, fmt.Errorf("TAG_RULES_FILE: %w", err)
+	}
+	for i, r := range rules {
+		if r.Tag == "" {
+			return nil, fmt.Errorf("TAG_RULES_FILE: rule %d has no tag", i+1)
+		}
+	}
+	return rules, nil
+}
+
+func newMovieFacts(movie Movie) movieFacts {
+	facts := movieFacts{
+		Genres:    map[string]bool{},
+		Keywords:  map[string]bool{},
+		Companies: map[string]bool{},
+		Countries: map[string]bool{},
+	}
+	for _, g := range movie.Genres {
+		facts.Genres[strings.ToLower(g.Name)] = true
+		facts.Genres[strconv.Itoa(int(g.ID))] = true
+	}
+	for _, k := range movie.Keywords.Keywords {
+		facts.Keywords[strings.ToLower(k.Name)] = true
+		facts.Keywords[strconv.Itoa(int(k.ID))] = true
+	}
+	for _, c := range movie.ProductionCompanies {
+		facts.Companies[strings.ToLower(c.Name)] = true
+		facts.Companies[strconv.Itoa(int(c.ID))] = true
+	}
+	for _, c := range movie.ProductionCountries {
+		facts.Countries[strings.ToLower(c.ISO31661)] = true
+	}
+	if date, err := time.Parse("2006-01-02", movie.ReleaseDateStr); err == nil {
+		facts.ReleaseMonth = int(date.Month())
+	}
+	return facts
+}
+
+// count returns how many of the condition's values the movie has, out of
+// how many are listed.
+func (c TagCondition) count(f movieFacts) (present, total int) {
+	fields := []struct {
+		values []string
+		facts  map[string]bool
+	}{
+		{c.Genres, f.Genres},
+		{c.Keywords, f.Keywords},
+		{c.Companies, f.Companies},
+		{c.Countries, f.Countries},
+	}
+	for _, field := range fields {
+		for _, v := range field.values {
+			total++
+			if field.facts[strings.ToLower(v)] {
+				present++
+			}
+		}
+	}
+	return present, total
+}
+
+func (r TagRule) matches(f movieFacts) bool {
+	if present, total := r.All.count(f); present < total {
+		return false
+	}
+	if present, total := r.Any.count(f); total > 0 && present == 0 {
+		return false
+	}
+	if present, _ := r.None.count(f); present > 0 {
+		return false
+	}
+	if len(r.ReleaseMonths) > 0 {
+		for _, m := range r.ReleaseMonths {
+			if m == f.ReleaseMonth {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func applyTagRules(rules []TagRule, movie Movie) []string {
+	facts := newMovieFacts(movie)
+	var tags []string
+	for _, r := range rules {
+		if r.matches(facts) {
+			tags = append(tags, r.Tag)
+		}
+	}
+	return tags
+}
+
+// writeMovieTagRows replaces the tags of every movie received, including
+// movies that no longer match any rule.
+func writeMovieTagRows(db *gorm.DB, dataChannel chan MovieTags, batchSize int) {
+	writeBatches(dataChannel, batchSize, func(batch []MovieTags) error {
+		return writeMovieTagsBatch(db, batch)
+	})
+}
+
+func writeMovieTagsBatch(db *gorm.DB, objects []MovieTags) error {
+	ids := make([]uint32, 0, len(objects))
+	var rows []MovieTag
+	seen := map[string]bool{}
+	for _, o := range objects {
+		ids = append(ids, o.MovieId)
+		for _, tag := range o.Tags {
+			if key := pairKey(o.MovieId, tag); !seen[key] {
+				seen[key] = true
+				rows = append(rows, MovieTag{MovieId: o.MovieId, Tag: tag})
+			}
+		}
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.WithContext(context.Background()).Table("MovieTag").Where(`"movieId" IN ?`, ids).Delete(&MovieTag{}).Error; err != nil {
+			return err
+		}
+		if len(rows) > 0 {
+			if err := tx.WithContext(context.Background()).Table("MovieTag").Create(&rows).Error; err != nil {
+				return err
+			}
+		}
+		changes := newChangeSet("movieTags")
+		for _, id := range ids {
+			changes.touch(strconv.Itoa(int(id)))
+		}
+		for _, r := range rows {
+			changes.add(strconv.Itoa(int(r.MovieId)), r)
+		}
+		return changes.record(tx)
+	})
+}
+
+// pruneMovieTags deletes the tags of rules no longer in TAG_RULES_FILE, all
+// of them without one. Tags are otherwise only rewritten along with their
+// movie, so a removed rule's tags would stay.
+func pruneMovieTags(db *gorm.DB, rules []TagRule) error {
+	query := `DELETE FROM "MovieTag"`
+	var args []any
+	if len(rules) > 0 {
+		tags := make([]string, 0, len(rules))
+		for _, r := range rules {
+			tags = append(tags, r.Tag)
+		}
+		query += ` WHERE "tag" NOT IN ?`
+		args = append(args, tags)
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		var ids []uint32
+		if err := tx.Raw(query+` RETURNING "movieId"`, args...).Scan(&ids).Error; err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		outputf("Deleted %d tags of removed tag rules\n", len(ids))
+		var rows []MovieTag
+		if err := tx.Table("MovieTag").Where(`"movieId" IN ?`, ids).Find(&rows).Error; err != nil {
+			return err
+		}
+		changes := newChangeSet("movieTags")
+		for _, id := range ids {
+			changes.touch(strconv.Itoa(int(id)))
+		}
+		for _, r := range rows {
+			changes.add(strconv.Itoa(int(r.MovieId)), r)
+		}
+		return changes.record(tx)
+	})
+}
@@ -0,0 +1,60 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestLoadTagRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		tags    []string
+		wantErr bool
+	}{
+		{"no rules", "", nil, false},
+		{"rules", `
+- tag: A24
+  any:
+    companies: [A24]
+- tag: oscar-contenders
+  all:
+    genres: [Drama]
+  releaseMonths: [9, 10, 11, 12]
+`, []string{"A24", "oscar-contenders"}, false},
+		{"rule without a tag", `
+- tag: A24
+- any:
+    genres: [Horror]
+`, nil, true},
+		{"not a list", "tag: A24", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rules.yaml")
+			if err := os.WriteFile(path, []byte(tt.yaml), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			rules, err := loadTagRules(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadTagRules error = %v, want error %v", err, tt.wantErr)
+			}
+			var tags []string
+			for _, r := range rules {
+				tags = append(tags, r.Tag)
+			}
+			if !slices.Equal(tags, tt.tags) {
+				t.Errorf("loadTagRules tags = %q, want %q", tags, tt.tags)
+			}
+		})
+	}
+
+	if rules, err := loadTagRules(""); rules != nil || err != nil {
+		t.Errorf(`loadTagRules("") = %v, %v, want no rules`, rules, err)
+	}
+	if _, err := loadTagRules(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("loadTagRules of a missing file succeeded")
+	}
+}
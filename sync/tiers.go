@@ -0,0 +1,70 @@
+package sync
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Popularity tiers spend API quota where users look. POPULARITY_TIERS lists
+// the sub-resources appended for movies from a popularity up, e.g.
+//
+//	20:release_dates+credits+keywords+images+videos+reviews,5:release_dates+credits,0:release_dates
+//
+// A movie gets the tier of the highest threshold its last synced popularity
+// reaches. Movies not synced yet, or below every threshold, get
+// DETAILS_APPEND.
+
+type PopularityTier struct {
+	MinPopularity float64
+	Resources     []string
+}
+
+// parsePopularityTiers parses POPULARITY_TIERS, highest threshold first.
+func parsePopularityTiers(raw string) ([]PopularityTier, error) {
+	var tiers []PopularityTier
+	for _, entry := range envSplit(raw) {
+		threshold, resources, found := strings.Cut(entry, ":")
+		minPopularity, err := strconv.ParseFloat(threshold, 64)
+		if !found || err != nil {
+			return nil, fmt.Errorf("POPULARITY_TIERS: %q is not popularity:resource+resource", entry)
+		}
+		tier := PopularityTier{MinPopularity: minPopularity}
+		for _, r := range strings.Split(resources, "+") {
+			if r = strings.TrimSpace(r); r != "" {
+				tier.Resources = append(tier.Resources, r)
+			}
+		}
+		tiers = append(tiers, tier)
+	}
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].MinPopularity > tiers[j].MinPopularity })
+	return tiers, nil
+}
+
+// tierResolver picks the sub-resources of each movie of a sync.
+type tierResolver struct {
+	db *gorm.DB
+}
+
+func newTierResolver(db *gorm.DB) tierResolver {
+	return tierResolver{db: db}
+}
+
+func (t tierResolver) resources(id uint32) []string {
+	if len(cfg.PopularityTiers) == 0 {
+		return cfg.DetailsAppend
+	}
+	var popularity []float64
+	if err := t.db.Table("Movie").Where(`"id" = ?`, id).Pluck(`"popularity"`, &popularity).Error; err != nil || len(popularity) == 0 {
+		return cfg.DetailsAppend
+	}
+	for _, tier := range cfg.PopularityTiers {
+		if popularity[0] >= tier.MinPopularity {
+			return tier.Resources
+		}
+	}
+	return cfg.DetailsAppend
+}
@@ -0,0 +1,32 @@
+package sync
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParsePopularityTiers(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{"", "[]", false},
+		{"0:release_dates", "[{0 [release_dates]}]", false},
+		{"5:release_dates+credits,20:release_dates+credits+videos", "[{20 [release_dates credits videos]} {5 [release_dates credits]}]", false},
+		{"2.5: release_dates + +images", "[{2.5 [release_dates images]}]", false},
+		{"10:", "[{10 []}]", false},
+		{"release_dates", "", true},
+		{"high:credits", "", true},
+	}
+	for _, tt := range tests {
+		tiers, err := parsePopularityTiers(tt.raw)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePopularityTiers(%q) error = %v, want error %v", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if got := fmt.Sprint(tiers); !tt.wantErr && got != tt.want {
+			t.Errorf("parsePopularityTiers(%q) = %s, want %s", tt.raw, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// tmdbGenres is TMDB's list of movie genres.
+var tmdbGenres = []Genre{
+	{28, "Action"}, {12, "Adventure"}, {16, "Animation"}, {35, "Comedy"}, {80, "Crime"},
+	{99, "Documentary"}, {18, "Drama"}, {10751, "Family"}, {14, "Fantasy"}, {36, "History"},
+	{27, "Horror"}, {10402, "Music"}, {9648, "Mystery"}, {10749, "Romance"},
+	{878, "Science Fiction"}, {53, "Thriller"}, {10752, "War"}, {37, "Western"},
+}
+
+// statusError is a TMDB response other than 200 OK.
+type statusError struct {
+	code int
+	// retryAfter is the wait requested by a 429 or 503, if any.
+	retryAfter time.Duration
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected HTTP status code: %d", e.code)
+}
+
+// notFound reports whether err is TMDB answering 404, which it does for
+// movies it deleted or marked adult.
+func notFound(err error) bool {
+	var status *statusError
+	return errors.As(err, &status) && status.code == http.StatusNotFound
+}
+
+// fetchTMDB performs a rate-limited GET against the TMDB API. path is
+// relative to the API root and may include a query string.
+func fetchTMDB(path string) ([]byte, error) {
+	return fetchTMDBLimited(limiter, path)
+}
+
+// fetchTMDBLimited is fetchTMDB paced by l instead of the movie limiter.
+// Throttled, 5xx and network failures are retried up to TMDBMaxRetries
+// times with exponential backoff and full jitter, waiting at least as long
+// as a Retry-After header asks.
+func fetchTMDBLimited(l *rate.Limiter, path string) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		body, err := fetchTMDBOnce(l, path)
+		if err == nil || attempt >= cfg.TMDBMaxRetries || !retryable(err) {
+			return body, err
+		}
+		wait := backoff(attempt)
+		var status *statusError
+		if errors.As(err, &status) && status.retryAfter > wait {
+			wait = status.retryAfter
+		}
+		logger.Debug("retrying TMDB request", "path", path, "attempt", attempt+1, "wait", wait, "error", err)
+		select {
+		case <-time.After(wait):
+		case <-runCtx.Done():
+			return nil, runCtx.Err()
+		}
+	}
+}
+
+// tmdbRequestTimeout bounds a single TMDB request, so a hung connection
+// fails into the retries instead of stalling its worker.
+const tmdbRequestTimeout = 30 * time.Second
+
+var tmdbClient = &http.Client{Timeout: tmdbRequestTimeout}
+
+func fetchTMDBOnce(l *rate.Limiter, path string) ([]byte, error) {
+	waitStart := time.Now()
+	if err := l.Wait(runCtx); err != nil {
+		return nil, fmt.Errorf("waiting for the rate limiter: %w", err)
+	}
+	observeLimiterWait(time.Since(waitStart))
+
+	req, err := http.NewRequestWithContext(runCtx, "GET", cfg.TMDBBaseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+cfg.APIAccessToken)
+	start := time.Now()
+	res, err := tmdbClient.Do(req)
+	if !errors.Is(err, context.Canceled) {
+		observeRequest(requestCode(res), time.Since(start))
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, res.Body)
+		return nil, &statusError{code: res.StatusCode, retryAfter: parseRetryAfter(res.Header.Get("Retry-After"))}
+	}
+	return io.ReadAll(res.Body)
+}
+
+// retryable reports whether a failed request may succeed when repeated:
+// throttling, server errors, timeouts and network failures, but not the
+// run being cancelled or past its deadline.
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || runCtx.Err() != nil {
+		return false
+	}
+	var status *statusError
+	if errors.As(err, &status) {
+		return status.code == http.StatusTooManyRequests || status.code >= 500
+	}
+	return true
+}
+
+// backoff returns a random wait up to TMDBRetryBase doubled per attempt,
+// capped at TMDBRetryMax.
+func backoff(attempt int) time.Duration {
+	ceiling := cfg.TMDBRetryBase << min(attempt, 30)
+	if ceiling <= 0 || ceiling > cfg.TMDBRetryMax {
+		ceiling = cfg.TMDBRetryMax
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling))) + 1
+}
+
+// parseRetryAfter reads a Retry-After header in seconds or as an HTTP date.
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		return max(time.Until(at), 0)
+	}
+	return 0
+}
@@ -0,0 +1,80 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	defer func(c Config) { cfg = c }(cfg)
+	tests := []struct {
+		base, max time.Duration
+		attempt   int
+		ceiling   time.Duration
+	}{
+		{time.Second, 30 * time.Second, 0, time.Second},
+		{time.Second, 30 * time.Second, 3, 8 * time.Second},
+		{time.Second, 30 * time.Second, 5, 30 * time.Second},
+		{time.Second, 30 * time.Second, 100, 30 * time.Second},
+		{0, 30 * time.Second, 2, 30 * time.Second},
+		{0, 0, 2, 0},
+	}
+	for _, tt := range tests {
+		cfg.TMDBRetryBase, cfg.TMDBRetryMax = tt.base, tt.max
+		for i := 0; i < 100; i++ {
+			got := backoff(tt.attempt)
+			if got > tt.ceiling || tt.ceiling > 0 && got <= 0 {
+				t.Errorf("backoff(%d) with base %s, max %s = %s, want in (0, %s]", tt.attempt, tt.base, tt.max, got, tt.ceiling)
+				break
+			}
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		header   string
+		min, max time.Duration
+	}{
+		{"", 0, 0},
+		{"5", 5 * time.Second, 5 * time.Second},
+		{"0", 0, 0},
+		{"-3", 0, 0},
+		{"soon", 0, 0},
+		{time.Now().Add(90 * time.Second).UTC().Format(http.TimeFormat), 85 * time.Second, 90 * time.Second},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.header); got < tt.min || got > tt.max {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s to %s", tt.header, got, tt.min, tt.max)
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"network error", errors.New("connection reset"), true},
+		{"too many requests", &statusError{code: http.StatusTooManyRequests}, true},
+		{"server error", &statusError{code: http.StatusBadGateway}, true},
+		{"wrapped server error", fmt.Errorf("page 3: %w", &statusError{code: http.StatusServiceUnavailable}), true},
+		{"not found", &statusError{code: http.StatusNotFound}, false},
+		{"unauthorized", &statusError{code: http.StatusUnauthorized}, false},
+		{"canceled", context.Canceled, false},
+		{"wrapped canceled", fmt.Errorf("fetching: %w", context.Canceled), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryable(tt.err); got != tt.want {
+				t.Errorf("retryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"golang.org/x/time/rate"
+	"gorm.io/gorm"
+)
+
+// Trakt allows 1000 GET calls per 5 minutes per client.
+var traktLimiter = rate.NewLimiter(rate.Every(300*time.Millisecond), 1)
+
+type traktStats struct {
+	Watchers   uint32 `json:"watchers"`
+	Plays      uint32 `json:"plays"`
+	Collectors uint32 `json:"collectors"`
+	Lists      uint32 `json:"lists"`
+}
+
+type traktTarget struct {
+	ID     uint32
+	ImdbId string `gorm:"column:imdbId"`
+}
+
+// syncTraktStats stores Trakt watcher, play and collector counts next to the
+// TMDB popularity of the most popular synced movies, so the site can blend
+// both signals when ranking.
+func syncTraktStats(db *gorm.DB, ids []uint32, clientID string, maxMovies int) error {
+	var targets []traktTarget
+	err := db.Table("Movie").
+		Select(`"id", "imdbId"`).
+		Where(`"id" IN ? AND "imdbId" IS NOT NULL`, ids).
+		Order(`"popularity" DESC`).
+		Limit(maxMovies).
+		Scan(&targets).Error
+	if err != nil {
+		return err
+	}
+
+	updated := 0
+	for _, t := range targets {
+		stats, err := fetchTraktStats(t.ImdbId, clientID)
+		if err != nil {
+			outputf("Error fetching Trakt stats for ID %d: %v\n", t.ID, err)
+			continue
+		}
+		err = db.Table("Movie").Where(`"id" = ?`, t.ID).Updates(map[string]any{
+			"traktWatchers":   stats.Watchers,
+			"traktPlays":      stats.Plays,
+			"traktCollectors": stats.Collectors,
+			"traktLists":      stats.Lists,
+		}).Error
+		if err != nil {
+			return err
+		}
+		updated++
+	}
+	outputf("Updated Trakt stats for %d movies\n", updated)
+	return nil
+}
+
+func fetchTraktStats(imdbId, clientID string) (traktStats, error) {
+	var stats traktStats
+	if err := traktLimiter.Wait(context.Background()); err != nil {
+		outputf("Trakt rate limit exceeded for %s: %v\n", imdbId, err)
+	}
+	req, err := http.NewRequest("GET", "https://api.trakt.tv/movies/"+imdbId+"/stats", nil)
+	if err != nil {
+		return stats, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("trakt-api-version", "2")
+	req.Header.Set("trakt-api-key", clientID)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return stats, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return stats, fmt.Errorf("unexpected HTTP status code: %d", res.StatusCode)
+	}
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return stats, err
+	}
+	err = json.Unmarshal(body, &stats)
+	return stats, err
+}
@@ -0,0 +1,206 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// A transform script is a Lua file defining transform(movie). It is called
+// for every parsed movie with a table of its fields and may change title,
+// original_title, original_language, release_date, runtime, budget,
+// popularity and imdb_id in place. genres, keywords, companies and
+// countries are lists of names for reading only. Returning false vetoes the
+// movie, optionally with a reason as second value:
+//
+//	function transform(movie)
+//	  for _, k in ipairs(movie.keywords) do
+//	    if k == "softcore" then return false, "banned keyword" end
+//	  end
+//	  movie.title = movie.title:upper()
+//	end
+//
+// Scripts run without the io, os and package libraries.
+type transformScript struct {
+	proto *lua.FunctionProto
+	// states holds ready interpreters, since details are parsed
+	// concurrently and an LState must not be shared.
+	states sync.Pool
+}
+
+// activeTransform is the script of the current configuration, if any.
+var (
+	activeTransform   *transformScript
+	registerTransform sync.Once
+)
+
+// loadTransformScript compiles the script at path and makes it the
+// afterMovieParsed hook, replacing the script of an earlier configuration.
+func loadTransformScript(path string) error {
+	activeTransform = nil
+	if path == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	chunk, err := parse.Parse(f, path)
+	if err != nil {
+		return err
+	}
+	proto, err := lua.Compile(chunk, path)
+	if err != nil {
+		return err
+	}
+	script := &transformScript{proto: proto}
+	// Running it once checks it defines transform before any movie is fetched.
+	L, err := script.newState()
+	if err != nil {
+		return err
+	}
+	script.states.Put(L)
+	activeTransform = script
+	registerTransform.Do(func() {
+		registerHook(hookAfterMovieParsed, func(p *hookPayload) error {
+			if activeTransform == nil {
+				return nil
+			}
+			return activeTransform.apply(p)
+		})
+	})
+	return nil
+}
+
+func (s *transformScript) newState() (*lua.LState, error) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for name, open := range map[string]lua.LGFunction{
+		lua.BaseLibName:   lua.OpenBase,
+		lua.TabLibName:    lua.OpenTable,
+		lua.StringLibName: lua.OpenString,
+		lua.MathLibName:   lua.OpenMath,
+	} {
+		L.Push(L.NewFunction(open))
+		L.Push(lua.LString(name))
+		L.Call(1, 0)
+	}
+	for _, name := range []string{"dofile", "loadfile", "load", "loadstring"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+	L.Push(L.NewFunctionFromProto(s.proto))
+	if err := L.PCall(0, 0, nil); err != nil {
+		L.Close()
+		return nil, err
+	}
+	if L.GetGlobal("transform").Type() != lua.LTFunction {
+		L.Close()
+		return nil, fmt.Errorf("%s does not define transform(movie)", s.proto.SourceName)
+	}
+	return L, nil
+}
+
+func (s *transformScript) apply(p *hookPayload) error {
+	L, ok := s.states.Get().(*lua.LState)
+	if !ok {
+		var err error
+		if L, err = s.newState(); err != nil {
+			return err
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.HookTimeout)
+	defer cancel()
+	L.SetContext(ctx)
+	defer func() {
+		L.RemoveContext()
+		s.states.Put(L)
+	}()
+
+	movie := p.Movie
+	t := movieTable(L, movie)
+	if err := L.CallByParam(lua.P{Fn: L.GetGlobal("transform"), NRet: 2, Protect: true}, t); err != nil {
+		return fmt.Errorf("transform script: %w", err)
+	}
+	keep, reason := L.Get(-2), L.Get(-1)
+	L.Pop(2)
+	if keep == lua.LFalse {
+		if reason == lua.LNil {
+			return errVetoed
+		}
+		return fmt.Errorf("%w: %s", errVetoed, reason.String())
+	}
+
+	movie.Title = lua.LVAsString(t.RawGetString("title"))
+	movie.ReleaseDateStr = lua.LVAsString(t.RawGetString("release_date"))
+	movie.ImdbId = lua.LVAsString(t.RawGetString("imdb_id"))
+	movie.OriginalTitle = luaOptionalString(t.RawGetString("original_title"))
+	movie.OriginalLanguage = luaOptionalString(t.RawGetString("original_language"))
+	movie.Runtime = uint16(lua.LVAsNumber(t.RawGetString("runtime")))
+	movie.Budget = uint64(lua.LVAsNumber(t.RawGetString("budget")))
+	movie.Revenue = uint64(lua.LVAsNumber(t.RawGetString("revenue")))
+	movie.Overview = lua.LVAsString(t.RawGetString("overview"))
+	movie.Tagline = lua.LVAsString(t.RawGetString("tagline"))
+	movie.Status = lua.LVAsString(t.RawGetString("status"))
+	movie.Popularity = float32(lua.LVAsNumber(t.RawGetString("popularity")))
+	return nil
+}
+
+func movieTable(L *lua.LState, movie *Movie) *lua.LTable {
+	t := L.NewTable()
+	t.RawSetString("id", lua.LNumber(movie.ID))
+	t.RawSetString("title", lua.LString(movie.Title))
+	t.RawSetString("release_date", lua.LString(movie.ReleaseDateStr))
+	t.RawSetString("imdb_id", lua.LString(movie.ImdbId))
+	if movie.OriginalTitle != nil {
+		t.RawSetString("original_title", lua.LString(*movie.OriginalTitle))
+	}
+	if movie.OriginalLanguage != nil {
+		t.RawSetString("original_language", lua.LString(*movie.OriginalLanguage))
+	}
+	t.RawSetString("runtime", lua.LNumber(movie.Runtime))
+	t.RawSetString("budget", lua.LNumber(movie.Budget))
+	t.RawSetString("revenue", lua.LNumber(movie.Revenue))
+	t.RawSetString("overview", lua.LString(movie.Overview))
+	t.RawSetString("tagline", lua.LString(movie.Tagline))
+	t.RawSetString("status", lua.LString(movie.Status))
+	t.RawSetString("popularity", lua.LNumber(movie.Popularity))
+
+	list := func(key string, names []string) {
+		l := L.NewTable()
+		for _, name := range names {
+			l.Append(lua.LString(name))
+		}
+		t.RawSetString(key, l)
+	}
+	var genres, keywords, companies, countries []string
+	for _, g := range movie.Genres {
+		genres = append(genres, g.Name)
+	}
+	for _, k := range movie.Keywords.Keywords {
+		keywords = append(keywords, strings.ToLower(k.Name))
+	}
+	for _, c := range movie.ProductionCompanies {
+		companies = append(companies, c.Name)
+	}
+	for _, c := range movie.ProductionCountries {
+		countries = append(countries, c.ISO31661)
+	}
+	list("genres", genres)
+	list("keywords", keywords)
+	list("companies", companies)
+	list("countries", countries)
+	return t
+}
+
+func luaOptionalString(v lua.LValue) *string {
+	if v == lua.LNil {
+		return nil
+	}
+	s := lua.LVAsString(v)
+	return &s
+}
@@ -0,0 +1,142 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type Translation struct {
+	ISO31661 string `json:"iso_3166_1"`
+	ISO6391  string `json:"iso_639_1"`
+	Data     struct {
+		Title    string `json:"title"`
+		Overview string `json:"overview"`
+		Tagline  string `json:"tagline"`
+	} `json:"data"`
+}
+
+type translationsResponse struct {
+	ID           uint32        `json:"id"`
+	Translations []Translation `json:"translations"`
+}
+
+type MovieTranslation struct {
+	MovieId  uint32 `gorm:"column:movieId"`
+	Locale   string
+	Title    *string
+	Overview *string
+	Tagline  *string
+}
+
+// matchTranslation picks the translation for a locale such as "pt-BR" or
+// "de". A bare language prefers the country of the same code (de-DE) and
+// otherwise takes the first translation in that language.
+func matchTranslation(translations []Translation, locale string) (Translation, bool) {
+	lang, country, _ := strings.Cut(locale, "-")
+	if country == "" {
+		country = strings.ToUpper(lang)
+	}
+	var fallback *Translation
+	for i, t := range translations {
+		if t.ISO6391 != lang {
+			continue
+		}
+		if t.ISO31661 == country {
+			return t, true
+		}
+		if fallback == nil && !strings.Contains(locale, "-") {
+			fallback = &translations[i]
+		}
+	}
+	if fallback != nil {
+		return *fallback, true
+	}
+	return Translation{}, false
+}
+
+func translationRow(movieID uint32, locale string, t Translation) MovieTranslation {
+	return MovieTranslation{
+		MovieId:  movieID,
+		Locale:   locale,
+		Title:    filterEmptyDates(t.Data.Title),
+		Overview: filterEmptyDates(t.Data.Overview),
+		Tagline:  filterEmptyDates(t.Data.Tagline),
+	}
+}
+
+// runBackfillLocale fetches translations for movies already in the DB for a
+// newly launched site locale, without a full catalog resync.
+func runBackfillLocale(db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("backfill-locale", flag.ContinueOnError)
+	locale := fs.String("locale", "", "site locale to backfill, e.g. pt-BR")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *locale == "" {
+		return errors.New("--locale is required")
+	}
+	if !validLocale(*locale) {
+		return fmt.Errorf("--locale: %q is not a locale such as de or pt-BR", *locale)
+	}
+
+	var ids []uint32
+	if err := db.Table("Movie").Order(`"id"`).Pluck(`"id"`, &ids).Error; err != nil {
+		return err
+	}
+	outputf("Backfilling locale %s for %d movies\n", *locale, len(ids))
+
+	batchSize := cfg.Preset.BatchSize
+	translationCh := make(chan MovieTranslation, 1000000)
+	forEachMovie(ids, workerCount(), func(id uint32) {
+		body, err := fetchTMDB(fmt.Sprintf("/movie/%d/translations", id))
+		if err != nil {
+			outputf("Error fetching translations for ID %d: %v\n", id, err)
+			return
+		}
+		var payload translationsResponse
+		if err := json.Unmarshal(body, &payload); err != nil {
+			outputln("Error parsing JSON data for Movie ID:", id, err)
+			return
+		}
+		if t, ok := matchTranslation(payload.Translations, *locale); ok {
+			send(translationCh, "MovieTranslation", translationRow(id, *locale, t))
+		}
+	})
+	close(translationCh)
+
+	writeTranslationRows(db, translationCh, batchSize)
+	if n := verifyChecksums(); n > 0 {
+		return fmt.Errorf("fetched and written rows differ in %d tables", n)
+	}
+	return nil
+}
+
+func writeTranslationRows(db *gorm.DB, dataChannel chan MovieTranslation, batchSize int) {
+	writeBatches(dataChannel, batchSize, func(batch []MovieTranslation) error {
+		if err := writeTranslationsBatch(db, batch); err != nil {
+			return err
+		}
+		checksumWritten("MovieTranslation", batch)
+		return nil
+	})
+}
+
+func writeTranslationsBatch(db *gorm.DB, objects []MovieTranslation) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.WithContext(context.Background()).Clauses(clause.OnConflict{Columns: conflictTarget("MovieTranslation"), UpdateAll: true}).Table("MovieTranslation").Model(&MovieTranslation{}).Create(&objects).Error; err != nil {
+			return err
+		}
+		changes := newChangeSet("movieTranslation")
+		for _, o := range objects {
+			changes.add(pairKey(o.MovieId, o.Locale), o)
+		}
+		return changes.record(tx)
+	})
+}
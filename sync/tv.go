@@ -0,0 +1,408 @@
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Sync media, selected by SYNC_MEDIA or sync --media.
+const (
+	mediaMovies = "movies"
+	mediaTV     = "tv"
+	mediaBoth   = "both"
+)
+
+func validMedia(media string) bool {
+	return media == mediaMovies || media == mediaTV || media == mediaBoth
+}
+
+type Series struct {
+	ID               uint32         `json:"id"`
+	Name             string         `json:"name"`
+	OriginalName     *string        `json:"original_name"`
+	OriginalLanguage *string        `json:"original_language"`
+	PosterPath       *string        `json:"poster_path"`
+	Popularity       float32        `json:"popularity"`
+	FirstAirDate     string         `json:"first_air_date"`
+	LastAirDate      string         `json:"last_air_date"`
+	Status           string         `json:"status"`
+	InProduction     bool           `json:"in_production"`
+	NumberOfSeasons  uint16         `json:"number_of_seasons"`
+	NumberOfEpisodes uint16         `json:"number_of_episodes"`
+	Genres           []Genre        `json:"genres"`
+	OriginCountry    []string       `json:"origin_country"`
+	CreatedBy        []Person       `json:"created_by"`
+	Seasons          []SeriesSeason `json:"seasons"`
+}
+
+type SeriesSeason struct {
+	ID           uint32          `json:"id"`
+	Name         string          `json:"name"`
+	SeasonNumber uint16          `json:"season_number"`
+	AirDate      string          `json:"air_date"`
+	EpisodeCount uint16          `json:"episode_count"`
+	PosterPath   *string         `json:"poster_path"`
+	Episodes     []SeriesEpisode `json:"episodes"`
+}
+
+type SeriesEpisode struct {
+	ID            uint32  `json:"id"`
+	Name          string  `json:"name"`
+	SeasonNumber  uint16  `json:"season_number"`
+	EpisodeNumber uint16  `json:"episode_number"`
+	AirDate       string  `json:"air_date"`
+	Runtime       *uint16 `json:"runtime"`
+}
+
+type SeriesDB struct {
+	ID               uint32
+	Name             string
+	OriginalName     *string `gorm:"column:originalName"`
+	OriginalLanguage *string `gorm:"column:originalLanguage"`
+	PosterPath       *string `gorm:"column:posterPath"`
+	Popularity       float32
+	FirstAirDate     *string `gorm:"column:firstAirDate;type:date"`
+	LastAirDate      *string `gorm:"column:lastAirDate;type:date"`
+	Status           string
+	InProduction     bool      `gorm:"column:inProduction"`
+	NumberOfSeasons  uint16    `gorm:"column:numberOfSeasons"`
+	NumberOfEpisodes uint16    `gorm:"column:numberOfEpisodes"`
+	SyncedAt         time.Time `gorm:"column:syncedAt"`
+}
+
+type SeasonDB struct {
+	ID           uint32
+	SeriesId     uint32 `gorm:"column:seriesId"`
+	SeasonNumber uint16 `gorm:"column:seasonNumber"`
+	Name         string
+	AirDate      *string `gorm:"column:airDate;type:date"`
+	EpisodeCount uint16  `gorm:"column:episodeCount"`
+	PosterPath   *string `gorm:"column:posterPath"`
+}
+
+type EpisodeDB struct {
+	ID            uint32
+	SeriesId      uint32 `gorm:"column:seriesId"`
+	SeasonId      uint32 `gorm:"column:seasonId"`
+	SeasonNumber  uint16 `gorm:"column:seasonNumber"`
+	EpisodeNumber uint16 `gorm:"column:episodeNumber"`
+	Name          string
+	AirDate       *string `gorm:"column:airDate;type:date"`
+	Runtime       *uint16
+}
+
+type SeriesGenre struct {
+	SeriesId uint32 `gorm:"column:seriesId"`
+	GenreId  uint32 `gorm:"column:genreId"`
+}
+
+type SeriesCountry struct {
+	SeriesId   uint32 `gorm:"column:seriesId"`
+	CountryIso string `gorm:"column:countryIso"`
+}
+
+type SeriesCreator struct {
+	SeriesId  uint32 `gorm:"column:seriesId"`
+	CreatorId uint32 `gorm:"column:creatorId"`
+}
+
+// seriesRows is everything written for one series.
+type seriesRows struct {
+	Series   SeriesDB
+	Seasons  []SeasonDB
+	Episodes []EpisodeDB
+	Genres   []SeriesGenre
+	Country  []SeriesCountry
+	Creators []SeriesCreator
+	People   []Person
+}
+
+// seasonsPerRequest is how many seasons TMDB appends to one request.
+const seasonsPerRequest = 20
+
+// seriesPerBatch bounds the series written per transaction; each brings
+// its seasons and episodes along.
+const seriesPerBatch = 20
+
+// runTVSync syncs every series in TMDB's TV changes feed, with its seasons
+// and episodes, under its own run and change window within bounds.
+func runTVSync(db *gorm.DB, bounds windowBounds) error {
+	return withRun(db, "sync-tv", func() error {
+		window, err := nextChangeWindow("sync-tv")
+		if err != nil {
+			return err
+		}
+		if window, err = bounds.apply(window); err != nil {
+			return err
+		}
+		if err := setRunWindow(window); err != nil {
+			return err
+		}
+		outputf("Syncing TV changes from %s to %s\n", window.Start.Format(time.RFC3339), window.End.Format(time.RFC3339))
+
+		idsCh := make(chan uint32, 20000)
+		defer trackQueue("seriesIds", idsCh)()
+		go func() {
+			defer close(idsCh)
+			pages := fetchChangesPage("tv", 1, window, idsCh)
+			for page := 2; page <= pages && !interrupted(); page++ {
+				fetchChangesPage("tv", page, window, idsCh)
+			}
+		}()
+
+		rowsCh := make(chan seriesRows, 1000)
+		defer trackQueue("Series", rowsCh)()
+		go func() {
+			runPool(idsCh, workerCount(), func(id uint32) {
+				series, err := fetchSeries(id)
+				recordFetch(err)
+				if err != nil {
+					outputf("Error fetching series ID %d: %v\n", id, err)
+					return
+				}
+				send(rowsCh, "Series", buildSeriesRows(series))
+			})
+			close(rowsCh)
+		}()
+
+		written := writeSeriesRows(db, rowsCh)
+		outputf("Synced %d series\n", written)
+		return nil
+	})
+}
+
+// fetchChangesPage queues the non-adult IDs of one page of the tv or
+// person changes feed and returns the number of pages, or 0 if the page
+// couldn't be read.
+func fetchChangesPage(feed string, page int, window changeWindow, idsCh chan uint32) int {
+	body, err := fetchTMDB(fmt.Sprintf("/%s/changes?page=%d&start_date=%s&end_date=%s",
+		feed, page, window.Start.UTC().Format("2006-01-02"), window.End.UTC().Format("2006-01-02")))
+	if err == nil {
+		var index Response
+		if err = json.Unmarshal(body, &index); err == nil {
+			recordFetch(nil)
+			for _, entry := range index.Results {
+				if !entry.Adult {
+					idsCh <- entry.ID
+				}
+			}
+			return int(index.TotalPages)
+		}
+	}
+	outputf("Error fetching %s changes page %d: %v\n", feed, page, err)
+	recordFetch(err)
+	return 0
+}
+
+// fetchSeries fetches a series and the episodes of all its seasons, which
+// TMDB only lists per season, appending up to 20 seasons per request. The
+// season numbers aren't known before the first response, so it appends
+// seasons 0 (specials) to 19 blind; only seasons beyond those cost further
+// requests.
+func fetchSeries(id uint32) (Series, error) {
+	var series Series
+	guessed := make([]string, seasonsPerRequest)
+	for i := range guessed {
+		guessed[i] = "season/" + strconv.Itoa(i)
+	}
+	body, err := fetchTMDB(seriesPath(id, guessed))
+	if err != nil {
+		return series, err
+	}
+	if err := json.Unmarshal(body, &series); err != nil {
+		return series, err
+	}
+	missing, err := setSeasonEpisodes(&series, body, nil)
+	if err != nil {
+		return series, err
+	}
+
+	for start := 0; start < len(missing); start += seasonsPerRequest {
+		chunk := missing[start:min(start+seasonsPerRequest, len(missing))]
+		appended := make([]string, 0, len(chunk))
+		for _, i := range chunk {
+			appended = append(appended, "season/"+strconv.Itoa(int(series.Seasons[i].SeasonNumber)))
+		}
+		body, err := fetchTMDB(seriesPath(id, appended))
+		if err != nil {
+			return series, fmt.Errorf("seasons: %w", err)
+		}
+		if _, err := setSeasonEpisodes(&series, body, chunk); err != nil {
+			return series, err
+		}
+	}
+	return series, nil
+}
+
+func seriesPath(id uint32, appended []string) string {
+	return fmt.Sprintf("/tv/%d?language=%s&append_to_response=%s", id, cfg.Language, strings.Join(appended, ","))
+}
+
+// setSeasonEpisodes fills in the episodes of the seasons at indexes, or of
+// all seasons if nil, from the seasons appended to body, and returns the
+// indexes of those body didn't have.
+func setSeasonEpisodes(series *Series, body []byte, indexes []int) ([]int, error) {
+	var appended map[string]json.RawMessage
+	if err := json.Unmarshal(body, &appended); err != nil {
+		return nil, fmt.Errorf("seasons: %w", err)
+	}
+	if indexes == nil {
+		indexes = make([]int, len(series.Seasons))
+		for i := range indexes {
+			indexes[i] = i
+		}
+	}
+	var missing []int
+	for _, i := range indexes {
+		raw, ok := appended["season/"+strconv.Itoa(int(series.Seasons[i].SeasonNumber))]
+		if !ok {
+			missing = append(missing, i)
+			continue
+		}
+		var season SeriesSeason
+		if err := json.Unmarshal(raw, &season); err != nil {
+			return nil, fmt.Errorf("season %d: %w", series.Seasons[i].SeasonNumber, err)
+		}
+		series.Seasons[i].Episodes = season.Episodes
+	}
+	return missing, nil
+}
+
+func buildSeriesRows(s Series) seriesRows {
+	rows := seriesRows{Series: SeriesDB{
+		ID:               s.ID,
+		Name:             s.Name,
+		OriginalName:     s.OriginalName,
+		OriginalLanguage: s.OriginalLanguage,
+		PosterPath:       s.PosterPath,
+		Popularity:       s.Popularity,
+		FirstAirDate:     filterEmptyDates(s.FirstAirDate),
+		LastAirDate:      filterEmptyDates(s.LastAirDate),
+		Status:           s.Status,
+		InProduction:     s.InProduction,
+		NumberOfSeasons:  s.NumberOfSeasons,
+		NumberOfEpisodes: s.NumberOfEpisodes,
+		SyncedAt:         time.Now(),
+	}}
+	for _, season := range s.Seasons {
+		rows.Seasons = append(rows.Seasons, SeasonDB{
+			ID:           season.ID,
+			SeriesId:     s.ID,
+			SeasonNumber: season.SeasonNumber,
+			Name:         season.Name,
+			AirDate:      filterEmptyDates(season.AirDate),
+			EpisodeCount: season.EpisodeCount,
+			PosterPath:   season.PosterPath,
+		})
+		for _, episode := range season.Episodes {
+			rows.Episodes = append(rows.Episodes, EpisodeDB{
+				ID:            episode.ID,
+				SeriesId:      s.ID,
+				SeasonId:      season.ID,
+				SeasonNumber:  season.SeasonNumber,
+				EpisodeNumber: episode.EpisodeNumber,
+				Name:          episode.Name,
+				AirDate:       filterEmptyDates(episode.AirDate),
+				Runtime:       episode.Runtime,
+			})
+		}
+	}
+	for _, genre := range s.Genres {
+		rows.Genres = append(rows.Genres, SeriesGenre{SeriesId: s.ID, GenreId: genre.ID})
+	}
+	for _, iso := range s.OriginCountry {
+		rows.Country = append(rows.Country, SeriesCountry{SeriesId: s.ID, CountryIso: iso})
+	}
+	for _, creator := range s.CreatedBy {
+		rows.Creators = append(rows.Creators, SeriesCreator{SeriesId: s.ID, CreatorId: creator.ID})
+		rows.People = append(rows.People, Person{ID: creator.ID, Name: creator.Name})
+	}
+	return rows
+}
+
+func writeSeriesRows(db *gorm.DB, dataChannel chan seriesRows) int {
+	written := 0
+	writeBatches(dataChannel, seriesPerBatch, func(batch []seriesRows) error {
+		if err := writeSeriesBatch(db, batch); err != nil {
+			return err
+		}
+		checksumWritten("Series", batch)
+		written += len(batch)
+		return nil
+	})
+	return written
+}
+
+// writeSeriesBatch upserts the series and replaces their seasons, episodes
+// and join rows, so seasons TMDB removed or renumbered don't linger.
+func writeSeriesBatch(db *gorm.DB, batch []seriesRows) error {
+	var series []SeriesDB
+	var seasons []SeasonDB
+	var episodes []EpisodeDB
+	var genres []SeriesGenre
+	var countries []SeriesCountry
+	var creators []SeriesCreator
+	var people []Person
+	ids := make([]uint32, 0, len(batch))
+	changes := newChangeSet("series")
+	for _, rows := range batch {
+		key := strconv.Itoa(int(rows.Series.ID))
+		changes.add(key, rows.Series)
+		addRows(changes, key, rows.Seasons)
+		addRows(changes, key, rows.Episodes)
+		addRows(changes, key, rows.Genres)
+		addRows(changes, key, rows.Country)
+		addRows(changes, key, rows.Creators)
+		series = append(series, rows.Series)
+		seasons = append(seasons, rows.Seasons...)
+		episodes = append(episodes, rows.Episodes...)
+		genres = append(genres, rows.Genres...)
+		countries = append(countries, rows.Country...)
+		creators = append(creators, rows.Creators...)
+		people = append(people, rows.People...)
+		ids = append(ids, rows.Series.ID)
+	}
+
+	size := cfg.Preset.BatchSize
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{Columns: conflictTarget("Series"), UpdateAll: true}).Table("Series").CreateInBatches(&series, size).Error; err != nil {
+			return err
+		}
+		if len(people) > 0 {
+			if err := tx.Clauses(clause.OnConflict{Columns: conflictTarget("CinemaPerson"), DoNothing: true}).Table("CinemaPerson").CreateInBatches(&people, size).Error; err != nil {
+				return err
+			}
+		}
+		for _, table := range []string{"Episode", "Season", "SeriesGenre", "SeriesCountry", "SeriesCreator"} {
+			if err := tx.Exec(`DELETE FROM "`+table+`" WHERE "seriesId" IN ?`, ids).Error; err != nil {
+				return err
+			}
+		}
+		inserts := []struct {
+			table string
+			rows  any
+			empty bool
+		}{
+			{"Season", &seasons, len(seasons) == 0},
+			{"Episode", &episodes, len(episodes) == 0},
+			{"SeriesGenre", &genres, len(genres) == 0},
+			{"SeriesCountry", &countries, len(countries) == 0},
+			{"SeriesCreator", &creators, len(creators) == 0},
+		}
+		for _, insert := range inserts {
+			if insert.empty {
+				continue
+			}
+			if err := tx.Table(insert.table).CreateInBatches(insert.rows, size).Error; err != nil {
+				return fmt.Errorf("%s: %w", insert.table, err)
+			}
+		}
+		return changes.record(tx)
+	})
+}
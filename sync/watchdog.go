@@ -0,0 +1,88 @@
+package sync
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// throttleSteps is the throttle level at full speed. Every halving of the
+// level halves the concurrent fetches of each worker pool and the size of
+// the batches writers collect.
+const throttleSteps = 8
+
+// throttle is lowered by the watchdog when memory or goroutines approach
+// their limit and raised again once the pressure is gone.
+var throttle atomic.Int32
+
+func init() {
+	throttle.Store(throttleSteps)
+}
+
+// throttled scales n, a worker count or batch size, down to the current
+// throttle level, keeping at least one.
+func throttled(n int) int {
+	return max(1, n*int(throttle.Load())/throttleSteps)
+}
+
+// Pressure thresholds of the watchdog, as shares of the configured limits.
+const (
+	watchdogSlowDown = 0.8
+	watchdogSpeedUp  = 0.5
+)
+
+// startWatchdog samples the memory obtained from the OS and the number of
+// goroutines every WATCHDOG_INTERVAL until the returned function is called.
+// Above 80% of WATCHDOG_MEMORY_MB or WATCHDOG_GOROUTINES it halves the
+// throttle level, below 50% it doubles it back. The memory limit is also
+// made the GC's soft limit, so collections get more frequent first; the
+// returned function restores the previous limit.
+func startWatchdog() func() {
+	limitBytes := uint64(cfg.WatchdogMemoryMB) << 20
+	previousLimit := debug.SetMemoryLimit(-1)
+	if limitBytes > 0 {
+		debug.SetMemoryLimit(int64(limitBytes))
+	}
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(cfg.WatchdogInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			var mem runtime.MemStats
+			runtime.ReadMemStats(&mem)
+			used := mem.Sys - mem.HeapReleased
+			goroutines := runtime.NumGoroutine()
+			var pressure float64
+			if limitBytes > 0 {
+				pressure = float64(used) / float64(limitBytes)
+			}
+			if cfg.WatchdogGoroutines > 0 {
+				pressure = max(pressure, float64(goroutines)/float64(cfg.WatchdogGoroutines))
+			}
+
+			level := throttle.Load()
+			switch {
+			case pressure >= watchdogSlowDown && level > 1:
+				throttle.Store(level / 2)
+				logger.Warn("slowing down under resource pressure", "level", level/2, "of", throttleSteps,
+					"usedMiB", used>>20, "goroutines", goroutines)
+				debug.FreeOSMemory()
+			case pressure < watchdogSpeedUp && level < throttleSteps:
+				throttle.Store(level * 2)
+				logger.Info("speeding up again", "level", level*2, "of", throttleSteps,
+					"usedMiB", used>>20, "goroutines", goroutines)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		throttle.Store(throttleSteps)
+		debug.SetMemoryLimit(previousLimit)
+	}
+}
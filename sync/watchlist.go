@@ -0,0 +1,16 @@
+package sync
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// loadWatchlistIDs returns the distinct movie IDs users follow, read from the
+// website's watchlist table. These are synced every run regardless of
+// whether they appear in the changes feed.
+func loadWatchlistIDs(db *gorm.DB, table, column string) ([]uint32, error) {
+	var ids []uint32
+	err := db.Table(fmt.Sprintf("%q", table)).Distinct(fmt.Sprintf("%q", column)).Pluck(fmt.Sprintf("%q", column), &ids).Error
+	return ids, err
+}
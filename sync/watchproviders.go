@@ -0,0 +1,163 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// With WATCH_PROVIDERS on, every movie a sync writes is followed by a
+// request to /movie/{id}/watch/providers, doubling the API calls. Each
+// movie's offers replace the ones stored before in MovieWatchProvider,
+// which the availability bitmaps are built from; the providers themselves
+// go to WatchProvider. Only the countries of RELEASE_REGIONS are kept when
+// it is set.
+
+type WatchProvider struct {
+	ID       uint32
+	Name     string
+	LogoPath *string `gorm:"column:logoPath"`
+}
+
+type MovieWatchProvider struct {
+	MovieId         uint32 `gorm:"column:movieId"`
+	CountryIso      string `gorm:"column:countryIso"`
+	ProviderId      uint32 `gorm:"column:providerId"`
+	Type            string `gorm:"column:type"`
+	DisplayPriority int    `gorm:"column:displayPriority"`
+}
+
+type providerOffer struct {
+	ProviderID      uint32  `json:"provider_id"`
+	ProviderName    string  `json:"provider_name"`
+	LogoPath        *string `json:"logo_path"`
+	DisplayPriority int     `json:"display_priority"`
+}
+
+type watchProvidersResponse struct {
+	Results map[string]map[string]json.RawMessage `json:"results"`
+}
+
+// offerTypes are the offer lists of a country's entry.
+var offerTypes = []string{"flatrate", "free", "ads", "rent", "buy"}
+
+// movieWatchProviders are the offers of one movie.
+type movieWatchProviders struct {
+	MovieId   uint32
+	Offers    []MovieWatchProvider
+	Providers []WatchProvider
+}
+
+func fetchWatchProviders(id uint32, countries []string) (movieWatchProviders, error) {
+	out := movieWatchProviders{MovieId: id}
+	body, err := fetchTMDB(fmt.Sprintf("/movie/%d/watch/providers", id))
+	if err != nil {
+		return out, err
+	}
+	var res watchProvidersResponse
+	if err := json.Unmarshal(body, &res); err != nil {
+		return out, err
+	}
+	seen := map[string]bool{}
+	for country, entry := range res.Results {
+		if len(countries) > 0 && !slices.Contains(countries, country) {
+			continue
+		}
+		for _, typ := range offerTypes {
+			raw, ok := entry[typ]
+			if !ok {
+				continue
+			}
+			var offers []providerOffer
+			if err := json.Unmarshal(raw, &offers); err != nil {
+				return out, fmt.Errorf("%s %s offers: %w", country, typ, err)
+			}
+			for _, o := range offers {
+				key := fmt.Sprintf("%s:%d:%s", country, o.ProviderID, typ)
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				out.Offers = append(out.Offers, MovieWatchProvider{
+					MovieId: id, CountryIso: country, ProviderId: o.ProviderID, Type: typ, DisplayPriority: o.DisplayPriority,
+				})
+				out.Providers = append(out.Providers, WatchProvider{ID: o.ProviderID, Name: o.ProviderName, LogoPath: o.LogoPath})
+			}
+		}
+	}
+	return out, nil
+}
+
+// syncWatchProviders fetches and writes the offers of the given movies.
+func syncWatchProviders(db *gorm.DB, ids []uint32) {
+	if len(ids) == 0 {
+		return
+	}
+	countries := cfg.regionCountries()
+	offersCh := make(chan movieWatchProviders, 10000)
+	defer trackQueue("MovieWatchProvider", offersCh)()
+	go func() {
+		runPool(idsChannel(ids), workerCount(), func(id uint32) {
+			offers, err := fetchWatchProviders(id, countries)
+			recordFetch(err)
+			if err != nil {
+				outputf("Error fetching watch providers of movie ID %d: %v\n", id, err)
+				return
+			}
+			offersCh <- offers
+		})
+		close(offersCh)
+	}()
+	writeBatches(offersCh, cfg.Preset.BatchSize, func(batch []movieWatchProviders) error {
+		return writeWatchProvidersBatch(db, batch)
+	})
+}
+
+func writeWatchProvidersBatch(db *gorm.DB, objects []movieWatchProviders) error {
+	ids := make([]uint32, 0, len(objects))
+	var offers []MovieWatchProvider
+	var providers []WatchProvider
+	seenProvider := map[uint32]bool{}
+	for _, o := range objects {
+		ids = append(ids, o.MovieId)
+		offers = append(offers, o.Offers...)
+		for _, p := range o.Providers {
+			if !seenProvider[p.ID] {
+				seenProvider[p.ID] = true
+				providers = append(providers, p)
+			}
+		}
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if len(providers) > 0 {
+			err := tx.WithContext(context.Background()).Clauses(clause.OnConflict{
+				Columns:   conflictTarget("WatchProvider"),
+				DoUpdates: clause.AssignmentColumns([]string{"name", "logoPath"}),
+			}).Table("WatchProvider").Create(&providers).Error
+			if err != nil {
+				return err
+			}
+		}
+		if err := tx.WithContext(context.Background()).Table("MovieWatchProvider").Where(`"movieId" IN ?`, ids).Delete(&MovieWatchProvider{}).Error; err != nil {
+			return err
+		}
+		if len(offers) > 0 {
+			if err := tx.WithContext(context.Background()).Table("MovieWatchProvider").Create(&offers).Error; err != nil {
+				return err
+			}
+		}
+		changes := newChangeSet("movieWatchProviders")
+		for _, id := range ids {
+			changes.touch(strconv.Itoa(int(id)))
+		}
+		for _, r := range offers {
+			changes.add(strconv.Itoa(int(r.MovieId)), r)
+		}
+		return changes.record(tx)
+	})
+}
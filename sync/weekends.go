@@ -0,0 +1,82 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Releases are grouped into the cinema weekend of their week, which starts
+// on the country's usual release day: Friday by default, Wednesday in France
+// and Thursday in much of Europe. A release counts toward the weekend that
+// started on or before its day: a Saturday or Tuesday one in the US toward
+// the Friday before, a Monday one in France toward the Wednesday before.
+
+const defaultWeekendStarts = "FR:wed,BE:wed,DE:thu,AT:thu,CH:thu,NL:thu,IT:thu,AU:thu,NZ:thu"
+
+var weekdayOffsets = map[string]int{"mon": 0, "tue": 1, "wed": 2, "thu": 3, "fri": 4, "sat": 5, "sun": 6}
+
+// parseWeekendStarts parses WEEKEND_STARTS, e.g. "FR:wed,DE:thu", into each
+// country's start day as an offset from Monday. A "*" entry replaces the
+// Friday default.
+func parseWeekendStarts(raw string) (map[string]int, error) {
+	starts := map[string]int{"*": weekdayOffsets["fri"]}
+	for _, entry := range envSplit(raw) {
+		country, day, found := strings.Cut(entry, ":")
+		offset, ok := weekdayOffsets[strings.ToLower(day)]
+		if !found || !ok {
+			return nil, fmt.Errorf("WEEKEND_STARTS: %q is not COUNTRY:weekday", entry)
+		}
+		starts[strings.ToUpper(country)] = offset
+	}
+	return starts, nil
+}
+
+// rebuildReleaseWeekends replaces the ReleaseWeekend rows of the given movies.
+func rebuildReleaseWeekends(db *gorm.DB, movieIDs []uint32, starts map[string]int) error {
+	if len(movieIDs) == 0 {
+		return nil
+	}
+	values := []string{}
+	var startArgs []any
+	for country, offset := range starts {
+		if country == "*" {
+			continue
+		}
+		values = append(values, "(?, ?::int)")
+		startArgs = append(startArgs, country, offset)
+	}
+	startsJoin := `LEFT JOIN (SELECT NULL::text AS country, NULL::int AS start_offset) s ON false`
+	if len(values) > 0 {
+		startsJoin = `LEFT JOIN (VALUES ` + strings.Join(values, ", ") + `) AS s(country, start_offset) ON s.country = rc."iso31661"`
+	}
+
+	for start := 0; start < len(movieIDs); start += denormalizeChunkSize {
+		ids := movieIDs[start:min(start+denormalizeChunkSize, len(movieIDs))]
+		args := append(append([]any{}, startArgs...), starts["*"], ids)
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(`DELETE FROM "ReleaseWeekend" WHERE "movieId" IN ?`, ids).Error; err != nil {
+				return err
+			}
+			return tx.Exec(`
+				INSERT INTO "ReleaseWeekend" ("countryIso", "weekendStart", "movieId", "releaseDate")
+				SELECT DISTINCT ON (rc."iso31661", rc."movieId", weekend)
+					rc."iso31661", weekend, rc."movieId", lr."releaseDate"::date
+				FROM "MLocalRelease" lr
+				JOIN "MReleaseCountry" rc ON `+releaseJoin+`
+				JOIN "Movie" m ON m."id" = rc."movieId" AND m."deletedAt" IS NULL
+				`+startsJoin+`
+				CROSS JOIN LATERAL (
+					SELECT lr."releaseDate"::date
+						- (extract(isodow FROM lr."releaseDate")::int - 1 - COALESCE(s.start_offset, ?::int) + 7) % 7 AS weekend
+				) w
+				WHERE rc."movieId" IN ?
+				ORDER BY rc."iso31661", rc."movieId", weekend, lr."releaseDate"`, args...).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
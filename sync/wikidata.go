@@ -0,0 +1,329 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	wikidataEndpoint  = "https://query.wikidata.org/sparql"
+	wikidataBatchSize = 50
+)
+
+// Wikidata asks for at most a handful of concurrent queries per client, so
+// it gets its own limiter instead of sharing the TMDB one.
+var wikidataLimiter = rate.NewLimiter(rate.Every(time.Second), 1)
+
+type MovieWikidata struct {
+	MovieId       uint32    `gorm:"column:movieId;primaryKey"`
+	WikidataId    *string   `gorm:"column:wikidataId"`
+	SeriesId      *string   `gorm:"column:seriesId"`
+	SeriesLabel   *string   `gorm:"column:seriesLabel"`
+	SeriesOrdinal *string   `gorm:"column:seriesOrdinal"`
+	Runtime       *uint16   `gorm:"column:runtime"`
+	ReleaseDate   *string   `gorm:"column:releaseDate;type:date"`
+	FetchedAt     time.Time `gorm:"column:fetchedAt"`
+}
+
+type MovieAward struct {
+	MovieId    uint32 `gorm:"column:movieId"`
+	AwardId    string `gorm:"column:awardId"`
+	AwardLabel string `gorm:"column:awardLabel"`
+}
+
+type MovieBasedOn struct {
+	MovieId   uint32 `gorm:"column:movieId"`
+	WorkId    string `gorm:"column:workId"`
+	WorkLabel string `gorm:"column:workLabel"`
+}
+
+type wikidataTarget struct {
+	ID         uint32
+	ImdbId     *string `gorm:"column:imdbId"`
+	WikidataId *string `gorm:"column:wikidataId"`
+}
+
+type sparqlValue struct {
+	Value string `json:"value"`
+}
+
+type sparqlResponse struct {
+	Results struct {
+		Bindings []map[string]sparqlValue `json:"bindings"`
+	} `json:"results"`
+}
+
+// wikidataItemPattern matches the item IDs interpolated into queries.
+var wikidataItemPattern = regexp.MustCompile(`^Q[1-9][0-9]*$`)
+
+// wikidataBatch maps the Wikidata items of a batch to its movies. Movies
+// with a wikidataId from TMDB's external IDs are looked up by item, the
+// others by IMDb ID through wdt:P345.
+type wikidataBatch struct {
+	byItem map[string]uint32
+	byImdb map[string]uint32
+	items  []string
+	imdbs  []string
+}
+
+func newWikidataBatch(targets []wikidataTarget) wikidataBatch {
+	b := wikidataBatch{byItem: map[string]uint32{}, byImdb: map[string]uint32{}}
+	for _, t := range targets {
+		switch {
+		case t.WikidataId != nil && wikidataItemPattern.MatchString(*t.WikidataId):
+			b.byItem[*t.WikidataId] = t.ID
+			b.items = append(b.items, "wd:"+*t.WikidataId)
+		case t.ImdbId != nil:
+			b.byImdb[*t.ImdbId] = t.ID
+			b.imdbs = append(b.imdbs, fmt.Sprintf("%q", *t.ImdbId))
+		}
+	}
+	return b
+}
+
+// pattern binds ?item to the items of the batch, and ?imdb to the IMDb ID
+// an item was found by.
+func (b wikidataBatch) pattern() string {
+	var parts []string
+	if len(b.items) > 0 {
+		parts = append(parts, `{ VALUES ?item { `+strings.Join(b.items, " ")+` } }`)
+	}
+	if len(b.imdbs) > 0 {
+		parts = append(parts, `{ VALUES ?imdb { `+strings.Join(b.imdbs, " ")+` } ?item wdt:P345 ?imdb . }`)
+	}
+	return strings.Join(parts, " UNION ")
+}
+
+// movie returns the movie a result row is about.
+func (b wikidataBatch) movie(binding map[string]sparqlValue) (uint32, bool) {
+	if v, ok := binding["imdb"]; ok {
+		id, ok := b.byImdb[v.Value]
+		return id, ok
+	}
+	id, ok := b.byItem[entityId(binding["item"].Value)]
+	return id, ok
+}
+
+// runWikidata enriches movies with awards, based-on works, series ordering,
+// duration and earliest publication date from Wikidata, found by the
+// wikidataId TMDB links them to or else by IMDb ID. Movies enriched within
+// --max-age are skipped, which also caches negative lookups for titles
+// Wikidata doesn't know.
+func runWikidata(db *gorm.DB, args []string) error {
+	fs := flag.NewFlagSet("wikidata", flag.ContinueOnError)
+	limit := fs.Int("limit", 5000, "maximum number of movies to enrich")
+	maxAge := fs.Duration("max-age", 30*24*time.Hour, "re-query movies enriched longer ago than this")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var targets []wikidataTarget
+	err := db.Table(`"Movie" m`).
+		Select(`m."id", m."imdbId", e."wikidataId"`).
+		Joins(`LEFT JOIN "MovieExternalIds" e ON e."movieId" = m."id"`).
+		Joins(`LEFT JOIN "MovieWikidata" w ON w."movieId" = m."id"`).
+		Where(`(e."wikidataId" IS NOT NULL OR m."imdbId" IS NOT NULL) AND (w."fetchedAt" IS NULL OR w."fetchedAt" < ?)`, time.Now().Add(-*maxAge)).
+		Order(`m."popularity" DESC`).
+		Limit(*limit).
+		Scan(&targets).Error
+	if err != nil {
+		return err
+	}
+
+	for start := 0; start < len(targets); start += wikidataBatchSize {
+		batch := targets[start:min(start+wikidataBatchSize, len(targets))]
+		if err := enrichWikidataBatch(db, batch); err != nil {
+			outputf("Error enriching Wikidata batch at %d: %v\n", start, err)
+		}
+	}
+	outputf("Queried Wikidata for %d movies\n", len(targets))
+	printWriteSummary()
+	if err := rebuildWorkRelations(db); err != nil {
+		return fmt.Errorf("rebuilding remake relations: %w", err)
+	}
+	return nil
+}
+
+func enrichWikidataBatch(db *gorm.DB, targets []wikidataTarget) error {
+	batch := newWikidataBatch(targets)
+	if len(batch.items)+len(batch.imdbs) == 0 {
+		return nil
+	}
+
+	query := `SELECT ?imdb ?item ?award ?awardLabel ?basedOn ?basedOnLabel ?series ?seriesLabel ?ordinal WHERE {
+		` + batch.pattern() + `
+		OPTIONAL { ?item wdt:P166 ?award . }
+		OPTIONAL { ?item wdt:P144 ?basedOn . }
+		OPTIONAL { ?item p:P179 ?st . ?st ps:P179 ?series . OPTIONAL { ?st pq:P1545 ?ordinal . } }
+		SERVICE wikibase:label { bd:serviceParam wikibase:language "en". }
+	}`
+	body, err := fetchSparql(query)
+	if err != nil {
+		return err
+	}
+	var parsed sparqlResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	rows := make(map[uint32]*MovieWikidata, len(targets))
+	for _, t := range targets {
+		rows[t.ID] = &MovieWikidata{MovieId: t.ID, FetchedAt: now}
+	}
+	awards := map[string]MovieAward{}
+	basedOn := map[string]MovieBasedOn{}
+	for _, b := range parsed.Results.Bindings {
+		movieId, ok := batch.movie(b)
+		if !ok {
+			continue
+		}
+		row := rows[movieId]
+		row.WikidataId = optionalEntity(b["item"].Value)
+		if v, ok := b["series"]; ok && row.SeriesId == nil {
+			row.SeriesId = optionalEntity(v.Value)
+			row.SeriesLabel = filterEmptyDates(b["seriesLabel"].Value)
+			row.SeriesOrdinal = filterEmptyDates(b["ordinal"].Value)
+		}
+		if v, ok := b["award"]; ok {
+			id := entityId(v.Value)
+			awards[pairKey(movieId, id)] = MovieAward{MovieId: movieId, AwardId: id, AwardLabel: b["awardLabel"].Value}
+		}
+		if v, ok := b["basedOn"]; ok {
+			id := entityId(v.Value)
+			basedOn[pairKey(movieId, id)] = MovieBasedOn{MovieId: movieId, WorkId: id, WorkLabel: b["basedOnLabel"].Value}
+		}
+	}
+
+	if err := addWikidataFacts(rows, batch); err != nil {
+		return err
+	}
+
+	ids := make([]uint32, 0, len(rows))
+	wikidataRows := make([]MovieWikidata, 0, len(rows))
+	for id, row := range rows {
+		ids = append(ids, id)
+		wikidataRows = append(wikidataRows, *row)
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{Columns: conflictTarget("MovieWikidata"), UpdateAll: true}).Table("MovieWikidata").Create(&wikidataRows).Error; err != nil {
+			return err
+		}
+		inSavepoint(tx, "MovieAward", func(tx *gorm.DB) error {
+			if err := tx.Table("MovieAward").Where(`"movieId" IN ?`, ids).Delete(&MovieAward{}).Error; err != nil {
+				return err
+			}
+			if len(awards) == 0 {
+				return nil
+			}
+			rows := make([]MovieAward, 0, len(awards))
+			for _, a := range awards {
+				rows = append(rows, a)
+			}
+			return tx.Table("MovieAward").Create(&rows).Error
+		})
+		inSavepoint(tx, "MovieBasedOn", func(tx *gorm.DB) error {
+			if err := tx.Table("MovieBasedOn").Where(`"movieId" IN ?`, ids).Delete(&MovieBasedOn{}).Error; err != nil {
+				return err
+			}
+			if len(basedOn) == 0 {
+				return nil
+			}
+			rows := make([]MovieBasedOn, 0, len(basedOn))
+			for _, w := range basedOn {
+				rows = append(rows, w)
+			}
+			return tx.Table("MovieBasedOn").Create(&rows).Error
+		})
+		return nil
+	})
+}
+
+// addWikidataFacts fills in the duration and earliest publication date of
+// the rows, which SOURCE_PRECEDENCE may prefer to TMDB's. They are asked
+// for grouped, apart from the other statements, as a film has a
+// publication date per country. Durations are read normalized to seconds,
+// as films state them in minutes, hours or seconds alike.
+func addWikidataFacts(rows map[uint32]*MovieWikidata, batch wikidataBatch) error {
+	query := `SELECT ?item ?imdb (SAMPLE(?seconds) AS ?runtime) (MIN(?published) AS ?releaseDate) WHERE {
+		` + batch.pattern() + `
+		OPTIONAL { ?item p:P2047/psn:P2047/wikibase:quantityAmount ?seconds . }
+		OPTIONAL { ?item wdt:P577 ?published . }
+	} GROUP BY ?item ?imdb`
+	body, err := fetchSparql(query)
+	if err != nil {
+		return err
+	}
+	var parsed sparqlResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return err
+	}
+	for _, b := range parsed.Results.Bindings {
+		movieId, ok := batch.movie(b)
+		if !ok {
+			continue
+		}
+		row := rows[movieId]
+		if v, ok := b["runtime"]; ok {
+			if seconds, err := strconv.ParseFloat(v.Value, 64); err == nil && seconds >= 60 && seconds/60 < 1<<16 {
+				runtime := uint16(math.Round(seconds / 60))
+				row.Runtime = &runtime
+			}
+		}
+		if v, ok := b["releaseDate"]; ok && len(v.Value) >= 10 && v.Value[0] != '-' {
+			date := v.Value[:10]
+			row.ReleaseDate = &date
+		}
+	}
+	return nil
+}
+
+func fetchSparql(query string) ([]byte, error) {
+	if err := wikidataLimiter.Wait(context.Background()); err != nil {
+		outputf("Wikidata rate limit exceeded: %v\n", err)
+	}
+	req, err := http.NewRequest("POST", wikidataEndpoint, strings.NewReader(url.Values{"query": {query}}.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/sparql-results+json")
+	req.Header.Set("User-Agent", "wiitco-db-movies-cron (https://github.com/pogorskii/wiitco-db-movies-cron)")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status code: %d", res.StatusCode)
+	}
+	return io.ReadAll(res.Body)
+}
+
+// entityId turns an entity URI such as http://www.wikidata.org/entity/Q42
+// into its bare ID.
+func entityId(uri string) string {
+	return uri[strings.LastIndex(uri, "/")+1:]
+}
+
+func optionalEntity(uri string) *string {
+	if uri == "" {
+		return nil
+	}
+	id := entityId(uri)
+	return &id
+}
@@ -0,0 +1,113 @@
+package sync
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const writeStatsStartKey = "wiitco:write_start"
+
+type tableWriteStats struct {
+	Batches   int
+	Rows      int
+	Failures  int
+	Latencies []time.Duration
+}
+
+var writeStats = struct {
+	sync.Mutex
+	tables map[string]*tableWriteStats
+}{tables: map[string]*tableWriteStats{}}
+
+// registerWriteStats hooks GORM's create callbacks to time every batch
+// insert per table, logging batches slower than slow.
+func registerWriteStats(db *gorm.DB, slow time.Duration) error {
+	err := db.Callback().Create().Before("gorm:create").Register("wiitco:write_stats_start", func(tx *gorm.DB) {
+		tx.InstanceSet(writeStatsStartKey, time.Now())
+	})
+	if err != nil {
+		return err
+	}
+	return db.Callback().Create().After("gorm:create").Register("wiitco:write_stats_end", func(tx *gorm.DB) {
+		v, ok := tx.InstanceGet(writeStatsStartKey)
+		if !ok {
+			return
+		}
+		elapsed := time.Since(v.(time.Time))
+		table := tx.Statement.Table
+		rows := 1
+		if rv := reflect.Indirect(tx.Statement.ReflectValue); rv.Kind() == reflect.Slice {
+			rows = rv.Len()
+		}
+		if slow > 0 && elapsed >= slow {
+			outputf("Slow batch: table=%s rows=%d took=%s\n", table, rows, elapsed.Round(time.Millisecond))
+		}
+
+		writeStats.Lock()
+		defer writeStats.Unlock()
+		stats, ok := writeStats.tables[table]
+		if !ok {
+			stats = &tableWriteStats{}
+			writeStats.tables[table] = stats
+		}
+		stats.Batches++
+		stats.Rows += rows
+		stats.Latencies = append(stats.Latencies, elapsed)
+		if tx.Error != nil {
+			stats.Failures++
+		}
+	})
+}
+
+// writeTotals returns the number of batch inserts so far and how many
+// failed.
+func writeTotals() (batches, failures int) {
+	writeStats.Lock()
+	defer writeStats.Unlock()
+	for _, stats := range writeStats.tables {
+		batches += stats.Batches
+		failures += stats.Failures
+	}
+	return batches, failures
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(float64(len(sorted)-1) * p)
+	return sorted[idx]
+}
+
+// printWriteSummary logs per-table batch counts, rows and latency
+// percentiles, to guide batch-size tuning.
+func printWriteSummary() {
+	writeStats.Lock()
+	defer writeStats.Unlock()
+	tables := make([]string, 0, len(writeStats.tables))
+	for table := range writeStats.tables {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	outputln("Write summary:")
+	for _, table := range tables {
+		stats := writeStats.tables[table]
+		sorted := append([]time.Duration(nil), stats.Latencies...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		outputf("  %-20s batches=%d rows=%d failed=%d p50=%s p95=%s max=%s\n",
+			table, stats.Batches, stats.Rows, stats.Failures,
+			percentile(sorted, 0.5).Round(time.Millisecond),
+			percentile(sorted, 0.95).Round(time.Millisecond),
+			percentile(sorted, 1).Round(time.Millisecond))
+	}
+
+	steps, counts := savepointSummary()
+	for _, step := range steps {
+		outputf("  %-20s rolled back %d times\n", step, counts[step])
+	}
+}